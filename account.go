@@ -0,0 +1,238 @@
+package ningen
+
+import (
+	"sync"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+	"github.com/diamondburned/ningen/v3/readyextra"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	gateway.OpUnmarshalers.Add(
+		func() ws.Event { return new(UserRequiredActionUpdateEvent) },
+	)
+}
+
+// RequiredAction is something that the user must do before they can use their
+// account normally. Until then, Discord rejects most requests, such as sending
+// messages, so clients should show a banner asking the user to do it.
+type RequiredAction string
+
+const (
+	// NoRequiredAction is when the user doesn't need to do anything.
+	NoRequiredAction RequiredAction = ""
+	// AgreementsRequired is when the user must accept the updated terms of
+	// service.
+	AgreementsRequired RequiredAction = "AGREEMENTS"
+
+	RequireCaptcha                          RequiredAction = "REQUIRE_CAPTCHA"
+	RequireVerifiedEmail                    RequiredAction = "REQUIRE_VERIFIED_EMAIL"
+	RequireReverifiedEmail                  RequiredAction = "REQUIRE_REVERIFIED_EMAIL"
+	RequireVerifiedPhone                    RequiredAction = "REQUIRE_VERIFIED_PHONE"
+	RequireReverifiedPhone                  RequiredAction = "REQUIRE_REVERIFIED_PHONE"
+	RequireVerifiedEmailOrVerifiedPhone     RequiredAction = "REQUIRE_VERIFIED_EMAIL_OR_VERIFIED_PHONE"
+	RequireReverifiedEmailOrVerifiedPhone   RequiredAction = "REQUIRE_REVERIFIED_EMAIL_OR_VERIFIED_PHONE"
+	RequireVerifiedEmailOrReverifiedPhone   RequiredAction = "REQUIRE_VERIFIED_EMAIL_OR_REVERIFIED_PHONE"
+	RequireReverifiedEmailOrReverifiedPhone RequiredAction = "REQUIRE_REVERIFIED_EMAIL_OR_REVERIFIED_PHONE"
+)
+
+// Email returns true if verifying the user's email satisfies the action.
+func (a RequiredAction) Email() bool {
+	switch a {
+	case RequireVerifiedEmail, RequireReverifiedEmail,
+		RequireVerifiedEmailOrVerifiedPhone, RequireReverifiedEmailOrVerifiedPhone,
+		RequireVerifiedEmailOrReverifiedPhone, RequireReverifiedEmailOrReverifiedPhone:
+		return true
+	default:
+		return false
+	}
+}
+
+// Phone returns true if verifying the user's phone number satisfies the
+// action.
+func (a RequiredAction) Phone() bool {
+	switch a {
+	case RequireVerifiedPhone, RequireReverifiedPhone,
+		RequireVerifiedEmailOrVerifiedPhone, RequireReverifiedEmailOrVerifiedPhone,
+		RequireVerifiedEmailOrReverifiedPhone, RequireReverifiedEmailOrReverifiedPhone:
+		return true
+	default:
+		return false
+	}
+}
+
+// String returns the action in words, such as for a banner.
+func (a RequiredAction) String() string {
+	switch {
+	case a == NoRequiredAction:
+		return "none"
+	case a == AgreementsRequired:
+		return "accept the terms of service"
+	case a == RequireCaptcha:
+		return "complete a captcha"
+	case a.Email() && a.Phone():
+		return "verify your email or phone number"
+	case a.Email():
+		return "verify your email"
+	case a.Phone():
+		return "verify your phone number"
+	default:
+		return string(a)
+	}
+}
+
+// UserRequiredActionUpdateEvent is a dispatch event for
+// USER_REQUIRED_ACTION_UPDATE. It is sent when the user's required action
+// changes, including when it is done. It is undocumented.
+type UserRequiredActionUpdateEvent struct {
+	RequiredAction RequiredAction `json:"required_action"`
+}
+
+// Op implements ws.Event.
+func (*UserRequiredActionUpdateEvent) Op() ws.OpCode { return 0 }
+
+// EventType implements ws.Event.
+func (*UserRequiredActionUpdateEvent) EventType() ws.EventType {
+	return "USER_REQUIRED_ACTION_UPDATE"
+}
+
+// StandingState is how close the user's account is to being suspended for
+// breaking Discord's rules.
+type StandingState int
+
+const (
+	StandingAllGood     StandingState = 100
+	StandingLimited     StandingState = 200
+	StandingVeryLimited StandingState = 300
+	StandingAtRisk      StandingState = 400
+	StandingSuspended   StandingState = 500
+)
+
+// String returns the state in words.
+func (s StandingState) String() string {
+	switch s {
+	case StandingAllGood:
+		return "all good"
+	case StandingLimited:
+		return "limited"
+	case StandingVeryLimited:
+		return "very limited"
+	case StandingAtRisk:
+		return "at risk"
+	case StandingSuspended:
+		return "suspended"
+	default:
+		return "unknown"
+	}
+}
+
+// Violation is a rule that the user was found to have broken.
+type Violation struct {
+	ID            discord.Snowflake `json:"id"`
+	Type          string            `json:"classification_type"`
+	Description   string            `json:"description"`
+	ExplainerLink string            `json:"explainer_link"`
+	// ExpiresAt is when the violation stops counting against the user.
+	ExpiresAt discord.Timestamp `json:"max_expiration_time"`
+}
+
+// AccountStanding is the standing of the user's account, as shown in the
+// safety hub of the official client. It is undocumented.
+type AccountStanding struct {
+	State      StandingState
+	Violations []Violation
+	// GuildViolations are the violations of the guilds that the user owns.
+	GuildViolations []Violation
+}
+
+// AccountStandingUpdateEvent is dispatched when FetchAccountStanding finds
+// that the state of the user's account standing has changed since it was
+// last fetched.
+type AccountStandingUpdateEvent struct {
+	Standing AccountStanding
+	// Previous is the state that was last fetched. It is 0 if the standing
+	// was never fetched.
+	Previous StandingState
+}
+
+var _ gateway.Event = (*AccountStandingUpdateEvent)(nil)
+
+func (ev AccountStandingUpdateEvent) Op() ws.OpCode { return -1 }
+func (ev AccountStandingUpdateEvent) EventType() ws.EventType {
+	return "__ningen.AccountStandingUpdateEvent"
+}
+
+type accountState struct {
+	extras   *readyextra.Cache
+	mutex    sync.Mutex
+	action   RequiredAction
+	standing StandingState
+}
+
+func (a *accountState) handle(ev gateway.Event) {
+	switch ev := ev.(type) {
+	case *gateway.ReadyEvent:
+		// arikawa doesn't decode the required action.
+		action := RequiredAction(a.extras.Of(ev).RequiredAction)
+
+		a.mutex.Lock()
+		a.action = action
+		a.mutex.Unlock()
+
+	case *UserRequiredActionUpdateEvent:
+		a.mutex.Lock()
+		a.action = ev.RequiredAction
+		a.mutex.Unlock()
+	}
+}
+
+// RequiredAction returns what the user must do before they can use their
+// account normally, from the Ready event and UserRequiredActionUpdateEvents.
+// It is NoRequiredAction if there is nothing to do.
+func (s *State) RequiredAction() RequiredAction {
+	s.account.mutex.Lock()
+	defer s.account.mutex.Unlock()
+
+	return s.account.action
+}
+
+// FetchAccountStanding fetches the standing of the user's account. An
+// AccountStandingUpdateEvent is dispatched if its state differs from the one
+// that was last fetched.
+func (s *State) FetchAccountStanding() (*AccountStanding, error) {
+	var body struct {
+		Classifications      []Violation `json:"classifications"`
+		GuildClassifications []Violation `json:"guild_classifications"`
+		AccountStanding      struct {
+			State StandingState `json:"state"`
+		} `json:"account_standing"`
+	}
+
+	if err := s.RequestJSON(&body, "GET", api.Endpoint+"safety-hub/@me"); err != nil {
+		return nil, errors.Wrap(err, "failed to fetch account standing")
+	}
+
+	standing := &AccountStanding{
+		State:           body.AccountStanding.State,
+		Violations:      body.Classifications,
+		GuildViolations: body.GuildClassifications,
+	}
+
+	s.account.mutex.Lock()
+	previous := s.account.standing
+	s.account.standing = standing.State
+	s.account.mutex.Unlock()
+
+	if previous != standing.State {
+		s.Handler.Call(&AccountStandingUpdateEvent{
+			Standing: *standing,
+			Previous: previous,
+		})
+	}
+
+	return standing, nil
+}
@@ -0,0 +1,66 @@
+package ningen_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/ningen/v3"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestRequiredAction(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	if a := n.RequiredAction(); a != ningen.NoRequiredAction {
+		t.Errorf("got required action %q from a Ready without one", a)
+	}
+
+	var ready gateway.ReadyEvent
+	body := `{
+		"v": 9,
+		"user": {"id": "100000000000000001", "username": "ningen"},
+		"guilds": [],
+		"session_id": "ningentest",
+		"required_action": "REQUIRE_VERIFIED_EMAIL"
+	}`
+	if err := json.Unmarshal([]byte(body), &ready); err != nil {
+		t.Fatal("cannot decode Ready:", err)
+	}
+	ningentest.Dispatch(n, &ready)
+
+	a := n.RequiredAction()
+	if a != ningen.RequireVerifiedEmail || !a.Email() || a.Phone() {
+		t.Errorf("got required action %q after Ready", a)
+	}
+
+	fn := gateway.OpUnmarshalers.Lookup(0, "USER_REQUIRED_ACTION_UPDATE")
+	if fn == nil {
+		t.Fatal("USER_REQUIRED_ACTION_UPDATE isn't registered")
+	}
+
+	update := fn().(*ningen.UserRequiredActionUpdateEvent)
+	if err := json.Unmarshal([]byte(`{"required_action": null}`), update); err != nil {
+		t.Fatal("cannot decode update:", err)
+	}
+	ningentest.Dispatch(n, update)
+
+	if a := n.RequiredAction(); a != ningen.NoRequiredAction {
+		t.Errorf("got required action %q after it was done", a)
+	}
+}
+
+func TestRequiredActionString(t *testing.T) {
+	tests := map[ningen.RequiredAction]string{
+		ningen.RequireVerifiedPhone:                "verify your phone number",
+		ningen.RequireVerifiedEmailOrVerifiedPhone: "verify your email or phone number",
+		ningen.AgreementsRequired:                  "accept the terms of service",
+		"SOMETHING_NEW":                            "SOMETHING_NEW",
+	}
+
+	for action, want := range tests {
+		if got := action.String(); got != want {
+			t.Errorf("%q: got %q, want %q", string(action), got, want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package ningen_test
+
+import (
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/ningen/v3"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func BenchmarkChannels(b *testing.B) {
+	n := ningentest.NewState(b, ningentest.Guilds)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		n.Channels(200000000000000001, textChannels)
+	}
+}
+
+func BenchmarkGuildIsUnread(b *testing.B) {
+	n := ningentest.NewState(b, ningentest.Guilds)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		n.GuildIsUnread(200000000000000001, ningen.GuildUnreadOpts{})
+	}
+}
+
+func BenchmarkMessageMentions(b *testing.B) {
+	n := ningentest.NewState(b, ningentest.Guilds)
+	msg := &discord.Message{
+		ID:        900000000000000040,
+		ChannelID: 300000000000000002,
+		GuildID:   200000000000000001,
+		Author:    discord.User{ID: 100000000000000002},
+		Mentions: []discord.GuildUser{
+			{User: discord.User{ID: 100000000000000001}},
+		},
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		n.MessageMentions(msg)
+	}
+}
+
+// TestAllocBudgets keeps the hot paths within the allocation budgets that are
+// documented on them. The budgets must hold for a guild with 20 times the
+// channels of the fixture, since they don't depend on the number of channels.
+func TestAllocBudgets(t *testing.T) {
+	const guildID = 200000000000000001
+
+	states := []struct {
+		name string
+		n    *ningen.State
+	}{
+		{"fixture", ningentest.NewState(t, ningentest.Guilds)},
+		{"large", newLargeGuildState(t, guildID, 100)},
+	}
+
+	for _, state := range states {
+		n := state.n
+
+		budgets := []struct {
+			name   string
+			budget float64
+			fn     func()
+		}{
+			{"Channels", 8, func() { n.Channels(guildID, textChannels) }},
+			{"GuildIsUnread", 12, func() { n.GuildIsUnread(guildID, ningen.GuildUnreadOpts{}) }},
+		}
+
+		for _, b := range budgets {
+			if allocs := testing.AllocsPerRun(100, b.fn); allocs > b.budget {
+				t.Errorf("%s: %s: %v allocs/op, budget is %v", state.name, b.name, allocs, b.budget)
+			}
+		}
+	}
+}
+
+// newLargeGuildState returns the Guilds fixture with the given number of text
+// channels added to the guild. All channels of the guild are read, so that
+// GuildIsUnread checks every one of them instead of stopping at a mention.
+func newLargeGuildState(t *testing.T, guildID discord.GuildID, channels int) *ningen.State {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	for i := 0; i < channels; i++ {
+		ningentest.Dispatch(n, &gateway.ChannelCreateEvent{Channel: discord.Channel{
+			ID:            discord.ChannelID(310000000000000000 + i),
+			GuildID:       guildID,
+			Type:          discord.GuildText,
+			Position:      10 + i,
+			LastMessageID: discord.MessageID(910000000000000000 + i),
+		}})
+	}
+
+	chs, err := n.Cabinet.Channels(guildID)
+	if err != nil {
+		t.Fatal("cannot get channels:", err)
+	}
+
+	for _, ch := range chs {
+		if ch.LastMessageID.IsValid() {
+			ningentest.Dispatch(n, &gateway.MessageAckEvent{
+				ChannelID: ch.ID,
+				MessageID: ch.LastMessageID,
+			})
+		}
+	}
+
+	if ind := n.GuildIsUnread(guildID, ningen.GuildUnreadOpts{}); ind != ningen.ChannelRead {
+		t.Fatalf("large guild is %d, want read", ind)
+	}
+
+	return n
+}
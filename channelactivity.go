@@ -0,0 +1,211 @@
+package ningen
+
+import (
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+)
+
+// ChannelActivity describes the kinds of activity in a channel.
+type ChannelActivity uint8
+
+const (
+	// MessageActivity is when a message is posted in the channel.
+	MessageActivity ChannelActivity = 1 << iota
+	// ThreadActivity is when a thread is created in the channel, such as a
+	// post in a forum.
+	ThreadActivity
+	// VoiceActivity is when someone joins the voice channel.
+	VoiceActivity
+)
+
+// Has returns true if other is in a.
+func (a ChannelActivity) Has(other ChannelActivity) bool {
+	return a&other == other
+}
+
+// ChannelActivityEvent is dispatched when there is activity in a channel, for
+// indicators such as "active now" or unread forum posts that don't need every
+// message. The first activity in a channel is dispatched right away. Activity
+// within ChannelActivityThrottle after that is collected into one event that
+// is dispatched at the end of the period, so each channel gets at most one
+// event per period.
+type ChannelActivityEvent struct {
+	ChannelID discord.ChannelID
+	GuildID   discord.GuildID
+	// Activity is every kind of activity that happened.
+	Activity ChannelActivity
+	// Count is the number of activities that happened.
+	Count int
+}
+
+var _ gateway.Event = (*ChannelActivityEvent)(nil)
+
+func (ev ChannelActivityEvent) Op() ws.OpCode           { return -1 }
+func (ev ChannelActivityEvent) EventType() ws.EventType { return "__ningen.ChannelActivityEvent" }
+
+// ChannelActivityThrottle is the minimum duration between two
+// ChannelActivityEvents of the same channel.
+var ChannelActivityThrottle = 5 * time.Second
+
+// newThreadAge is the age up to which a created thread counts as new. Threads
+// that the user is added to long after their creation are also sent as
+// created.
+const newThreadAge = time.Minute
+
+type activityWindow struct {
+	guildID  discord.GuildID
+	activity ChannelActivity
+	count    int
+	timer    *time.Timer
+}
+
+type voiceUser struct {
+	guildID discord.GuildID
+	userID  discord.UserID
+}
+
+type channelActivityThrottler struct {
+	mutex   sync.Mutex
+	windows map[discord.ChannelID]*activityWindow
+	// voice maps each user in a voice channel to the channel, so that joins
+	// can be told apart from other voice state updates.
+	voice    map[voiceUser]discord.ChannelID
+	dispatch func(*ChannelActivityEvent)
+}
+
+func newChannelActivityThrottler(dispatch func(*ChannelActivityEvent)) *channelActivityThrottler {
+	return &channelActivityThrottler{
+		windows:  make(map[discord.ChannelID]*activityWindow),
+		voice:    make(map[voiceUser]discord.ChannelID),
+		dispatch: dispatch,
+	}
+}
+
+// pendingTimers returns the number of channels within their throttle period.
+func (t *channelActivityThrottler) pendingTimers() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return len(t.windows)
+}
+
+func (t *channelActivityThrottler) handle(ev gateway.Event) {
+	switch ev := ev.(type) {
+	case *gateway.ReadyEvent:
+		t.mutex.Lock()
+		for _, w := range t.windows {
+			w.timer.Stop()
+		}
+		t.windows = make(map[discord.ChannelID]*activityWindow)
+		t.voice = make(map[voiceUser]discord.ChannelID)
+		for _, guild := range ev.Guilds {
+			t.setVoice(guild.ID, guild.VoiceStates)
+		}
+		t.mutex.Unlock()
+
+	case *gateway.GuildCreateEvent:
+		t.mutex.Lock()
+		t.setVoice(ev.ID, ev.VoiceStates)
+		t.mutex.Unlock()
+
+	case *gateway.MessageCreateEvent:
+		t.add(ev.ChannelID, ev.GuildID, MessageActivity)
+
+	case *gateway.ThreadCreateEvent:
+		if ev.ParentID.IsValid() && time.Since(ev.ID.Time()) < newThreadAge {
+			t.add(ev.ParentID, ev.GuildID, ThreadActivity)
+		}
+
+	case *gateway.VoiceStateUpdateEvent:
+		key := voiceUser{ev.GuildID, ev.UserID}
+
+		t.mutex.Lock()
+		old := t.voice[key]
+		if ev.ChannelID.IsValid() {
+			t.voice[key] = ev.ChannelID
+		} else {
+			delete(t.voice, key)
+		}
+		t.mutex.Unlock()
+
+		if ev.ChannelID.IsValid() && ev.ChannelID != old {
+			t.add(ev.ChannelID, ev.GuildID, VoiceActivity)
+		}
+	}
+}
+
+// setVoice replaces the voice channels of the guild's users. t.mutex must be
+// held.
+func (t *channelActivityThrottler) setVoice(guildID discord.GuildID, states []discord.VoiceState) {
+	for key := range t.voice {
+		if key.guildID == guildID {
+			delete(t.voice, key)
+		}
+	}
+	for _, vs := range states {
+		if vs.ChannelID.IsValid() {
+			t.voice[voiceUser{guildID, vs.UserID}] = vs.ChannelID
+		}
+	}
+}
+
+// add adds the activity to the channel. It is dispatched right away unless the
+// channel is within its throttle period.
+func (t *channelActivityThrottler) add(chID discord.ChannelID, guildID discord.GuildID, activity ChannelActivity) {
+	t.mutex.Lock()
+
+	if w, ok := t.windows[chID]; ok {
+		w.activity |= activity
+		w.count++
+		t.mutex.Unlock()
+		return
+	}
+
+	w := &activityWindow{guildID: guildID}
+	w.timer = time.AfterFunc(ChannelActivityThrottle, func() { t.flush(chID, w) })
+	t.windows[chID] = w
+	t.mutex.Unlock()
+
+	t.dispatch(&ChannelActivityEvent{
+		ChannelID: chID,
+		GuildID:   guildID,
+		Activity:  activity,
+		Count:     1,
+	})
+}
+
+// flush dispatches the activity collected during the throttle period, if any,
+// and starts another period. The channel's window is dropped once a period has
+// passed without activity.
+func (t *channelActivityThrottler) flush(chID discord.ChannelID, w *activityWindow) {
+	t.mutex.Lock()
+	// The window may have been dropped by a Ready event.
+	if current, ok := t.windows[chID]; !ok || current != w {
+		t.mutex.Unlock()
+		return
+	}
+
+	if w.count == 0 {
+		delete(t.windows, chID)
+		t.mutex.Unlock()
+		return
+	}
+
+	ev := &ChannelActivityEvent{
+		ChannelID: chID,
+		GuildID:   w.guildID,
+		Activity:  w.activity,
+		Count:     w.count,
+	}
+
+	w.activity = 0
+	w.count = 0
+	w.timer.Reset(ChannelActivityThrottle)
+	t.mutex.Unlock()
+
+	t.dispatch(ev)
+}
@@ -0,0 +1,104 @@
+package ningen_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/ningen/v3"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestChannelActivityEvent(t *testing.T) {
+	const guildID = 200000000000000001
+	const textID = 300000000000000002
+	const voiceID = 300000000000000004
+
+	old := ningen.ChannelActivityThrottle
+	ningen.ChannelActivityThrottle = 50 * time.Millisecond
+	t.Cleanup(func() { ningen.ChannelActivityThrottle = old })
+
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	events := make(chan *ningen.ChannelActivityEvent, 8)
+	n.AddSyncHandler(func(ev *ningen.ChannelActivityEvent) { events <- ev })
+
+	next := func() *ningen.ChannelActivityEvent {
+		t.Helper()
+
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for ChannelActivityEvent")
+			return nil
+		}
+	}
+
+	message := func(id discord.MessageID) {
+		ningentest.Dispatch(n, &gateway.MessageCreateEvent{
+			Message: discord.Message{
+				ID:        id,
+				ChannelID: textID,
+				GuildID:   guildID,
+				Author:    discord.User{ID: 100000000000000002},
+			},
+		})
+	}
+
+	// The first activity is dispatched right away.
+	message(900000000000000070)
+	if ev := next(); ev.ChannelID != textID || ev.Activity != ningen.MessageActivity || ev.Count != 1 {
+		t.Errorf("got first event %+v", ev)
+	}
+
+	// The rest is collected until the end of the period.
+	message(900000000000000071)
+	ningentest.Dispatch(n, &gateway.ThreadCreateEvent{
+		Channel: discord.Channel{
+			ID:       discord.ChannelID(discord.NewSnowflake(time.Now())),
+			GuildID:  guildID,
+			ParentID: textID,
+			Type:     discord.GuildPublicThread,
+		},
+	})
+
+	ev := next()
+	if ev.ChannelID != textID || ev.Count != 2 ||
+		!ev.Activity.Has(ningen.MessageActivity|ningen.ThreadActivity) {
+		t.Errorf("got throttled event %+v", ev)
+	}
+
+	join := func(chID discord.ChannelID) {
+		ningentest.Dispatch(n, &gateway.VoiceStateUpdateEvent{
+			VoiceState: discord.VoiceState{
+				GuildID:   guildID,
+				ChannelID: chID,
+				UserID:    100000000000000002,
+			},
+		})
+	}
+
+	// Only joining counts, not muting.
+	join(voiceID)
+	join(voiceID)
+
+	if ev := next(); ev.ChannelID != voiceID || ev.Activity != ningen.VoiceActivity {
+		t.Errorf("got voice event %+v", ev)
+	}
+
+	// The windows are dropped once a period passes without activity, which
+	// doesn't dispatch anything.
+	waitFor(t, "the activity windows to close", func() bool { return n.Diagnostics().Timers == 0 })
+	if err := n.Flush(context.Background()); err != nil {
+		t.Fatal("cannot flush:", err)
+	}
+
+	select {
+	case ev := <-events:
+		t.Errorf("got unexpected event %+v", ev)
+	default:
+	}
+}
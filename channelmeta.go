@@ -0,0 +1,211 @@
+package ningen
+
+import (
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+)
+
+// ChannelMetadata is the part of a channel that channel headers show.
+type ChannelMetadata struct {
+	Name  string
+	Topic string
+	NSFW  bool
+	// Slowmode is the duration that users have to wait between messages.
+	Slowmode discord.Seconds
+}
+
+// ChannelMetadataOf returns the metadata of the channel.
+func ChannelMetadataOf(ch *discord.Channel) ChannelMetadata {
+	return ChannelMetadata{
+		Name:     ch.Name,
+		Topic:    ch.Topic,
+		NSFW:     ch.NSFW,
+		Slowmode: ch.UserRateLimit,
+	}
+}
+
+// ChannelMetadataChangedEvent is dispatched when the metadata of an open
+// channel has changed; see OpenChannelView. Channel updates that come in
+// bursts are coalesced into one event that is dispatched after
+// ChannelMetadataQuietPeriod has passed without further changes, and updates
+// that don't change the metadata are ignored.
+type ChannelMetadataChangedEvent struct {
+	ChannelID discord.ChannelID
+	GuildID   discord.GuildID
+	Old       ChannelMetadata
+	New       ChannelMetadata
+}
+
+var _ gateway.Event = (*ChannelMetadataChangedEvent)(nil)
+
+func (ev ChannelMetadataChangedEvent) Op() ws.OpCode { return -1 }
+func (ev ChannelMetadataChangedEvent) EventType() ws.EventType {
+	return "__ningen.ChannelMetadataChangedEvent"
+}
+
+// NameChanged returns true if the channel was renamed.
+func (ev *ChannelMetadataChangedEvent) NameChanged() bool { return ev.Old.Name != ev.New.Name }
+
+// TopicChanged returns true if the channel's topic has changed.
+func (ev *ChannelMetadataChangedEvent) TopicChanged() bool { return ev.Old.Topic != ev.New.Topic }
+
+// NSFWChanged returns true if the channel was marked or unmarked as NSFW.
+func (ev *ChannelMetadataChangedEvent) NSFWChanged() bool { return ev.Old.NSFW != ev.New.NSFW }
+
+// SlowmodeChanged returns true if the channel's slowmode has changed.
+func (ev *ChannelMetadataChangedEvent) SlowmodeChanged() bool {
+	return ev.Old.Slowmode != ev.New.Slowmode
+}
+
+// ChannelMetadataQuietPeriod is the duration without metadata changes in an
+// open channel after which a ChannelMetadataChangedEvent is dispatched.
+var ChannelMetadataQuietPeriod = 250 * time.Millisecond
+
+type openChannel struct {
+	refs int
+	meta ChannelMetadata
+	// old is the metadata from before the pending changes. It is only valid
+	// if timer is not nil.
+	old   ChannelMetadata
+	timer *time.Timer
+}
+
+type channelMetadataWatcher struct {
+	mutex    sync.Mutex
+	open     map[discord.ChannelID]*openChannel
+	dispatch func(*ChannelMetadataChangedEvent)
+}
+
+func newChannelMetadataWatcher(dispatch func(*ChannelMetadataChangedEvent)) *channelMetadataWatcher {
+	return &channelMetadataWatcher{
+		open:     make(map[discord.ChannelID]*openChannel),
+		dispatch: dispatch,
+	}
+}
+
+// OpenChannelView marks the channel as open, which makes the State dispatch
+// ChannelMetadataChangedEvents for it. Views that show the channel, such as
+// channel headers, should call it when they are shown and call the returned
+// function when they are closed. A channel may be opened more than once; it
+// stays open until every view has closed it.
+func (s *State) OpenChannelView(chID discord.ChannelID) (close func()) {
+	w := s.channelMeta
+
+	var meta ChannelMetadata
+	if ch, err := s.Cabinet.Channel(chID); err == nil {
+		meta = ChannelMetadataOf(ch)
+	}
+
+	w.mutex.Lock()
+	open, ok := w.open[chID]
+	if !ok {
+		open = &openChannel{meta: meta}
+		w.open[chID] = open
+	}
+	open.refs++
+	w.mutex.Unlock()
+
+	var once sync.Once
+	return func() { once.Do(func() { w.close(chID) }) }
+}
+
+func (w *channelMetadataWatcher) close(chID discord.ChannelID) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	open, ok := w.open[chID]
+	if !ok {
+		return
+	}
+
+	open.refs--
+	if open.refs > 0 {
+		return
+	}
+
+	if open.timer != nil {
+		open.timer.Stop()
+	}
+	delete(w.open, chID)
+}
+
+// pendingTimers returns the number of open channels waiting for their quiet
+// period.
+func (w *channelMetadataWatcher) pendingTimers() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	var n int
+	for _, open := range w.open {
+		if open.timer != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func (w *channelMetadataWatcher) handle(ev gateway.Event) {
+	switch ev := ev.(type) {
+	case *gateway.ChannelUpdateEvent:
+		w.update(&ev.Channel)
+	case *gateway.ThreadUpdateEvent:
+		w.update(&ev.Channel)
+	}
+}
+
+func (w *channelMetadataWatcher) update(ch *discord.Channel) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	open, ok := w.open[ch.ID]
+	if !ok {
+		return
+	}
+
+	meta := ChannelMetadataOf(ch)
+	if meta == open.meta {
+		return
+	}
+
+	if open.timer != nil {
+		open.meta = meta
+		open.timer.Reset(ChannelMetadataQuietPeriod)
+		return
+	}
+
+	open.old = open.meta
+	open.meta = meta
+
+	chID := ch.ID
+	guildID := ch.GuildID
+
+	// timer is only read while w.mutex is held, by which time it is set.
+	var timer *time.Timer
+	timer = time.AfterFunc(ChannelMetadataQuietPeriod, func() {
+		w.mutex.Lock()
+		// The channel may have been closed, or the timer may have fired
+		// again after a Reset that came too late.
+		if current, ok := w.open[chID]; !ok || current != open || open.timer != timer {
+			w.mutex.Unlock()
+			return
+		}
+		open.timer = nil
+		ev := &ChannelMetadataChangedEvent{
+			ChannelID: chID,
+			GuildID:   guildID,
+			Old:       open.old,
+			New:       open.meta,
+		}
+		w.mutex.Unlock()
+
+		// A burst may have changed the metadata back.
+		if ev.Old != ev.New {
+			w.dispatch(ev)
+		}
+	})
+	open.timer = timer
+}
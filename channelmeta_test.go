@@ -0,0 +1,75 @@
+package ningen_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/ningen/v3"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestChannelMetadataChangedEvent(t *testing.T) {
+	const openID = 300000000000000002
+	const closedID = 300000000000000003
+
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	events := make(chan *ningen.ChannelMetadataChangedEvent, 4)
+	n.AddSyncHandler(func(ev *ningen.ChannelMetadataChangedEvent) { events <- ev })
+
+	update := func(id discord.ChannelID, fn func(*discord.Channel)) {
+		ch, _ := n.Cabinet.Channel(id)
+		cpy := *ch
+		fn(&cpy)
+		ningentest.Dispatch(n, &gateway.ChannelUpdateEvent{Channel: cpy})
+	}
+
+	closeView := n.OpenChannelView(openID)
+	closeAgain := n.OpenChannelView(openID)
+	closeAgain()
+	closeAgain()
+
+	old, _ := n.Cabinet.Channel(openID)
+	oldName := old.Name
+
+	// Only the open channel is watched, and moving it doesn't change its
+	// metadata.
+	update(closedID, func(ch *discord.Channel) { ch.Topic = "ignored" })
+	update(openID, func(ch *discord.Channel) { ch.Position += 5 })
+
+	// A burst of changes is coalesced.
+	update(openID, func(ch *discord.Channel) { ch.Topic = "new topic" })
+	update(openID, func(ch *discord.Channel) { ch.UserRateLimit = 30 })
+
+	select {
+	case ev := <-events:
+		if ev.ChannelID != openID || ev.GuildID != 200000000000000001 {
+			t.Fatalf("got event for channel %d in guild %d", ev.ChannelID, ev.GuildID)
+		}
+		if !ev.TopicChanged() || !ev.SlowmodeChanged() || ev.NameChanged() || ev.NSFWChanged() {
+			t.Errorf("got changes %+v -> %+v", ev.Old, ev.New)
+		}
+		if ev.New.Topic != "new topic" || ev.New.Slowmode != 30 || ev.New.Name != oldName {
+			t.Errorf("got new metadata %+v", ev.New)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for ChannelMetadataChangedEvent")
+	}
+
+	select {
+	case ev := <-events:
+		t.Fatalf("got another event %+v, want only one", ev)
+	case <-time.After(2 * ningen.ChannelMetadataQuietPeriod):
+	}
+
+	closeView()
+	update(openID, func(ch *discord.Channel) { ch.Name = "closed" })
+
+	select {
+	case ev := <-events:
+		t.Fatalf("got event %+v after closing the view", ev)
+	case <-time.After(2 * ningen.ChannelMetadataQuietPeriod):
+	}
+}
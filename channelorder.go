@@ -0,0 +1,130 @@
+package ningen
+
+import (
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+)
+
+// ChannelOrderChangedEvent is dispatched when the order of channels in a guild
+// has changed, i.e. when channels are created, deleted, moved or put into
+// another category. Server reorganizations cause a storm of
+// ChannelUpdateEvents, so they are coalesced into one event that is dispatched
+// after ChannelOrderQuietPeriod has passed without further changes.
+type ChannelOrderChangedEvent struct {
+	GuildID discord.GuildID
+}
+
+var _ gateway.Event = (*ChannelOrderChangedEvent)(nil)
+
+func (ev ChannelOrderChangedEvent) Op() ws.OpCode { return -1 }
+func (ev ChannelOrderChangedEvent) EventType() ws.EventType {
+	return "__ningen.ChannelOrderChangedEvent"
+}
+
+// ChannelOrderQuietPeriod is the duration without channel order changes in a
+// guild after which a ChannelOrderChangedEvent is dispatched.
+var ChannelOrderQuietPeriod = 500 * time.Millisecond
+
+type channelPosition struct {
+	position int
+	parentID discord.ChannelID
+}
+
+func positionOf(ch *discord.Channel) channelPosition {
+	return channelPosition{
+		position: ch.Position,
+		parentID: ch.ParentID,
+	}
+}
+
+type channelOrderWatcher struct {
+	mutex     sync.Mutex
+	positions map[discord.ChannelID]channelPosition
+	timers    map[discord.GuildID]*time.Timer
+	dispatch  func(*ChannelOrderChangedEvent)
+}
+
+func newChannelOrderWatcher(dispatch func(*ChannelOrderChangedEvent)) *channelOrderWatcher {
+	return &channelOrderWatcher{
+		positions: make(map[discord.ChannelID]channelPosition),
+		timers:    make(map[discord.GuildID]*time.Timer),
+		dispatch:  dispatch,
+	}
+}
+
+// pendingTimers returns the number of guilds waiting for their quiet period.
+func (w *channelOrderWatcher) pendingTimers() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return len(w.timers)
+}
+
+func (w *channelOrderWatcher) handle(ev gateway.Event) {
+	switch ev := ev.(type) {
+	case *gateway.ReadyEvent:
+		w.mutex.Lock()
+		w.positions = make(map[discord.ChannelID]channelPosition, len(w.positions))
+		for _, guild := range ev.Guilds {
+			w.setAll(guild.Channels)
+		}
+		w.mutex.Unlock()
+
+	case *gateway.GuildCreateEvent:
+		w.mutex.Lock()
+		w.setAll(ev.Channels)
+		w.mutex.Unlock()
+
+	case *gateway.ChannelCreateEvent:
+		w.mutex.Lock()
+		w.positions[ev.ID] = positionOf(&ev.Channel)
+		w.changed(ev.GuildID)
+		w.mutex.Unlock()
+
+	case *gateway.ChannelUpdateEvent:
+		w.mutex.Lock()
+		pos := positionOf(&ev.Channel)
+		if old, ok := w.positions[ev.ID]; !ok || old != pos {
+			w.positions[ev.ID] = pos
+			w.changed(ev.GuildID)
+		}
+		w.mutex.Unlock()
+
+	case *gateway.ChannelDeleteEvent:
+		w.mutex.Lock()
+		delete(w.positions, ev.ID)
+		w.changed(ev.GuildID)
+		w.mutex.Unlock()
+	}
+}
+
+func (w *channelOrderWatcher) setAll(channels []discord.Channel) {
+	for i := range channels {
+		w.positions[channels[i].ID] = positionOf(&channels[i])
+	}
+}
+
+// changed (re)starts the quiet period timer of the guild. w.mutex must be
+// held.
+func (w *channelOrderWatcher) changed(guildID discord.GuildID) {
+	if !guildID.IsValid() {
+		return
+	}
+
+	if timer, ok := w.timers[guildID]; ok {
+		timer.Reset(ChannelOrderQuietPeriod)
+		return
+	}
+
+	w.timers[guildID] = time.AfterFunc(ChannelOrderQuietPeriod, func() {
+		w.mutex.Lock()
+		delete(w.timers, guildID)
+		w.mutex.Unlock()
+
+		w.dispatch(&ChannelOrderChangedEvent{GuildID: guildID})
+	})
+}
@@ -0,0 +1,54 @@
+package ningen_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/ningen/v3"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestChannelOrderChangedEvent(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	events := make(chan discord.GuildID, 4)
+	n.AddSyncHandler(func(ev *ningen.ChannelOrderChangedEvent) { events <- ev.GuildID })
+
+	// Renaming doesn't change the order.
+	renamed, _ := n.Cabinet.Channel(300000000000000002)
+	renamedCopy := *renamed
+	renamedCopy.Name = "renamed"
+	ningentest.Dispatch(n, &gateway.ChannelUpdateEvent{Channel: renamedCopy})
+
+	select {
+	case guildID := <-events:
+		t.Fatalf("got event for guild %d after renaming a channel", guildID)
+	case <-time.After(2 * ningen.ChannelOrderQuietPeriod):
+	}
+
+	// A reorganization moves several channels at once.
+	for i, id := range []discord.ChannelID{300000000000000002, 300000000000000003, 300000000000000005} {
+		ch, _ := n.Cabinet.Channel(id)
+		moved := *ch
+		moved.Position = 10 - i
+		moved.ParentID = 300000000000000004
+		ningentest.Dispatch(n, &gateway.ChannelUpdateEvent{Channel: moved})
+	}
+
+	select {
+	case guildID := <-events:
+		if guildID != 200000000000000001 {
+			t.Fatalf("got event for guild %d, want 200000000000000001", guildID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for ChannelOrderChangedEvent")
+	}
+
+	select {
+	case guildID := <-events:
+		t.Fatalf("got another event for guild %d, want only one", guildID)
+	case <-time.After(2 * ningen.ChannelOrderQuietPeriod):
+	}
+}
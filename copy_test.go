@@ -0,0 +1,123 @@
+package ningen_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/ningen/v3"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestOfflineOnline(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	if n.IsOffline() {
+		t.Fatal("new state is offline")
+	}
+
+	offline := n.Offline()
+	if !offline.IsOffline() {
+		t.Fatal("Offline returned an online state")
+	}
+	if offline.Context().Err() == nil {
+		t.Fatal("Offline state has a live context")
+	}
+
+	// Going offline twice must not lose the online context.
+	online := offline.Offline().Online()
+	if online.IsOffline() {
+		t.Fatal("Online returned an offline state")
+	}
+	if online.Context().Err() != nil {
+		t.Fatal("Online state has a cancelled context:", online.Context().Err())
+	}
+
+	if online.Online() != online {
+		t.Fatal("Online on an online state should return itself")
+	}
+
+	// Sub-states are shared between all copies.
+	if offline.ReadState != n.ReadState || online.MutedState != n.MutedState {
+		t.Fatal("copies don't share sub-states")
+	}
+}
+
+func TestWithContextShared(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cpy := n.WithContext(ctx)
+	if cpy.Context() != ctx {
+		t.Fatal("WithContext did not replace the context")
+	}
+	if n.Context() == ctx {
+		t.Fatal("WithContext modified the original state")
+	}
+
+	// Events dispatched to the original are seen by the copy.
+	ningentest.Dispatch(n, &gateway.MessageAckEvent{
+		ChannelID: 300000000000000003,
+		MessageID: 900000000000000020,
+	})
+
+	if got := cpy.ChannelIsUnread(300000000000000003, ningen.UnreadOpts{}); got != ningen.ChannelRead {
+		t.Fatalf("copy sees channel as %d after ack, want read", got)
+	}
+}
+
+// TestCopyRace is meant to be run with -race. It ensures that copies can be
+// made and used while the live state is handling events.
+func TestCopyRace(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// The events are dispatched without waiting for the events that
+		// they cause, so that those race with the copies too.
+		for i := 0; i < 200; i++ {
+			n.Session.Handler.Call(&gateway.MessageCreateEvent{
+				Message: discord.Message{
+					ID:        discord.MessageID(900000000000000100 + i),
+					ChannelID: 300000000000000002,
+					GuildID:   200000000000000001,
+					Author:    discord.User{ID: 100000000000000002},
+				},
+			})
+		}
+		close(done)
+	}()
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				offline := n.Offline()
+				offline.GuildIsUnread(200000000000000001, ningen.GuildUnreadOpts{})
+				offline.Online().ChannelIsUnread(300000000000000002, ningen.UnreadOpts{})
+				n.WithContext(context.Background()).Channels(200000000000000001, nil)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if err := n.Flush(context.Background()); err != nil {
+		t.Fatal("cannot flush:", err)
+	}
+}
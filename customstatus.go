@@ -0,0 +1,135 @@
+package ningen
+
+import (
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/httputil"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+	"github.com/diamondburned/ningen/v3/trace"
+	"github.com/pkg/errors"
+)
+
+// CustomStatusExpiredEvent is dispatched after the current user's custom
+// status has expired and was cleared from their presence and settings.
+type CustomStatusExpiredEvent struct {
+	Status gateway.CustomUserStatus
+}
+
+var _ gateway.Event = (*CustomStatusExpiredEvent)(nil)
+
+func (ev CustomStatusExpiredEvent) Op() ws.OpCode { return -1 }
+func (ev CustomStatusExpiredEvent) EventType() ws.EventType {
+	return "__ningen.CustomStatusExpiredEvent"
+}
+
+// customStatusExpiry keeps the timer that clears the custom status once it
+// expires. Only the latest custom status has a timer.
+type customStatusExpiry struct {
+	mutex sync.Mutex
+	timer *time.Timer
+	// gen is incremented every time the timer is replaced, so that a timer
+	// that fires while being replaced does nothing.
+	gen    uint64
+	expire func(gateway.CustomUserStatus)
+}
+
+func newCustomStatusExpiry(expire func(gateway.CustomUserStatus)) *customStatusExpiry {
+	return &customStatusExpiry{expire: expire}
+}
+
+// schedule replaces the timer with one for the given custom status. The timer
+// is stopped if the status never expires.
+func (e *customStatusExpiry) schedule(custom gateway.CustomUserStatus) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.gen++
+	if e.timer != nil {
+		e.timer.Stop()
+		e.timer = nil
+	}
+
+	if !custom.ExpiresAt.IsValid() {
+		return
+	}
+
+	gen := e.gen
+	e.timer = time.AfterFunc(time.Until(custom.ExpiresAt.Time()), func() {
+		e.mutex.Lock()
+		current := e.gen == gen
+		if current {
+			e.timer = nil
+		}
+		e.mutex.Unlock()
+
+		if current {
+			e.expire(custom)
+		}
+	})
+}
+
+// pendingTimers returns 1 if a custom status is waiting to expire.
+func (e *customStatusExpiry) pendingTimers() int {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.timer != nil {
+		return 1
+	}
+	return 0
+}
+
+// expireCustomStatus removes the custom activity from the current user's
+// presence, both locally and on the gateway, and clears it from the user
+// settings.
+func (s *State) expireCustomStatus(custom gateway.CustomUserStatus) {
+	me, err := s.Me()
+	if err != nil {
+		return
+	}
+
+	if p, _ := s.PresenceStore.Presence(0, me.ID); p != nil {
+		cleared := *p
+		cleared.Activities = withoutCustomActivity(p.Activities)
+		s.PresenceStore.PresenceSet(p.GuildID, &cleared, true)
+
+		if gw := s.Gateway(); gw != nil {
+			err := s.Tracer.Send(s.Context(), gw, trace.CustomStatus, &gateway.UpdatePresenceCommand{
+				Status:     cleared.Status,
+				Activities: cleared.Activities,
+			})
+			if err != nil {
+				s.Handler.Call(&ws.BackgroundErrorEvent{
+					Err: errors.Wrap(err, "cannot clear expired custom status on gateway"),
+				})
+			}
+		}
+	}
+
+	if !s.Features().Bot {
+		patchSettings := map[string]interface{}{"custom_status": nil}
+		if err := s.FastRequest("PATCH", api.EndpointMe+"/settings", httputil.WithJSONBody(patchSettings)); err != nil {
+			s.Handler.Call(&ws.BackgroundErrorEvent{
+				Err: errors.Wrap(err, "cannot clear expired custom status in user settings"),
+			})
+		}
+	}
+
+	s.Handler.Call(&CustomStatusExpiredEvent{Status: custom})
+}
+
+// withoutCustomActivity returns a copy of the activities without the custom
+// status activity.
+func withoutCustomActivity(activities []discord.Activity) []discord.Activity {
+	filtered := make([]discord.Activity, 0, len(activities))
+	for _, activity := range activities {
+		if activity.Type != discord.CustomActivity {
+			filtered = append(filtered, activity)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,87 @@
+package ningen_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/httputil/httpdriver"
+	"github.com/diamondburned/ningen/v3"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestCustomStatusExpiry(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	patches := make(chan string, 1)
+	n.Client.Client.Retries = 1
+	n.Client.Client.Client = httpdriver.WrapClient(http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			if r.Method == "PATCH" && strings.HasSuffix(r.URL.Path, "/users/@me/settings") {
+				b, _ := io.ReadAll(r.Body)
+				patches <- strings.TrimSpace(string(b))
+			}
+			return &http.Response{
+				StatusCode: 204,
+				Body:       io.NopCloser(strings.NewReader("")),
+			}, nil
+		}),
+	})
+
+	me, err := n.Me()
+	if err != nil {
+		t.Fatal("cannot get current user:", err)
+	}
+
+	n.PresenceStore.PresenceSet(0, &discord.Presence{
+		User:       *me,
+		Status:     discord.OnlineStatus,
+		Activities: []discord.Activity{{Name: "Go", Type: discord.GameActivity}},
+	}, true)
+
+	expired := make(chan *ningen.CustomStatusExpiredEvent, 1)
+	n.AddSyncHandler(func(ev *ningen.CustomStatusExpiredEvent) { expired <- ev })
+
+	ningentest.Dispatch(n, &gateway.UserSettingsUpdateEvent{
+		UserSettings: gateway.UserSettings{
+			Status: discord.OnlineStatus,
+			CustomStatus: &gateway.CustomUserStatus{
+				Text:      "brb",
+				ExpiresAt: discord.NewTimestamp(time.Now().Add(50 * time.Millisecond)),
+			},
+		},
+	})
+
+	p, _ := n.PresenceStore.Presence(0, me.ID)
+	if len(p.Activities) != 2 || p.Activities[1].Type != discord.CustomActivity {
+		t.Fatalf("got activities %+v before expiry", p.Activities)
+	}
+	if d := n.Diagnostics(); d.Timers != 1 {
+		t.Errorf("got %d timers, want the expiry", d.Timers)
+	}
+
+	select {
+	case ev := <-expired:
+		if ev.Status.Text != "brb" {
+			t.Errorf("got expired status %q", ev.Status.Text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("custom status never expired")
+	}
+
+	if body := <-patches; body != `{"custom_status":null}` {
+		t.Errorf("got settings patch %s", body)
+	}
+
+	p, _ = n.PresenceStore.Presence(0, me.ID)
+	if len(p.Activities) != 1 || p.Activities[0].Name != "Go" {
+		t.Errorf("got activities %+v after expiry", p.Activities)
+	}
+	if d := n.Diagnostics(); d.Timers != 0 {
+		t.Errorf("got %d timers after expiry", d.Timers)
+	}
+}
@@ -0,0 +1,125 @@
+package ningen
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+)
+
+// MessagesDeleteEvent is a consolidated event for deleted messages. It is
+// dispatched once for each MessageDeleteBulkEvent, as well as once for each
+// burst of MessageDeleteEvents in the same channel, such as when a moderation
+// bot purges messages one by one. UIs can handle this event instead of
+// processing hundreds of individual deletions.
+//
+// The individual gateway events are still dispatched as usual.
+type MessagesDeleteEvent struct {
+	ChannelID discord.ChannelID
+	GuildID   discord.GuildID
+	// IDs are the deleted message IDs in ascending order.
+	IDs []discord.MessageID
+}
+
+var _ gateway.Event = (*MessagesDeleteEvent)(nil)
+
+func (ev MessagesDeleteEvent) Op() ws.OpCode           { return -1 }
+func (ev MessagesDeleteEvent) EventType() ws.EventType { return "__ningen.MessagesDeleteEvent" }
+
+// MessageDeleteCoalesceDelay is the duration that MessageDeleteEvents are
+// collected for before a MessagesDeleteEvent is dispatched.
+var MessageDeleteCoalesceDelay = 250 * time.Millisecond
+
+type deleteCoalescer struct {
+	mutex    sync.Mutex
+	channels map[discord.ChannelID]*pendingDeletes
+	dispatch func(*MessagesDeleteEvent)
+}
+
+type pendingDeletes struct {
+	ev    MessagesDeleteEvent
+	timer *time.Timer
+}
+
+func newDeleteCoalescer(dispatch func(*MessagesDeleteEvent)) *deleteCoalescer {
+	return &deleteCoalescer{
+		channels: make(map[discord.ChannelID]*pendingDeletes),
+		dispatch: dispatch,
+	}
+}
+
+// pendingTimers returns the number of channels waiting to be flushed.
+func (c *deleteCoalescer) pendingTimers() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return len(c.channels)
+}
+
+// add adds a single deleted message. The event is dispatched after
+// MessageDeleteCoalesceDelay.
+func (c *deleteCoalescer) add(ev *gateway.MessageDeleteEvent) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	pending, ok := c.channels[ev.ChannelID]
+	if !ok {
+		pending = &pendingDeletes{
+			ev: MessagesDeleteEvent{
+				ChannelID: ev.ChannelID,
+				GuildID:   ev.GuildID,
+			},
+		}
+		c.channels[ev.ChannelID] = pending
+
+		pending.timer = time.AfterFunc(MessageDeleteCoalesceDelay, func() { c.flush(pending) })
+	}
+
+	pending.ev.IDs = append(pending.ev.IDs, ev.ID)
+}
+
+// addBulk merges the bulk deletion with any pending deletions in the same
+// channel and dispatches them immediately.
+func (c *deleteCoalescer) addBulk(ev *gateway.MessageDeleteBulkEvent) {
+	c.mutex.Lock()
+	pending, ok := c.channels[ev.ChannelID]
+	delete(c.channels, ev.ChannelID)
+	c.mutex.Unlock()
+
+	deleted := MessagesDeleteEvent{
+		ChannelID: ev.ChannelID,
+		GuildID:   ev.GuildID,
+	}
+
+	if ok {
+		pending.timer.Stop()
+		deleted.IDs = pending.ev.IDs
+	}
+
+	deleted.IDs = append(deleted.IDs, ev.IDs...)
+	c.send(&deleted)
+}
+
+// flush dispatches the pending deletions once their delay is over. It does
+// nothing if they were already taken by addBulk, since the timer may fire
+// before it is stopped.
+func (c *deleteCoalescer) flush(pending *pendingDeletes) {
+	c.mutex.Lock()
+	ok := c.channels[pending.ev.ChannelID] == pending
+	if ok {
+		delete(c.channels, pending.ev.ChannelID)
+	}
+	c.mutex.Unlock()
+
+	if ok {
+		c.send(&pending.ev)
+	}
+}
+
+func (c *deleteCoalescer) send(ev *MessagesDeleteEvent) {
+	sort.Slice(ev.IDs, func(i, j int) bool { return ev.IDs[i] < ev.IDs[j] })
+	c.dispatch(ev)
+}
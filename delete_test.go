@@ -0,0 +1,148 @@
+package ningen_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/ningen/v3"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestMessagesDeleteEvent(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	events := make(chan *ningen.MessagesDeleteEvent, 2)
+	n.AddSyncHandler(func(ev *ningen.MessagesDeleteEvent) { events <- ev })
+
+	// A purge, one message at a time.
+	for _, id := range []discord.MessageID{3, 1, 2} {
+		ningentest.Dispatch(n, &gateway.MessageDeleteEvent{
+			ID:        id,
+			ChannelID: 300000000000000002,
+			GuildID:   200000000000000001,
+		})
+	}
+
+	// A bulk deletion is dispatched right away.
+	ningentest.Dispatch(n, &gateway.MessageDeleteBulkEvent{
+		IDs:       []discord.MessageID{5, 4},
+		ChannelID: 300000000000000003,
+		GuildID:   200000000000000001,
+	})
+
+	wantIDs := map[discord.ChannelID][]discord.MessageID{
+		300000000000000002: {1, 2, 3},
+		300000000000000003: {4, 5},
+	}
+
+	timeout := time.After(5 * time.Second)
+	for i := 0; i < 2; i++ {
+		select {
+		case ev := <-events:
+			want, ok := wantIDs[ev.ChannelID]
+			if !ok {
+				t.Fatalf("unexpected event for channel %d", ev.ChannelID)
+			}
+			if len(ev.IDs) != len(want) {
+				t.Fatalf("channel %d: got IDs %v, want %v", ev.ChannelID, ev.IDs, want)
+			}
+			for i := range want {
+				if ev.IDs[i] != want[i] {
+					t.Fatalf("channel %d: got IDs %v, want %v", ev.ChannelID, ev.IDs, want)
+				}
+			}
+			delete(wantIDs, ev.ChannelID)
+		case <-timeout:
+			t.Fatal("timed out waiting for MessagesDeleteEvent")
+		}
+	}
+}
+
+func TestMessagesDeleteEventAfterBulk(t *testing.T) {
+	defer func(delay time.Duration) { ningen.MessageDeleteCoalesceDelay = delay }(ningen.MessageDeleteCoalesceDelay)
+	ningen.MessageDeleteCoalesceDelay = 400 * time.Millisecond
+
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	events := make(chan *ningen.MessagesDeleteEvent, 2)
+	n.AddSyncHandler(func(ev *ningen.MessagesDeleteEvent) { events <- ev })
+
+	const chID = 300000000000000002
+
+	// The bulk deletion takes the pending deletion along with it.
+	ningentest.Dispatch(n, &gateway.MessageDeleteEvent{ID: 1, ChannelID: chID})
+	ningentest.Dispatch(n, &gateway.MessageDeleteBulkEvent{IDs: []discord.MessageID{2}, ChannelID: chID})
+
+	if ev := <-events; len(ev.IDs) != 2 {
+		t.Fatalf("got IDs %v, want [1 2]", ev.IDs)
+	}
+
+	time.Sleep(ningen.MessageDeleteCoalesceDelay / 2)
+	added := time.Now()
+	ningentest.Dispatch(n, &gateway.MessageDeleteEvent{ID: 3, ChannelID: chID})
+
+	select {
+	case ev := <-events:
+		if elapsed := time.Since(added); elapsed < ningen.MessageDeleteCoalesceDelay*3/4 {
+			t.Fatalf("deletion of %v flushed after %v by the previous timer", ev.IDs, elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for MessagesDeleteEvent")
+	}
+}
+
+func TestUnreadAfterBulkDelete(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	const chID = 300000000000000003
+
+	for _, id := range []discord.MessageID{900000000000000015, 900000000000000019, 900000000000000020} {
+		n.Cabinet.MessageSet(&discord.Message{ID: id, ChannelID: chID}, false)
+	}
+
+	ningentest.Dispatch(n, &gateway.MessageDeleteBulkEvent{
+		IDs:       []discord.MessageID{900000000000000019, 900000000000000020},
+		ChannelID: chID,
+		GuildID:   200000000000000001,
+	})
+
+	if got := n.ChannelIsUnread(chID, ningen.UnreadOpts{}); got != ningen.ChannelRead {
+		t.Fatalf("channel is %d after bulk deleting, want read", got)
+	}
+}
+
+func TestMentionsAfterBulkDelete(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	const chID = 300000000000000003
+
+	for _, id := range []discord.MessageID{900000000000000030, 900000000000000031, 900000000000000032} {
+		ningentest.Dispatch(n, &gateway.MessageCreateEvent{Message: discord.Message{
+			ID:        id,
+			ChannelID: chID,
+			GuildID:   200000000000000001,
+			Author:    discord.User{ID: 100000000000000002},
+			Mentions:  []discord.GuildUser{{User: discord.User{ID: 100000000000000001}}},
+		}})
+	}
+
+	if rs := n.ReadState.ReadState(chID); rs == nil || rs.MentionCount != 3 {
+		t.Fatalf("got read state %+v, want 3 mentions", rs)
+	}
+
+	// The deleted mentions no longer count, while the remaining one does.
+	ningentest.Dispatch(n, &gateway.MessageDeleteBulkEvent{
+		IDs:       []discord.MessageID{900000000000000031, 900000000000000032},
+		ChannelID: chID,
+		GuildID:   200000000000000001,
+	})
+
+	if rs := n.ReadState.ReadState(chID); rs == nil || rs.MentionCount != 1 {
+		t.Fatalf("got read state %+v after bulk deleting, want 1 mention", rs)
+	}
+	if got := n.ChannelCountUnreads(chID, ningen.UnreadOpts{}); got != 1 {
+		t.Errorf("got %d unread messages after bulk deleting, want 1", got)
+	}
+}
@@ -0,0 +1,76 @@
+package ningen
+
+import (
+	"runtime"
+
+	"github.com/diamondburned/ningen/v3/prefetch"
+)
+
+// Diagnostics is a snapshot of the load of a State. It is meant to be shown in
+// debug panels and attached to performance reports.
+type Diagnostics struct {
+	// Goroutines is the number of goroutines in the whole process.
+	Goroutines int
+	// Timers is the number of pending coalescing and debouncing timers, such
+	// as the ones used by MessagesDeleteEvent, ChannelOrderChangedEvent,
+	// ChannelMetadataChangedEvent and ChannelActivityEvent, and the expiry of
+	// the custom status.
+	Timers int
+	// PendingMemberRequests is the number of members requested using
+	// MemberState.RequestMember that haven't arrived yet.
+	PendingMemberRequests int
+	// PendingAcks is the number of acks and read state updates in flight.
+	PendingAcks int
+	// PendingLoads is the number of MessageState.LoadMore calls waiting for
+	// messages to load.
+	PendingLoads int
+	// Prefetch is the load of the prefetch scheduler. Event handlers don't
+	// have queues of their own, so this is the only queue of a State.
+	Prefetch prefetch.Stats
+	// Caches contains the number of items in each store.
+	Caches CacheSizes
+}
+
+// CacheSizes contains the number of items in each store of a State.
+type CacheSizes struct {
+	Guilds     int
+	Channels   int
+	Members    int
+	Presences  int
+	ReadStates int
+}
+
+// Diagnostics returns a snapshot of the load of the State. It iterates over the
+// stores, so it shouldn't be called too often.
+func (s *State) Diagnostics() Diagnostics {
+	d := Diagnostics{
+		Goroutines:            runtime.NumGoroutine(),
+		PendingMemberRequests: s.MemberState.PendingRequests(),
+		PendingAcks:           s.ReadState.Pending(),
+		PendingLoads:          s.MessageState.Pending(),
+		Prefetch:              s.Prefetch.Stats(),
+	}
+
+	d.Timers += s.deletes.pendingTimers()
+	d.Timers += s.channelOrder.pendingTimers()
+	d.Timers += s.channelMeta.pendingTimers()
+	d.Timers += s.customStatus.pendingTimers()
+	d.Timers += s.activity.pendingTimers()
+
+	d.Caches.Members = s.MemberStore.Len()
+	d.Caches.Presences = s.PresenceStore.Len()
+	d.Caches.ReadStates = s.ReadState.Len()
+
+	guilds, _ := s.Cabinet.Guilds()
+	d.Caches.Guilds = len(guilds)
+
+	for _, guild := range guilds {
+		chs, _ := s.Cabinet.Channels(guild.ID)
+		d.Caches.Channels += len(chs)
+	}
+
+	privates, _ := s.Cabinet.PrivateChannels()
+	d.Caches.Channels += len(privates)
+
+	return d
+}
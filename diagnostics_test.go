@@ -0,0 +1,33 @@
+package ningen_test
+
+import (
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestDiagnostics(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	d := n.Diagnostics()
+	if d.Caches.Guilds != 3 {
+		t.Errorf("got %d guilds, want 3", d.Caches.Guilds)
+	}
+	if d.Caches.Channels == 0 {
+		t.Error("got no channels")
+	}
+	if d.Timers != 0 {
+		t.Errorf("got %d timers before any event", d.Timers)
+	}
+
+	ningentest.Dispatch(n, &gateway.MessageDeleteEvent{
+		ID:        900000000000000020,
+		ChannelID: 300000000000000003,
+		GuildID:   200000000000000001,
+	})
+
+	if d := n.Diagnostics(); d.Timers != 1 {
+		t.Errorf("got %d timers after a deletion, want 1", d.Timers)
+	}
+}
@@ -0,0 +1,99 @@
+package discordmd
+
+import (
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// SpoilerPrefix is the filename prefix that marks an attachment as a spoiler.
+// The official client adds it when the user marks an upload as a spoiler.
+const SpoilerPrefix = "SPOILER_"
+
+// AttachmentFlags are the flags of an attachment. arikawa's Attachment doesn't
+// have them, so they have to be decoded from the attachment's "flags" field
+// separately; see Attachment.
+type AttachmentFlags uint32
+
+const (
+	AttachmentIsClip AttachmentFlags = 1 << iota
+	AttachmentIsThumbnail
+	AttachmentIsRemix
+	AttachmentIsSpoiler
+	// AttachmentContainsExplicitMedia is set when Discord's explicit content
+	// scan flagged the attachment as obscene.
+	AttachmentContainsExplicitMedia
+)
+
+// Has returns true if flags has all of the given flags.
+func (flags AttachmentFlags) Has(has AttachmentFlags) bool {
+	return flags&has == has
+}
+
+// Attachment is an attachment along with its flags. It decodes from the same
+// JSON as discord.Attachment.
+type Attachment struct {
+	discord.Attachment
+	Flags AttachmentFlags `json:"flags,omitempty"`
+}
+
+// View returns the view of the attachment.
+func (a Attachment) View() AttachmentView {
+	return ViewAttachment(a.Attachment, a.Flags)
+}
+
+// AttachmentView describes how an attachment should be shown. Renderers should
+// blur the attachment and only reveal it on click if Blurred returns true.
+type AttachmentView struct {
+	discord.Attachment
+	// Spoiler is true if the attachment is marked as a spoiler, either by
+	// its filename or by its flags.
+	Spoiler bool
+	// Obscene is true if the attachment was flagged as explicit media.
+	Obscene bool
+}
+
+// ViewAttachment returns the view of the attachment. flags may be 0 if they
+// aren't known, in which case only the filename is checked.
+func ViewAttachment(a discord.Attachment, flags AttachmentFlags) AttachmentView {
+	return AttachmentView{
+		Attachment: a,
+		Spoiler:    AttachmentIsSpoilered(a) || flags.Has(AttachmentIsSpoiler),
+		Obscene:    flags.Has(AttachmentContainsExplicitMedia),
+	}
+}
+
+// ViewAttachments returns the views of all of the message's attachments.
+// flags returns the flags of each attachment, such as
+// messages.State.AttachmentFlags. If it is nil, only the filenames are
+// checked.
+func ViewAttachments(msg *discord.Message, flags func(discord.AttachmentID) AttachmentFlags) []AttachmentView {
+	views := make([]AttachmentView, len(msg.Attachments))
+	for i, a := range msg.Attachments {
+		var f AttachmentFlags
+		if flags != nil {
+			f = flags(a.ID)
+		}
+		views[i] = ViewAttachment(a, f)
+	}
+	return views
+}
+
+// Blurred returns true if the attachment should be hidden until it's clicked.
+func (v AttachmentView) Blurred() bool {
+	return v.Spoiler || v.Obscene
+}
+
+// DisplayFilename returns the filename without the spoiler prefix.
+func (v AttachmentView) DisplayFilename() string {
+	if v.Spoiler {
+		return strings.TrimPrefix(v.Filename, SpoilerPrefix)
+	}
+	return v.Filename
+}
+
+// AttachmentIsSpoilered returns true if the attachment's filename marks it as
+// a spoiler.
+func AttachmentIsSpoilered(a discord.Attachment) bool {
+	return strings.HasPrefix(a.Filename, SpoilerPrefix)
+}
@@ -0,0 +1,51 @@
+package discordmd
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+func TestViewAttachment(t *testing.T) {
+	tests := []struct {
+		filename string
+		flags    AttachmentFlags
+		spoiler  bool
+		obscene  bool
+		display  string
+	}{
+		{"cat.png", 0, false, false, "cat.png"},
+		{"SPOILER_cat.png", 0, true, false, "cat.png"},
+		{"cat.png", AttachmentIsSpoiler, true, false, "cat.png"},
+		{"cat.png", AttachmentContainsExplicitMedia | AttachmentIsClip, false, true, "cat.png"},
+		{"spoiler_cat.png", 0, false, false, "spoiler_cat.png"},
+	}
+
+	for _, test := range tests {
+		v := ViewAttachment(discord.Attachment{Filename: test.filename}, test.flags)
+		if v.Spoiler != test.spoiler || v.Obscene != test.obscene {
+			t.Errorf("%q %b: got spoiler=%v obscene=%v", test.filename, test.flags, v.Spoiler, v.Obscene)
+		}
+		if v.Blurred() != (test.spoiler || test.obscene) {
+			t.Errorf("%q %b: got blurred=%v", test.filename, test.flags, v.Blurred())
+		}
+		if got := v.DisplayFilename(); got != test.display {
+			t.Errorf("%q %b: got display name %q, want %q", test.filename, test.flags, got, test.display)
+		}
+	}
+}
+
+func TestAttachmentFlags(t *testing.T) {
+	var a Attachment
+	if err := json.Unmarshal([]byte(`{"id":"1","filename":"cat.png","flags":8}`), &a); err != nil {
+		t.Fatal(err)
+	}
+
+	if a.ID != 1 || a.Filename != "cat.png" || a.Flags != AttachmentIsSpoiler {
+		t.Fatalf("got attachment %+v", a)
+	}
+	if !a.View().Spoiler {
+		t.Error("attachment with the spoiler flag isn't a spoiler")
+	}
+}
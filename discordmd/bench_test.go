@@ -0,0 +1,42 @@
+package discordmd
+
+import (
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/state/store/defaultstore"
+)
+
+const benchContent = "hello **world**, this is a __message__ with `code` and " +
+	"<:emoji:123456789012345678> in it.\n> quoted ~~text~~\n" +
+	"```go\nfunc main() {}\n```\nsee https://example.com for ||spoilers||"
+
+func BenchmarkParse(b *testing.B) {
+	src := []byte(benchContent)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(src)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		Parse(src)
+	}
+}
+
+func BenchmarkParseWithMessage(b *testing.B) {
+	src := []byte(benchContent + " <@1> <#2>")
+	cab := defaultstore.New()
+	msg := &discord.Message{
+		Content: string(src),
+		Mentions: []discord.GuildUser{
+			{User: discord.User{ID: 1, Username: "user"}},
+		},
+	}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(src)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		ParseWithMessage(src, *cab, msg, true)
+	}
+}
@@ -3,6 +3,8 @@ package discordmd
 import (
 	"bytes"
 	"regexp"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/yuin/goldmark/ast"
 	"github.com/yuin/goldmark/parser"
@@ -31,7 +33,14 @@ type Emoji struct {
 	Name string
 	GIF  bool
 
-	Large bool // TODO
+	// Unicode is the emoji itself if it is a Unicode emoji rather than a
+	// custom one, in which case ID and Name are empty. Each emoji gets its own
+	// node, including ones made of several code points such as flags.
+	Unicode string
+
+	// Large is true if the message has nothing but emojis, which Discord
+	// renders at LargeEmojiSize.
+	Large bool
 }
 
 var KindEmoji = ast.NewNodeKind("Emoji")
@@ -46,15 +55,61 @@ func (e *Emoji) Dump(source []byte, level int) {
 	ast.DumpHelper(e, source, level, nil, nil)
 }
 
+// EmojiURL returns the URL of the custom emoji's image. It returns an empty
+// string for Unicode emojis.
 func (e Emoji) EmojiURL() string {
+	if e.Unicode != "" {
+		return ""
+	}
 	return EmojiURL(string(e.ID), e.GIF)
 }
 
-type emoji struct {
+type emoji struct{}
+
+// emojiState is the per-parse state of the emoji parser. It is kept in the
+// parser context, so the emoji parser itself stays stateless.
+type emojiState struct {
 	searched bool // if a small/large check was done
 	large    bool
 }
 
+var emojiStateCtx = parser.NewContextKey()
+
+func getEmojiState(pc parser.Context) *emojiState {
+	if v, ok := pc.Get(emojiStateCtx).(*emojiState); ok {
+		return v
+	}
+	state := &emojiState{}
+	pc.Set(emojiStateCtx, state)
+	return state
+}
+
+// isLarge returns whether the emojis of the source should be large. The source
+// is only searched once per parse.
+func (s *emojiState) isLarge(source []byte) bool {
+	if !s.searched {
+		s.searched = true
+		s.large = onlyEmojis(source)
+	}
+	return s.large
+}
+
+// onlyEmojis returns true if the source has nothing but custom and Unicode
+// emojis and spaces.
+func onlyEmojis(source []byte) bool {
+	source = bytes.TrimSpace(emojiRegex.ReplaceAll(source, nil))
+
+	for len(source) > 0 {
+		n := unicodeEmojiLen(source)
+		if n == 0 {
+			return false
+		}
+		source = bytes.TrimLeftFunc(source[n:], unicode.IsSpace)
+	}
+
+	return true
+}
+
 var emojiRegex = regexp.MustCompile(`<(a?):(.+?):(\d+)>`)
 
 func (emoji) Trigger() []byte {
@@ -62,7 +117,7 @@ func (emoji) Trigger() []byte {
 	return []byte{'<'}
 }
 
-func (state *emoji) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+func (emoji) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
 	match := matchInline(block, '<', '>')
 	if match == nil {
 		return nil
@@ -79,29 +134,71 @@ func (state *emoji) Parse(parent ast.Node, block text.Reader, pc parser.Context)
 		GIF:   string(matches[1]) == "a",
 		Name:  string(matches[2]),
 		ID:    string(matches[3]),
-		Large: state.large,
+		Large: getEmojiState(pc).isLarge(block.Source()),
 	}
 
-	// Check if emojis should be small:
-	if !state.searched {
-		state.searched = true
+	return emoji
+}
+
+// unicodeEmoji turns the Unicode emojis in text nodes into Emoji nodes. It is
+// an AST transformer rather than an inline parser, since goldmark only tries
+// inline parsers on punctuation and spaces.
+type unicodeEmoji struct{}
+
+func (unicodeEmoji) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	var texts []*ast.Text
 
-		// Get the entire text:
-		source := block.Source()
+	ast.Walk(doc, func(n ast.Node, enter bool) (ast.WalkStatus, error) {
+		// Raw text is the content of code spans.
+		if t, ok := n.(*ast.Text); ok && enter && !t.IsRaw() {
+			texts = append(texts, t)
+		}
+		return ast.WalkContinue, nil
+	})
 
-		// Try and delete all emoji matches:
-		source = emojiRegex.ReplaceAll(source, nil)
+	source := reader.Source()
+	for _, t := range texts {
+		splitEmojis(t, source, pc)
+	}
+}
 
-		// Trim spaces:
-		source = bytes.TrimSpace(source)
+// splitEmojis inserts the text before each emoji of the text node and the
+// emoji itself before the node, which keeps the text after the last emoji.
+func splitEmojis(t *ast.Text, source []byte, pc parser.Context) {
+	parent := t.Parent()
+	segment := t.Segment
+	start := segment.Start
+
+	for i := segment.Start; i < segment.Stop; {
+		n := unicodeEmojiLen(source[i:segment.Stop])
+		if n == 0 {
+			_, size := utf8.DecodeRune(source[i:segment.Stop])
+			i += size
+			continue
+		}
 
-		// Check if there are letters:
-		if len(source) == 0 {
-			// No, make our emojis big:
-			state.large = true
-			emoji.Large = true
+		if i > start {
+			parent.InsertBefore(parent, t, ast.NewTextSegment(text.NewSegment(start, i)))
 		}
+
+		parent.InsertBefore(parent, t, &Emoji{
+			Unicode: string(source[i : i+n]),
+			Large:   getEmojiState(pc).isLarge(source),
+		})
+
+		i += n
+		start = i
 	}
 
-	return emoji
+	if start == segment.Start {
+		return
+	}
+
+	// Keep empty text that still ends the line.
+	if start == segment.Stop && !t.SoftLineBreak() && !t.HardLineBreak() {
+		parent.RemoveChild(parent, t)
+		return
+	}
+
+	t.Segment = segment.WithStart(start)
 }
@@ -0,0 +1,56 @@
+package discordmd
+
+import (
+	"testing"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+func TestUnicodeEmoji(t *testing.T) {
+	type emoji struct {
+		Unicode string
+		Name    string
+		Large   bool
+	}
+
+	tests := []struct {
+		src  string
+		want []emoji
+	}{
+		{"hi 😀", []emoji{{Unicode: "😀"}}},
+		{"😀", []emoji{{Unicode: "😀", Large: true}}},
+		{" 👍🏽 🇯🇵\n❤️", []emoji{
+			{Unicode: "👍🏽", Large: true},
+			{Unicode: "🇯🇵", Large: true},
+			{Unicode: "❤️", Large: true},
+		}},
+		{"👨‍👩‍👧 <:pog:3>", []emoji{
+			{Unicode: "👨‍👩‍👧", Large: true},
+			{Name: "pog", Large: true},
+		}},
+		{"1️⃣ 2 ❤ ™", []emoji{{Unicode: "1️⃣"}}},
+		{"✓ ★ “quoted”", nil},
+	}
+
+	for _, test := range tests {
+		src := []byte(test.src)
+
+		var got []emoji
+		ast.Walk(Parse(src), func(n ast.Node, enter bool) (ast.WalkStatus, error) {
+			if e, ok := n.(*Emoji); ok && enter {
+				got = append(got, emoji{e.Unicode, e.Name, e.Large})
+			}
+			return ast.WalkContinue, nil
+		})
+
+		if len(got) != len(test.want) {
+			t.Errorf("%q: got emojis %+v, want %+v", test.src, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%q: got emoji %+v, want %+v", test.src, got[i], test.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,273 @@
+// Package html renders parsed Discord markdown into HTML for web frontends and
+// log exporters. All text is escaped and unsafe URLs are dropped, so the output
+// can be embedded into a page as-is.
+package html
+
+import (
+	"html"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/diamondburned/ningen/v3/discordmd"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+)
+
+// Renderer renders the nodes of package discordmd into HTML. Mentions are
+// rendered as spans with the mentioned IDs as data attributes, custom emojis
+// as images, Unicode emojis as spans and code blocks with a language class as
+// pre elements. Styling is left to the page; see the class names in the
+// output.
+type Renderer struct{}
+
+var DefaultRenderer renderer.Renderer = &Renderer{}
+
+func (r *Renderer) AddOptions(...renderer.Option) {}
+
+// Render renders the node into HTML.
+func (r *Renderer) Render(w io.Writer, source []byte, n ast.Node) error {
+	walker := &renderWalker{w: w, source: source}
+	return ast.Walk(n, func(node ast.Node, enter bool) (ast.WalkStatus, error) {
+		return walker.walk(node, enter), nil
+	})
+}
+
+// Render renders the node into HTML using the DefaultRenderer.
+func Render(w io.Writer, source []byte, n ast.Node) error {
+	return DefaultRenderer.Render(w, source, n)
+}
+
+// RenderString renders the node into an HTML string.
+func RenderString(source []byte, n ast.Node) string {
+	var b strings.Builder
+	Render(&b, source, n)
+	return b.String()
+}
+
+// inlineTags maps each attribute to its tag, in the order that they're
+// opened.
+var inlineTags = []struct {
+	attr  discordmd.Attribute
+	open  string
+	close string
+}{
+	{discordmd.AttrBold, "<strong>", "</strong>"},
+	{discordmd.AttrItalics, "<em>", "</em>"},
+	{discordmd.AttrUnderline, "<u>", "</u>"},
+	{discordmd.AttrStrikethrough, "<s>", "</s>"},
+	{discordmd.AttrSpoiler, `<span class="spoiler">`, "</span>"},
+	{discordmd.AttrMonospace, "<code>", "</code>"},
+}
+
+type renderWalker struct {
+	w      io.Writer
+	source []byte
+}
+
+func (r *renderWalker) write(str string) {
+	io.WriteString(r.w, str)
+}
+
+// text writes the escaped text from the source.
+func (r *renderWalker) text(b []byte) {
+	r.write(html.EscapeString(string(discordmd.Unescape(b))))
+}
+
+func (r *renderWalker) walk(n ast.Node, enter bool) ast.WalkStatus {
+	switch n := n.(type) {
+	case *ast.Document:
+		// noop
+	case *ast.Paragraph:
+		r.tag("p", enter)
+	case *ast.Blockquote:
+		r.tag("blockquote", enter)
+	case *ast.Heading:
+		r.tag("h"+strconv.Itoa(n.Level), enter)
+	case *ast.List:
+		switch {
+		case !n.IsOrdered():
+			r.tag("ul", enter)
+		case enter && n.Start != 1:
+			r.write(`<ol start="` + strconv.Itoa(n.Start) + `">`)
+		default:
+			r.tag("ol", enter)
+		}
+	case *ast.ListItem:
+		r.tag("li", enter)
+	case *ast.FencedCodeBlock:
+		if enter {
+			r.codeBlock(n)
+		}
+		return ast.WalkSkipChildren
+	case *discordmd.Inline:
+		r.inline(n.Attr, enter)
+	case *ast.Link:
+		r.link(n, discordmd.SuspiciousLink(n), enter)
+	case *ast.AutoLink:
+		if enter {
+			url := n.URL(r.source)
+			if discordmd.SafeURL(string(url)) {
+				r.write(`<a href="` + html.EscapeString(string(url)) + `" rel="noopener noreferrer nofollow">`)
+				r.text(url)
+				r.write("</a>")
+			} else {
+				r.text(url)
+			}
+		}
+	case *discordmd.Emoji:
+		if enter {
+			r.emoji(n)
+		}
+	case *discordmd.Mention:
+		if enter {
+			r.mention(n)
+		}
+	case *discordmd.Timestamp:
+		if enter {
+			r.write(`<time datetime="` + n.Time.UTC().Format(time.RFC3339) + `"`)
+			r.write(` data-style="` + html.EscapeString(string(n.Style)) + `">`)
+			r.write(html.EscapeString(n.String()))
+			r.write("</time>")
+		}
+	case *ast.String:
+		if enter {
+			r.text(n.Value)
+		}
+	case *ast.Text:
+		if enter {
+			r.text(n.Segment.Value(r.source))
+			if n.HardLineBreak() || n.SoftLineBreak() {
+				r.write("<br>\n")
+			}
+		}
+	}
+
+	return ast.WalkContinue
+}
+
+func (r *renderWalker) tag(name string, enter bool) {
+	if enter {
+		r.write("<" + name + ">")
+	} else {
+		r.write("</" + name + ">")
+	}
+}
+
+func (r *renderWalker) inline(attr discordmd.Attribute, enter bool) {
+	if enter {
+		for _, tag := range inlineTags {
+			if attr.Has(tag.attr) {
+				r.write(tag.open)
+			}
+		}
+		return
+	}
+
+	for i := len(inlineTags) - 1; i >= 0; i-- {
+		if attr.Has(inlineTags[i].attr) {
+			r.write(inlineTags[i].close)
+		}
+	}
+}
+
+func (r *renderWalker) codeBlock(n *ast.FencedCodeBlock) {
+	r.write("<pre><code")
+	if lang := codeLanguage(n.Language(r.source)); lang != "" {
+		r.write(` class="language-` + lang + `"`)
+	}
+	r.write(">")
+
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		r.text(line.Value(r.source))
+	}
+
+	r.write("</code></pre>")
+}
+
+// codeLanguage returns the language if it's safe to use in a class name, or
+// an empty string otherwise.
+func codeLanguage(lang []byte) string {
+	for _, c := range lang {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '-', c == '_', c == '+', c == '#':
+		default:
+			return ""
+		}
+	}
+	return string(lang)
+}
+
+// link writes the opening or closing tag of the link. Unsafe links are left
+// out, so that only their text is rendered.
+func (r *renderWalker) link(n *ast.Link, suspicious, enter bool) {
+	if !discordmd.SafeURL(string(n.Destination)) {
+		return
+	}
+
+	if !enter {
+		r.write("</a>")
+		return
+	}
+
+	r.write(`<a href="` + html.EscapeString(string(n.Destination)) + `"`)
+	if suspicious {
+		r.write(` class="suspicious"`)
+	}
+	if len(n.Title) > 0 {
+		r.write(` title="` + html.EscapeString(string(n.Title)) + `"`)
+	}
+	r.write(` rel="noopener noreferrer nofollow">`)
+}
+
+func (r *renderWalker) emoji(n *discordmd.Emoji) {
+	size := discordmd.InlineEmojiSize
+	class := "emoji"
+	if n.Large {
+		size = discordmd.LargeEmojiSize
+		class = "emoji large"
+	}
+
+	if n.Unicode != "" {
+		r.write(`<span class="` + class + `">` + html.EscapeString(n.Unicode) + `</span>`)
+		return
+	}
+
+	name := html.EscapeString(":" + n.Name + ":")
+	sizeStr := strconv.Itoa(size)
+
+	r.write(`<img class="` + class + `" src="` + html.EscapeString(n.EmojiURL()) + `"`)
+	r.write(` alt="` + name + `" title="` + name + `"`)
+	r.write(` width="` + sizeStr + `" height="` + sizeStr + `">`)
+}
+
+func (r *renderWalker) mention(n *discordmd.Mention) {
+	class := "mention"
+	if n.Mentioned {
+		class += " mentioned"
+	}
+
+	var attr, id, name string
+
+	switch {
+	case n.Channel != nil:
+		attr, id, name = "data-channel-id", n.Channel.ID.String(), "#"+n.Channel.Name
+	case n.GuildUser != nil:
+		attr, id, name = "data-user-id", n.GuildUser.ID.String(), "@"+n.GuildUser.Username
+		if n.GuildUser.Member != nil && n.GuildUser.Member.Nick != "" {
+			name = "@" + n.GuildUser.Member.Nick
+		}
+	case n.GuildRole != nil:
+		attr, id, name = "data-role-id", n.GuildRole.ID.String(), "@"+n.GuildRole.Name
+	default:
+		return
+	}
+
+	r.write(`<span class="` + class + `" ` + attr + `="` + id + `">`)
+	r.write(html.EscapeString(name))
+	r.write("</span>")
+}
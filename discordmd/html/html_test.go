@@ -0,0 +1,93 @@
+package html
+
+import (
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/state/store/defaultstore"
+	"github.com/diamondburned/ningen/v3/discordmd"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "inline",
+			src:  "**bold** ||<b>spoiler</b>|| *it*",
+			want: `<p><strong>bold</strong> <span class="spoiler">&lt;b&gt;spoiler&lt;/b&gt;</span> <em>it</em></p>`,
+		},
+		{
+			name: "code block",
+			src:  "```go\nif a < b {}\n```",
+			want: `<pre><code class="language-go">if a &lt; b {}` + "\n" + `</code></pre>`,
+		},
+		{
+			name: "code block with bad language",
+			src:  "```\"onclick=x\nhi\n```",
+			want: "<pre><code>hi\n</code></pre>",
+		},
+		{
+			name: "mentions",
+			src:  "hi <@1> in <#2>",
+			want: `<p>hi <span class="mention mentioned" data-user-id="1">@bob</span> in <span class="mention" data-channel-id="2">#general</span></p>`,
+		},
+		{
+			name: "emoji",
+			src:  "a <:pog:3>",
+			want: `<p>a <img class="emoji" src="https://cdn.discordapp.com/emojis/3.png?v=1" alt=":pog:" title=":pog:" width="22" height="22"></p>`,
+		},
+		{
+			name: "unicode emoji",
+			src:  "🎉",
+			want: `<p><span class="emoji large">🎉</span></p>`,
+		},
+		{
+			name: "autolink",
+			src:  "see https://example.com/?a=1&b=2",
+			want: `<p>see <a href="https://example.com/?a=1&amp;b=2" rel="noopener noreferrer nofollow">https://example.com/?a=1&amp;b=2</a></p>`,
+		},
+	}
+
+	cab := defaultstore.New()
+	cab.ChannelSet(&discord.Channel{ID: 2, Name: "general"}, false)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg := &discord.Message{
+				ChannelID: 2,
+				Content:   test.src,
+				Mentions:  []discord.GuildUser{{User: discord.User{ID: 1, Username: "bob"}}},
+			}
+
+			src := []byte(test.src)
+			node := discordmd.ParseWithMessage(src, *cab, msg, true)
+
+			if got := RenderString(src, node); got != test.want {
+				t.Errorf("got  %q\nwant %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRenderSuspiciousLink(t *testing.T) {
+	src := []byte("[discord.com](https://example.com)")
+	node := discordmd.ParseWithMessage(src, *defaultstore.New(), &discord.Message{}, false)
+
+	want := `<p><a href="https://example.com" class="suspicious" rel="noopener noreferrer nofollow">discord.com</a></p>`
+	if got := RenderString(src, node); got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestRenderUnsafeLink(t *testing.T) {
+	src := []byte("[click](javascript:alert(1)) [ok](https://example.com)")
+	node := discordmd.ParseWithMessage(src, *defaultstore.New(), &discord.Message{}, false)
+
+	want := `<p>click <a href="https://example.com" rel="noopener noreferrer nofollow">ok</a></p>`
+	if got := RenderString(src, node); got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
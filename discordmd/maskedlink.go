@@ -0,0 +1,124 @@
+package discordmd
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// UserMaskedLinks, when true, makes ParseWithMessage parse masked links in the
+// messages of users. By default, only the messages of bots and webhooks have
+// masked links, like embeds.
+var UserMaskedLinks = false
+
+// maskedLinksAllowed returns true if masked links are parsed in the message.
+func maskedLinksAllowed(m *discord.Message) bool {
+	if UserMaskedLinks {
+		return true
+	}
+	return m != nil && (m.Author.Bot || m.WebhookID.IsValid())
+}
+
+// suspiciousAttr is the name of the attribute that marks suspicious links.
+var suspiciousAttr = []byte("suspicious")
+
+// SuspiciousLink returns true if the text of the link looks like a URL or a
+// domain other than its destination, such as [discord.com](https://example.com),
+// which is a common way of phishing. Clients should warn before opening such
+// links.
+func SuspiciousLink(n *ast.Link) bool {
+	v, ok := n.Attribute(suspiciousAttr)
+	if !ok {
+		return false
+	}
+	suspicious, _ := v.(bool)
+	return suspicious
+}
+
+// maskedLinks marks the links parsed by goldmark, which are all masked links,
+// as suspicious if their text doesn't match their destination.
+type maskedLinks struct{}
+
+func (maskedLinks) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+
+	ast.Walk(doc, func(n ast.Node, enter bool) (ast.WalkStatus, error) {
+		link, ok := n.(*ast.Link)
+		if ok && enter && suspiciousLink(string(link.Text(source)), string(link.Destination)) {
+			link.SetAttribute(suspiciousAttr, true)
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// suspiciousLink returns true if the text of a link looks like a URL or a
+// domain that isn't the destination's.
+func suspiciousLink(label, dest string) bool {
+	textHost := linkTextHost(label)
+	if textHost == "" {
+		return false
+	}
+
+	u, err := url.Parse(dest)
+	if err != nil || u.Hostname() == "" {
+		return true
+	}
+
+	host := trimWWW(strings.ToLower(u.Hostname()))
+
+	// Subdomains of the text's domain are fine.
+	return host != textHost && !strings.HasSuffix(host, "."+textHost)
+}
+
+// linkTextHost returns the host of the link text if it looks like a URL or a
+// domain, or an empty string otherwise.
+func linkTextHost(label string) string {
+	label = strings.TrimSpace(label)
+	if label == "" || strings.ContainsAny(label, " \t\n") {
+		return ""
+	}
+
+	if !strings.Contains(label, "://") {
+		label = "https://" + label
+	}
+
+	u, err := url.Parse(label)
+	if err != nil {
+		return ""
+	}
+
+	// Hosts without a top-level domain, such as "hello" from [hello](...)
+	// or "1.5" from [v1.5](...), aren't domains.
+	host := trimWWW(strings.ToLower(u.Hostname()))
+
+	dot := strings.LastIndexByte(host, '.')
+	if dot == -1 || !isTLD(host[dot+1:]) {
+		return ""
+	}
+
+	return host
+}
+
+// isTLD returns true if s can be a top-level domain.
+func isTLD(s string) bool {
+	if strings.HasPrefix(s, "xn--") {
+		return true
+	}
+	if len(s) < 2 {
+		return false
+	}
+	for _, r := range s {
+		if r < 'a' || r > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+func trimWWW(host string) string {
+	return strings.TrimPrefix(strings.TrimSuffix(host, "."), "www.")
+}
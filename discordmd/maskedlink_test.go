@@ -0,0 +1,69 @@
+package discordmd
+
+import (
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/state/store"
+	"github.com/yuin/goldmark/ast"
+)
+
+func TestSuspiciousLink(t *testing.T) {
+	tests := []struct {
+		label, dest string
+		want        bool
+	}{
+		{"click here", "https://example.com", false},
+		{"v1.5", "https://example.com", false},
+		{"example.com", "https://example.com/page", false},
+		{"https://www.example.com", "https://example.com", false},
+		{"example.com", "https://docs.example.com", false},
+		{"discord.com", "https://example.com", true},
+		{"https://discord.com/nitro", "https://discord.gift.example.com", true},
+		{"example.com", "https://notexample.com", true},
+	}
+
+	for _, test := range tests {
+		if got := suspiciousLink(test.label, test.dest); got != test.want {
+			t.Errorf("[%s](%s): got %v, want %v", test.label, test.dest, got, test.want)
+		}
+	}
+}
+
+func TestMaskedLinkTrust(t *testing.T) {
+	src := []byte("[discord.com](https://example.com)")
+
+	links := func(m *discord.Message) []*ast.Link {
+		var links []*ast.Link
+		ast.Walk(ParseWithMessage(src, store.Cabinet{}, m, true), func(n ast.Node, enter bool) (ast.WalkStatus, error) {
+			if link, ok := n.(*ast.Link); ok && enter {
+				links = append(links, link)
+			}
+			return ast.WalkContinue, nil
+		})
+		return links
+	}
+
+	if l := links(&discord.Message{}); len(l) != 0 {
+		t.Error("parsed a masked link in a user's message")
+	}
+
+	l := links(&discord.Message{Author: discord.User{Bot: true}})
+	if len(l) != 1 {
+		t.Fatal("didn't parse a masked link in a bot's message")
+	}
+	if label := string(l[0].Text(src)); label != "discord.com" || !SuspiciousLink(l[0]) {
+		t.Errorf("got label %q, suspicious %v", label, SuspiciousLink(l[0]))
+	}
+
+	if l := links(&discord.Message{WebhookID: 1}); len(l) != 1 {
+		t.Error("didn't parse a masked link in a webhook's message")
+	}
+
+	UserMaskedLinks = true
+	defer func() { UserMaskedLinks = false }()
+
+	if l := links(&discord.Message{}); len(l) != 1 {
+		t.Error("didn't parse a masked link in a user's message with UserMaskedLinks")
+	}
+}
@@ -1,14 +1,13 @@
 package discordmd
 
 import (
-	"log"
+	"sync"
 
 	"github.com/diamondburned/arikawa/v3/discord"
 	"github.com/diamondburned/arikawa/v3/state/store"
 	"github.com/yuin/goldmark/ast"
 	"github.com/yuin/goldmark/parser"
 	"github.com/yuin/goldmark/text"
-	"github.com/yuin/goldmark/util"
 )
 
 var (
@@ -16,42 +15,55 @@ var (
 	sessionCtx = parser.NewContextKey()
 )
 
+// The parsers are stateless, so they are only created once and shared. Any
+// per-parse state is kept in the parser.Context.
+var (
+	parserOnce   sync.Once
+	msgParser    parser.Parser // without links
+	nonMsgParser parser.Parser // with links
+)
+
+func initParsers() {
+	parserOnce.Do(func() {
+		msgParser = parser.NewParser(
+			parser.WithBlockParsers(BlockParsers()...),
+			parser.WithInlineParsers(InlineParsers()...),
+			parser.WithASTTransformers(ASTTransformers()...),
+		)
+		nonMsgParser = parser.NewParser(
+			parser.WithBlockParsers(BlockParsers()...),
+			parser.WithInlineParsers(InlineParserWithLink()...),
+			parser.WithASTTransformers(ASTTransformers()...),
+		)
+	})
+}
+
 // ParseWithMessage parses the given byte slice with the Discord state and the
 // Message as source for the ast nodes. If msg is false, then links will also be
 // parsed (accordingly to embeds and webhooks, normal messages don't have
-// links).
+// links). Links are also parsed in the messages of bots and webhooks, or in
+// every message if UserMaskedLinks is true.
 func ParseWithMessage(b []byte, s store.Cabinet, m *discord.Message, msg bool) ast.Node {
+	initParsers()
+
 	// Context to pass down messages:
 	ctx := parser.NewContext()
 	ctx.Set(messageCtx, m)
 	ctx.Set(sessionCtx, &s)
 
-	var inlineParsers []util.PrioritizedValue
-	if msg {
-		inlineParsers = InlineParsers()
-	} else {
-		inlineParsers = InlineParserWithLink()
+	p := msgParser
+	if !msg || maskedLinksAllowed(m) {
+		p = nonMsgParser
 	}
 
-	p := parser.NewParser(
-		parser.WithBlockParsers(BlockParsers()...),
-		parser.WithInlineParsers(inlineParsers...),
-	)
-
-	log.Printf("Parsing content: %q", string(b))
-
 	return p.Parse(text.NewReader(b), parser.WithContext(ctx))
 }
 
 // Parse parses the given byte slice with extra options. It does not parse
 // links.
 func Parse(content []byte, opts ...parser.ParseOption) ast.Node {
-	p := parser.NewParser(
-		parser.WithBlockParsers(BlockParsers()...),
-		parser.WithInlineParsers(InlineParsers()...),
-	)
-
-	return p.Parse(text.NewReader(content), opts...)
+	initParsers()
+	return msgParser.Parse(text.NewReader(content), opts...)
 }
 
 func getMessage(pc parser.Context) *discord.Message {
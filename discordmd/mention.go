@@ -19,6 +19,36 @@ type Mention struct {
 	Channel   *discord.Channel
 	GuildUser *discord.GuildUser
 	GuildRole *discord.Role // might not have anything else but ID
+	// RoleIcon is the icon of GuildRole. It is nil if the role has no icon.
+	RoleIcon *RoleIcon
+}
+
+// RoleIcon describes the icon drawn next to a role. Only one of URL and Emoji
+// is set.
+type RoleIcon struct {
+	// URL is the URL to the uploaded icon image.
+	URL string
+	// Emoji is the Unicode emoji used as the icon.
+	Emoji string
+}
+
+// RoleIconURL returns the URL to the role icon with the given hash.
+func RoleIconURL(roleID discord.RoleID, hash discord.Hash) string {
+	return "https://cdn.discordapp.com/role-icons/" + roleID.String() + "/" + hash + ".png"
+}
+
+// RoleIconOf returns the icon of the given role, or nil if the role has none.
+// Uploaded icons take precedence over Unicode emojis, like in the official
+// client.
+func RoleIconOf(role *discord.Role) *RoleIcon {
+	switch {
+	case role.Icon != "":
+		return &RoleIcon{URL: RoleIconURL(role.ID, role.Icon)}
+	case role.UnicodeEmoji != "":
+		return &RoleIcon{Emoji: role.UnicodeEmoji}
+	default:
+		return nil
+	}
 }
 
 var KindMention = ast.NewNodeKind("Mention")
@@ -144,6 +174,7 @@ func (mention) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.
 			Message:    msg,
 			Mentioned:  mentioned,
 			GuildRole:  r,
+			RoleIcon:   RoleIconOf(r),
 		}
 	}
 
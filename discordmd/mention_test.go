@@ -0,0 +1,48 @@
+package discordmd
+
+import (
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/state/store/defaultstore"
+	"github.com/yuin/goldmark/ast"
+)
+
+func TestRoleMentionIcon(t *testing.T) {
+	const guildID = 1
+
+	cab := defaultstore.New()
+	cab.RoleSet(guildID, &discord.Role{ID: 2, Name: "uploaded", Icon: "abc"}, false)
+	cab.RoleSet(guildID, &discord.Role{ID: 3, Name: "emoji", UnicodeEmoji: "🌟"}, false)
+	cab.RoleSet(guildID, &discord.Role{ID: 4, Name: "plain"}, false)
+
+	src := []byte("<@&2> <@&3> <@&4>")
+	msg := &discord.Message{GuildID: guildID, Content: string(src)}
+
+	var icons []*RoleIcon
+	ast.Walk(ParseWithMessage(src, *cab, msg, true), func(n ast.Node, enter bool) (ast.WalkStatus, error) {
+		if m, ok := n.(*Mention); ok && enter {
+			icons = append(icons, m.RoleIcon)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	want := []*RoleIcon{
+		{URL: "https://cdn.discordapp.com/role-icons/2/abc.png"},
+		{Emoji: "🌟"},
+		nil,
+	}
+
+	if len(icons) != len(want) {
+		t.Fatalf("got %d role mentions, want %d", len(icons), len(want))
+	}
+
+	for i := range want {
+		switch {
+		case want[i] == nil && icons[i] != nil:
+			t.Errorf("mention %d: got icon %+v, want none", i, *icons[i])
+		case want[i] != nil && (icons[i] == nil || *icons[i] != *want[i]):
+			t.Errorf("mention %d: got icon %v, want %+v", i, icons[i], *want[i])
+		}
+	}
+}
@@ -25,15 +25,25 @@ func BlockParsers() []util.PrioritizedValue {
 // InlineParsers returns a list of inline parsers.
 func InlineParsers() []util.PrioritizedValue {
 	return []util.PrioritizedValue{
-		util.Prioritized(&emoji{}, 200), // (*emoji).Parse()
+		util.Prioritized(emoji{}, 200),
 		util.Prioritized(inlineCodeSpan{}, 300),
 		// util.Prioritized(parser.NewCodeSpanParser(), 300),
 		util.Prioritized(inline{}, 350),
 		util.Prioritized(mention{}, 400),
+		util.Prioritized(timestamp{}, 450),
 		util.Prioritized(autolink{}, 500),
 	}
 }
 
+// ASTTransformers returns a list of AST transformers, which mark suspicious
+// links and turn Unicode emojis into Emoji nodes.
+func ASTTransformers() []util.PrioritizedValue {
+	return []util.PrioritizedValue{
+		util.Prioritized(maskedLinks{}, 50),
+		util.Prioritized(unicodeEmoji{}, 100),
+	}
+}
+
 // InlineParserWithLink returns a list of inline parsers, including the link
 // parser.
 func InlineParserWithLink() []util.PrioritizedValue {
@@ -42,10 +42,24 @@ var DefaultRenderer renderer.Renderer = &BasicRenderer{}
 func (r *BasicRenderer) AddOptions(...renderer.Option) {}
 
 func (r *BasicRenderer) Render(w io.Writer, source []byte, n ast.Node) error {
+	return r.RenderWithAttrs(w, source, n, nil)
+}
+
+// RenderWithAttrs renders like Render, except that the text from the source is
+// given to fn along with the attributes that apply to it instead of being
+// written to w. Only the text that the renderer adds, such as list bullets,
+// blockquote markers and newlines, is written to w. This lets renderers map
+// the attributes to their own markup without rewriting the walker. The text
+// is already unescaped.
+//
+// If fn is nil, the text is written to w as-is.
+func (r *BasicRenderer) RenderWithAttrs(
+	w io.Writer, source []byte, n ast.Node, fn func(attrs Attribute, text []byte)) error {
+
 	// Wrap the current writer behind an unescaper.
 	w = UnescapeWriter(w)
 
-	walker := &basicRenderWalker{}
+	walker := &basicRenderWalker{textFn: fn}
 	return ast.Walk(n, func(node ast.Node, enter bool) (ast.WalkStatus, error) {
 		return walker.walk(w, source, node, enter), nil
 	})
@@ -54,6 +68,41 @@ func (r *BasicRenderer) Render(w io.Writer, source []byte, n ast.Node) error {
 type basicRenderWalker struct {
 	listIx     *int
 	listNested int
+
+	textFn func(Attribute, []byte)
+	// attrs is the stack of attributes. Each element has all of the
+	// attributes of the elements before it.
+	attrs []Attribute
+}
+
+func (r *basicRenderWalker) attr() Attribute {
+	if len(r.attrs) == 0 {
+		return 0
+	}
+	return r.attrs[len(r.attrs)-1]
+}
+
+func (r *basicRenderWalker) pushAttr(attr Attribute) {
+	r.attrs = append(r.attrs, r.attr()|attr)
+}
+
+func (r *basicRenderWalker) popAttr() {
+	if len(r.attrs) > 0 {
+		r.attrs = r.attrs[:len(r.attrs)-1]
+	}
+}
+
+// text writes the text from the source.
+func (r *basicRenderWalker) text(w io.Writer, b []byte) {
+	if r.textFn != nil {
+		r.textFn(r.attr(), Unescape(b))
+	} else {
+		w.Write(b)
+	}
+}
+
+func (r *basicRenderWalker) textString(w io.Writer, str string) {
+	r.text(w, []byte(str))
 }
 
 func (r *basicRenderWalker) walk(w io.Writer, source []byte, n ast.Node, enter bool) ast.WalkStatus {
@@ -62,18 +111,21 @@ func (r *basicRenderWalker) walk(w io.Writer, source []byte, n ast.Node, enter b
 		// noop
 	case *ast.Blockquote:
 		if enter {
+			r.pushAttr(AttrQuoted)
 			// A blockquote contains a paragraph each line. Because Discord.
 			for child := n.FirstChild(); child != nil; child = child.NextSibling() {
 				io.WriteString(w, "> ")
 				ast.Walk(child, func(node ast.Node, enter bool) (ast.WalkStatus, error) {
 					// We only call when entering, since we don't want to trigger a
-					// hard new line after each paragraph.
-					if enter {
+					// hard new line after each paragraph. Inlines are still
+					// exited to pop their attributes.
+					if _, ok := node.(*Inline); enter || ok {
 						return r.walk(w, source, node, enter), nil
 					}
 					return ast.WalkContinue, nil
 				})
 			}
+			r.popAttr()
 		}
 		// We've already walked over children ourselves.
 		return ast.WalkSkipChildren
@@ -86,37 +138,56 @@ func (r *basicRenderWalker) walk(w io.Writer, source []byte, n ast.Node, enter b
 		io.WriteString(w, "\n")
 		if enter {
 			// Write the body
+			r.pushAttr(AttrMonospace)
 			for i := 0; i < n.Lines().Len(); i++ {
 				line := n.Lines().At(i)
-				io.WriteString(w, "| "+string(line.Value(source)))
+				io.WriteString(w, "| ")
+				r.text(w, line.Value(source))
 			}
+			r.popAttr()
 		}
 	case *ast.Link:
 		if enter {
-			io.WriteString(w, string(n.Title)+" ("+string(n.Destination)+")")
+			r.text(w, n.Title)
+			io.WriteString(w, " (")
+			r.text(w, n.Destination)
+			io.WriteString(w, ")")
 		}
 	case *ast.AutoLink:
 		if enter {
-			io.WriteString(w, string(n.URL(source)))
+			r.text(w, n.URL(source))
 		}
 	case *Inline:
-		// n.Attr should be used, but since we're in plaintext mode, there is no
-		// formatting.
+		// Plain text has no formatting, but the attributes are given to
+		// RenderWithAttrs' callback.
+		if enter {
+			r.pushAttr(n.Attr)
+		} else {
+			r.popAttr()
+		}
 	case *Emoji:
 		if enter {
-			io.WriteString(w, ":"+string(n.Name)+":")
+			if n.Unicode != "" {
+				r.textString(w, n.Unicode)
+			} else {
+				r.textString(w, ":"+n.Name+":")
+			}
 		}
 	case *Mention:
 		if enter {
 			switch {
 			case n.Channel != nil:
-				io.WriteString(w, "#"+n.Channel.Name)
+				r.textString(w, "#"+n.Channel.Name)
 			case n.GuildUser != nil:
-				io.WriteString(w, "@"+n.GuildUser.Username)
+				r.textString(w, "@"+n.GuildUser.Username)
 			case n.GuildRole != nil:
-				io.WriteString(w, "@"+n.GuildRole.Name)
+				r.textString(w, "@"+n.GuildRole.Name)
 			}
 		}
+	case *Timestamp:
+		if enter {
+			r.textString(w, n.String())
+		}
 	case *ast.Heading:
 		io.WriteString(w, "\n")
 		indent := strings.Repeat("  ", n.Level-1)
@@ -160,11 +231,11 @@ func (r *basicRenderWalker) walk(w io.Writer, source []byte, n ast.Node, enter b
 		}
 	case *ast.String:
 		if enter {
-			w.Write(n.Value)
+			r.text(w, n.Value)
 		}
 	case *ast.Text:
 		if enter {
-			w.Write(n.Segment.Value(source))
+			r.text(w, n.Segment.Value(source))
 			switch {
 			case n.HardLineBreak():
 				io.WriteString(w, "\n\n")
@@ -31,3 +31,48 @@ func TestRenderer(t *testing.T) {
 		t.Error(diff)
 	}
 }
+
+func TestRenderWithAttrs(t *testing.T) {
+	type chunk struct {
+		attrs Attribute
+		text  string
+	}
+
+	src := []byte("**bold ||spoiler||** `code` plain\n> ~~quoted~~")
+
+	var chunks []chunk
+	var out strings.Builder
+
+	err := DefaultRenderer.(*BasicRenderer).RenderWithAttrs(&out, src, Parse(src),
+		func(attrs Attribute, text []byte) {
+			chunks = append(chunks, chunk{attrs, string(text)})
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []chunk{
+		{AttrBold, "bold "},
+		{AttrBold | AttrSpoiler, "spoiler"},
+		{0, " "},
+		{AttrMonospace, "code"},
+		{0, " plain"},
+		{AttrQuoted | AttrStrikethrough, "quoted"},
+	}
+
+	if len(chunks) != len(want) {
+		t.Fatalf("got chunks %+v, want %+v", chunks, want)
+	}
+
+	for i := range want {
+		if chunks[i] != want[i] {
+			t.Errorf("chunk %d: got %+v, want %+v", i, chunks[i], want[i])
+		}
+	}
+
+	// Only the renderer's own text is written.
+	if got := out.String(); got != "\n> " {
+		t.Errorf("got written text %q", got)
+	}
+}
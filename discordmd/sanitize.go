@@ -0,0 +1,289 @@
+package discordmd
+
+import (
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/yuin/goldmark/ast"
+)
+
+// Embed limits enforced by Discord. Embeds received from the gateway should
+// already be within them, but embeds are user-provided data, so renderers
+// shouldn't rely on that.
+const (
+	MaxEmbedTitle       = 256
+	MaxEmbedDescription = 4096
+	MaxEmbedFields      = 25
+	MaxEmbedFieldName   = 256
+	MaxEmbedFieldValue  = 1024
+	MaxEmbedFooter      = 2048
+	MaxEmbedAuthorName  = 256
+	MaxButtonLabel      = 80
+)
+
+// WarningKind is the kind of a sanitization warning.
+type WarningKind uint8
+
+const (
+	// UnsafeURL is when a URL has a scheme other than http or https, or can't
+	// be parsed. The URL is removed.
+	UnsafeURL WarningKind = iota
+	// Truncated is when a string is over its limit. The string is truncated.
+	Truncated
+	// TooManyFields is when an embed has more fields than MaxEmbedFields. The
+	// extra fields are removed.
+	TooManyFields
+	// InvalidUTF8 is when a string isn't valid UTF-8. The invalid bytes are
+	// replaced with the replacement character.
+	InvalidUTF8
+)
+
+// String returns the kind in words.
+func (k WarningKind) String() string {
+	switch k {
+	case UnsafeURL:
+		return "unsafe URL"
+	case Truncated:
+		return "truncated"
+	case TooManyFields:
+		return "too many fields"
+	case InvalidUTF8:
+		return "invalid UTF-8"
+	default:
+		return "unknown"
+	}
+}
+
+// Warning describes something that a sanitizer changed.
+type Warning struct {
+	Kind WarningKind
+	// Field is the path of the changed field, such as "author.url" or
+	// "fields[2].value".
+	Field string
+}
+
+// String formats the warning.
+func (w Warning) String() string {
+	return w.Field + ": " + w.Kind.String()
+}
+
+// SafeURL returns true if the URL can be safely opened or embedded, that is,
+// if it is an absolute http or https URL. Schemes such as javascript, data and
+// file are rejected.
+func SafeURL(u string) bool {
+	if u == "" {
+		return false
+	}
+
+	for _, r := range u {
+		if r < ' ' || r == 0x7F {
+			return false
+		}
+	}
+
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https":
+		return true
+	default:
+		return false
+	}
+}
+
+type sanitizer struct {
+	warnings []Warning
+}
+
+func (s *sanitizer) warn(kind WarningKind, field string) {
+	s.warnings = append(s.warnings, Warning{kind, field})
+}
+
+func (s *sanitizer) url(u *discord.URL, field string) {
+	if *u != "" && !SafeURL(*u) {
+		*u = ""
+		s.warn(UnsafeURL, field)
+	}
+}
+
+func (s *sanitizer) text(str *string, max int, field string) {
+	if !utf8.ValidString(*str) {
+		*str = strings.ToValidUTF8(*str, "�")
+		s.warn(InvalidUTF8, field)
+	}
+
+	if max > 0 && utf8.RuneCountInString(*str) > max {
+		*str = string([]rune(*str)[:max])
+		s.warn(Truncated, field)
+	}
+}
+
+// SanitizeEmbed returns a copy of the embed with its unsafe URLs removed and
+// its strings clamped to Discord's limits, as well as warnings describing what
+// was changed. The markdown in the embed is left as-is; use SanitizeLinks on
+// the parsed markdown.
+func SanitizeEmbed(embed discord.Embed) (discord.Embed, []Warning) {
+	var s sanitizer
+
+	s.text(&embed.Title, MaxEmbedTitle, "title")
+	s.text(&embed.Description, MaxEmbedDescription, "description")
+	s.url(&embed.URL, "url")
+
+	if embed.Footer != nil {
+		footer := *embed.Footer
+		s.text(&footer.Text, MaxEmbedFooter, "footer.text")
+		s.url(&footer.Icon, "footer.icon_url")
+		s.url(&footer.ProxyIcon, "footer.proxy_icon_url")
+		embed.Footer = &footer
+	}
+
+	if embed.Image != nil {
+		image := *embed.Image
+		s.url(&image.URL, "image.url")
+		s.url(&image.Proxy, "image.proxy_url")
+		embed.Image = &image
+	}
+
+	if embed.Thumbnail != nil {
+		thumbnail := *embed.Thumbnail
+		s.url(&thumbnail.URL, "thumbnail.url")
+		s.url(&thumbnail.Proxy, "thumbnail.proxy_url")
+		embed.Thumbnail = &thumbnail
+	}
+
+	if embed.Video != nil {
+		video := *embed.Video
+		s.url(&video.URL, "video.url")
+		s.url(&video.Proxy, "video.proxy_url")
+		embed.Video = &video
+	}
+
+	if embed.Provider != nil {
+		provider := *embed.Provider
+		s.text(&provider.Name, MaxEmbedAuthorName, "provider.name")
+		s.url(&provider.URL, "provider.url")
+		embed.Provider = &provider
+	}
+
+	if embed.Author != nil {
+		author := *embed.Author
+		s.text(&author.Name, MaxEmbedAuthorName, "author.name")
+		s.url(&author.URL, "author.url")
+		s.url(&author.Icon, "author.icon_url")
+		s.url(&author.ProxyIcon, "author.proxy_icon_url")
+		embed.Author = &author
+	}
+
+	if len(embed.Fields) > MaxEmbedFields {
+		embed.Fields = embed.Fields[:MaxEmbedFields]
+		s.warn(TooManyFields, "fields")
+	}
+
+	if embed.Fields != nil {
+		embed.Fields = append([]discord.EmbedField(nil), embed.Fields...)
+		for i := range embed.Fields {
+			field := "fields[" + strconv.Itoa(i) + "]"
+			s.text(&embed.Fields[i].Name, MaxEmbedFieldName, field+".name")
+			s.text(&embed.Fields[i].Value, MaxEmbedFieldValue, field+".value")
+		}
+	}
+
+	return embed, s.warnings
+}
+
+// SanitizeComponents returns a copy of the components with their button labels
+// clamped. Link buttons with an unsafe URL are turned into disabled buttons.
+func SanitizeComponents(components discord.ContainerComponents) (discord.ContainerComponents, []Warning) {
+	var s sanitizer
+
+	sanitized := make(discord.ContainerComponents, len(components))
+
+	for i, container := range components {
+		row, ok := container.(*discord.ActionRowComponent)
+		if !ok {
+			sanitized[i] = container
+			continue
+		}
+
+		newRow := make(discord.ActionRowComponent, len(*row))
+
+		for j, component := range *row {
+			button, ok := component.(*discord.ButtonComponent)
+			if !ok {
+				newRow[j] = component
+				continue
+			}
+
+			field := "components[" + strconv.Itoa(i) + "][" + strconv.Itoa(j) + "]"
+			b := *button
+
+			s.text(&b.Label, MaxButtonLabel, field+".label")
+
+			if u, ok := LinkButtonURL(&b); ok && !SafeURL(u) {
+				b.Style = discord.SecondaryButtonStyle()
+				b.Disabled = true
+				s.warn(UnsafeURL, field+".url")
+			}
+
+			newRow[j] = &b
+		}
+
+		sanitized[i] = &newRow
+	}
+
+	return sanitized, s.warnings
+}
+
+// LinkButtonURL returns the URL of the link button. False is returned if the
+// button isn't a link button.
+func LinkButtonURL(b *discord.ButtonComponent) (discord.URL, bool) {
+	if b.Style == nil {
+		return "", false
+	}
+
+	// arikawa doesn't export the link style's type, but it is the only style
+	// that is a string.
+	v := reflect.ValueOf(b.Style)
+	if v.Kind() != reflect.String {
+		return "", false
+	}
+
+	return v.String(), true
+}
+
+// SanitizeLinks removes the destinations of the links and images in the parsed
+// markdown that aren't safe according to SafeURL. Links without a destination
+// should be rendered as plain text.
+func SanitizeLinks(n ast.Node) []Warning {
+	var s sanitizer
+
+	ast.Walk(n, func(n ast.Node, enter bool) (ast.WalkStatus, error) {
+		if !enter {
+			return ast.WalkContinue, nil
+		}
+
+		switch n := n.(type) {
+		case *ast.Link:
+			if len(n.Destination) > 0 && !SafeURL(string(n.Destination)) {
+				n.Destination = nil
+				s.warn(UnsafeURL, "link")
+			}
+		case *ast.Image:
+			if len(n.Destination) > 0 && !SafeURL(string(n.Destination)) {
+				n.Destination = nil
+				s.warn(UnsafeURL, "image")
+			}
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	return s.warnings
+}
@@ -0,0 +1,104 @@
+package discordmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/state/store"
+	"github.com/yuin/goldmark/ast"
+)
+
+func TestSafeURL(t *testing.T) {
+	tests := map[string]bool{
+		"https://discord.com":      true,
+		"HTTP://example.com/a?b":   true,
+		"javascript:alert(1)":      false,
+		"JaVaScRiPt:alert(1)":      false,
+		"data:text/html,<b>hi</b>": false,
+		"file:///etc/passwd":       false,
+		"//example.com":            false,
+		"https://exa\nmple.com":    false,
+		"":                         false,
+	}
+
+	for u, want := range tests {
+		if got := SafeURL(u); got != want {
+			t.Errorf("SafeURL(%q) = %v, want %v", u, got, want)
+		}
+	}
+}
+
+func TestSanitizeEmbed(t *testing.T) {
+	embed := discord.Embed{
+		Title:  strings.Repeat("a", MaxEmbedTitle+1),
+		URL:    "javascript:alert(1)",
+		Author: &discord.EmbedAuthor{Name: "ok", URL: "https://example.com"},
+		Fields: make([]discord.EmbedField, MaxEmbedFields+1),
+	}
+
+	sanitized, warnings := SanitizeEmbed(embed)
+
+	if len(sanitized.Title) != MaxEmbedTitle || sanitized.URL != "" || len(sanitized.Fields) != MaxEmbedFields {
+		t.Errorf("embed not sanitized: title %d, url %q, fields %d",
+			len(sanitized.Title), sanitized.URL, len(sanitized.Fields))
+	}
+	if sanitized.Author.URL != "https://example.com" {
+		t.Errorf("safe author URL removed")
+	}
+	if embed.URL == "" {
+		t.Errorf("original embed modified")
+	}
+
+	want := []Warning{{Truncated, "title"}, {UnsafeURL, "url"}, {TooManyFields, "fields"}}
+	if len(warnings) != len(want) {
+		t.Fatalf("got warnings %v, want %v", warnings, want)
+	}
+	for i := range want {
+		if warnings[i] != want[i] {
+			t.Errorf("warning %d = %v, want %v", i, warnings[i], want[i])
+		}
+	}
+}
+
+func TestSanitizeComponents(t *testing.T) {
+	components := discord.ContainerComponents{
+		&discord.ActionRowComponent{
+			&discord.ButtonComponent{Label: "bad", Style: discord.LinkButtonStyle("javascript:alert(1)")},
+			&discord.ButtonComponent{Label: "good", Style: discord.LinkButtonStyle("https://example.com")},
+		},
+	}
+
+	sanitized, warnings := SanitizeComponents(components)
+	if len(warnings) != 1 || warnings[0].Kind != UnsafeURL {
+		t.Fatalf("unexpected warnings %v", warnings)
+	}
+
+	row := *sanitized[0].(*discord.ActionRowComponent)
+	if bad := row[0].(*discord.ButtonComponent); !bad.Disabled {
+		t.Error("unsafe link button not disabled")
+	}
+	if u, _ := LinkButtonURL(row[1].(*discord.ButtonComponent)); u != "https://example.com" {
+		t.Errorf("safe link button URL = %q", u)
+	}
+}
+
+func TestSanitizeLinks(t *testing.T) {
+	node := ParseWithMessage([]byte("[a](javascript:alert(1)) [b](https://example.com)"), store.Cabinet{}, nil, false)
+
+	if warnings := SanitizeLinks(node); len(warnings) != 1 {
+		t.Fatalf("got warnings %v, want 1", warnings)
+	}
+
+	var dests []string
+	ast.Walk(node, func(n ast.Node, enter bool) (ast.WalkStatus, error) {
+		if link, ok := n.(*ast.Link); ok && enter {
+			dests = append(dests, string(link.Destination))
+		}
+		return ast.WalkContinue, nil
+	})
+
+	if len(dests) != 2 || dests[0] != "" || dests[1] != "https://example.com" {
+		t.Errorf("got destinations %q", dests)
+	}
+}
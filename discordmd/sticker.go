@@ -0,0 +1,30 @@
+package discordmd
+
+import "github.com/diamondburned/arikawa/v3/discord"
+
+// StickerSize is the size that the official client displays stickers at.
+const StickerSize = 160
+
+// StickerFormatGIF is the GIF sticker format, which arikawa doesn't define.
+const StickerFormatGIF discord.StickerFormatType = 4
+
+// StickerURL returns the URL to the image of the sticker. Lottie stickers
+// point to their JSON animation; use StickerIsLottie to check for them, since
+// most renderers can't display them.
+func StickerURL(sticker discord.StickerItem) string {
+	const StickerBaseURL = "https://media.discordapp.net/stickers/"
+
+	switch sticker.FormatType {
+	case discord.StickerFormatLottie:
+		return StickerBaseURL + sticker.ID.String() + ".json"
+	case StickerFormatGIF:
+		return StickerBaseURL + sticker.ID.String() + ".gif"
+	default:
+		return StickerBaseURL + sticker.ID.String() + ".png"
+	}
+}
+
+// StickerIsLottie returns true if the sticker is a Lottie animation.
+func StickerIsLottie(sticker discord.StickerItem) bool {
+	return sticker.FormatType == discord.StickerFormatLottie
+}
@@ -0,0 +1,26 @@
+package discordmd
+
+import (
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+func TestStickerURL(t *testing.T) {
+	tests := []struct {
+		format discord.StickerFormatType
+		want   string
+	}{
+		{discord.StickerFormatPNG, "https://media.discordapp.net/stickers/1.png"},
+		{discord.StickerFormatAPNG, "https://media.discordapp.net/stickers/1.png"},
+		{discord.StickerFormatLottie, "https://media.discordapp.net/stickers/1.json"},
+		{StickerFormatGIF, "https://media.discordapp.net/stickers/1.gif"},
+	}
+
+	for _, test := range tests {
+		got := StickerURL(discord.StickerItem{ID: 1, FormatType: test.format})
+		if got != test.want {
+			t.Errorf("format %d: got %q, want %q", test.format, got, test.want)
+		}
+	}
+}
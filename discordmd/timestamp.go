@@ -0,0 +1,179 @@
+package discordmd
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// TimestampStyle is the format style of a timestamp tag, which is the letter
+// after the Unix time, as in <t:1234567890:R>.
+type TimestampStyle byte
+
+const (
+	ShortTime     TimestampStyle = 't' // 4:20 PM
+	LongTime      TimestampStyle = 'T' // 4:20:30 PM
+	ShortDate     TimestampStyle = 'd' // 04/20/2021
+	LongDate      TimestampStyle = 'D' // April 20, 2021
+	ShortDateTime TimestampStyle = 'f' // April 20, 2021 4:20 PM
+	LongDateTime  TimestampStyle = 'F' // Tuesday, April 20, 2021 4:20 PM
+	RelativeTime  TimestampStyle = 'R' // 2 months ago
+
+	// DefaultTimestampStyle is the style of timestamp tags without one.
+	DefaultTimestampStyle = ShortDateTime
+)
+
+// Layout returns the time layout of the style, or an empty string for
+// RelativeTime and unknown styles.
+func (s TimestampStyle) Layout() string {
+	switch s {
+	case ShortTime:
+		return "3:04 PM"
+	case LongTime:
+		return "3:04:05 PM"
+	case ShortDate:
+		return "01/02/2006"
+	case LongDate:
+		return "January 2, 2006"
+	case ShortDateTime:
+		return "January 2, 2006 3:04 PM"
+	case LongDateTime:
+		return "Monday, January 2, 2006 3:04 PM"
+	default:
+		return ""
+	}
+}
+
+// Timestamp is a timestamp tag, such as <t:1234567890:R>. The official client
+// shows it in the user's time zone.
+type Timestamp struct {
+	ast.BaseInline
+
+	Time  time.Time // in the local time zone
+	Style TimestampStyle
+}
+
+var KindTimestamp = ast.NewNodeKind("Timestamp")
+
+// Kind implements Node.Kind.
+func (t *Timestamp) Kind() ast.NodeKind {
+	return KindTimestamp
+}
+
+// Dump implements Node.Dump
+func (t *Timestamp) Dump(source []byte, level int) {
+	ast.DumpHelper(t, source, level, map[string]string{
+		"Time":  t.Time.String(),
+		"Style": string(t.Style),
+	}, nil)
+}
+
+// String formats the timestamp in its style. Relative timestamps are relative
+// to the current time, so they should be formatted again once in a while.
+func (t *Timestamp) String() string {
+	return FormatTimestamp(t.Time, t.Style, time.Now())
+}
+
+// FormatTimestamp formats the time in the given style the way the official
+// client does. now is only used for RelativeTime.
+func FormatTimestamp(t time.Time, style TimestampStyle, now time.Time) string {
+	if style == RelativeTime {
+		return formatRelative(t, now)
+	}
+
+	layout := style.Layout()
+	if layout == "" {
+		layout = DefaultTimestampStyle.Layout()
+	}
+
+	return t.Format(layout)
+}
+
+// formatRelative formats the duration between t and now with the same
+// thresholds as the official client.
+func formatRelative(t, now time.Time) string {
+	d := t.Sub(now)
+
+	future := d > 0
+	if !future {
+		d = -d
+	}
+
+	const day = 24 * time.Hour
+
+	var s string
+	switch {
+	case d < 45*time.Second:
+		s = "a few seconds"
+	case d < 90*time.Second:
+		s = "a minute"
+	case d < 45*time.Minute:
+		s = plural(d.Round(time.Minute)/time.Minute, "minutes")
+	case d < 90*time.Minute:
+		s = "an hour"
+	case d < 22*time.Hour:
+		s = plural(d.Round(time.Hour)/time.Hour, "hours")
+	case d < 36*time.Hour:
+		s = "a day"
+	case d < 26*day:
+		s = plural(d.Round(day)/day, "days")
+	case d < 45*day:
+		s = "a month"
+	case d < 320*day:
+		s = plural((d+15*day)/(30*day), "months")
+	case d < 548*day:
+		s = "a year"
+	default:
+		s = plural((d+182*day)/(365*day), "years")
+	}
+
+	if future {
+		return "in " + s
+	}
+	return s + " ago"
+}
+
+func plural(n time.Duration, unit string) string {
+	return strconv.FormatInt(int64(n), 10) + " " + unit
+}
+
+type timestamp struct{}
+
+var timestampRegex = regexp.MustCompile(`^<t:(-?\d+)(?::([tTdDfFR]))?>$`)
+
+func (timestamp) Trigger() []byte {
+	return []byte{'<'}
+}
+
+func (timestamp) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	match := matchInline(block, '<', '>')
+	if match == nil {
+		return nil
+	}
+
+	var matches = timestampRegex.FindSubmatch(match)
+	if len(matches) != 3 {
+		return nil
+	}
+
+	unix, err := strconv.ParseInt(string(matches[1]), 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	style := DefaultTimestampStyle
+	if len(matches[2]) > 0 {
+		style = TimestampStyle(matches[2][0])
+	}
+
+	return &Timestamp{
+		BaseInline: ast.BaseInline{},
+
+		Time:  time.Unix(unix, 0),
+		Style: style,
+	}
+}
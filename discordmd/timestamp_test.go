@@ -0,0 +1,64 @@
+package discordmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+func TestTimestampParse(t *testing.T) {
+	src := []byte("starts <t:1618935630:R>, ends <t:1618935690> and not <t:abc:R> or <t:1:X>")
+
+	var timestamps []*Timestamp
+	ast.Walk(Parse(src), func(n ast.Node, enter bool) (ast.WalkStatus, error) {
+		if ts, ok := n.(*Timestamp); ok && enter {
+			timestamps = append(timestamps, ts)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	if len(timestamps) != 2 {
+		t.Fatalf("got %d timestamps, want 2", len(timestamps))
+	}
+
+	if ts := timestamps[0]; ts.Time.Unix() != 1618935630 || ts.Style != RelativeTime {
+		t.Errorf("got first timestamp %v %c", ts.Time, ts.Style)
+	}
+	if ts := timestamps[1]; ts.Time.Unix() != 1618935690 || ts.Style != DefaultTimestampStyle {
+		t.Errorf("got second timestamp %v %c", ts.Time, ts.Style)
+	}
+}
+
+func TestFormatTimestamp(t *testing.T) {
+	now := time.Date(2021, time.April, 20, 16, 20, 30, 0, time.UTC)
+
+	tests := []struct {
+		time  time.Time
+		style TimestampStyle
+		want  string
+	}{
+		{now, ShortTime, "4:20 PM"},
+		{now, LongTime, "4:20:30 PM"},
+		{now, ShortDate, "04/20/2021"},
+		{now, LongDate, "April 20, 2021"},
+		{now, ShortDateTime, "April 20, 2021 4:20 PM"},
+		{now, LongDateTime, "Tuesday, April 20, 2021 4:20 PM"},
+		{now, 'x', "April 20, 2021 4:20 PM"},
+		{now.Add(10 * time.Second), RelativeTime, "in a few seconds"},
+		{now.Add(-time.Minute), RelativeTime, "a minute ago"},
+		{now.Add(-5 * time.Minute), RelativeTime, "5 minutes ago"},
+		{now.Add(3 * time.Hour), RelativeTime, "in 3 hours"},
+		{now.Add(-30 * time.Hour), RelativeTime, "a day ago"},
+		{now.Add(-4 * 24 * time.Hour), RelativeTime, "4 days ago"},
+		{now.Add(-90 * 24 * time.Hour), RelativeTime, "3 months ago"},
+		{now.Add(2 * 365 * 24 * time.Hour), RelativeTime, "in 2 years"},
+	}
+
+	for _, test := range tests {
+		got := FormatTimestamp(test.time, test.style, now)
+		if got != test.want {
+			t.Errorf("%v %c: got %q, want %q", test.time, test.style, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package discordmd
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	zeroWidthJoiner   = '\u200D'
+	variationSelector = '\uFE0F' // emoji presentation
+	textSelector      = '\uFE0E' // text presentation
+	combiningKeycap   = '\u20E3'
+)
+
+// emojiPresentation contains the code points that are shown as emojis without
+// a variation selector. It is a close approximation of the Emoji_Presentation
+// property, which the unicode package doesn't have.
+var emojiPresentation = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x231A, Hi: 0x231B, Stride: 1},
+		{Lo: 0x23E9, Hi: 0x23EC, Stride: 1},
+		{Lo: 0x23F0, Hi: 0x23F0, Stride: 1},
+		{Lo: 0x23F3, Hi: 0x23F3, Stride: 1},
+		{Lo: 0x25FD, Hi: 0x25FE, Stride: 1},
+		{Lo: 0x2614, Hi: 0x2615, Stride: 1},
+		{Lo: 0x2648, Hi: 0x2653, Stride: 1},
+		{Lo: 0x267F, Hi: 0x267F, Stride: 1},
+		{Lo: 0x2693, Hi: 0x2693, Stride: 1},
+		{Lo: 0x26A1, Hi: 0x26A1, Stride: 1},
+		{Lo: 0x26AA, Hi: 0x26AB, Stride: 1},
+		{Lo: 0x26BD, Hi: 0x26BE, Stride: 1},
+		{Lo: 0x26C4, Hi: 0x26C5, Stride: 1},
+		{Lo: 0x26CE, Hi: 0x26CE, Stride: 1},
+		{Lo: 0x26D4, Hi: 0x26D4, Stride: 1},
+		{Lo: 0x26EA, Hi: 0x26EA, Stride: 1},
+		{Lo: 0x26F2, Hi: 0x26F3, Stride: 1},
+		{Lo: 0x26F5, Hi: 0x26F5, Stride: 1},
+		{Lo: 0x26FA, Hi: 0x26FA, Stride: 1},
+		{Lo: 0x26FD, Hi: 0x26FD, Stride: 1},
+		{Lo: 0x2705, Hi: 0x2705, Stride: 1},
+		{Lo: 0x270A, Hi: 0x270B, Stride: 1},
+		{Lo: 0x2728, Hi: 0x2728, Stride: 1},
+		{Lo: 0x274C, Hi: 0x274C, Stride: 1},
+		{Lo: 0x274E, Hi: 0x274E, Stride: 1},
+		{Lo: 0x2753, Hi: 0x2755, Stride: 1},
+		{Lo: 0x2757, Hi: 0x2757, Stride: 1},
+		{Lo: 0x2795, Hi: 0x2797, Stride: 1},
+		{Lo: 0x27B0, Hi: 0x27B0, Stride: 1},
+		{Lo: 0x27BF, Hi: 0x27BF, Stride: 1},
+		{Lo: 0x2B1B, Hi: 0x2B1C, Stride: 1},
+		{Lo: 0x2B50, Hi: 0x2B50, Stride: 1},
+		{Lo: 0x2B55, Hi: 0x2B55, Stride: 1},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1F004, Hi: 0x1F004, Stride: 1},
+		{Lo: 0x1F0CF, Hi: 0x1F0CF, Stride: 1},
+		{Lo: 0x1F18E, Hi: 0x1F18E, Stride: 1},
+		{Lo: 0x1F191, Hi: 0x1F19A, Stride: 1},
+		{Lo: 0x1F1E6, Hi: 0x1F1FF, Stride: 1}, // regional indicators
+		{Lo: 0x1F201, Hi: 0x1F201, Stride: 1},
+		{Lo: 0x1F21A, Hi: 0x1F21A, Stride: 1},
+		{Lo: 0x1F22F, Hi: 0x1F22F, Stride: 1},
+		{Lo: 0x1F232, Hi: 0x1F236, Stride: 1},
+		{Lo: 0x1F238, Hi: 0x1F23A, Stride: 1},
+		{Lo: 0x1F250, Hi: 0x1F251, Stride: 1},
+		{Lo: 0x1F300, Hi: 0x1F64F, Stride: 1},
+		{Lo: 0x1F680, Hi: 0x1F6FF, Stride: 1},
+		{Lo: 0x1F7E0, Hi: 0x1F7F0, Stride: 1},
+		{Lo: 0x1F90C, Hi: 0x1F9FF, Stride: 1},
+		{Lo: 0x1FA70, Hi: 0x1FAFF, Stride: 1},
+	},
+}
+
+func isRegionalIndicator(r rune) bool { return 0x1F1E6 <= r && r <= 0x1F1FF }
+func isSkinTone(r rune) bool          { return 0x1F3FB <= r && r <= 0x1F3FF }
+func isTag(r rune) bool               { return 0xE0020 <= r && r <= 0xE007F }
+
+// unicodeEmojiLen returns the length in bytes of the Unicode emoji at the
+// start of b, or 0 if b doesn't start with one. Sequences joined with
+// zero-width joiners, skin tones, flags and keycaps count as one emoji.
+func unicodeEmojiLen(b []byte) int {
+	n := emojiElementLen(b)
+	if n == 0 {
+		return 0
+	}
+
+	for {
+		r, size := utf8.DecodeRune(b[n:])
+		if r != zeroWidthJoiner {
+			return n
+		}
+
+		next := emojiElementLen(b[n+size:])
+		if next == 0 {
+			return n
+		}
+
+		n += size + next
+	}
+}
+
+// emojiElementLen returns the length in bytes of the emoji at the start of b,
+// not counting the emojis joined to it.
+func emojiElementLen(b []byte) int {
+	r, n := utf8.DecodeRune(b)
+
+	next := func() rune {
+		r, _ := utf8.DecodeRune(b[n:])
+		return r
+	}
+
+	switch {
+	case isRegionalIndicator(r):
+		// Flags are pairs of regional indicators.
+		if r2 := next(); isRegionalIndicator(r2) {
+			n += utf8.RuneLen(r2)
+		}
+		return n
+
+	case r == '#' || r == '*' || ('0' <= r && r <= '9'):
+		// Keycaps, such as 1️⃣.
+		if next() == variationSelector {
+			n += utf8.RuneLen(variationSelector)
+		}
+		if next() != combiningKeycap {
+			return 0
+		}
+		return n + utf8.RuneLen(combiningKeycap)
+
+	case r < '©':
+		return 0
+
+	case unicode.Is(emojiPresentation, r):
+		if next() == textSelector {
+			return 0
+		}
+
+	case r == '©' || r == '®' || (0x2000 <= r && r <= 0x32FF):
+		// Symbols that are only emojis with the variation selector.
+		if next() != variationSelector {
+			return 0
+		}
+
+	default:
+		return 0
+	}
+
+	if next() == variationSelector {
+		n += utf8.RuneLen(variationSelector)
+	}
+	if r := next(); isSkinTone(r) {
+		n += utf8.RuneLen(r)
+	}
+	// Tags, such as in the flags of England or Scotland.
+	for r := next(); isTag(r); r = next() {
+		n += utf8.RuneLen(r)
+	}
+
+	return n
+}
@@ -0,0 +1,148 @@
+package ningen
+
+import (
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/ningen/v3/trace"
+	"github.com/pkg/errors"
+)
+
+// DMPresenceRequestInterval is the minimum duration between two presence
+// requests for the same user made by RequestDMPresences.
+var DMPresenceRequestInterval = time.Minute
+
+// dmPresenceRequests keeps track of when the presences of users were last
+// requested.
+type dmPresenceRequests struct {
+	mutex     sync.Mutex
+	requested map[discord.UserID]time.Time
+}
+
+func newDMPresenceRequests() *dmPresenceRequests {
+	return &dmPresenceRequests{
+		requested: make(map[discord.UserID]time.Time),
+	}
+}
+
+// take returns true if the user's presence should be requested now, and
+// records the request if so.
+func (r *dmPresenceRequests) take(userID discord.UserID) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	if last, ok := r.requested[userID]; ok && now.Sub(last) < DMPresenceRequestInterval {
+		return false
+	}
+
+	// Drop the old entries while we're at it, so the map doesn't grow
+	// forever.
+	for id, last := range r.requested {
+		if now.Sub(last) >= DMPresenceRequestInterval {
+			delete(r.requested, id)
+		}
+	}
+
+	r.requested[userID] = now
+	return true
+}
+
+// RequestDMPresences requests the presences of the recipients of the private
+// channel whose presences aren't known, so that DM lists can show whether they
+// are online. Discord only sends the presences of friends and of members of
+// shared guilds, so each recipient's presence is requested from a guild that
+// the user shares with them, found in the member store or using
+// ProfileState. The presences arrive in a GuildMembersChunkEvent and are put
+// into the PresenceStore.
+//
+// Recipients who are friends or who share no guild with the user are skipped,
+// as are those requested within DMPresenceRequestInterval. Since profiles may
+// have to be fetched, RequestDMPresences may block.
+func (s *State) RequestDMPresences(chID discord.ChannelID) error {
+	ch, err := s.Cabinet.Channel(chID)
+	if err != nil {
+		return errors.Wrap(err, "cannot get channel")
+	}
+
+	if ch.Type != discord.DirectMessage && ch.Type != discord.GroupDM {
+		return errors.New("channel is not a private channel")
+	}
+
+	guilds := make(map[discord.GuildID][]discord.UserID)
+
+	for _, recipient := range ch.DMRecipients {
+		if s.dmPresenceKnown(recipient.ID) || !s.dmPresences.take(recipient.ID) {
+			continue
+		}
+
+		if guildID := s.sharedGuild(recipient.ID); guildID.IsValid() {
+			guilds[guildID] = append(guilds[guildID], recipient.ID)
+		}
+	}
+
+	if len(guilds) == 0 {
+		return nil
+	}
+
+	gw := s.Gateway()
+	if gw == nil {
+		return errors.New("gateway is not open")
+	}
+
+	for guildID, userIDs := range guilds {
+		err := s.Tracer.Send(s.Context(), gw, trace.DMPresences, &gateway.RequestGuildMembersCommand{
+			GuildIDs:  []discord.GuildID{guildID},
+			UserIDs:   userIDs,
+			Presences: true,
+		})
+		if err != nil {
+			return errors.Wrap(err, "cannot request presences")
+		}
+	}
+
+	return nil
+}
+
+// dmPresenceKnown returns true if the presence of the user is kept up to date
+// without asking for it.
+func (s *State) dmPresenceKnown(userID discord.UserID) bool {
+	if s.RelationshipState.Relationship(userID) == discord.FriendRelationship {
+		return true
+	}
+
+	// The presences of users that only come from Ready aren't real; they
+	// have no guild.
+	p, err := s.PresenceStore.Presence(0, userID)
+	return err == nil && p.GuildID.IsValid()
+}
+
+// sharedGuild returns a guild that the user shares with the given user, or
+// null if there is none.
+func (s *State) sharedGuild(userID discord.UserID) discord.GuildID {
+	guilds, _ := s.Cabinet.Guilds()
+	for _, guild := range guilds {
+		if _, err := s.Cabinet.Member(guild.ID, userID); err == nil {
+			return guild.ID
+		}
+	}
+
+	if !s.Features().Profiles {
+		return 0
+	}
+
+	profile, err := s.ProfileState.Fetch(s.Context(), userID)
+	if err != nil {
+		return 0
+	}
+
+	for _, mutual := range profile.MutualGuilds {
+		if _, err := s.Cabinet.Guild(mutual.ID); err == nil {
+			return mutual.ID
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,50 @@
+package ningen_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/utils/httputil/httpdriver"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestRequestDMPresences(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.GroupDMs)
+
+	var fetches int32
+	n.Client.Client.Retries = 1
+	n.Client.Client.Client = httpdriver.WrapClient(http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			atomic.AddInt32(&fetches, 1)
+			if !strings.HasSuffix(r.URL.Path, "/users/100000000000000004/profile") {
+				t.Errorf("unexpected request to %s", r.URL.Path)
+			}
+			return &http.Response{
+				StatusCode: 200,
+				Header:     http.Header{"Content-Type": {"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(`{"mutual_guilds": []}`)),
+			}, nil
+		}),
+	})
+
+	// Alice is a friend, so Discord already sends their presence.
+	if err := n.RequestDMPresences(400000000000000001); err != nil {
+		t.Fatal("cannot request friend's presence:", err)
+	}
+	if got := atomic.LoadInt32(&fetches); got != 0 {
+		t.Fatalf("fetched %d profiles for a friend", got)
+	}
+
+	// Carol shares no guild with the user, so there's nothing to request.
+	for i := 0; i < 2; i++ {
+		if err := n.RequestDMPresences(400000000000000003); err != nil {
+			t.Fatal("cannot request presence:", err)
+		}
+	}
+	if got := atomic.LoadInt32(&fetches); got != 1 {
+		t.Errorf("fetched %d profiles, want once", got)
+	}
+}
@@ -0,0 +1,300 @@
+package ningen
+
+import (
+	"sort"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/pkg/errors"
+)
+
+// PermissionStepKind is the kind of a step in resolving a member's
+// permissions.
+type PermissionStepKind uint8
+
+const (
+	// StepOwner means that the member owns the guild, so they have all
+	// permissions. It is always the only step.
+	StepOwner PermissionStepKind = iota
+	// StepEveryoneRole adds the permissions of the @everyone role.
+	StepEveryoneRole
+	// StepRole adds the permissions of one of the member's roles.
+	StepRole
+	// StepAdministrator means that a role grants Administrator, so the member
+	// has all permissions regardless of the overwrites. It is the last step.
+	StepAdministrator
+	// StepEveryoneOverwrite applies the channel's overwrite for @everyone.
+	StepEveryoneOverwrite
+	// StepRoleOverwrite applies the channel's overwrite for one of the
+	// member's roles. The overwrites of all roles are applied at once, so
+	// Permissions of these steps is only set on the last one.
+	StepRoleOverwrite
+	// StepMemberOverwrite applies the channel's overwrite for the member.
+	StepMemberOverwrite
+	// StepTimeout means that the member is timed out, so they can only view
+	// the channel and read its history.
+	StepTimeout
+)
+
+// String returns a short name of the step kind.
+func (k PermissionStepKind) String() string {
+	switch k {
+	case StepOwner:
+		return "owner"
+	case StepEveryoneRole:
+		return "@everyone role"
+	case StepRole:
+		return "role"
+	case StepAdministrator:
+		return "administrator"
+	case StepEveryoneOverwrite:
+		return "@everyone overwrite"
+	case StepRoleOverwrite:
+		return "role overwrite"
+	case StepMemberOverwrite:
+		return "member overwrite"
+	case StepTimeout:
+		return "timeout"
+	default:
+		return "unknown"
+	}
+}
+
+// PermissionStep is a step in resolving a member's permissions.
+type PermissionStep struct {
+	Kind PermissionStepKind
+	// ID is the ID of the role or member that the step is about. It is the
+	// role that grants Administrator for StepAdministrator.
+	ID discord.Snowflake
+	// Allow and Deny are the permissions that the step adds and removes.
+	// Roles only add permissions.
+	Allow discord.Permissions
+	Deny  discord.Permissions
+	// Permissions are the member's permissions after the step.
+	Permissions discord.Permissions
+}
+
+// PermissionExplanation explains how a member's permissions in a channel are
+// resolved.
+type PermissionExplanation struct {
+	ChannelID discord.ChannelID
+	UserID    discord.UserID
+	// OverwriteChannelID is the channel whose overwrites are used, which is
+	// the parent channel for threads.
+	OverwriteChannelID discord.ChannelID
+	// Steps are the steps of the resolution in order.
+	Steps []PermissionStep
+	// Permissions are the member's final permissions.
+	Permissions discord.Permissions
+}
+
+// Why returns the last step that added or removed the given permission, which
+// is the reason that the member has it or not. Nil is returned if no step
+// touched it.
+func (e *PermissionExplanation) Why(perm discord.Permissions) *PermissionStep {
+	for i := len(e.Steps) - 1; i >= 0; i-- {
+		step := &e.Steps[i]
+		switch step.Kind {
+		case StepOwner, StepAdministrator:
+			return step
+		}
+		if step.Allow&perm != 0 || step.Deny&perm != 0 {
+			return step
+		}
+	}
+	return nil
+}
+
+// ExplainPermissions resolves the permissions of the user in the channel step
+// by step, the same way Discord does. The member, guild and roles are fetched
+// if they aren't in the cabinet.
+//
+// Unlike Permissions, timeouts are taken into account, and threads use the
+// overwrites of their parent channel.
+func (s *State) ExplainPermissions(chID discord.ChannelID, userID discord.UserID) (*PermissionExplanation, error) {
+	ch, err := s.Channel(chID)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get channel")
+	}
+
+	if !ch.GuildID.IsValid() {
+		return nil, errors.New("channel is not in a guild")
+	}
+
+	explanation := &PermissionExplanation{
+		ChannelID:          chID,
+		UserID:             userID,
+		OverwriteChannelID: chID,
+	}
+
+	if isThread(ch.Type) && ch.ParentID.IsValid() {
+		parent, err := s.Channel(ch.ParentID)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get thread parent")
+		}
+		ch = parent
+		explanation.OverwriteChannelID = parent.ID
+	}
+
+	g, err := s.Guild(ch.GuildID)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get guild")
+	}
+
+	if g.OwnerID == userID {
+		explanation.Permissions = discord.PermissionAll
+		explanation.Steps = []PermissionStep{{
+			Kind:        StepOwner,
+			ID:          discord.Snowflake(userID),
+			Allow:       discord.PermissionAll,
+			Permissions: discord.PermissionAll,
+		}}
+		return explanation, nil
+	}
+
+	m, err := s.Member(ch.GuildID, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get member")
+	}
+
+	roles, err := s.Roles(ch.GuildID)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get roles")
+	}
+
+	explanation.explain(g, ch, m, roles)
+	return explanation, nil
+}
+
+func (e *PermissionExplanation) explain(g *discord.Guild, ch *discord.Channel, m *discord.Member, roles []discord.Role) {
+	var perms discord.Permissions
+
+	step := func(step PermissionStep) {
+		perms &^= step.Deny
+		perms |= step.Allow
+		step.Permissions = perms
+		e.Steps = append(e.Steps, step)
+	}
+
+	for _, role := range roles {
+		if role.ID == discord.RoleID(g.ID) {
+			step(PermissionStep{
+				Kind:  StepEveryoneRole,
+				ID:    discord.Snowflake(role.ID),
+				Allow: role.Permissions,
+			})
+			break
+		}
+	}
+
+	memberRoles := make([]discord.Role, 0, len(m.RoleIDs))
+	for _, role := range roles {
+		if hasRole(m.RoleIDs, role.ID) {
+			memberRoles = append(memberRoles, role)
+		}
+	}
+
+	sort.SliceStable(memberRoles, func(i, j int) bool {
+		return memberRoles[i].Position > memberRoles[j].Position
+	})
+
+	for _, role := range memberRoles {
+		step(PermissionStep{
+			Kind:  StepRole,
+			ID:    discord.Snowflake(role.ID),
+			Allow: role.Permissions,
+		})
+	}
+
+	if perms.Has(discord.PermissionAdministrator) {
+		var adminID discord.Snowflake
+		for _, step := range e.Steps {
+			if step.Allow.Has(discord.PermissionAdministrator) {
+				adminID = step.ID
+				break
+			}
+		}
+
+		step(PermissionStep{
+			Kind:  StepAdministrator,
+			ID:    adminID,
+			Allow: discord.PermissionAll,
+		})
+		e.Permissions = perms
+		return
+	}
+
+	for _, overwrite := range ch.Overwrites {
+		if discord.GuildID(overwrite.ID) == g.ID {
+			step(PermissionStep{
+				Kind:  StepEveryoneOverwrite,
+				ID:    overwrite.ID,
+				Allow: overwrite.Allow,
+				Deny:  overwrite.Deny,
+			})
+			break
+		}
+	}
+
+	// Role overwrites are combined before being applied, so an allow on one
+	// role wins over a deny on another.
+	var allow, deny discord.Permissions
+	start := len(e.Steps)
+
+	for _, overwrite := range ch.Overwrites {
+		if overwrite.Type != discord.OverwriteRole || discord.GuildID(overwrite.ID) == g.ID {
+			continue
+		}
+		if !hasRole(m.RoleIDs, discord.RoleID(overwrite.ID)) {
+			continue
+		}
+
+		allow |= overwrite.Allow
+		deny |= overwrite.Deny
+
+		e.Steps = append(e.Steps, PermissionStep{
+			Kind:  StepRoleOverwrite,
+			ID:    overwrite.ID,
+			Allow: overwrite.Allow,
+			Deny:  overwrite.Deny,
+		})
+	}
+
+	if len(e.Steps) > start {
+		perms &^= deny
+		perms |= allow
+		e.Steps[len(e.Steps)-1].Permissions = perms
+	}
+
+	for _, overwrite := range ch.Overwrites {
+		if overwrite.Type == discord.OverwriteMember && discord.UserID(overwrite.ID) == m.User.ID {
+			step(PermissionStep{
+				Kind:  StepMemberOverwrite,
+				ID:    overwrite.ID,
+				Allow: overwrite.Allow,
+				Deny:  overwrite.Deny,
+			})
+			break
+		}
+	}
+
+	if until := m.CommunicationDisabledUntil; until.IsValid() && until.Time().After(time.Now()) {
+		const timeoutPerms = discord.PermissionViewChannel | discord.PermissionReadMessageHistory
+		step(PermissionStep{
+			Kind: StepTimeout,
+			ID:   discord.Snowflake(m.User.ID),
+			Deny: perms &^ timeoutPerms,
+		})
+	}
+
+	e.Permissions = perms
+}
+
+func hasRole(roleIDs []discord.RoleID, id discord.RoleID) bool {
+	for _, roleID := range roleIDs {
+		if roleID == id {
+			return true
+		}
+	}
+	return false
+}
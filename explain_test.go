@@ -0,0 +1,91 @@
+package ningen_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/ningen/v3"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestExplainPermissions(t *testing.T) {
+	const (
+		guildID = 200000000000000001
+		userID  = 100000000000000001
+		roleID  = 200000000000000060
+	)
+
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	n.RoleSet(guildID, &discord.Role{
+		ID: roleID, Position: 1, Permissions: discord.PermissionManageMessages,
+	}, false)
+
+	me, err := n.Cabinet.Member(guildID, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	me.RoleIDs = []discord.RoleID{roleID}
+	n.MemberSet(guildID, me, true)
+
+	n.ChannelSet(&discord.Channel{
+		ID: 300000000000000060, GuildID: guildID, Type: discord.GuildText,
+		Overwrites: []discord.Overwrite{
+			{ID: guildID, Type: discord.OverwriteRole, Deny: discord.PermissionSendMessages},
+			{ID: roleID, Type: discord.OverwriteRole, Allow: discord.PermissionSendMessages},
+			{ID: userID, Type: discord.OverwriteMember, Deny: discord.PermissionSendMessages},
+		},
+	}, false)
+
+	e, err := n.ExplainPermissions(300000000000000060, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kinds := []ningen.PermissionStepKind{
+		ningen.StepEveryoneRole,
+		ningen.StepRole,
+		ningen.StepEveryoneOverwrite,
+		ningen.StepRoleOverwrite,
+		ningen.StepMemberOverwrite,
+	}
+	if len(e.Steps) != len(kinds) {
+		t.Fatalf("got steps %+v", e.Steps)
+	}
+	for i, kind := range kinds {
+		if e.Steps[i].Kind != kind {
+			t.Errorf("step %d: got %v, want %v", i, e.Steps[i].Kind, kind)
+		}
+	}
+
+	if e.Permissions.Has(discord.PermissionSendMessages) {
+		t.Error("member overwrite didn't deny sending messages")
+	}
+	if why := e.Why(discord.PermissionSendMessages); why == nil || why.Kind != ningen.StepMemberOverwrite {
+		t.Errorf("got reason %+v", why)
+	}
+
+	// The explanation agrees with the permissions without a timeout.
+	perms, err := n.Permissions(300000000000000060, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perms != e.Permissions {
+		t.Errorf("got permissions %d, explained %d", perms, e.Permissions)
+	}
+
+	me.CommunicationDisabledUntil = discord.NewTimestamp(time.Now().Add(time.Hour))
+	n.MemberSet(guildID, me, true)
+
+	e, err = n.ExplainPermissions(300000000000000002, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := discord.PermissionViewChannel; e.Permissions != want {
+		t.Errorf("timed out member has permissions %d, want %d", e.Permissions, want)
+	}
+	if why := e.Why(discord.PermissionSendMessages); why == nil || why.Kind != ningen.StepTimeout {
+		t.Errorf("got reason %+v", why)
+	}
+}
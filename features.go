@@ -0,0 +1,118 @@
+package ningen
+
+import (
+	"sync"
+
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+	"github.com/pkg/errors"
+)
+
+// Features describes what the session provides, which depends on the account
+// type and the capabilities given when identifying. Bots and sessions with
+// reduced capabilities lack some of the data that user clients have, so the
+// states that rely on that data stay empty. Clients should hide the UI that
+// depends on a missing feature.
+type Features struct {
+	// Bot is true if the session belongs to a bot.
+	Bot bool
+	// ReadStates is true if the session has read states. Without them,
+	// ReadState is put into passive mode and nothing is ever acked.
+	ReadStates bool
+	// UserSettings is true if the session has the user settings, which hold
+	// the status and the custom status.
+	UserSettings bool
+	// GuildSettings is true if the session has the guild settings, which
+	// MutedState uses.
+	GuildSettings bool
+	// Relationships is true if the session has relationships, which
+	// RelationshipState uses.
+	Relationships bool
+	// LazyGuilds is true if guilds can be subscribed to, which member lists
+	// need. See member.State.SetLazyGuilds.
+	LazyGuilds bool
+	// Profiles is true if user profiles can be fetched using ProfileState.
+	// Only user accounts can fetch them.
+	Profiles bool
+}
+
+type featureState struct {
+	mutex    sync.Mutex
+	features Features
+	ready    bool
+}
+
+// defaultFeatures returns the features that are assumed when they can't be
+// detected, which are all of them, save for the ones that bots never have.
+func defaultFeatures(bot bool) Features {
+	return Features{
+		Bot:           bot,
+		ReadStates:    true,
+		UserSettings:  true,
+		GuildSettings: true,
+		Relationships: true,
+		LazyGuilds:    !bot,
+		Profiles:      !bot,
+	}
+}
+
+// Features returns the features of the session. Every feature is assumed to be
+// available until the Ready event is received, or if the Ready event can't be
+// decoded well enough to tell.
+func (s *State) Features() Features {
+	s.features.mutex.Lock()
+	defer s.features.mutex.Unlock()
+
+	if !s.features.ready {
+		return defaultFeatures(false)
+	}
+
+	return s.features.features
+}
+
+// detectFeatures detects the features of the session from the Ready event and
+// turns off the parts of the sub-states that can't work without them. It runs
+// before the sub-states handle the Ready event.
+func (s *State) detectFeatures(ev *gateway.ReadyEvent) {
+	// This is the first handler of the Ready event, so it reports the errors
+	// of the extras that the other handlers use.
+	extras := s.ReadyExtras.Of(ev)
+	if extras.Err != nil {
+		s.dispatch(&ws.BackgroundErrorEvent{
+			Err: errors.Wrap(extras.Err, "cannot decode Ready extras, keeping the previous features"),
+		})
+
+		// Missing extras would otherwise look like missing features, which
+		// would e.g. quietly put ReadState into passive mode.
+		s.features.mutex.Lock()
+		if !s.features.ready {
+			s.features.features = defaultFeatures(ev.User.Bot)
+			s.features.ready = true
+		}
+		s.features.mutex.Unlock()
+		return
+	}
+
+	bot := ev.User.Bot
+	features := Features{
+		Bot:           bot,
+		ReadStates:    extras.ReadStates.Present,
+		UserSettings:  extras.UserSettings != nil || bool(extras.UserSettingsProto),
+		GuildSettings: bool(extras.UserGuildSettings),
+		Relationships: bool(extras.Relationships),
+		LazyGuilds:    !bot,
+		Profiles:      !bot,
+	}
+
+	s.features.mutex.Lock()
+	s.features.features = features
+	s.features.ready = true
+	s.features.mutex.Unlock()
+
+	// Passive mode is only ever turned on here, since the user may have
+	// turned it on themselves.
+	if !features.ReadStates {
+		s.ReadState.SetPassive(true)
+	}
+	s.MemberState.SetLazyGuilds(features.LazyGuilds)
+}
@@ -0,0 +1,101 @@
+package ningen_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/state"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+	"github.com/diamondburned/ningen/v3"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestFeatures(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	f := n.Features()
+	if f.Bot || !f.ReadStates || !f.GuildSettings || !f.Relationships || !f.LazyGuilds || !f.Profiles {
+		t.Errorf("got features %+v for a user account", f)
+	}
+	// The fixture has no user settings.
+	if f.UserSettings {
+		t.Error("got user settings that the Ready event doesn't have")
+	}
+	if n.ReadState.IsPassive() {
+		t.Error("read state is passive for a user account")
+	}
+}
+
+func TestFeaturesBot(t *testing.T) {
+	n := ningen.FromState(state.NewWithIdentifier(gateway.DefaultIdentifier("Bot ningentest")))
+
+	if f := n.Features(); !f.ReadStates || !f.LazyGuilds {
+		t.Errorf("got features %+v before Ready", f)
+	}
+
+	var ready gateway.ReadyEvent
+	body := `{
+		"v": 9,
+		"user": {"id": "100000000000000001", "username": "ningenbot", "bot": true},
+		"guilds": [],
+		"session_id": "ningentest"
+	}`
+	if err := json.Unmarshal([]byte(body), &ready); err != nil {
+		t.Fatal("cannot decode Ready:", err)
+	}
+
+	ningentest.Dispatch(n, &ready)
+
+	f := n.Features()
+	if !f.Bot || f.ReadStates || f.UserSettings || f.GuildSettings || f.Relationships || f.LazyGuilds || f.Profiles {
+		t.Errorf("got features %+v for a bot", f)
+	}
+	if !n.ReadState.IsPassive() {
+		t.Error("read state isn't passive without read states")
+	}
+	if n.MemberState.LazyGuilds() {
+		t.Error("lazy guilds are enabled for a bot")
+	}
+	if _, err := n.MutualFriends(100000000000000002); err == nil {
+		t.Error("fetched mutual friends as a bot")
+	}
+}
+
+func TestFeaturesDecodeError(t *testing.T) {
+	n := ningen.FromState(state.NewWithIdentifier(gateway.DefaultIdentifier("ningentest")))
+
+	errs := make(chan error, 1)
+	n.AddSyncHandler(func(ev *ws.BackgroundErrorEvent) { errs <- ev.Err })
+
+	var ready gateway.ReadyEvent
+	body := `{
+		"v": 9,
+		"user": {"id": "100000000000000001", "username": "ningen"},
+		"guilds": [],
+		"read_state": 5,
+		"session_id": "ningentest"
+	}`
+	if err := json.Unmarshal([]byte(body), &ready); err != nil {
+		t.Fatal("cannot decode Ready:", err)
+	}
+
+	ningentest.Dispatch(n, &ready)
+
+	select {
+	case <-errs:
+	default:
+		t.Error("decode error not reported")
+	}
+
+	// The malformed read states don't turn them off.
+	if f := n.Features(); f != (ningen.Features{
+		ReadStates: true, UserSettings: true, GuildSettings: true,
+		Relationships: true, LazyGuilds: true, Profiles: true,
+	}) {
+		t.Errorf("got features %+v after a decode error, want the defaults", f)
+	}
+	if n.ReadState.IsPassive() {
+		t.Error("read state is passive after a decode error")
+	}
+}
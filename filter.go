@@ -0,0 +1,214 @@
+package ningen
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+	"github.com/diamondburned/ningen/v3/states/send"
+)
+
+// ErrContentFlagged is returned when an outgoing message isn't sent because a
+// content filter flagged it.
+var ErrContentFlagged = send.ErrFlagged
+
+// ContentFilter filters the content of a message. It returns the content with
+// the offending parts redacted, and whether the whole message should be
+// flagged. It must be fast and concurrency-safe.
+type ContentFilter func(content string) (filtered string, flagged bool)
+
+// RedactFilter returns a ContentFilter that replaces every character of the
+// matches of re with mask.
+func RedactFilter(re *regexp.Regexp, mask rune) ContentFilter {
+	return func(content string) (string, bool) {
+		return re.ReplaceAllStringFunc(content, func(match string) string {
+			return strings.Repeat(string(mask), utf8.RuneCountInString(match))
+		}), false
+	}
+}
+
+// FlagFilter returns a ContentFilter that flags messages that match re
+// without changing them.
+func FlagFilter(re *regexp.Regexp) ContentFilter {
+	return func(content string) (string, bool) {
+		return content, re.MatchString(content)
+	}
+}
+
+// FilterDirection is the direction of the messages that a content filter
+// applies to.
+type FilterDirection uint8
+
+const (
+	// FilterIncoming applies the filter to messages received from the
+	// gateway.
+	FilterIncoming FilterDirection = 1 << iota
+	// FilterOutgoing applies the filter to messages sent using
+	// SendState.QueueMessage or SendMessageWithProgress.
+	FilterOutgoing
+)
+
+// MessageFilteredEvent is dispatched when an incoming message is redacted or
+// flagged by a content filter. It is dispatched before the event of the
+// message itself, which already has the filtered content, as does the
+// cabinet.
+type MessageFilteredEvent struct {
+	Message *discord.Message
+	// Original is the content before it was filtered.
+	Original string
+	Flagged  bool
+}
+
+var _ gateway.Event = (*MessageFilteredEvent)(nil)
+
+func (ev MessageFilteredEvent) Op() ws.OpCode           { return -1 }
+func (ev MessageFilteredEvent) EventType() ws.EventType { return "__ningen.MessageFilteredEvent" }
+
+type contentFilter struct {
+	id     uint64
+	dir    FilterDirection
+	filter ContentFilter
+}
+
+// contentFilters keeps the registered content filters and the messages that
+// they flagged.
+type contentFilters struct {
+	mutex   sync.RWMutex
+	filters []contentFilter
+	lastID  uint64
+	flagged map[discord.MessageID]struct{}
+}
+
+func newContentFilters() *contentFilters {
+	return &contentFilters{
+		flagged: make(map[discord.MessageID]struct{}),
+	}
+}
+
+// AddContentFilter adds a filter for messages of the given directions, which
+// may be combined. Filters run in the order that they were added, each on the
+// content returned by the previous one. Incoming messages are filtered before
+// any handler or sub-state sees them. The returned function removes the
+// filter.
+func (s *State) AddContentFilter(dir FilterDirection, filter ContentFilter) (remove func()) {
+	c := s.filters
+
+	c.mutex.Lock()
+	c.lastID++
+	id := c.lastID
+	c.filters = append(c.filters, contentFilter{id, dir, filter})
+	c.mutex.Unlock()
+
+	return func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		for i, f := range c.filters {
+			if f.id == id {
+				c.filters = append(c.filters[:i:i], c.filters[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// FilterContent runs the content filters of the given direction on the
+// content. It is useful for content that doesn't come from the gateway, such
+// as messages fetched from the API.
+func (s *State) FilterContent(dir FilterDirection, content string) (filtered string, flagged bool) {
+	s.filters.mutex.RLock()
+	filters := s.filters.filters
+	s.filters.mutex.RUnlock()
+
+	for _, f := range filters {
+		if f.dir&dir == 0 {
+			continue
+		}
+
+		var flag bool
+		content, flag = f.filter(content)
+		flagged = flagged || flag
+	}
+
+	return content, flagged
+}
+
+// MessageIsFlagged returns true if a content filter flagged the incoming
+// message with the given ID.
+func (s *State) MessageIsFlagged(msgID discord.MessageID) bool {
+	s.filters.mutex.RLock()
+	defer s.filters.mutex.RUnlock()
+
+	_, ok := s.filters.flagged[msgID]
+	return ok
+}
+
+// filterIncoming filters the content of incoming messages in place. It must
+// run before every other handler.
+func (s *State) filterIncoming(ev gateway.Event) {
+	var msg *discord.Message
+
+	switch ev := ev.(type) {
+	case *gateway.ReadyEvent:
+		s.filters.mutex.Lock()
+		s.filters.flagged = make(map[discord.MessageID]struct{})
+		s.filters.mutex.Unlock()
+		return
+
+	case *gateway.MessageDeleteEvent:
+		s.filters.mutex.Lock()
+		delete(s.filters.flagged, ev.ID)
+		s.filters.mutex.Unlock()
+		return
+
+	case *gateway.MessageDeleteBulkEvent:
+		s.filters.mutex.Lock()
+		for _, id := range ev.IDs {
+			delete(s.filters.flagged, id)
+		}
+		s.filters.mutex.Unlock()
+		return
+
+	case *gateway.MessageCreateEvent:
+		msg = &ev.Message
+	case *gateway.MessageUpdateEvent:
+		// Updates without content only change the embeds.
+		if ev.Content == "" {
+			return
+		}
+		msg = &ev.Message
+	default:
+		return
+	}
+
+	filtered, flagged := s.FilterContent(FilterIncoming, msg.Content)
+
+	s.filters.mutex.Lock()
+	_, wasFlagged := s.filters.flagged[msg.ID]
+	if flagged {
+		s.filters.flagged[msg.ID] = struct{}{}
+	} else {
+		delete(s.filters.flagged, msg.ID)
+	}
+	s.filters.mutex.Unlock()
+
+	if filtered == msg.Content && flagged == wasFlagged {
+		return
+	}
+
+	original := msg.Content
+	msg.Content = filtered
+
+	// The cabinet already has the unfiltered message.
+	s.Cabinet.MessageSet(msg, true)
+
+	s.dispatch(&MessageFilteredEvent{
+		Message:  msg,
+		Original: original,
+		Flagged:  flagged,
+	})
+}
@@ -0,0 +1,76 @@
+package ningen_test
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/ningen/v3"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestContentFilter(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	n.AddContentFilter(ningen.FilterIncoming|ningen.FilterOutgoing,
+		ningen.RedactFilter(regexp.MustCompile(`(?i)heck`), '#'))
+	removeFlag := n.AddContentFilter(ningen.FilterIncoming,
+		ningen.FlagFilter(regexp.MustCompile(`spoilers`)))
+
+	var filtered []*ningen.MessageFilteredEvent
+	n.AddSyncHandler(func(ev *ningen.MessageFilteredEvent) { filtered = append(filtered, ev) })
+
+	var notified *ningen.NotificationEvent
+	n.AddSyncHandler(func(ev *ningen.NotificationEvent) { notified = ev })
+
+	msg := discord.Message{
+		ID:        900000000000000050,
+		ChannelID: 300000000000000002,
+		GuildID:   200000000000000001,
+		Author:    discord.User{ID: 100000000000000002},
+		Content:   "what the Heck, spoilers",
+	}
+	ningentest.Dispatch(n, &gateway.MessageCreateEvent{Message: msg})
+
+	if len(filtered) != 1 || filtered[0].Original != msg.Content || !filtered[0].Flagged {
+		t.Fatalf("got filtered events %+v", filtered)
+	}
+
+	m, err := n.Cabinet.Message(msg.ChannelID, msg.ID)
+	if err != nil {
+		t.Fatal("cannot get message:", err)
+	}
+	if m.Content != "what the ####, spoilers" {
+		t.Errorf("got cabinet content %q", m.Content)
+	}
+
+	if !n.MessageIsFlagged(msg.ID) {
+		t.Error("message isn't flagged")
+	}
+	if notified == nil || !notified.Flagged {
+		t.Errorf("got notification %+v, want flagged", notified)
+	}
+
+	// Editing the message unflags it.
+	removeFlag()
+	msg.Content = "no more spoilers"
+	ningentest.Dispatch(n, &gateway.MessageUpdateEvent{Message: msg})
+
+	if len(filtered) != 2 || filtered[1].Flagged || n.MessageIsFlagged(msg.ID) {
+		t.Fatalf("message is still flagged after removing the filter: %+v", filtered)
+	}
+
+	if content, _ := n.FilterContent(ningen.FilterOutgoing, "heck no"); content != "#### no" {
+		t.Errorf("got outgoing content %q", content)
+	}
+
+	n.AddContentFilter(ningen.FilterOutgoing, ningen.FlagFilter(regexp.MustCompile(`secret`)))
+
+	_, err = n.SendMessageWithProgress(msg.ChannelID, api.SendMessageData{Content: "the secret is"}, nil)
+	if !errors.Is(err, ningen.ErrContentFlagged) {
+		t.Fatalf("got error %v, want ErrContentFlagged", err)
+	}
+}
@@ -0,0 +1,99 @@
+package handlerrepo
+
+import (
+	"context"
+	"sync"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// Ordered runs functions in the background, one after another for functions
+// with the same key, in the order that Go was called. Functions with different
+// keys may run concurrently.
+//
+// States use it to dispatch the events that they synthesize. These events are
+// mostly caused by gateway events, so they would otherwise be dispatched from
+// within the handler of the event that caused them, where calling the
+// handlers again would deadlock against a concurrent AddHandler. Keying the
+// functions by e.g. channel keeps the events of the same channel in causal
+// order.
+//
+// The zero value is ready to use.
+type Ordered struct {
+	mutex  sync.Mutex
+	queues map[discord.Snowflake][]func()
+	// idle is closed once all queues are drained. It is nil if there are no
+	// queues.
+	idle chan struct{}
+}
+
+// Go queues fn to run after all functions previously queued with the same key.
+func (o *Ordered) Go(key discord.Snowflake, fn func()) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.queues == nil {
+		o.queues = make(map[discord.Snowflake][]func())
+	}
+
+	if len(o.queues) == 0 {
+		o.idle = make(chan struct{})
+	}
+
+	queue, running := o.queues[key]
+	o.queues[key] = append(queue, fn)
+
+	if !running {
+		go o.run(key)
+	}
+}
+
+// run drains the queue of the key. The key stays in the map for as long as
+// run is running.
+func (o *Ordered) run(key discord.Snowflake) {
+	for {
+		o.mutex.Lock()
+
+		queue := o.queues[key]
+		if len(queue) == 0 {
+			delete(o.queues, key)
+			if len(o.queues) == 0 {
+				close(o.idle)
+				o.idle = nil
+			}
+			o.mutex.Unlock()
+			return
+		}
+
+		fn := queue[0]
+		queue[0] = nil
+		o.queues[key] = queue[1:]
+
+		o.mutex.Unlock()
+
+		fn()
+	}
+}
+
+// Flush blocks until all queued functions have run, including the ones queued
+// while waiting, or until ctx is done, in which case ctx's error is returned.
+//
+// Every state that dispatches events through an Ordered has a Flush method
+// with the same contract, which tests and clients can use to wait until the
+// events caused by the events that they dispatched have been handled.
+func (o *Ordered) Flush(ctx context.Context) error {
+	o.mutex.Lock()
+	idle := o.idle
+	o.mutex.Unlock()
+
+	if idle == nil {
+		return nil
+	}
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
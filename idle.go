@@ -0,0 +1,173 @@
+package ningen
+
+import (
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+	"github.com/diamondburned/ningen/v3/trace"
+	"github.com/pkg/errors"
+)
+
+// IdleChangedEvent is dispatched when the user is automatically put into or
+// taken out of idle. See SetIdleAfter.
+type IdleChangedEvent struct {
+	Idle bool
+	// Since is when the user was last active.
+	Since time.Time
+}
+
+var _ gateway.Event = (*IdleChangedEvent)(nil)
+
+func (ev IdleChangedEvent) Op() ws.OpCode           { return -1 }
+func (ev IdleChangedEvent) EventType() ws.EventType { return "__ningen.IdleChangedEvent" }
+
+// idleManager puts the user into idle after a period of inactivity.
+type idleManager struct {
+	mutex      sync.Mutex
+	after      time.Duration
+	timer      *time.Timer
+	lastActive time.Time
+	// restore is the status to restore once the user is active again. It is
+	// empty if the user isn't idle.
+	restore discord.Status
+	// gen is incremented every time the timer is replaced, so that a timer
+	// that fires while being replaced does nothing.
+	gen uint64
+}
+
+// SetIdleAfter makes the State put the user into idle once they have been
+// inactive for the given duration, and take them out of idle once they are
+// active again. The application reports activity using ReportActivity, such as
+// on every key press or when its window is focused. A duration of 0 turns it
+// off, which also takes the user out of idle.
+//
+// Only users that are online are put into idle; other statuses, including an
+// idle status that the user chose, are left alone. The idle status is only
+// sent to the gateway and never saved into the user settings, so other
+// devices keep the status that the user chose. If the user's status is changed
+// while they are idle, it is kept instead of the one from before.
+func (s *State) SetIdleAfter(d time.Duration) {
+	s.idle.mutex.Lock()
+	s.idle.after = d
+	s.idle.mutex.Unlock()
+
+	if d > 0 {
+		s.ReportActivity()
+	} else {
+		s.setActive(time.Now(), false)
+	}
+}
+
+// ReportActivity reports that the user is active. It takes the user out of
+// idle if SetIdleAfter has put them into it, and restarts the inactivity
+// timer. It does nothing if SetIdleAfter hasn't been called.
+func (s *State) ReportActivity() {
+	s.setActive(time.Now(), true)
+}
+
+// IsIdle returns true if SetIdleAfter has put the user into idle.
+func (s *State) IsIdle() bool {
+	s.idle.mutex.Lock()
+	defer s.idle.mutex.Unlock()
+
+	return s.idle.restore != ""
+}
+
+// setActive takes the user out of idle and restarts the timer if rearm is true
+// and idling is turned on.
+func (s *State) setActive(now time.Time, rearm bool) {
+	s.idle.mutex.Lock()
+
+	s.idle.gen++
+	if s.idle.timer != nil {
+		s.idle.timer.Stop()
+		s.idle.timer = nil
+	}
+
+	restore := s.idle.restore
+	since := s.idle.lastActive
+	s.idle.restore = ""
+	s.idle.lastActive = now
+
+	if rearm && s.idle.after > 0 {
+		gen := s.idle.gen
+		s.idle.timer = time.AfterFunc(s.idle.after, func() { s.goIdle(gen) })
+	}
+
+	s.idle.mutex.Unlock()
+
+	if restore != "" {
+		s.sendIdle(false, restore, since)
+	}
+}
+
+// goIdle puts the user into idle if the timer of the given generation is still
+// the current one.
+func (s *State) goIdle(gen uint64) {
+	me, err := s.Me()
+	if err != nil {
+		return
+	}
+
+	p, _ := s.PresenceStore.Presence(0, me.ID)
+	if p == nil || p.Status != discord.OnlineStatus {
+		return
+	}
+
+	s.idle.mutex.Lock()
+	if s.idle.gen != gen {
+		s.idle.mutex.Unlock()
+		return
+	}
+	s.idle.timer = nil
+	s.idle.restore = p.Status
+	since := s.idle.lastActive
+	s.idle.mutex.Unlock()
+
+	s.sendIdle(true, discord.IdleStatus, since)
+}
+
+// statusChanged forgets the status to restore, since the user has chosen
+// another one while idle.
+func (s *State) statusChanged() {
+	s.idle.mutex.Lock()
+	wasIdle := s.idle.restore != ""
+	s.idle.restore = ""
+	s.idle.mutex.Unlock()
+
+	if wasIdle {
+		s.dispatch(&IdleChangedEvent{Idle: false, Since: time.Now()})
+	}
+}
+
+// sendIdle sends the given status with the user's current activities and
+// dispatches an IdleChangedEvent.
+func (s *State) sendIdle(idle bool, status discord.Status, since time.Time) {
+	cmd := gateway.UpdatePresenceCommand{
+		Status:     status,
+		Activities: []discord.Activity{},
+		AFK:        idle,
+	}
+	if idle {
+		cmd.Since = discord.TimeToMilliseconds(since)
+	}
+
+	if me, err := s.Me(); err == nil {
+		if p, _ := s.PresenceStore.Presence(0, me.ID); p != nil && p.Activities != nil {
+			cmd.Activities = p.Activities
+		}
+	}
+
+	if gw := s.Gateway(); gw != nil {
+		if err := s.Tracer.Send(s.Context(), gw, trace.Idle, &cmd); err != nil {
+			s.dispatch(&ws.BackgroundErrorEvent{
+				Err: errors.Wrap(err, "cannot update idle status"),
+			})
+		}
+	}
+
+	s.dispatch(&IdleChangedEvent{Idle: idle, Since: since})
+}
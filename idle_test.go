@@ -0,0 +1,73 @@
+package ningen_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/ningen/v3"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestIdleAfter(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	me, err := n.Me()
+	if err != nil {
+		t.Fatal("cannot get current user:", err)
+	}
+
+	n.PresenceStore.PresenceSet(0, &discord.Presence{
+		User:   *me,
+		Status: discord.OnlineStatus,
+	}, true)
+
+	events := make(chan *ningen.IdleChangedEvent, 1)
+	n.AddSyncHandler(func(ev *ningen.IdleChangedEvent) { events <- ev })
+
+	wait := func(idle bool) {
+		t.Helper()
+		select {
+		case ev := <-events:
+			if ev.Idle != idle {
+				t.Fatalf("got idle=%v, want %v", ev.Idle, idle)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for idle=%v", idle)
+		}
+	}
+
+	n.SetIdleAfter(20 * time.Millisecond)
+	defer n.SetIdleAfter(0)
+
+	wait(true)
+	if !n.IsIdle() {
+		t.Error("user isn't idle after the timeout")
+	}
+
+	n.ReportActivity()
+	wait(false)
+	if n.IsIdle() {
+		t.Error("user is still idle after activity")
+	}
+
+	// A status that the user chooses while idle is kept.
+	wait(true)
+	ningentest.Dispatch(n, &gateway.UserSettingsUpdateEvent{
+		UserSettings: gateway.UserSettings{Status: discord.DoNotDisturbStatus},
+	})
+	wait(false)
+
+	n.PresenceStore.PresenceSet(0, &discord.Presence{
+		User:   *me,
+		Status: discord.DoNotDisturbStatus,
+	}, true)
+
+	n.ReportActivity()
+	select {
+	case ev := <-events:
+		t.Errorf("got %+v for a user who chose do not disturb", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,71 @@
+// Package fuzzy matches search queries against names for the autocompleters
+// of the states.
+package fuzzy
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Match is how well a query matches a name. Better matches are greater.
+type Match uint8
+
+const (
+	// None means that the name doesn't match.
+	None Match = iota
+	// Subsequence means that the name contains the characters of the query
+	// in order.
+	Subsequence
+	// Substring means that the name contains the query.
+	Substring
+	// WordPrefix means that a word of the name starts with the query, such
+	// as "face" in "smiling_face". Words are only told apart if a separator
+	// is given to MatchName.
+	WordPrefix
+	// Prefix means that the name starts with the query.
+	Prefix
+	// Exact means that the name is the query.
+	Exact
+)
+
+// MatchName returns how well the lowercase query matches the name, ignoring
+// the case of the name. Sep separates the words of the name, or is empty if
+// the name isn't split into words.
+func MatchName(query, name, sep string) Match {
+	if name == "" {
+		return None
+	}
+
+	name = strings.ToLower(name)
+
+	switch {
+	case name == query:
+		return Exact
+	case strings.HasPrefix(name, query):
+		return Prefix
+	case sep != "" && strings.Contains(name, sep+query):
+		return WordPrefix
+	case strings.Contains(name, query):
+		return Substring
+	case IsSubsequence(query, name):
+		return Subsequence
+	default:
+		return None
+	}
+}
+
+// IsSubsequence returns true if the runes of sub appear in s in order.
+func IsSubsequence(sub, s string) bool {
+	for _, r := range s {
+		if sub == "" {
+			break
+		}
+
+		first, size := utf8.DecodeRuneInString(sub)
+		if r == first {
+			sub = sub[size:]
+		}
+	}
+
+	return sub == ""
+}
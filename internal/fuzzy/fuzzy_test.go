@@ -0,0 +1,26 @@
+package fuzzy
+
+import "testing"
+
+func TestMatchName(t *testing.T) {
+	tests := []struct {
+		query, name, sep string
+		want             Match
+	}{
+		{"face", "Face", "_", Exact},
+		{"smi", "smiling_face", "_", Prefix},
+		{"face", "smiling_face", "_", WordPrefix},
+		{"face", "smiling_face", "", Substring},
+		{"ling", "smiling_face", "_", Substring},
+		{"smf", "smiling_face", "_", Subsequence},
+		{"fs", "smiling_face", "_", None},
+		{"a", "", "", None},
+	}
+
+	for _, test := range tests {
+		if got := MatchName(test.query, test.name, test.sep); got != test.want {
+			t.Errorf("MatchName(%q, %q, %q) = %d, want %d",
+				test.query, test.name, test.sep, got, test.want)
+		}
+	}
+}
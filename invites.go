@@ -0,0 +1,200 @@
+package ningen
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/json/option"
+	"github.com/pkg/errors"
+)
+
+// DefaultInviteMaxAge is the expiry of invites created with a zero MaxAge,
+// which is the default of the official client's invite dialog.
+const DefaultInviteMaxAge = 7 * 24 * time.Hour
+
+// InviteReuseDuration is the duration that a created invite is reused for when
+// another invite with the same options is requested for the same channel.
+var InviteReuseDuration = 5 * time.Minute
+
+// InviteOpts are the options for CreateChannelInvite. The zero value matches the
+// defaults of the official client: the invite expires after 7 days and has no
+// maximum number of uses.
+type InviteOpts struct {
+	// MaxAge is the duration before the invite expires. If it is 0,
+	// DefaultInviteMaxAge is used. If it is negative, the invite never
+	// expires.
+	MaxAge time.Duration
+	// MaxUses is the maximum number of uses, or 0 for unlimited.
+	MaxUses uint
+	// Temporary grants temporary membership, which is revoked when the user
+	// disconnects without being given a role.
+	Temporary bool
+	// Unique always creates a new invite instead of reusing a recent one.
+	Unique bool
+}
+
+func (opts InviteOpts) data() api.CreateInviteData {
+	data := api.CreateInviteData{
+		MaxUses:   opts.MaxUses,
+		Temporary: opts.Temporary,
+		Unique:    opts.Unique,
+	}
+
+	switch {
+	case opts.MaxAge == 0:
+		data.MaxAge = option.NewUint(uint(DefaultInviteMaxAge / time.Second))
+	case opts.MaxAge < 0:
+		data.MaxAge = option.NewUint(0)
+	default:
+		data.MaxAge = option.NewUint(uint(opts.MaxAge / time.Second))
+	}
+
+	return data
+}
+
+type inviteKey struct {
+	channelID discord.ChannelID
+	maxAge    time.Duration
+	maxUses   uint
+	temporary bool
+}
+
+type inviteCall struct {
+	done    chan struct{}
+	invite  *discord.Invite
+	err     error
+	created time.Time
+}
+
+// inviteCache keeps the invites created recently, so that spamming the invite
+// button doesn't create a new invite every time. Concurrent requests for the
+// same invite share a single API call.
+type inviteCache struct {
+	mutex sync.Mutex
+	calls map[inviteKey]*inviteCall
+}
+
+func newInviteCache() *inviteCache {
+	return &inviteCache{
+		calls: make(map[inviteKey]*inviteCall),
+	}
+}
+
+func (c *inviteCache) handle(ev gateway.Event) {
+	switch ev := ev.(type) {
+	case *gateway.ReadyEvent:
+		c.mutex.Lock()
+		c.calls = make(map[inviteKey]*inviteCall)
+		c.mutex.Unlock()
+
+	case *gateway.InviteDeleteEvent:
+		c.remove(func(key inviteKey, call *inviteCall) bool {
+			return call.invite != nil && call.invite.Code == ev.Code
+		})
+
+	case *gateway.ChannelDeleteEvent:
+		c.remove(func(key inviteKey, _ *inviteCall) bool {
+			return key.channelID == ev.ID
+		})
+	}
+}
+
+// remove removes the finished calls that match.
+func (c *inviteCache) remove(match func(inviteKey, *inviteCall) bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for key, call := range c.calls {
+		select {
+		case <-call.done:
+		default:
+			continue
+		}
+
+		if match(key, call) {
+			delete(c.calls, key)
+		}
+	}
+}
+
+// create returns the cached invite for the key or calls create.
+func (c *inviteCache) create(key inviteKey, create func() (*discord.Invite, error)) (*discord.Invite, error) {
+	c.mutex.Lock()
+
+	if call, ok := c.calls[key]; ok {
+		select {
+		case <-call.done:
+			if call.err == nil && time.Since(call.created) < InviteReuseDuration {
+				c.mutex.Unlock()
+				return call.invite, nil
+			}
+		default:
+			c.mutex.Unlock()
+			<-call.done
+			return call.invite, call.err
+		}
+	}
+
+	call := &inviteCall{done: make(chan struct{})}
+	c.calls[key] = call
+	c.mutex.Unlock()
+
+	call.invite, call.err = create()
+	call.created = time.Now()
+
+	c.mutex.Lock()
+	if call.err != nil && c.calls[key] == call {
+		delete(c.calls, key)
+	}
+	c.mutex.Unlock()
+
+	close(call.done)
+
+	return call.invite, call.err
+}
+
+// CreateChannelInvite creates an invite to the given guild channel. It asserts
+// that the user can create invites in the channel first. Unless opts.Unique is
+// true, an invite created with the same options within InviteReuseDuration is
+// returned instead of creating a new one.
+func (s *State) CreateChannelInvite(
+	ctx context.Context, chID discord.ChannelID, opts InviteOpts) (*discord.Invite, error) {
+
+	ch, err := s.Cabinet.Channel(chID)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get channel")
+	}
+
+	if !ch.GuildID.IsValid() {
+		return nil, errors.New("invites can only be created for guild channels")
+	}
+
+	if err := s.AssertPermissions(chID, discord.PermissionCreateInstantInvite); err != nil {
+		return nil, err
+	}
+
+	create := func() (*discord.Invite, error) {
+		inv, err := s.Client.WithContext(ctx).CreateInvite(chID, opts.data())
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot create invite")
+		}
+		return inv, nil
+	}
+
+	if opts.Unique {
+		return create()
+	}
+
+	key := inviteKey{
+		channelID: chID,
+		maxAge:    opts.MaxAge,
+		maxUses:   opts.MaxUses,
+		temporary: opts.Temporary,
+	}
+
+	return s.invites.create(key, create)
+}
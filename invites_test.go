@@ -0,0 +1,21 @@
+package ningen_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/diamondburned/ningen/v3"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestCreateChannelInviteNoPermission(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	_, err := n.CreateChannelInvite(context.Background(), 300000000000000002, ningen.InviteOpts{})
+
+	var permErr *ningen.NoPermissionError
+	if !errors.As(err, &permErr) {
+		t.Fatalf("got error %v, want NoPermissionError", err)
+	}
+}
@@ -0,0 +1,198 @@
+package ningen
+
+import (
+	"regexp"
+	"sync"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/pkg/errors"
+)
+
+// MaxLinkPreviews is the number of messages resolved from message links that
+// are cached.
+const MaxLinkPreviews = 256
+
+// messageLinkRegex matches the message links in message content. ParseLink
+// validates them further.
+var messageLinkRegex = regexp.MustCompile(
+	`https?://(?:(?:ptb|canary)\.)?discord(?:app)?\.com/channels/(?:@me|\d+)/\d+/\d+`,
+)
+
+// MessageLinkPreview is a message link in a message along with the message it
+// links to.
+type MessageLinkPreview struct {
+	Link Link
+	// Message is the linked message. It is nil if the message couldn't be
+	// resolved, in which case Err is the reason.
+	Message *discord.Message
+	Err     error
+}
+
+// FindMessageLinks returns the message links in the content in the order that
+// they appear. Duplicate links are only returned once.
+func FindMessageLinks(content string) []Link {
+	var links []Link
+
+	for _, match := range messageLinkRegex.FindAllString(content, -1) {
+		link, err := ParseMessageLink(match)
+		if err != nil {
+			continue
+		}
+
+		dupe := false
+		for _, l := range links {
+			if l == link {
+				dupe = true
+				break
+			}
+		}
+
+		if !dupe {
+			links = append(links, link)
+		}
+	}
+
+	return links
+}
+
+// MessageLinkPreviews resolves the messages linked in the given message for
+// inline previews. The content is only searched for links; use discordmd to
+// render it. Links that can't be resolved are still returned with the error.
+func (s *State) MessageLinkPreviews(msg *discord.Message) []MessageLinkPreview {
+	links := FindMessageLinks(msg.Content)
+	if len(links) == 0 {
+		return nil
+	}
+
+	previews := make([]MessageLinkPreview, len(links))
+	for i, link := range links {
+		m, err := s.ResolveMessageLink(link)
+		previews[i] = MessageLinkPreview{
+			Link:    link,
+			Message: m,
+			Err:     err,
+		}
+	}
+
+	return previews
+}
+
+// ResolveMessageLink returns the message that the link points to. The user
+// must be able to read the message history of guild channels, and DM channels
+// must be known. The message is taken from the cabinet if possible; otherwise,
+// it is fetched and cached separately, so the channel's messages in the
+// cabinet aren't affected.
+func (s *State) ResolveMessageLink(link Link) (*discord.Message, error) {
+	if !link.MessageID.IsValid() {
+		return nil, ErrInvalidLink
+	}
+
+	ch, err := s.Cabinet.Channel(link.ChannelID)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get linked channel")
+	}
+
+	if ch.GuildID.IsValid() {
+		err := s.AssertPermissions(ch.ID, discord.PermissionViewChannel|discord.PermissionReadMessageHistory)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if m, err := s.Cabinet.Message(link.ChannelID, link.MessageID); err == nil {
+		return m, nil
+	}
+
+	if m, ok := s.linkPreviews.get(link.MessageID); ok {
+		return m, nil
+	}
+
+	m, err := s.Client.Message(link.ChannelID, link.MessageID)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot fetch linked message")
+	}
+
+	s.linkPreviews.set(m)
+	return m, nil
+}
+
+// linkPreviewCache caches the messages fetched for message links. The oldest
+// message is evicted once it holds MaxLinkPreviews messages.
+type linkPreviewCache struct {
+	mutex    sync.Mutex
+	messages map[discord.MessageID]*discord.Message
+	order    []discord.MessageID
+}
+
+func newLinkPreviewCache() *linkPreviewCache {
+	return &linkPreviewCache{
+		messages: make(map[discord.MessageID]*discord.Message),
+	}
+}
+
+func (c *linkPreviewCache) handle(ev gateway.Event) {
+	switch ev := ev.(type) {
+	case *gateway.ReadyEvent:
+		c.mutex.Lock()
+		c.messages = make(map[discord.MessageID]*discord.Message)
+		c.order = nil
+		c.mutex.Unlock()
+
+	case *gateway.MessageUpdateEvent:
+		c.mutex.Lock()
+		if _, ok := c.messages[ev.ID]; ok {
+			// Message updates may be partial, so fetch it again next time.
+			delete(c.messages, ev.ID)
+		}
+		c.mutex.Unlock()
+
+	case *gateway.MessageDeleteEvent:
+		c.mutex.Lock()
+		delete(c.messages, ev.ID)
+		c.mutex.Unlock()
+
+	case *gateway.MessageDeleteBulkEvent:
+		c.mutex.Lock()
+		for _, id := range ev.IDs {
+			delete(c.messages, id)
+		}
+		c.mutex.Unlock()
+	}
+}
+
+func (c *linkPreviewCache) get(id discord.MessageID) (*discord.Message, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	m, ok := c.messages[id]
+	return m, ok
+}
+
+func (c *linkPreviewCache) set(m *discord.Message) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := c.messages[m.ID]; !ok {
+		c.order = append(c.order, m.ID)
+	}
+	c.messages[m.ID] = m
+
+	// Evict the oldest messages, skipping the ones that were already removed
+	// by events.
+	for len(c.messages) > MaxLinkPreviews && len(c.order) > 0 {
+		delete(c.messages, c.order[0])
+		c.order = c.order[1:]
+	}
+
+	// Don't let the order grow with removed messages forever.
+	if len(c.order) > 2*MaxLinkPreviews {
+		order := c.order[:0]
+		for _, id := range c.order {
+			if _, ok := c.messages[id]; ok {
+				order = append(order, id)
+			}
+		}
+		c.order = order
+	}
+}
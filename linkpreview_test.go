@@ -0,0 +1,75 @@
+package ningen_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/httputil/httpdriver"
+	"github.com/diamondburned/ningen/v3"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestMessageLinkPreviews(t *testing.T) {
+	const dmID = 400000000000000001
+
+	n := ningentest.NewState(t, ningentest.Guilds)
+	n.ChannelSet(&discord.Channel{ID: dmID, Type: discord.DirectMessage}, false)
+	n.MessageSet(&discord.Message{ID: 900000000000000200, ChannelID: dmID, Content: "cached"}, false)
+
+	var fetches int32
+	n.Client.Client.Retries = 1
+	n.Client.Client.Client = httpdriver.WrapClient(http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			atomic.AddInt32(&fetches, 1)
+			body := `{"id":"900000000000000201","channel_id":"400000000000000001","content":"fetched"}`
+			return &http.Response{
+				StatusCode: 200,
+				Header:     http.Header{"Content-Type": {"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(body)),
+			}, nil
+		}),
+	})
+
+	msg := &discord.Message{Content: "see https://discord.com/channels/@me/400000000000000001/900000000000000200 " +
+		"and <https://discord.com/channels/@me/400000000000000001/900000000000000201>, " +
+		"https://discord.com/channels/200000000000000001/300000000000000002/900000000000000010 " +
+		"and again https://discord.com/channels/@me/400000000000000001/900000000000000200"}
+
+	previews := n.MessageLinkPreviews(msg)
+	if len(previews) != 3 {
+		t.Fatalf("got %d previews, want 3", len(previews))
+	}
+
+	if m := previews[0].Message; m == nil || m.Content != "cached" {
+		t.Errorf("got cabinet preview %+v, %v", m, previews[0].Err)
+	}
+	if m := previews[1].Message; m == nil || m.Content != "fetched" {
+		t.Errorf("got fetched preview %+v, %v", m, previews[1].Err)
+	}
+
+	// The fixture guild doesn't give Read Message History.
+	var noPerm *ningen.NoPermissionError
+	if previews[2].Message != nil || !errors.As(previews[2].Err, &noPerm) {
+		t.Errorf("got guild preview %+v, want NoPermissionError", previews[2])
+	}
+
+	n.MessageLinkPreviews(msg)
+	if got := atomic.LoadInt32(&fetches); got != 1 {
+		t.Errorf("fetched %d times, want once", got)
+	}
+
+	ningentest.Dispatch(n, &gateway.MessageDeleteEvent{ID: 900000000000000201, ChannelID: dmID})
+
+	if _, err := n.ResolveMessageLink(previews[1].Link); err != nil {
+		t.Fatal("cannot resolve link:", err)
+	}
+	if got := atomic.LoadInt32(&fetches); got != 2 {
+		t.Errorf("fetched %d times after delete, want twice", got)
+	}
+}
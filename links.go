@@ -0,0 +1,132 @@
+package ningen
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/pkg/errors"
+)
+
+// LinkBaseURL is the base URL of the links made by ChannelLink and
+// MessageLink.
+const LinkBaseURL = "https://discord.com/channels/"
+
+// ErrInvalidLink is returned when parsing a link that isn't a Discord channel
+// or message link.
+var ErrInvalidLink = errors.New("not a Discord channel or message link")
+
+// linkHosts are the hosts of the official clients' links.
+var linkHosts = map[string]bool{
+	"discord.com":           true,
+	"ptb.discord.com":       true,
+	"canary.discord.com":    true,
+	"discordapp.com":        true,
+	"ptb.discordapp.com":    true,
+	"canary.discordapp.com": true,
+}
+
+// Link is a link to a channel or a message, as copied using "Copy Link" in the
+// official client. GuildID is null for DM channels and MessageID is null for
+// channel links.
+type Link struct {
+	GuildID   discord.GuildID
+	ChannelID discord.ChannelID
+	MessageID discord.MessageID
+}
+
+// String returns the canonical URL of the link.
+func (l Link) String() string {
+	guild := "@me"
+	if l.GuildID.IsValid() {
+		guild = l.GuildID.String()
+	}
+
+	u := LinkBaseURL + guild + "/" + l.ChannelID.String()
+	if l.MessageID.IsValid() {
+		u += "/" + l.MessageID.String()
+	}
+
+	return u
+}
+
+// ChannelLink returns the link to the channel. The guild ID is null for DM
+// channels.
+func ChannelLink(guildID discord.GuildID, chID discord.ChannelID) string {
+	return Link{GuildID: guildID, ChannelID: chID}.String()
+}
+
+// MessageLink returns the link to the message. The guild ID is null for
+// messages in DM channels.
+func MessageLink(guildID discord.GuildID, chID discord.ChannelID, msgID discord.MessageID) string {
+	return Link{GuildID: guildID, ChannelID: chID, MessageID: msgID}.String()
+}
+
+// MessageLinkOf returns the link to the given message.
+func MessageLinkOf(msg *discord.Message) string {
+	return MessageLink(msg.GuildID, msg.ChannelID, msg.ID)
+}
+
+// ChannelLinkOf returns the link to the given channel.
+func ChannelLinkOf(ch *discord.Channel) string {
+	return ChannelLink(ch.GuildID, ch.ID)
+}
+
+// ParseLink parses a channel or message link. Links of the PTB and Canary
+// clients and of the old discordapp.com domain are accepted.
+func ParseLink(link string) (Link, error) {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return Link{}, ErrInvalidLink
+	}
+
+	if u.Scheme != "https" && u.Scheme != "http" || !linkHosts[strings.ToLower(u.Host)] {
+		return Link{}, ErrInvalidLink
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 3 || len(parts) > 4 || parts[0] != "channels" {
+		return Link{}, ErrInvalidLink
+	}
+
+	var l Link
+
+	if parts[1] != "@me" {
+		id, err := discord.ParseSnowflake(parts[1])
+		if err != nil || !id.IsValid() {
+			return Link{}, ErrInvalidLink
+		}
+		l.GuildID = discord.GuildID(id)
+	}
+
+	chID, err := discord.ParseSnowflake(parts[2])
+	if err != nil || !chID.IsValid() {
+		return Link{}, ErrInvalidLink
+	}
+	l.ChannelID = discord.ChannelID(chID)
+
+	if len(parts) == 4 {
+		msgID, err := discord.ParseSnowflake(parts[3])
+		if err != nil || !msgID.IsValid() {
+			return Link{}, ErrInvalidLink
+		}
+		l.MessageID = discord.MessageID(msgID)
+	}
+
+	return l, nil
+}
+
+// ParseMessageLink parses a message link. ErrInvalidLink is returned for
+// channel links.
+func ParseMessageLink(link string) (Link, error) {
+	l, err := ParseLink(link)
+	if err != nil {
+		return Link{}, err
+	}
+
+	if !l.MessageID.IsValid() {
+		return Link{}, ErrInvalidLink
+	}
+
+	return l, nil
+}
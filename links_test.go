@@ -0,0 +1,57 @@
+package ningen_test
+
+import (
+	"testing"
+
+	"github.com/diamondburned/ningen/v3"
+)
+
+func TestLinks(t *testing.T) {
+	tests := []struct {
+		link string
+		want ningen.Link
+		err  bool
+	}{
+		{link: "https://discord.com/channels/1/2/3", want: ningen.Link{GuildID: 1, ChannelID: 2, MessageID: 3}},
+		{link: "https://discord.com/channels/1/2", want: ningen.Link{GuildID: 1, ChannelID: 2}},
+		{link: "https://discord.com/channels/@me/2/3", want: ningen.Link{ChannelID: 2, MessageID: 3}},
+		{link: "https://canary.discordapp.com/channels/1/2/3/", want: ningen.Link{GuildID: 1, ChannelID: 2, MessageID: 3}},
+		{link: "https://example.com/channels/1/2/3", err: true},
+		{link: "https://discord.com/channels/1", err: true},
+		{link: "https://discord.com/channels/1/abc", err: true},
+		{link: "https://discord.com/invite/abc", err: true},
+		{link: "javascript://discord.com/channels/1/2/3", err: true},
+	}
+
+	for _, test := range tests {
+		l, err := ningen.ParseLink(test.link)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected error, got %+v", test.link, l)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.link, err)
+			continue
+		}
+
+		if l != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.link, l, test.want)
+		}
+
+		// Round-trip through the canonical form.
+		if again, err := ningen.ParseLink(l.String()); err != nil || again != l {
+			t.Errorf("%s: canonical link %s parsed to %+v, %v", test.link, l, again, err)
+		}
+	}
+
+	if got := ningen.MessageLink(0, 2, 3); got != "https://discord.com/channels/@me/2/3" {
+		t.Errorf("got DM message link %s", got)
+	}
+
+	if _, err := ningen.ParseMessageLink("https://discord.com/channels/1/2"); err != ningen.ErrInvalidLink {
+		t.Errorf("expected ErrInvalidLink for channel link, got %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+package ningen
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/ningen/v3/states/member"
+)
+
+// MentionRecentAuthors is the number of most recent message authors in a
+// channel that SuggestMentions ranks higher.
+const MentionRecentAuthors = 10
+
+// MentionCandidate is a member that may be suggested when autocompleting a
+// mention, along with what RankMentions weighs besides their name.
+type MentionCandidate struct {
+	Member discord.Member
+	// RecentRank is the rank of the member among the recent authors of the
+	// channel, where 1 is the author of the latest message. It is 0 if the
+	// member hasn't sent any of the recent messages.
+	RecentRank int
+	// Friend is true if the member is a friend of the user.
+	Friend bool
+	// RoleMatch is true if one of the member's roles has a name that starts
+	// with the query, such that "@mod" suggests the moderators.
+	RoleMatch bool
+}
+
+// Weights of MentionScore, from the heaviest to the lightest. An exact match
+// outweighs a prefix match with everything else combined, which in turn
+// outweighs everything but an exact match, so typing a whole name always puts
+// that member first. Recent authors outweigh friends, who outweigh role
+// members. The fuzzy matches only break ties.
+const (
+	mentionExactWeight       = 20000
+	mentionPrefixWeight      = 10000
+	mentionRecentWeight      = 1000
+	mentionFriendWeight      = 500
+	mentionRoleWeight        = 200
+	mentionSubstringWeight   = 20
+	mentionSubsequenceWeight = 10
+)
+
+// MentionScore returns the score of the candidate for the query. Candidates
+// with a higher score should be suggested first. The score is 0 if the
+// candidate shouldn't be suggested at all, which is when neither their names
+// nor their roles match the query.
+func MentionScore(query string, c *MentionCandidate) int {
+	var score int
+
+	switch member.MatchMember(query, &c.Member) {
+	case member.MatchExact:
+		score += mentionExactWeight
+	case member.MatchPrefix:
+		score += mentionPrefixWeight
+	case member.MatchSubstring:
+		score += mentionSubstringWeight
+	case member.MatchSubsequence:
+		score += mentionSubsequenceWeight
+	default:
+		if !c.RoleMatch {
+			return 0
+		}
+	}
+
+	if c.RecentRank > 0 && c.RecentRank <= MentionRecentAuthors {
+		// The latest author weighs the most.
+		score += mentionRecentWeight - (c.RecentRank-1)*(mentionRecentWeight/(2*MentionRecentAuthors))
+	}
+	if c.Friend {
+		score += mentionFriendWeight
+	}
+	if c.RoleMatch {
+		score += mentionRoleWeight
+	}
+
+	return score
+}
+
+// RankMentions sorts the candidates from the best to the worst for the query
+// and drops the ones that shouldn't be suggested. Candidates with the same
+// score are sorted by their names, then by their IDs, so every frontend ranks
+// them in the same order. At most limit candidates are returned, or all of
+// them if limit is 0 or less.
+func RankMentions(query string, candidates []MentionCandidate, limit int) []MentionCandidate {
+	type scored struct {
+		candidate MentionCandidate
+		score     int
+		name      string
+	}
+
+	ranked := make([]scored, 0, len(candidates))
+	for i := range candidates {
+		score := MentionScore(query, &candidates[i])
+		if score == 0 {
+			continue
+		}
+
+		ranked = append(ranked, scored{
+			candidate: candidates[i],
+			score:     score,
+			name:      strings.ToLower(memberName(&candidates[i].Member)),
+		})
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].score != ranked[j].score {
+			return ranked[i].score > ranked[j].score
+		}
+		if ranked[i].name != ranked[j].name {
+			return ranked[i].name < ranked[j].name
+		}
+		return ranked[i].candidate.Member.User.ID < ranked[j].candidate.Member.User.ID
+	})
+
+	if limit > 0 && len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+
+	sorted := make([]MentionCandidate, len(ranked))
+	for i, r := range ranked {
+		sorted[i] = r.candidate
+	}
+
+	return sorted
+}
+
+// SuggestMentions ranks the members for a mention being typed in the channel
+// using RankMentions. The recent authors come from the channel's messages in
+// the cabinet, the friends from RelationshipState, and the roles from the
+// cabinet. The members usually come from MemberState.SearchList and the
+// member store.
+func (s *State) SuggestMentions(chID discord.ChannelID, query string, members []discord.Member, limit int) []MentionCandidate {
+	recent := make(map[discord.UserID]int, MentionRecentAuthors)
+	if msgs, err := s.Cabinet.Messages(chID); err == nil {
+		for _, msg := range msgs {
+			if len(recent) == MentionRecentAuthors {
+				break
+			}
+			if _, ok := recent[msg.Author.ID]; !ok {
+				recent[msg.Author.ID] = len(recent) + 1
+			}
+		}
+	}
+
+	matchingRoles := make(map[discord.RoleID]bool)
+	if ch, err := s.Cabinet.Channel(chID); err == nil && ch.GuildID.IsValid() {
+		lowerQuery := strings.ToLower(strings.TrimSpace(query))
+		roles, _ := s.RolesSorted(ch.GuildID)
+		for _, role := range roles {
+			// @everyone is mentioned differently.
+			if lowerQuery != "" && role.ID != discord.RoleID(ch.GuildID) &&
+				strings.HasPrefix(strings.ToLower(role.Name), lowerQuery) {
+				matchingRoles[role.ID] = true
+			}
+		}
+	}
+
+	candidates := make([]MentionCandidate, len(members))
+	for i, m := range members {
+		c := MentionCandidate{
+			Member:     m,
+			RecentRank: recent[m.User.ID],
+			Friend:     s.RelationshipState.Relationship(m.User.ID) == discord.FriendRelationship,
+		}
+		for _, roleID := range m.RoleIDs {
+			if matchingRoles[roleID] {
+				c.RoleMatch = true
+				break
+			}
+		}
+		candidates[i] = c
+	}
+
+	return RankMentions(query, candidates, limit)
+}
+
+// memberName returns the name that the member is shown with.
+func memberName(m *discord.Member) string {
+	if m.Nick != "" {
+		return m.Nick
+	}
+	return m.User.DisplayOrUsername()
+}
@@ -0,0 +1,62 @@
+package ningen_test
+
+import (
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/ningen/v3"
+)
+
+func TestRankMentions(t *testing.T) {
+	member := func(id discord.UserID, name string) discord.Member {
+		return discord.Member{User: discord.User{ID: id, Username: name}}
+	}
+
+	candidates := []ningen.MentionCandidate{
+		{Member: member(1, "xalice")},                  // substring
+		{Member: member(2, "alfred")},                  // prefix
+		{Member: member(3, "albert"), Friend: true},    // prefix, friend
+		{Member: member(4, "alan"), RecentRank: 2},     // prefix, recent
+		{Member: member(5, "alma"), RecentRank: 1},     // prefix, latest
+		{Member: member(6, "bob"), RoleMatch: true},    // role only
+		{Member: member(7, "zed")},                     // no match
+		{Member: member(8, "a_l"), RecentRank: 3},      // subsequence, recent
+		{Member: member(9, "alfred")},                  // same name as 2
+		{Member: member(10, "mallory"), Friend: true},  // substring, friend
+		{Member: member(11, "al"), RoleMatch: true},    // exact, role
+		{Member: member(12, "dave"), RecentRank: 100},  // no match, too old
+		{Member: member(13, "x_a_l"), RoleMatch: true}, // subsequence, role
+	}
+
+	got := ningen.RankMentions("Al", candidates, 0)
+
+	want := []discord.UserID{11, 5, 4, 3, 2, 9, 8, 10, 13, 6, 1}
+	if len(got) != len(want) {
+		t.Fatalf("got %d candidates, want %d", len(got), len(want))
+	}
+	for i, c := range got {
+		if c.Member.User.ID != want[i] {
+			t.Errorf("candidate %d is %s (%d), want %d", i, c.Member.User.Username, c.Member.User.ID, want[i])
+		}
+	}
+
+	if got := ningen.RankMentions("al", candidates, 2); len(got) != 2 || got[1].Member.User.ID != 5 {
+		t.Errorf("limited ranking is %+v, want al then alma", got)
+	}
+}
+
+func TestMentionScoreExact(t *testing.T) {
+	exact := ningen.MentionCandidate{
+		Member: discord.Member{User: discord.User{ID: 1, Username: "al"}},
+	}
+	prefix := ningen.MentionCandidate{
+		Member:     discord.Member{User: discord.User{ID: 2, Username: "alma"}},
+		RecentRank: 1,
+		Friend:     true,
+		RoleMatch:  true,
+	}
+
+	if e, p := ningen.MentionScore("al", &exact), ningen.MentionScore("al", &prefix); e <= p {
+		t.Errorf("exact match scored %d, not above the prefix match's %d", e, p)
+	}
+}
@@ -0,0 +1,211 @@
+package ningen
+
+import (
+	"sync"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+	"github.com/diamondburned/ningen/v3/states/read"
+)
+
+// MentionCountEvent is dispatched when the mention count of a guild changes,
+// which also changes the total. Private channels are counted under a null
+// GuildID. Taskbar badges can use it instead of going through all read states
+// on every read.UpdateEvent.
+type MentionCountEvent struct {
+	GuildID discord.GuildID
+	Count   int
+	Total   int
+}
+
+var _ gateway.Event = (*MentionCountEvent)(nil)
+
+func (ev MentionCountEvent) Op() ws.OpCode           { return -1 }
+func (ev MentionCountEvent) EventType() ws.EventType { return "__ningen.MentionCountEvent" }
+
+// GuildMentionCount returns the number of unread mentions in the guild's
+// channels, or in private channels if guildID is null. See TotalMentionCount
+// for which mentions are counted.
+func (s *State) GuildMentionCount(guildID discord.GuildID) int {
+	return s.mentions.guild(guildID)
+}
+
+// TotalMentionCount returns the number of unread mentions in all guilds and
+// private channels. Like GuildIsUnread, mentions count even in muted channels,
+// unless the channel's notifications are turned off entirely. Mentions in
+// channels that the user can't see don't count.
+func (s *State) TotalMentionCount() int {
+	return s.mentions.totalCount()
+}
+
+// countsMentions returns true if the mentions in the channel should be
+// counted.
+func (s *State) countsMentions(chID discord.ChannelID, guildID discord.GuildID) bool {
+	if !guildID.IsValid() {
+		return true
+	}
+
+	notifications := s.MutedState.ChannelOverrides(chID).Notifications
+	if notifications == gateway.GuildDefaults {
+		notifications = s.MutedState.GuildSettings(guildID).Notifications
+	}
+	if notifications == gateway.NoNotifications {
+		return false
+	}
+
+	return s.HasPermissions(chID, discord.PermissionViewChannel)
+}
+
+type channelMentions struct {
+	guildID  discord.GuildID
+	mentions int
+}
+
+// mentionCounter keeps the mention counts of guilds up to date.
+type mentionCounter struct {
+	mutex    sync.Mutex
+	channels map[discord.ChannelID]channelMentions
+	guilds   map[discord.GuildID]int
+	total    int
+
+	state    *State
+	dispatch func(*MentionCountEvent)
+}
+
+func newMentionCounter(state *State, dispatch func(*MentionCountEvent)) *mentionCounter {
+	return &mentionCounter{
+		channels: make(map[discord.ChannelID]channelMentions),
+		guilds:   make(map[discord.GuildID]int),
+		state:    state,
+		dispatch: dispatch,
+	}
+}
+
+func (c *mentionCounter) handle(ev gateway.Event) {
+	var events []*MentionCountEvent
+
+	switch ev := ev.(type) {
+	case *gateway.ReadyEvent:
+		c.mutex.Lock()
+
+		guilds := make(map[discord.GuildID]struct{}, len(c.guilds))
+		for guildID := range c.guilds {
+			guilds[guildID] = struct{}{}
+		}
+
+		c.channels = make(map[discord.ChannelID]channelMentions)
+		for _, rs := range c.state.ReadState.Mentioned() {
+			var guildID discord.GuildID
+			if ch, err := c.state.Cabinet.Channel(rs.ChannelID); err == nil {
+				guildID = ch.GuildID
+			}
+
+			c.channels[rs.ChannelID] = channelMentions{guildID, rs.MentionCount}
+			guilds[guildID] = struct{}{}
+		}
+
+		for guildID := range guilds {
+			events = c.recount(events, guildID)
+		}
+
+		c.mutex.Unlock()
+
+	case *read.UpdateEvent:
+		c.mutex.Lock()
+
+		old, ok := c.channels[ev.ChannelID]
+		if ev.MentionCount > 0 {
+			c.channels[ev.ChannelID] = channelMentions{ev.GuildID, ev.MentionCount}
+		} else {
+			delete(c.channels, ev.ChannelID)
+		}
+
+		if ok && old.guildID != ev.GuildID {
+			events = c.recount(events, old.guildID)
+		}
+		if ok || ev.MentionCount > 0 {
+			events = c.recount(events, ev.GuildID)
+		}
+
+		c.mutex.Unlock()
+
+	case *gateway.UserGuildSettingsUpdateEvent:
+		c.mutex.Lock()
+		events = c.recount(events, ev.GuildID)
+		c.mutex.Unlock()
+
+	case *gateway.ChannelUpdateEvent:
+		// The channel's overwrites may have changed.
+		c.mutex.Lock()
+		if _, ok := c.channels[ev.ID]; ok {
+			events = c.recount(events, ev.GuildID)
+		}
+		c.mutex.Unlock()
+
+	case *gateway.ChannelDeleteEvent:
+		c.mutex.Lock()
+		if _, ok := c.channels[ev.ID]; ok {
+			delete(c.channels, ev.ID)
+			events = c.recount(events, ev.GuildID)
+		}
+		c.mutex.Unlock()
+
+	case *gateway.GuildDeleteEvent:
+		c.mutex.Lock()
+		for chID, ch := range c.channels {
+			if ch.guildID == ev.ID {
+				delete(c.channels, chID)
+			}
+		}
+		events = c.recount(events, ev.ID)
+		c.mutex.Unlock()
+	}
+
+	for _, ev := range events {
+		c.dispatch(ev)
+	}
+}
+
+// recount recounts the mentions of the guild and appends an event to events if
+// the count changed. c.mutex must be held.
+func (c *mentionCounter) recount(events []*MentionCountEvent, guildID discord.GuildID) []*MentionCountEvent {
+	var count int
+	for chID, ch := range c.channels {
+		if ch.guildID == guildID && c.state.countsMentions(chID, guildID) {
+			count += ch.mentions
+		}
+	}
+
+	old := c.guilds[guildID]
+	if count == old {
+		return events
+	}
+
+	if count > 0 {
+		c.guilds[guildID] = count
+	} else {
+		delete(c.guilds, guildID)
+	}
+	c.total += count - old
+
+	return append(events, &MentionCountEvent{
+		GuildID: guildID,
+		Count:   count,
+		Total:   c.total,
+	})
+}
+
+func (c *mentionCounter) guild(guildID discord.GuildID) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.guilds[guildID]
+}
+
+func (c *mentionCounter) totalCount() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.total
+}
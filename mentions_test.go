@@ -0,0 +1,91 @@
+package ningen_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/ningen/v3"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestMentionCount(t *testing.T) {
+	const (
+		guildID = 200000000000000001
+		mutedID = 200000000000000002
+	)
+
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	// The muted guild's mentions still count.
+	if got := n.GuildMentionCount(mutedID); got != 2 {
+		t.Fatalf("got %d mentions in the muted guild, want 2", got)
+	}
+	if got := n.TotalMentionCount(); got != 2 {
+		t.Fatalf("got %d mentions in total, want 2", got)
+	}
+
+	events := make(chan *ningen.MentionCountEvent, 10)
+	n.AddSyncHandler(func(ev *ningen.MentionCountEvent) { events <- ev })
+
+	mention := func(chID discord.ChannelID, msgID discord.MessageID) {
+		ningentest.Dispatch(n, &gateway.MessageCreateEvent{Message: discord.Message{
+			ID:        msgID,
+			ChannelID: chID,
+			GuildID:   guildID,
+			Author:    discord.User{ID: 100000000000000002},
+			Mentions:  []discord.GuildUser{{User: discord.User{ID: 100000000000000001}}},
+		}})
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		if err := n.ReadState.Flush(ctx); err != nil {
+			t.Fatal("cannot flush read state:", err)
+		}
+	}
+
+	mention(300000000000000003, 900000000000000030)
+
+	select {
+	case ev := <-events:
+		if ev.GuildID != guildID || ev.Count != 1 || ev.Total != 3 {
+			t.Fatalf("got event %+v", ev)
+		}
+	default:
+		t.Fatal("no MentionCountEvent dispatched")
+	}
+
+	// Mentions in the hidden channel don't count.
+	mention(300000000000000005, 900000000000000031)
+
+	if got := n.GuildMentionCount(guildID); got != 1 {
+		t.Fatalf("got %d mentions after a hidden mention, want 1", got)
+	}
+	if len(events) > 0 {
+		t.Fatalf("unexpected event %+v", <-events)
+	}
+
+	// Turning off the guild's notifications hides its mentions.
+	ningentest.Dispatch(n, &gateway.UserGuildSettingsUpdateEvent{
+		UserGuildSetting: gateway.UserGuildSetting{
+			GuildID:       mutedID,
+			Notifications: gateway.NoNotifications,
+		},
+	})
+
+	if got := n.TotalMentionCount(); got != 1 {
+		t.Fatalf("got %d mentions in total, want 1", got)
+	}
+
+	select {
+	case ev := <-events:
+		if ev.GuildID != mutedID || ev.Count != 0 || ev.Total != 1 {
+			t.Fatalf("got event %+v", ev)
+		}
+	default:
+		t.Fatal("no MentionCountEvent dispatched")
+	}
+}
@@ -0,0 +1,215 @@
+package ningen_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/httputil/httpdriver"
+	"github.com/diamondburned/ningen/v3/discordmd"
+	"github.com/diamondburned/ningen/v3/ningentest"
+	"github.com/diamondburned/ningen/v3/prefetch"
+)
+
+func TestLoadMore(t *testing.T) {
+	const chID = 300000000000000002
+	const total = 120
+
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	// The channel has messages 1 to 120, a millisecond apart.
+	id := func(i int) discord.MessageID { return discord.MessageID(i << 22) }
+
+	var requests int32
+	release := make(chan struct{})
+
+	n.Client.Client.Retries = 1
+	n.Client.Client.Client = httpdriver.WrapClient(http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			atomic.AddInt32(&requests, 1)
+			<-release
+
+			before := total + 1
+			if b := r.URL.Query().Get("before"); b != "" {
+				b, _ := strconv.Atoi(b)
+				before = b >> 22
+			}
+			limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+			var msgs []discord.Message
+			for i := before - 1; i > 0 && len(msgs) < limit; i-- {
+				msgs = append(msgs, discord.Message{ID: id(i), ChannelID: chID})
+			}
+
+			body, _ := json.Marshal(msgs)
+			return &http.Response{
+				StatusCode: 200,
+				Header:     http.Header{"Content-Type": {"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(string(body))),
+			}, nil
+		}),
+	})
+
+	// Concurrent loads share the request.
+	var wg sync.WaitGroup
+	results := make([][]discord.Message, 3)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			msgs, err := n.MessageState.LoadMore(chID, 0, 50)
+			if err != nil {
+				t.Error("cannot load messages:", err)
+			}
+			results[i] = msgs
+		}(i)
+	}
+
+	// Wait for the other loads to join the first one's request.
+	waitFor(t, "the loads to join", func() bool { return n.MessageState.Pending() == len(results) })
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Fatalf("made %d requests for concurrent loads, want 1", got)
+	}
+	for i, msgs := range results {
+		if len(msgs) != 50 || msgs[0].ID != id(120) || msgs[49].ID != id(71) {
+			t.Fatalf("load %d: got %d messages", i, len(msgs))
+		}
+	}
+
+	if n.MessageState.ReachedTop(chID) {
+		t.Fatal("top reached after first load")
+	}
+
+	// The following loads continue from the oldest message in the cabinet.
+	msgs, err := n.MessageState.LoadMore(chID, 0, 50)
+	if err != nil || len(msgs) != 50 || msgs[0].ID != id(70) {
+		t.Fatalf("got %d messages, %v", len(msgs), err)
+	}
+
+	msgs, err = n.MessageState.LoadMore(chID, 0, 50)
+	if err != nil || len(msgs) != 20 || msgs[19].ID != id(1) {
+		t.Fatalf("got %d messages, %v", len(msgs), err)
+	}
+
+	if !n.MessageState.ReachedTop(chID) {
+		t.Error("top not reached after loading the first message")
+	}
+
+	// The newest messages are still in the cabinet.
+	cached, _ := n.Cabinet.Messages(chID)
+	if len(cached) == 0 || cached[0].ID != id(120) {
+		t.Errorf("newest cached message is not the latest")
+	}
+}
+
+func TestLoadMoreAttachmentFlags(t *testing.T) {
+	const chID = 300000000000000002
+
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	n.Client.Client.Retries = 1
+	n.Client.Client.Client = httpdriver.WrapClient(http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: 200,
+				Header:     http.Header{"Content-Type": {"application/json"}},
+				Body: io.NopCloser(strings.NewReader(`[{
+					"id": "900000000000000100",
+					"channel_id": "300000000000000002",
+					"attachments": [
+						{"id": "1", "filename": "cat.png", "flags": 8},
+						{"id": "2", "filename": "dog.png"}
+					]
+				}]`)),
+			}, nil
+		}),
+	})
+
+	msgs, err := n.MessageState.LoadMore(chID, 0, 50)
+	if err != nil {
+		t.Fatal("cannot load messages:", err)
+	}
+	if len(msgs) != 1 || len(msgs[0].Attachments) != 2 || msgs[0].Attachments[0].Filename != "cat.png" {
+		t.Fatalf("got messages %+v", msgs)
+	}
+
+	views := discordmd.ViewAttachments(&msgs[0], n.MessageState.AttachmentFlags)
+	if !views[0].Spoiler || views[1].Spoiler {
+		t.Errorf("got spoilers %v and %v, want only the first", views[0].Spoiler, views[1].Spoiler)
+	}
+
+	// The flags are dropped along with the message.
+	ningentest.Dispatch(n, &gateway.MessageDeleteBulkEvent{
+		IDs:       []discord.MessageID{900000000000000100},
+		ChannelID: chID,
+	})
+
+	if flags := n.MessageState.AttachmentFlags(1); flags != 0 {
+		t.Errorf("got flags %v after deleting the message, want none", flags)
+	}
+}
+
+func TestPrefetchHistory(t *testing.T) {
+	const chID = 300000000000000002
+
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	n.Client.Client.Retries = 1
+	n.Client.Client.Client = httpdriver.WrapClient(http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: 200,
+				Header:     http.Header{"Content-Type": {"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(`[{"id": "900000000000000100", "channel_id": "300000000000000002"}]`)),
+			}, nil
+		}),
+	})
+
+	n.MessageState.Prefetch(context.Background(), chID, prefetch.Adjacent)
+
+	waitFor(t, "the history to be prefetched", func() bool { return n.MessageState.ReachedTop(chID) })
+
+	if msgs, _ := n.Cabinet.Messages(chID); len(msgs) != 1 {
+		t.Fatalf("got %d cached messages after prefetching, want 1", len(msgs))
+	}
+}
+
+func TestPrefetchAttachments(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	msgs := []discord.Message{
+		{ID: 1, Attachments: []discord.Attachment{{ID: 1}, {ID: 2}}},
+		{ID: 2, Attachments: []discord.Attachment{{ID: 3}}},
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	n.MessageState.PrefetchAttachments(canceled, msgs, prefetch.Visible, func(_ context.Context, a discord.Attachment) {
+		t.Errorf("attachment %d fetched after canceling", a.ID)
+	})
+
+	fetched := make(chan discord.AttachmentID, 3)
+	n.MessageState.PrefetchAttachments(context.Background(), msgs, prefetch.Visible, func(_ context.Context, a discord.Attachment) {
+		fetched <- a.ID
+	})
+
+	got := map[discord.AttachmentID]bool{}
+	for i := 0; i < 3; i++ {
+		got[<-fetched] = true
+	}
+	if len(got) != 3 {
+		t.Fatalf("fetched attachments %v, want 1, 2 and 3", got)
+	}
+}
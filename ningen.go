@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/diamondburned/arikawa/v3/api"
@@ -15,18 +16,30 @@ import (
 	"github.com/diamondburned/arikawa/v3/state"
 	"github.com/diamondburned/arikawa/v3/utils/handler"
 	"github.com/diamondburned/arikawa/v3/utils/httputil"
-	"github.com/diamondburned/arikawa/v3/utils/json"
 	"github.com/diamondburned/arikawa/v3/utils/ws"
+	"github.com/diamondburned/ningen/v3/handlerrepo"
 	"github.com/diamondburned/ningen/v3/nstore"
+	"github.com/diamondburned/ningen/v3/prefetch"
+	"github.com/diamondburned/ningen/v3/readyextra"
+	"github.com/diamondburned/ningen/v3/states/ban"
+	"github.com/diamondburned/ningen/v3/states/command"
 	"github.com/diamondburned/ningen/v3/states/emoji"
 	"github.com/diamondburned/ningen/v3/states/guild"
 	"github.com/diamondburned/ningen/v3/states/member"
+	"github.com/diamondburned/ningen/v3/states/messages"
 	"github.com/diamondburned/ningen/v3/states/mute"
 	"github.com/diamondburned/ningen/v3/states/note"
+	"github.com/diamondburned/ningen/v3/states/pin"
+	"github.com/diamondburned/ningen/v3/states/profile"
+	"github.com/diamondburned/ningen/v3/states/reaction"
 	"github.com/diamondburned/ningen/v3/states/read"
 	"github.com/diamondburned/ningen/v3/states/relationship"
+	"github.com/diamondburned/ningen/v3/states/send"
+	"github.com/diamondburned/ningen/v3/states/sticker"
 	"github.com/diamondburned/ningen/v3/states/summary"
 	"github.com/diamondburned/ningen/v3/states/thread"
+	"github.com/diamondburned/ningen/v3/states/voice"
+	"github.com/diamondburned/ningen/v3/trace"
 	"github.com/pkg/errors"
 )
 
@@ -38,10 +51,6 @@ func init() {
 	cancelledCtx = c
 }
 
-func init() {
-	gateway.ReadyEventKeepRaw = true
-}
-
 // ConnectedEvent is an event that's sent on Ready or Resumed. The event arrives
 // before all ningen's handlers are called.
 type ConnectedEvent struct {
@@ -75,6 +84,21 @@ func (ev *DisconnectedEvent) IsGraceful() bool {
 	return ev.Code != -1
 }
 
+// State is a ningen state. It wraps around arikawa's state and adds its own
+// stores and states on top.
+//
+// # Copies
+//
+// WithContext, Offline and Online return shallow copies of the State. A copy
+// only differs from the original in the context used for API calls; everything
+// else, including the cabinet, the handler and all sub-states (ReadState,
+// MutedState, etc.), is shared with the State created by FromState. The
+// sub-states always act on behalf of that original State, so calling e.g.
+// ReadState.MarkRead on an Offline copy still sends the ack using the live
+// context.
+//
+// Copies are safe to create and use concurrently with the original State
+// handling events. Only the original State should be opened and closed.
 type State struct {
 	*state.State
 	*handler.Handler
@@ -84,60 +108,231 @@ type State struct {
 	PresenceStore *nstore.PresenceStore
 
 	// Custom State values.
+	BanState          *ban.State
 	NoteState         *note.State
+	PinState          *pin.State
 	ReadState         *read.State
+	SendState         *send.State
 	MutedState        *mute.State
 	GuildState        *guild.State
 	EmojiState        *emoji.State
 	MemberState       *member.State
+	MessageState      *messages.State
 	ThreadState       *thread.State
+	StickerState      *sticker.State
+	VoiceChannelState *voice.State
+	ReactionState     *reaction.State
+	CommandState      *command.State
 	SummaryState      *summary.State
 	RelationshipState *relationship.State
+	ProfileState      *profile.State
+
+	// Prefetch schedules the background fetches of the sub-states. Views can
+	// also use it to schedule their own fetches.
+	Prefetch *prefetch.Scheduler
+	// ReadyExtras shares the decoded extras of the Ready event between the
+	// handlers.
+	ReadyExtras *readyextra.Cache
+	// Tracer reports the gateway commands that ningen sends once a hook is
+	// set using Tracer.SetHook.
+	Tracer *trace.Tracer
+
+	deletes       *deleteCoalescer
+	channelOrder  *channelOrderWatcher
+	channelMeta   *channelMetadataWatcher
+	superProps    *superPropertiesState
+	progress      *readyProgress
+	notifier      *notifier
+	invites       *inviteCache
+	linkPreviews  *linkPreviewCache
+	subscriptions *roleSubscriptions
+	mentions      *mentionCounter
+	filters       *contentFilters
+	dmPresences   *dmPresenceRequests
+	customStatus  *customStatusExpiry
+	features      *featureState
+	idle          *idleManager
+	roles         *roleCache
+	conversations *conversationTracker
+	activity      *channelActivityThrottler
+	account       *accountState
+
+	// ordered dispatches the events that ningen derives from gateway events;
+	// see dispatch.
+	ordered *handlerrepo.Ordered
 
 	initd  chan struct{} // nil after Open().
 	oldCtx context.Context
 }
 
 // New creates a new ningen state from the given token and the default
-// identifier.
+// identifier, which uses DefaultSuperProperties.
 func New(token string) *State {
+	return NewWithSuperProperties(token, DefaultSuperProperties)
+}
+
+// NewWithSuperProperties creates a new ningen state from the given token that
+// identifies using the given super properties.
+func NewWithSuperProperties(token string, props SuperProperties) *State {
 	id := gateway.DefaultIdentifier(token)
 	id.Capabilities = 253 // magic constant from reverse-engineering
-	return NewWithIdentifier(id)
+	id.Properties = props.IdentifyProperties()
+
+	s := NewWithIdentifier(id)
+	if props.BrowserUserAgent != "" {
+		s.Client.UserAgent = props.BrowserUserAgent
+	}
+	if props.SystemLocale != "" {
+		s.Client.Client.OnRequest = append(s.Client.Client.OnRequest, props.localeHeader())
+	}
+	s.superProps.set(props)
+
+	return s
 }
 
 // NewWithIdentifier creates a new ningen state from the given identifier.
+// Attribution fields are cleared from the identify properties.
 func NewWithIdentifier(id gateway.Identifier) *State {
-	return FromState(state.NewWithIdentifier(id))
+	id.Properties.Referrer = ""
+	id.Properties.ReferringDomain = ""
+
+	s := FromState(state.NewWithIdentifier(id))
+	s.superProps.set(SuperProperties{
+		OS:               id.Properties.OS,
+		Browser:          id.Properties.Browser,
+		Device:           id.Properties.Device,
+		BrowserUserAgent: id.Properties.BrowserUserAgent,
+		BrowserVersion:   id.Properties.BrowserVersion,
+		OSVersion:        id.Properties.OSVersion,
+	})
+
+	return s
 }
 
-// FromState wraps a normal state.
+// FromState wraps a normal state. The state's API client is put into
+// no-telemetry mode; see NoTelemetry.
 func FromState(s *state.State) *State {
 	state := &State{
-		initd:   make(chan struct{}, 1),
-		State:   s,
-		Handler: handler.New(),
+		initd:      make(chan struct{}, 1),
+		State:      s,
+		Handler:    handler.New(),
+		ordered:    &handlerrepo.Ordered{},
+		superProps: &superPropertiesState{},
 	}
 
+	noTelemetry(s.Client.Client, state.superProps)
+
+	state.deletes = newDeleteCoalescer(func(ev *MessagesDeleteEvent) {
+		state.dispatch(ev)
+	})
+
+	state.notifier = &notifier{}
+	state.invites = newInviteCache()
+	state.linkPreviews = newLinkPreviewCache()
+	state.ReadyExtras = &readyextra.Cache{}
+	state.subscriptions = newRoleSubscriptions(state.ReadyExtras)
+	state.filters = newContentFilters()
+	state.dmPresences = newDMPresenceRequests()
+	state.features = &featureState{}
+	state.idle = &idleManager{}
+	state.account = &accountState{extras: state.ReadyExtras}
+
+	state.mentions = newMentionCounter(state, func(ev *MentionCountEvent) {
+		state.dispatch(ev)
+	})
+
+	state.progress = newReadyProgress(func(ev *ReadyProgressEvent) {
+		state.dispatch(ev)
+	})
+
+	state.channelOrder = newChannelOrderWatcher(func(ev *ChannelOrderChangedEvent) {
+		state.dispatch(ev)
+	})
+
+	state.channelMeta = newChannelMetadataWatcher(func(ev *ChannelMetadataChangedEvent) {
+		state.dispatch(ev)
+	})
+
+	state.roles = newRoleCache(func(ev *RolesChangedEvent) {
+		state.dispatch(ev)
+	})
+
+	state.conversations = newConversationTracker(state, func(ev *RecentConversationsChangedEvent) {
+		state.dispatch(ev)
+	})
+
+	state.activity = newChannelActivityThrottler(func(ev *ChannelActivityEvent) {
+		state.dispatch(ev)
+	})
+
+	state.customStatus = newCustomStatusExpiry(state.expireCustomStatus)
+
 	state.MemberStore = nstore.NewMemberStore()
 	state.PresenceStore = nstore.NewPresenceStore()
 
 	state.Cabinet.MemberStore = state.MemberStore
 	state.Cabinet.PresenceStore = state.PresenceStore
+	state.PresenceStore.OnDiff = func(ev *nstore.PresenceDiffEvent) {
+		state.dispatch(ev)
+	}
+
+	state.Prefetch = prefetch.NewScheduler(0)
+	state.Tracer = trace.NewTracer()
 
 	prehandler := s.Handler
+
+	// Content filters run first, so that nothing sees unfiltered content.
+	s.AddSyncHandler(state.filterIncoming)
+	// Features are detected before the sub-states see the Ready event.
+	s.AddSyncHandler(state.detectFeatures)
+
 	// Give our local states the synchronous prehandler.
+	state.BanState = ban.NewState(s, prehandler)
 	state.NoteState = note.NewState(s, prehandler)
+	state.PinState = pin.NewState(s, prehandler)
 	state.ReadState = read.NewState(s, prehandler)
+	state.SendState = send.NewState(s, prehandler)
 	state.MutedState = mute.NewState(s.Cabinet, prehandler)
 	state.GuildState = guild.NewState(prehandler)
 	state.EmojiState = emoji.NewState(s.Cabinet)
 	state.MemberState = member.NewState(s, prehandler)
+	state.MessageState = messages.NewState(s, prehandler)
 	state.ThreadState = thread.NewState(s, prehandler)
+	state.StickerState = sticker.NewState(s, prehandler)
+	state.VoiceChannelState = voice.NewState(s, prehandler)
+	state.ReactionState = reaction.NewState(s, prehandler)
+	state.CommandState = command.NewState(s, prehandler)
 	state.SummaryState = summary.NewState(s, prehandler)
-	state.RelationshipState = relationship.NewState(s.Cabinet, prehandler)
+	state.RelationshipState = relationship.NewState(s, prehandler)
+	state.ProfileState = profile.NewState(s, prehandler)
+
+	state.NoteState.Scheduler = state.Prefetch
+	state.MemberState.Scheduler = state.Prefetch
+	state.ProfileState.Scheduler = state.Prefetch
+	state.MessageState.Scheduler = state.Prefetch
+	state.MemberState.Tracer = state.Tracer
+	state.NoteState.ReadyExtras = state.ReadyExtras
+	state.ReadState.ReadyExtras = state.ReadyExtras
+	state.StickerState.ReadyExtras = state.ReadyExtras
+	state.EmojiState.OnError = func(err error) {
+		state.dispatch(&ws.BackgroundErrorEvent{Err: err})
+	}
+	state.SendState.Filter = func(content string) (string, bool) {
+		return state.FilterContent(FilterOutgoing, content)
+	}
 
 	s.AddSyncHandler(func(v gateway.Event) {
+		state.channelOrder.handle(v)
+		state.channelMeta.handle(v)
+		state.roles.handle(v)
+		state.invites.handle(v)
+		state.linkPreviews.handle(v)
+		state.subscriptions.handle(v)
+		state.mentions.handle(v)
+		state.conversations.handle(v)
+		state.activity.handle(v)
+		state.account.handle(v)
+
 		switch v := v.(type) {
 		case *gateway.SessionsReplaceEvent:
 			me, _ := s.Me()
@@ -148,6 +343,13 @@ func FromState(s *state.State) *State {
 			s.PresenceSet(0, joinSession(*me, v), true)
 
 		case *gateway.UserSettingsUpdateEvent:
+			if v.Status != "" {
+				state.statusChanged()
+			}
+			if v.CustomStatus != nil {
+				state.customStatus.schedule(*v.CustomStatus)
+			}
+
 			me, _ := s.Me()
 			if me == nil {
 				break
@@ -160,7 +362,9 @@ func FromState(s *state.State) *State {
 
 				if v.CustomStatus != nil {
 					customActivity := discord.Activity{
-						Name: v.CustomStatus.Text,
+						Name:  "Custom Status",
+						Type:  discord.CustomActivity,
+						State: v.CustomStatus.Text,
 					}
 
 					if v.CustomStatus.EmojiName != "" {
@@ -184,6 +388,17 @@ func FromState(s *state.State) *State {
 				s.PresenceSet(p.GuildID, &new, true)
 			}
 
+		case *gateway.MessageReactionAddEvent:
+			if me, _ := s.Me(); me != nil && me.ID == v.UserID {
+				state.EmojiState.RecordUsage(v.Emoji)
+			}
+
+		case *gateway.MessageDeleteEvent:
+			state.deletes.add(v)
+
+		case *gateway.MessageDeleteBulkEvent:
+			state.deletes.addBulk(v)
+
 		case *gateway.ReadyEvent:
 			// Send to channel that unblocks Open() so applications don't access
 			// nil states and avoid data race.
@@ -194,12 +409,24 @@ func FromState(s *state.State) *State {
 			}
 
 			state.hackReady(v)
+			state.readReactionNotifications(v)
+
+			if settings := state.ReadyExtras.Of(v).UserSettings; settings != nil {
+				state.EmojiState.SeedSettingsUsage(settings.EmojiUsage)
+			}
+
+			if v.UserSettings != nil && v.UserSettings.CustomStatus != nil {
+				state.customStatus.schedule(*v.UserSettings.CustomStatus)
+			}
 		}
 
 		switch v := v.(type) {
 		// Might be better to trigger this on a ReadySupplemental event, as
 		// that's when things are truly done?
 		case *gateway.ReadyEvent, *gateway.ResumedEvent:
+			// Replay the subscriptions that a new session has lost, so that
+			// member lists and typing events keep coming.
+			state.MemberState.Resubscribe()
 			state.Handler.Call(&ConnectedEvent{v})
 		case *ws.CloseEvent:
 			state.Handler.Call(&DisconnectedEvent{*v})
@@ -208,22 +435,33 @@ func FromState(s *state.State) *State {
 		// Call the external handler after we're done. This handler is
 		// asynchronuos, or at least it should be.
 		state.Handler.Call(v)
+
+		// Report the loading progress after the guild itself.
+		state.progress.handle(v)
+
+		switch v := v.(type) {
+		case *gateway.MessageCreateEvent:
+			state.notify(&v.Message)
+		case *gateway.MessageReactionAddEvent:
+			state.notifyReaction(v)
+		case *gateway.ReadyEvent:
+			// Every handler has seen the Ready event by now.
+			state.ReadyExtras.Release(v)
+		}
 	})
 
 	return state
 }
 
-func (s *State) hackReady(ev *gateway.ReadyEvent) {
-	var extras readyEventExtras
+// dispatch calls the handlers of an event that ningen derived in the
+// background, in the order that dispatch is called; see handlerrepo.Ordered.
+func (s *State) dispatch(ev interface{}) {
+	s.ordered.Go(0, func() { s.Handler.Call(ev) })
+}
 
-	if errs := json.PartialUnmarshal(ev.RawEventBody, &extras); len(errs) > 0 {
-		for _, err := range errs {
-			s.Handler.Call(&ws.BackgroundErrorEvent{
-				Err: errors.Wrap(err, "error with ningen.readyEventExtras"),
-			})
-		}
-		return
-	}
+func (s *State) hackReady(ev *gateway.ReadyEvent) {
+	// The decoding errors are reported by detectFeatures.
+	extras := s.ReadyExtras.Of(ev)
 
 	for _, user := range extras.Users {
 		// Hopefully the state is happy with us doing this. We really don't have
@@ -238,7 +476,7 @@ func (s *State) hackReady(ev *gateway.ReadyEvent) {
 	}
 
 	// This is also weird.
-	for _, ch := range extras.PrivateChannelsV2 {
+	for _, ch := range extras.PrivateChannels {
 		if len(ch.RecipientIDs) == 0 || len(ch.DMRecipients) > 0 {
 			continue
 		}
@@ -268,6 +506,9 @@ func (s *State) Open(ctx context.Context) error {
 	default:
 	}
 
+	// Fetches are dropped while the State is closed.
+	s.Prefetch.Open()
+
 	if err := s.State.Open(ctx); err != nil {
 		return err
 	}
@@ -281,15 +522,79 @@ func (s *State) Open(ctx context.Context) error {
 	}
 }
 
-// WithContext returns State with the given context.
+// CloseFlushTimeout is the maximum duration that Close waits for pending work,
+// such as message acks, before closing the gateway.
+var CloseFlushTimeout = 5 * time.Second
+
+// Flush blocks until the acks sent by ReadState and the events that ningen
+// and its states dispatch in the background are done, or until ctx is done, in
+// which case ctx's error is returned.
+func (s *State) Flush(ctx context.Context) error {
+	// The events of the states may cause events of ningen's own, so those are
+	// flushed last.
+	flushes := []func(context.Context) error{
+		s.ReadState.Flush,
+		s.MemberState.Flush,
+		s.BanState.Flush,
+		s.PinState.Flush,
+		s.NoteState.Flush,
+		s.SendState.Flush,
+		s.VoiceChannelState.Flush,
+		s.ReactionState.Flush,
+		s.RelationshipState.Flush,
+		s.ordered.Flush,
+	}
+
+	for _, flush := range flushes {
+		if err := flush(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close flushes pending work, such as message acks sent by ReadState, then
+// closes the gateway. It waits for at most CloseFlushTimeout for the flush.
+func (s *State) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), CloseFlushTimeout)
+	defer cancel()
+
+	if err := s.Flush(ctx); err != nil {
+		log.Println("ningen: cannot flush before closing:", err)
+	}
+
+	s.Prefetch.Close()
+
+	return s.State.Close()
+}
+
+// WithContext returns a copy of State with the given context. See the State
+// documentation for what is shared between copies.
 func (s *State) WithContext(ctx context.Context) *State {
+	cpy := s.copy()
+	cpy.State = s.State.WithContext(ctx)
+	cpy.oldCtx = nil
+	return cpy
+}
+
+// copy copies the State by value, so new fields are never missed. The
+// sub-states and helpers are pointers shared between all copies; only the
+// embedded state and oldCtx are expected to be replaced by the caller. Slice
+// or map fields that belong to a single copy would have to be cloned here.
+func (s *State) copy() *State {
 	cpy := *s
-	cpy.State = cpy.State.WithContext(ctx)
 	return &cpy
 }
 
-// Offline returns an offline version of the state.
+// Offline returns an offline copy of the state. API calls made using the
+// returned State will fail immediately, so only the cabinet is used. If the
+// state is already offline, then it returns itself.
 func (s *State) Offline() *State {
+	if s.oldCtx != nil {
+		return s
+	}
+
 	oldCtx := s.Context()
 	cpy := s.WithContext(cancelledCtx)
 	cpy.oldCtx = oldCtx
@@ -302,9 +607,12 @@ func (s *State) Online() *State {
 	if s.oldCtx == nil {
 		return s
 	}
-	online := s.WithContext(s.oldCtx)
-	online.oldCtx = nil
-	return online
+	return s.WithContext(s.oldCtx)
+}
+
+// IsOffline returns true if the State was returned by Offline.
+func (s *State) IsOffline() bool {
+	return s.oldCtx != nil
 }
 
 // MessageMentionFlags is the resulting flag of a MessageMentions check. If it's
@@ -341,20 +649,29 @@ func (s *State) Status() discord.Status {
 }
 
 // MessageMentions returns true if the given message mentions the current user.
+// Mentions of the user's roles count unless the guild suppresses them. If the
+// user's roles aren't known yet, their member is requested in the background.
 func (s *State) MessageMentions(msg *discord.Message) MessageMentionFlags {
+	flags, _ := s.messageNotification(msg)
+	return flags
+}
+
+// messageNotification returns the mention flags of the message along with the
+// reason for them. See MessageMentions.
+func (s *State) messageNotification(msg *discord.Message) (MessageMentionFlags, NotificationReason) {
 	me, _ := s.Cabinet.Me()
 	if me == nil {
-		return 0
+		return 0, NoReason
 	}
 
 	// Ignore own messages.
 	if msg.Author.ID == me.ID {
-		return 0
+		return 0, NoReason
 	}
 
 	// Ignore messages from blocked users.
 	if s.UserIsBlocked(msg.Author.ID) {
-		return 0
+		return 0, NoReason
 	}
 
 	var mutedGuild gateway.UserGuildSetting
@@ -369,15 +686,28 @@ func (s *State) MessageMentions(msg *discord.Message) MessageMentionFlags {
 		// @everyone mentions still work if the guild is muted and @everyone
 		// is not suppressed.
 		if msg.MentionEveryone && !mutedGuild.SuppressEveryone {
-			return MessageMentions | MessageNotifies
+			return MessageMentions | MessageNotifies, EveryoneMentionReason
 		}
-
-		// TODO: roles
 	}
 
 	var flags MessageMentionFlags
-	if messageMentions(msg, me.ID) {
+	reason := NoReason
+
+	switch {
+	case messageMentions(msg, me.ID):
+		flags = MessageMentions
+		reason = MentionReason
+
+	// Role mentions are treated like user mentions unless they're suppressed.
+	case len(msg.MentionRoleIDs) > 0 && msg.GuildID.IsValid() &&
+		!mutedGuild.SuppressRoles && s.mentionsMyRoles(msg, me.ID):
+
 		flags = MessageMentions
+		reason = RoleMentionReason
+
+	case s.notifier.highlights(msg):
+		flags = MessageMentions
+		reason = HighlightReason
 	}
 
 	// Check channel settings. Channel settings override guilds.
@@ -386,11 +716,11 @@ func (s *State) MessageMentions(msg *discord.Message) MessageMentionFlags {
 	switch mutedCh.Notifications {
 	case gateway.NoNotifications:
 		// No notifications are allowed whatsoever.
-		return 0
+		return 0, NoReason
 
 	case gateway.AllNotifications:
 		if mutedCh.Muted {
-			return flags
+			return flags, reason
 		}
 
 	case gateway.OnlyMentions:
@@ -399,28 +729,31 @@ func (s *State) MessageMentions(msg *discord.Message) MessageMentionFlags {
 		if flags != 0 {
 			flags |= MessageNotifies
 		}
-		return flags
+		return flags, reason
 	}
 
 	if msg.GuildID.IsValid() {
 		switch mutedGuild.Notifications {
 		case gateway.NoNotifications:
 			// No notifications are allowed whatsoever.
-			return 0
+			return 0, NoReason
 
 		case gateway.AllNotifications:
 			if !mutedGuild.Muted {
 				// All messages trigger notification if not muted.
 				flags |= MessageNotifies
+				if reason == NoReason {
+					reason = AllMessagesReason
+				}
 			}
-			return flags
+			return flags, reason
 
 		case gateway.OnlyMentions:
 			if flags != 0 {
 				// If mentioned, will always notify.
 				flags |= MessageNotifies
 			}
-			return flags
+			return flags, reason
 		}
 	}
 
@@ -428,11 +761,35 @@ func (s *State) MessageMentions(msg *discord.Message) MessageMentionFlags {
 	if ch, err := s.Cabinet.Channel(msg.ChannelID); err == nil {
 		// True if the message is from DM or group.
 		if ch.Type == discord.DirectMessage || ch.Type == discord.GroupDM {
-			return flags | MessageNotifies
+			if reason == NoReason {
+				reason = DMReason
+			}
+			return flags | MessageNotifies, reason
 		}
 	}
 
-	return flags
+	return flags, reason
+}
+
+// mentionsMyRoles returns true if the message mentions any role that the user
+// has. If the user's member isn't in the state, it is requested and false is
+// returned.
+func (s *State) mentionsMyRoles(msg *discord.Message, uID discord.UserID) bool {
+	member, err := s.Cabinet.Member(msg.GuildID, uID)
+	if err != nil {
+		s.MemberState.RequestMember(msg.GuildID, uID)
+		return false
+	}
+
+	for _, roleID := range msg.MentionRoleIDs {
+		for _, myRoleID := range member.RoleIDs {
+			if roleID == myRoleID {
+				return true
+			}
+		}
+	}
+
+	return false
 }
 
 func messageMentions(msg *discord.Message, uID discord.UserID) bool {
@@ -482,7 +839,12 @@ func (s *State) PrivateChannels() ([]discord.Channel, error) {
 }
 
 // Channels returns a list of visible channels. Empty categories are
-// automatically filtered out.
+// automatically filtered out, and so are the posts of forum channels, which
+// ThreadState.ForumPosts lists.
+//
+// Channels is called very often by sidebars, so it is kept cheap: it makes at
+// most 8 allocations, including the channel list itself, regardless of the
+// number of channels.
 func (s *State) Channels(guildID discord.GuildID, allowedTypes []discord.ChannelType) ([]discord.Channel, error) {
 	// I have fully given up on life.
 	var allowedMap [64]bool
@@ -495,66 +857,143 @@ func (s *State) Channels(guildID discord.GuildID, allowedTypes []discord.Channel
 		return nil, err
 	}
 
+	perms := s.guildPermissions(guildID)
 	filtered := chs[:0]
 
 	// Filter out channels we can't see.
-	for _, ch := range chs {
+	for i := range chs {
+		ch := &chs[i]
 		if !allowedMap[ch.Type] {
 			continue
 		}
 
+		// Forum posts are listed by ThreadState.ForumPosts instead.
+		if isThread(ch.Type) && s.isForum(ch.ParentID) {
+			continue
+		}
+
 		// Only check if the channel is not a category, since we're filtering
 		// out empty categories anyway.
 		if ch.Type != discord.GuildCategory {
-			if !s.HasPermissions(ch.ID, discord.PermissionViewChannel) {
+			if !s.channelHasPermissions(ch, perms, discord.PermissionViewChannel) {
 				continue
 			}
 		}
 
-		filtered = append(filtered, ch)
+		filtered = append(filtered, *ch)
 	}
 
 	chs = filtered
+	filtered = chs[:0]
 
-	categories := make(map[discord.ChannelID]int, 10)
-	// Initialize the category map.
+	// Filter again but exclude all categories with no channels. Guilds don't
+	// have many categories, so scanning is cheaper than building a map.
 	for _, ch := range chs {
-		if ch.Type == discord.GuildCategory {
-			categories[ch.ID] = 0
+		if ch.Type == discord.GuildCategory && !categoryHasChannels(chs, ch.ID) {
+			continue
 		}
+		filtered = append(filtered, ch)
 	}
 
-	// Count all channels within categories.
+	return filtered, nil
+}
+
+// isForum returns true if the channel is a forum channel.
+func (s *State) isForum(chID discord.ChannelID) bool {
+	ch, err := s.Cabinet.Channel(chID)
+	return err == nil && ch.Type == discord.GuildForum
+}
+
+func categoryHasChannels(chs []discord.Channel, categoryID discord.ChannelID) bool {
 	for _, ch := range chs {
-		_, ok := categories[ch.ParentID]
-		if ok {
-			categories[ch.ParentID]++
+		if ch.ParentID == categoryID {
+			return true
 		}
 	}
+	return false
+}
 
-	filtered = chs[:0]
+// guildPermissions holds everything needed to calculate the current user's
+// permissions in many channels of the same guild without going through the
+// cabinet for each channel.
+type guildPermissions struct {
+	guild  *discord.Guild
+	member *discord.Member
+	roles  []discord.Role
+}
 
-	// Filter again but exclude all categories with no channels.
-	for _, ch := range chs {
-		if count, ok := categories[ch.ID]; ok && count == 0 {
-			continue
-		}
-		filtered = append(filtered, ch)
+// guildPermissions returns nil if any of the required information is not in
+// the cabinet, in which case the caller should fall back to HasPermissions.
+func (s *State) guildPermissions(guildID discord.GuildID) *guildPermissions {
+	if !guildID.IsValid() {
+		return nil
 	}
 
-	return filtered, nil
+	me, err := s.Cabinet.Me()
+	if err != nil {
+		return nil
+	}
+
+	g, err := s.Cabinet.Guild(guildID)
+	if err != nil {
+		return nil
+	}
+
+	m, err := s.Cabinet.Member(guildID, me.ID)
+	if err != nil {
+		return nil
+	}
+
+	rs, err := s.Cabinet.Roles(guildID)
+	if err != nil {
+		return nil
+	}
+
+	return &guildPermissions{g, m, rs}
+}
+
+// channelHasPermissions is HasPermissions, except perms is used if it is not
+// nil.
+func (s *State) channelHasPermissions(ch *discord.Channel, perms *guildPermissions, want discord.Permissions) bool {
+	if perms == nil || ch.GuildID != perms.guild.ID {
+		return s.HasPermissions(ch.ID, want)
+	}
+
+	p := discord.CalcOverrides(*perms.guild, *ch, *perms.member, perms.roles)
+	return p.Has(want)
 }
 
+// ErrNoPermission matches every NoPermissionError using errors.Is.
+var ErrNoPermission = errors.New("user is missing permission")
+
 // NoPermissionError is returned by AssertPermissions if the user lacks
 // the requested permissions.
 type NoPermissionError struct {
-	Has    discord.Permissions
-	Wanted discord.Permissions
+	ChannelID discord.ChannelID
+	Has       discord.Permissions
+	Wanted    discord.Permissions
+}
+
+// Missing returns the wanted permissions that the user doesn't have.
+func (err *NoPermissionError) Missing() discord.Permissions {
+	return err.Wanted &^ err.Has
 }
 
 // Error implemenets error.
 func (err *NoPermissionError) Error() string {
-	return "user is missing permission"
+	msg := "user is missing permission"
+	if names := PermissionNames(err.Missing()); len(names) > 0 {
+		msg += " " + strings.Join(names, ", ")
+	}
+	if err.ChannelID.IsValid() {
+		msg += " in channel " + err.ChannelID.String()
+	}
+	return msg
+}
+
+// Is returns true if target is ErrNoPermission.
+func (err *NoPermissionError) Is(target error) bool {
+	return target == ErrNoPermission
 }
 
 // HasPermissions returns true if AssertPermissions returns a nil error.
@@ -578,8 +1017,9 @@ func (s *State) AssertPermissions(chID discord.ChannelID, perms discord.Permissi
 
 	if !p.Has(perms) {
 		return &NoPermissionError{
-			Has:    p,
-			Wanted: perms,
+			ChannelID: chID,
+			Has:       p,
+			Wanted:    perms,
 		}
 	}
 
@@ -588,12 +1028,17 @@ func (s *State) AssertPermissions(chID discord.ChannelID, perms discord.Permissi
 
 // LastMessage returns the last message ID in the given channel.
 func (r *State) LastMessage(chID discord.ChannelID) discord.MessageID {
+	ch, _ := r.Cabinet.Channel(chID)
+	return r.lastMessage(chID, ch)
+}
+
+// lastMessage returns the last message ID in the channel. ch may be nil.
+func (r *State) lastMessage(chID discord.ChannelID, ch *discord.Channel) discord.MessageID {
 	msgs, _ := r.Cabinet.Messages(chID)
 	if len(msgs) > 0 {
 		return msgs[0].ID
 	}
 
-	ch, _ := r.Cabinet.Channel(chID)
 	if ch != nil {
 		return ch.LastMessageID
 	}
@@ -611,6 +1056,20 @@ const (
 	ChannelMentioned
 )
 
+// String returns the name of the indication, such as "unread".
+func (ind UnreadIndication) String() string {
+	switch ind {
+	case ChannelRead:
+		return "read"
+	case ChannelUnread:
+		return "unread"
+	case ChannelMentioned:
+		return "mentioned"
+	default:
+		return fmt.Sprintf("UnreadIndication(%d)", uint8(ind))
+	}
+}
+
 // UnreadOpts are options for the Unread function.
 type UnreadOpts struct {
 	// IncludeMutedCategories includes channels in muted categories.
@@ -620,38 +1079,94 @@ type UnreadOpts struct {
 }
 
 // ChannelIsUnread returns true if the channel with the given ID has unread
-// messages.
+// messages. A channel is also unread if one of its active threads that the
+// user has joined is unread. Forums never have messages of their own, so they
+// are only unread if one of their joined posts is.
 func (r *State) ChannelIsUnread(chID discord.ChannelID, opts UnreadOpts) UnreadIndication {
-	state := r.ReadState.ReadState(chID)
-	if state == nil || !state.LastMessageID.IsValid() {
+	ch, _ := r.Cabinet.Channel(chID)
+
+	ind := ChannelRead
+	if ch == nil || ch.Type != discord.GuildForum {
+		if state := r.ReadState.ReadState(chID); state != nil && state.LastMessageID.IsValid() {
+			ind = r.channelIsUnread(chID, ch, state, opts, nil)
+		}
+	}
+
+	if ind == ChannelMentioned || ch == nil || isThread(ch.Type) {
+		return ind
+	}
+
+	for _, threadID := range r.ThreadState.JoinedThreads(chID) {
+		if s := r.threadIsUnread(threadID, opts, nil); s > ind {
+			ind = s
+			if ind == ChannelMentioned {
+				break
+			}
+		}
+	}
+
+	return ind
+}
+
+// ThreadIsUnread returns the unread indication of the given thread. Threads
+// that the user hasn't joined are always read, like in the official client.
+func (r *State) ThreadIsUnread(threadID discord.ChannelID) UnreadIndication {
+	if !r.ThreadState.ThreadIsJoined(threadID) {
 		return ChannelRead
 	}
+	return r.threadIsUnread(threadID, UnreadOpts{}, nil)
+}
+
+func (r *State) threadIsUnread(threadID discord.ChannelID, opts UnreadOpts, perms *guildPermissions) UnreadIndication {
+	state, ok := r.ReadState.Entry(threadID)
+	if !ok || !state.LastMessageID.IsValid() {
+		return ChannelRead
+	}
+
+	ch, _ := r.Cabinet.Channel(threadID)
+	return r.channelIsUnread(threadID, ch, &state, opts, perms)
+}
+
+func isThread(t discord.ChannelType) bool {
+	switch t {
+	case discord.GuildAnnouncementThread, discord.GuildPublicThread, discord.GuildPrivateThread:
+		return true
+	default:
+		return false
+	}
+}
+
+// channelIsUnread is ChannelIsUnread with the channel and its read state
+// already fetched. ch may be nil, and perms is optional.
+func (r *State) channelIsUnread(
+	chID discord.ChannelID, ch *discord.Channel, state *gateway.ReadState,
+	opts UnreadOpts, perms *guildPermissions) UnreadIndication {
 
 	// Mentions override mutes.
 	if state.MentionCount > 0 {
 		return ChannelMentioned
 	}
 
-	if r.ChannelIsMuted(chID, opts) {
+	if r.channelIsMuted(chID, ch, opts) {
 		return ChannelRead
 	}
 
-	lastMsgID := r.LastMessage(chID)
-	if !lastMsgID.IsValid() {
+	lastMsgID := r.lastMessage(chID, ch)
+	if !lastMsgID.IsValid() || state.LastMessageID >= lastMsgID {
 		return ChannelRead
 	}
 
 	// This permission check isn't very important. We can do it just right
 	// before the unread check.
-	if !r.HasPermissions(chID, discord.PermissionViewChannel) {
+	if ch != nil {
+		if !r.channelHasPermissions(ch, perms, discord.PermissionViewChannel) {
+			return ChannelRead
+		}
+	} else if !r.HasPermissions(chID, discord.PermissionViewChannel) {
 		return ChannelRead
 	}
 
-	if state.LastMessageID < lastMsgID {
-		return ChannelUnread
-	}
-
-	return ChannelRead
+	return ChannelUnread
 }
 
 // GuildUnreadOpts are options for the GuildIsUnread function.
@@ -661,7 +1176,14 @@ type GuildUnreadOpts struct {
 	Types []discord.ChannelType
 }
 
-// GuildIsUnread returns true if the guild contains unread channels.
+// GuildIsUnread returns true if the guild contains unread channels. Threads
+// only count if the user has joined them, and they are filtered by the type of
+// their parent channel as well as their own.
+//
+// Like Channels, GuildIsUnread makes at most 12 allocations, including the
+// copy of the guild's channels, regardless of the number of channels. Channels
+// with cached messages are the exception, since the cabinet copies their
+// messages.
 func (r *State) GuildIsUnread(guildID discord.GuildID, opts GuildUnreadOpts) UnreadIndication {
 	chs, err := r.Cabinet.Channels(guildID)
 	if err != nil {
@@ -673,13 +1195,43 @@ func (r *State) GuildIsUnread(guildID discord.GuildID, opts GuildUnreadOpts) Unr
 		typeMap[typ] = true
 	}
 
+	perms := r.guildPermissions(guildID)
+
 	ind := ChannelRead
-	for _, ch := range chs {
-		if opts.Types != nil && !typeMap[ch.Type] {
+	for i := range chs {
+		ch := &chs[i]
+		if isThread(ch.Type) {
+			if !r.ThreadState.ThreadIsJoined(ch.ID) {
+				continue
+			}
+			if opts.Types != nil && !typeMap[ch.Type] {
+				parent, err := r.Cabinet.Channel(ch.ParentID)
+				if err != nil || !typeMap[parent.Type] {
+					continue
+				}
+			}
+		} else if opts.Types != nil && !typeMap[ch.Type] {
 			continue
 		}
-		if s := r.ChannelIsUnread(ch.ID, opts.UnreadOpts); s > ind {
+
+		// The read state of a forum only tracks the posts that the user has
+		// seen in the post list, so it may stay behind forever. Its posts
+		// are checked on their own instead.
+		if ch.Type == discord.GuildForum {
+			continue
+		}
+
+		state, ok := r.ReadState.Entry(ch.ID)
+		if !ok {
+			continue
+		}
+
+		if s := r.channelIsUnread(ch.ID, ch, &state, opts.UnreadOpts, perms); s > ind {
 			ind = s
+			// Nothing is higher than a mention, so we can stop here.
+			if ind == ChannelMentioned {
+				break
+			}
 		}
 	}
 
@@ -724,12 +1276,16 @@ func (s *State) ChannelCountUnreads(chID discord.ChannelID, opts UnreadOpts) int
 }
 
 // SetStatus sets the current user's status and presence.
+//
+// If the custom status has an ExpiresAt, it is cleared from the presence and
+// the user settings once it expires, and a CustomStatusExpiredEvent is
+// dispatched. Setting another custom status replaces the previous expiry. An
+// error is returned if the custom status has already expired.
 func (r *State) SetStatus(status discord.Status, custom *gateway.CustomUserStatus, activities ...discord.Activity) error {
 	me, _ := r.Me()
 
-	cmd := gateway.UpdatePresenceCommand{
-		Status:     status,
-		Activities: activities,
+	if custom != nil && custom.ExpiresAt.IsValid() && !custom.ExpiresAt.Time().After(time.Now()) {
+		return errors.New("custom status has already expired")
 	}
 
 	if custom != nil {
@@ -750,6 +1306,11 @@ func (r *State) SetStatus(status discord.Status, custom *gateway.CustomUserStatu
 		activities = append(activities, customActivity)
 	}
 
+	cmd := gateway.UpdatePresenceCommand{
+		Status:     status,
+		Activities: activities,
+	}
+
 	if p, _ := r.PresenceStore.Presence(0, me.ID); p != nil {
 		if status == "" && p.Status != "" {
 			cmd.Status = p.Status
@@ -759,18 +1320,33 @@ func (r *State) SetStatus(status discord.Status, custom *gateway.CustomUserStatu
 		}
 	}
 
-	if err := r.Gateway().Send(r.Context(), &cmd); err != nil {
+	if err := r.Tracer.Send(r.Context(), r.Gateway(), trace.Presence, &cmd); err != nil {
 		return errors.Wrap(err, "cannot update gateway")
 	}
 
+	if custom != nil {
+		r.customStatus.schedule(*custom)
+	}
+	if status != "" {
+		r.statusChanged()
+	}
+
+	// Bots have no user settings.
+	if r.Features().Bot {
+		return nil
+	}
+
 	// Keep this the same as gateway.UserSettings.
 	patchSettings := map[string]interface{}{"status": status}
 	if custom != nil {
 		patchSettings["custom_status"] = custom
 	}
 
-	err := r.FastRequest("PATCH", api.EndpointMe+"/settings", httputil.WithJSONBody(patchSettings))
-	return errors.Wrap(err, "cannot update user settings API")
+	if err := r.FastRequest("PATCH", api.EndpointMe+"/settings", httputil.WithJSONBody(patchSettings)); err != nil {
+		return errors.Wrap(err, "cannot update user settings API")
+	}
+
+	return nil
 }
 
 // SetAFK sets the current user's AFK status. If the user is AFK, then they will
@@ -778,7 +1354,7 @@ func (r *State) SetStatus(status discord.Status, custom *gateway.CustomUserStatu
 // user last interacted with Discord. The status is automatically set to idle.
 func (r *State) SetAFK(afk bool, since time.Time) error {
 	if afk {
-		return r.Gateway().Send(r.Context(), &gateway.UpdatePresenceCommand{
+		return r.Tracer.Send(r.Context(), r.Gateway(), trace.Presence, &gateway.UpdatePresenceCommand{
 			Status:     discord.IdleStatus,
 			Activities: []discord.Activity{},
 			Since:      discord.TimeToMilliseconds(since),
@@ -797,7 +1373,7 @@ func (r *State) SetAFK(afk bool, since time.Time) error {
 		return fmt.Errorf("cannot get presences: %w", err)
 	}
 
-	return r.Gateway().Send(r.Context(), &gateway.UpdatePresenceCommand{
+	return r.Tracer.Send(r.Context(), r.Gateway(), trace.Presence, &gateway.UpdatePresenceCommand{
 		Status:     presences.Status,
 		Activities: presences.Activities,
 		Since:      0,
@@ -805,6 +1381,27 @@ func (r *State) SetAFK(afk bool, since time.Time) error {
 	})
 }
 
+// MarkAllRead marks every guild channel and private channel as read, acking
+// them in bulk. See ReadState.MarkChannelsRead.
+func (s *State) MarkAllRead() {
+	var chIDs []discord.ChannelID
+
+	guilds, _ := s.Cabinet.Guilds()
+	for _, guild := range guilds {
+		chs, _ := s.Cabinet.Channels(guild.ID)
+		for _, ch := range chs {
+			chIDs = append(chIDs, ch.ID)
+		}
+	}
+
+	privates, _ := s.Cabinet.PrivateChannels()
+	for _, ch := range privates {
+		chIDs = append(chIDs, ch.ID)
+	}
+
+	s.ReadState.MarkChannelsRead(chIDs...)
+}
+
 // UserIsBlocked returns true if the user with the given ID is blocked by the
 // current user.
 func (r *State) UserIsBlocked(uID discord.UserID) bool {
@@ -814,28 +1411,37 @@ func (r *State) UserIsBlocked(uID discord.UserID) bool {
 // ChannelIsMuted returns true if the channel with the given ID is muted or if
 // it's in a category that's muted.
 func (r *State) ChannelIsMuted(chID discord.ChannelID, opts UnreadOpts) bool {
+	return r.channelIsMuted(chID, nil, opts)
+}
+
+// channelIsMuted is ChannelIsMuted, except the channel is only fetched if ch is
+// nil.
+func (r *State) channelIsMuted(chID discord.ChannelID, ch *discord.Channel, opts UnreadOpts) bool {
 	// If the channel is configured to be muted, then it's muted.
 	if r.MutedState.Channel(chID) {
 		return true
 	}
 
-	c, err := r.Cabinet.Channel(chID)
-	if err != nil {
-		log.Println("ningen: ChannelIsMuted: cannot get channel:", err)
-		return false
+	if ch == nil {
+		c, err := r.Cabinet.Channel(chID)
+		if err != nil {
+			log.Println("ningen: ChannelIsMuted: cannot get channel:", err)
+			return false
+		}
+		ch = c
 	}
 
 	// Is the channel a thread? If so, check if the thread is joined.
-	switch c.Type {
+	switch ch.Type {
 	case discord.GuildPublicThread, discord.GuildPrivateThread:
-		if !r.ThreadState.ThreadIsJoined(c.ID) {
+		if !r.ThreadState.ThreadIsJoined(ch.ID) {
 			return true
 		}
 	}
 
 	// If the channel is in a category, then check if the category is muted.
-	if !opts.IncludeMutedCategories && c.ParentID.IsValid() {
-		return r.ChannelIsMuted(c.ParentID, opts)
+	if !opts.IncludeMutedCategories && ch.ParentID.IsValid() {
+		return r.channelIsMuted(ch.ParentID, nil, opts)
 	}
 
 	return false
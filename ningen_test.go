@@ -0,0 +1,914 @@
+package ningen_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/httputil/httpdriver"
+	"github.com/diamondburned/ningen/v3"
+	"github.com/diamondburned/ningen/v3/ningentest"
+	"github.com/diamondburned/ningen/v3/states/mute"
+	"github.com/diamondburned/ningen/v3/states/note"
+	"github.com/diamondburned/ningen/v3/states/read"
+	"github.com/diamondburned/ningen/v3/states/relationship"
+	"github.com/diamondburned/ningen/v3/states/thread"
+)
+
+func TestFixtures(t *testing.T) {
+	for _, name := range ningentest.FixtureNames() {
+		t.Run(name, func(t *testing.T) {
+			n := ningentest.NewState(t, name)
+
+			me, err := n.Me()
+			if err != nil {
+				t.Fatal("cannot get current user:", err)
+			}
+			if !me.ID.IsValid() {
+				t.Fatal("current user has no ID")
+			}
+		})
+	}
+}
+
+var textChannels = []discord.ChannelType{
+	discord.GuildText,
+	discord.GuildCategory,
+}
+
+func TestChannels(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	chs, err := n.Channels(200000000000000001, textChannels)
+	if err != nil {
+		t.Fatal("cannot get channels:", err)
+	}
+
+	names := make([]string, len(chs))
+	for i, ch := range chs {
+		names[i] = ch.Name
+	}
+
+	// The hidden channel and the empty category must be filtered out.
+	want := []string{"Text Channels", "general", "random"}
+	if len(names) != len(want) {
+		t.Fatalf("got channels %q, want %q", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("got channels %q, want %q", names, want)
+		}
+	}
+}
+
+func TestUnread(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	channelTests := []struct {
+		id   discord.ChannelID
+		want ningen.UnreadIndication
+	}{
+		{300000000000000002, ningen.ChannelRead},
+		{300000000000000003, ningen.ChannelUnread},
+		{300000000000000005, ningen.ChannelRead}, // hidden
+		{300000000000000011, ningen.ChannelUnread},
+		{300000000000000012, ningen.ChannelMentioned},
+	}
+
+	for _, test := range channelTests {
+		if got := n.ChannelIsUnread(test.id, ningen.UnreadOpts{}); got != test.want {
+			t.Errorf("channel %d: got %d, want %d", test.id, got, test.want)
+		}
+	}
+
+	guildTests := []struct {
+		id   discord.GuildID
+		want ningen.UnreadIndication
+	}{
+		{200000000000000001, ningen.ChannelUnread},
+		{200000000000000002, ningen.ChannelMentioned}, // muted, but mentioned
+		{200000000000000003, ningen.ChannelRead},
+	}
+
+	for _, test := range guildTests {
+		if got := n.GuildIsUnread(test.id, ningen.GuildUnreadOpts{}); got != test.want {
+			t.Errorf("guild %d: got %d, want %d", test.id, got, test.want)
+		}
+	}
+}
+
+func TestLocalMutes(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	const guildID = 200000000000000001
+	const chID = 300000000000000003
+
+	msg := &discord.Message{
+		ID:        900000000000000050,
+		ChannelID: chID,
+		GuildID:   guildID,
+		Author:    discord.User{ID: 100000000000000002},
+	}
+
+	if !n.MessageMentions(msg).Has(ningen.MessageNotifies) {
+		t.Fatal("message doesn't notify before muting")
+	}
+
+	n.MutedState.SetLocalChannel(chID, true)
+
+	// Local mutes are ignored until they are used.
+	if n.ChannelIsMuted(chID, ningen.UnreadOpts{}) {
+		t.Fatal("channel is muted before using local mutes")
+	}
+
+	n.MutedState.SetUseLocal(true)
+
+	if !n.ChannelIsMuted(chID, ningen.UnreadOpts{}) {
+		t.Fatal("locally muted channel isn't muted")
+	}
+	if got := n.ChannelIsUnread(chID, ningen.UnreadOpts{}); got != ningen.ChannelRead {
+		t.Errorf("locally muted channel is %d, want read", got)
+	}
+	if n.MessageMentions(msg).Has(ningen.MessageNotifies) {
+		t.Error("message in locally muted channel notifies")
+	}
+
+	n.MutedState.SetLocalChannel(chID, false)
+	n.MutedState.SetLocalGuild(guildID, true)
+
+	if got := n.GuildIsUnread(guildID, ningen.GuildUnreadOpts{}); got != ningen.ChannelRead {
+		t.Errorf("locally muted guild is %d, want read", got)
+	}
+	if n.MessageMentions(msg).Has(ningen.MessageNotifies) {
+		t.Error("message in locally muted guild notifies")
+	}
+
+	mutes := n.MutedState.LocalMutes()
+	if len(mutes.Guilds) != 1 || mutes.Guilds[0] != guildID || len(mutes.Channels) != 0 {
+		t.Fatalf("got local mutes %+v", mutes)
+	}
+
+	n.MutedState.LoadLocalMutes(mute.LocalMutes{Channels: []discord.ChannelID{chID}})
+
+	if n.MutedState.LocalGuild(guildID) || !n.MutedState.LocalChannel(chID) {
+		t.Fatalf("got local mutes %+v after loading", n.MutedState.LocalMutes())
+	}
+}
+
+func TestPrivateChannels(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.GroupDMs)
+
+	chs, err := n.PrivateChannels()
+	if err != nil {
+		t.Fatal("cannot get private channels:", err)
+	}
+
+	if len(chs) != 3 {
+		t.Fatalf("got %d private channels, want 3", len(chs))
+	}
+
+	// Private channels are sorted by the last message.
+	if chs[0].ID != 400000000000000002 {
+		t.Errorf("got first channel %d, want the group DM", chs[0].ID)
+	}
+
+	// Recipients are filled in from the Ready users.
+	for _, ch := range chs {
+		for _, u := range ch.DMRecipients {
+			if u.Username == "" {
+				t.Errorf("channel %d has recipient %d without a username", ch.ID, u.ID)
+			}
+		}
+	}
+
+	if !n.UserIsBlocked(100000000000000005) {
+		t.Error("expected blocked user to be blocked")
+	}
+}
+
+func TestThreads(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Threads)
+
+	if !n.ThreadState.ThreadIsJoined(300000000000000111) {
+		t.Error("expected thread to be joined")
+	}
+
+	got := n.ChannelIsUnread(300000000000000111, ningen.UnreadOpts{})
+	if got != ningen.ChannelUnread {
+		t.Errorf("thread: got %d, want %d", got, ningen.ChannelUnread)
+	}
+
+	if got := n.ThreadIsUnread(300000000000000111); got != ningen.ChannelUnread {
+		t.Errorf("ThreadIsUnread: got %d, want %d", got, ningen.ChannelUnread)
+	}
+
+	// The parent is read, but its joined thread isn't.
+	if got := n.ChannelIsUnread(300000000000000101, ningen.UnreadOpts{}); got != ningen.ChannelUnread {
+		t.Errorf("parent: got %d, want %d", got, ningen.ChannelUnread)
+	}
+
+	ningentest.Dispatch(n, &gateway.ThreadMembersUpdateEvent{
+		ID:               300000000000000111,
+		GuildID:          200000000000000011,
+		RemovedMemberIDs: []discord.UserID{100000000000000001},
+	})
+
+	if got := n.ChannelIsUnread(300000000000000101, ningen.UnreadOpts{}); got != ningen.ChannelRead {
+		t.Errorf("parent after leaving: got %d, want %d", got, ningen.ChannelRead)
+	}
+	if got := n.GuildIsUnread(200000000000000011, ningen.GuildUnreadOpts{}); got != ningen.ChannelRead {
+		t.Errorf("guild after leaving: got %d, want %d", got, ningen.ChannelRead)
+	}
+}
+
+func TestReadStateFlush(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	updated := make(chan struct{}, 1)
+	n.AddSyncHandler(func(*read.UpdateEvent) {
+		select {
+		case updated <- struct{}{}:
+		default:
+		}
+	})
+
+	ningentest.Dispatch(n, &gateway.MessageAckEvent{
+		ChannelID: 300000000000000003,
+		MessageID: 900000000000000020,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := n.ReadState.Flush(ctx); err != nil {
+		t.Fatal("cannot flush read state:", err)
+	}
+
+	select {
+	case <-updated:
+	default:
+		t.Fatal("update event not dispatched after flushing")
+	}
+}
+
+func TestReadStateCorrection(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	const chID = 300000000000000003
+
+	corrections := make(chan *read.CorrectionEvent, 1)
+	n.AddSyncHandler(func(ev *read.CorrectionEvent) { corrections <- ev })
+
+	flush := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		if err := n.ReadState.Flush(ctx); err != nil {
+			t.Fatal("cannot flush read state:", err)
+		}
+	}
+
+	ack := func(msgID discord.MessageID) {
+		ningentest.Dispatch(n, &gateway.MessageAckEvent{ChannelID: chID, MessageID: msgID})
+		flush()
+	}
+
+	ack(900000000000000020)
+
+	// A stale local read must not move the read state backwards.
+	n.ReadState.MarkRead(chID, 900000000000000019)
+	if rs := n.ReadState.ReadState(chID); rs.LastMessageID != 900000000000000020 {
+		t.Fatalf("stale MarkRead moved the read state to %d", rs.LastMessageID)
+	}
+
+	// Another device marks the channel as unread from an older message.
+	ack(900000000000000015)
+
+	select {
+	case ev := <-corrections:
+		if ev.Previous != 900000000000000020 || ev.LastMessageID != 900000000000000015 || !ev.Unread {
+			t.Fatalf("got correction %+v", ev)
+		}
+	default:
+		t.Fatal("no correction event dispatched")
+	}
+
+	if v := n.ReadState.Version(chID); v != 2 {
+		t.Fatalf("got version %d, want 2", v)
+	}
+}
+
+func TestReadStatePassive(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+	n.ReadState.SetPassive(true)
+
+	const chID = 300000000000000003
+
+	n.ReadState.MarkRead(chID, 900000000000000020)
+	if got := n.ChannelIsUnread(chID, ningen.UnreadOpts{}); got != ningen.ChannelUnread {
+		t.Fatalf("channel is %d after MarkRead in passive mode, want unread", got)
+	}
+
+	ningentest.Dispatch(n, &gateway.MessageAckEvent{ChannelID: chID, MessageID: 900000000000000020})
+	if got := n.ChannelIsUnread(chID, ningen.UnreadOpts{}); got != ningen.ChannelRead {
+		t.Fatalf("channel is %d after another device acked, want read", got)
+	}
+}
+
+func TestUnreadAfterDelete(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	const chID = 300000000000000003
+
+	if got := n.ChannelIsUnread(chID, ningen.UnreadOpts{}); got != ningen.ChannelUnread {
+		t.Fatalf("channel is %d before deleting, want unread", got)
+	}
+
+	// Without cached messages, there may be newer unread messages that
+	// weren't loaded, so deleting the last message changes nothing.
+	ningentest.Dispatch(n, &gateway.MessageDeleteEvent{
+		ID:        900000000000000020,
+		ChannelID: chID,
+		GuildID:   200000000000000001,
+	})
+
+	if got := n.ChannelIsUnread(chID, ningen.UnreadOpts{}); got != ningen.ChannelUnread {
+		t.Fatalf("channel is %d after deleting uncached message, want unread", got)
+	}
+
+	for _, id := range []discord.MessageID{900000000000000015, 900000000000000020} {
+		n.Cabinet.MessageSet(&discord.Message{ID: id, ChannelID: chID}, false)
+	}
+
+	// Delete the only unread message.
+	ningentest.Dispatch(n, &gateway.MessageDeleteEvent{
+		ID:        900000000000000020,
+		ChannelID: chID,
+		GuildID:   200000000000000001,
+	})
+
+	if got := n.ChannelIsUnread(chID, ningen.UnreadOpts{}); got != ningen.ChannelRead {
+		t.Fatalf("channel is %d after deleting, want read", got)
+	}
+
+	// Discord may still send the stale last message ID.
+	ch, err := n.Cabinet.Channel(chID)
+	if err != nil {
+		t.Fatal("cannot get channel:", err)
+	}
+	ch.LastMessageID = 900000000000000020
+	ningentest.Dispatch(n, &gateway.ChannelUpdateEvent{Channel: *ch})
+
+	if got := n.ChannelIsUnread(chID, ningen.UnreadOpts{}); got != ningen.ChannelRead {
+		t.Fatalf("channel is %d after update, want read", got)
+	}
+}
+
+func TestForumPosts(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Threads)
+
+	const forumID = 300000000000000102
+
+	tests := []struct {
+		name string
+		view thread.ForumView
+		want []discord.ChannelID
+	}{
+		{
+			name: "latest activity",
+			view: thread.ForumView{SortOrder: discord.SortOrderTypeLatestActivity},
+			want: []discord.ChannelID{300000000000000112, 300000000000000113},
+		},
+		{
+			name: "creation date",
+			view: thread.ForumView{SortOrder: discord.SoftOrderTypeCreationDate},
+			want: []discord.ChannelID{300000000000000113, 300000000000000112},
+		},
+		{
+			name: "any tag",
+			view: thread.ForumView{Tags: []discord.TagID{500000000000000002, 500000000000000003}},
+			want: []discord.ChannelID{300000000000000113},
+		},
+		{
+			name: "all tags",
+			view: thread.ForumView{Tags: []discord.TagID{500000000000000001, 500000000000000003}, MatchAll: true},
+			want: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			n.ThreadState.SetForumView(forumID, test.view)
+
+			posts, err := n.ThreadState.ForumPosts(forumID, nil)
+			if err != nil {
+				t.Fatal("cannot get forum posts:", err)
+			}
+
+			if len(posts) != len(test.want) {
+				t.Fatalf("got %d posts, want %d", len(posts), len(test.want))
+			}
+			for i, post := range posts {
+				if post.ID != test.want[i] {
+					t.Errorf("post %d: got %d, want %d", i, post.ID, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestForumArchivedPosts(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Threads)
+
+	const forumID = 300000000000000102
+
+	forum, err := n.Cabinet.Channel(forumID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forum.AvailableTags = []discord.Tag{
+		{ID: 500000000000000002, Name: "solved"},
+		{ID: 500000000000000001, Name: "question"},
+	}
+	n.ChannelSet(forum, true)
+
+	if tag, ok := n.ThreadState.ForumTag(forumID, 500000000000000001); !ok || tag.Name != "question" {
+		t.Errorf("got tag %+v, %v", tag, ok)
+	}
+
+	tagged, _ := n.Cabinet.Channel(300000000000000113)
+	if tags := n.ThreadState.ForumPostTags(tagged); len(tags) != 2 || tags[0].Name != "solved" {
+		t.Errorf("got post tags %+v", tags)
+	}
+
+	pages := []string{
+		`{"threads":[{"id":"300000000000000114","type":11,"parent_id":"300000000000000102",` +
+			`"thread_metadata":{"archived":true,"archive_timestamp":"2022-12-01T00:00:00+00:00"}}],"has_more":true}`,
+		`{"threads":[{"id":"300000000000000115","type":11,"parent_id":"300000000000000102",` +
+			`"thread_metadata":{"archived":true,"archive_timestamp":"2022-11-01T00:00:00+00:00"}}],"has_more":false}`,
+	}
+
+	var befores []string
+	n.Client.Client.Retries = 1
+	n.Client.Client.Client = httpdriver.WrapClient(http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			befores = append(befores, r.URL.Query().Get("before"))
+			return &http.Response{
+				StatusCode: 200,
+				Header:     http.Header{"Content-Type": {"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(pages[len(befores)-1])),
+			}, nil
+		}),
+	})
+
+	for more := true; more; {
+		more, err = n.ThreadState.LoadArchivedForumPosts(forumID)
+		if err != nil {
+			t.Fatal("cannot load archived posts:", err)
+		}
+	}
+
+	if len(befores) != 2 || befores[0] != "" || !strings.HasPrefix(befores[1], "2022-12-01") {
+		t.Errorf("got before parameters %q", befores)
+	}
+
+	if !n.ThreadState.ArchivedForumPostsLoaded(forumID) {
+		t.Error("archived posts not loaded")
+	}
+
+	n.ThreadState.SetForumView(forumID, thread.ForumView{SortOrder: discord.SoftOrderTypeCreationDate})
+
+	posts, err := n.ThreadState.ForumPosts(forumID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []discord.ChannelID{300000000000000115, 300000000000000114, 300000000000000113, 300000000000000112}
+	if len(posts) != len(want) {
+		t.Fatalf("got %d posts, want %d", len(posts), len(want))
+	}
+	for i, post := range posts {
+		if post.ID != want[i] {
+			t.Errorf("post %d: got %d, want %d", i, post.ID, want[i])
+		}
+	}
+
+	// Forum posts aren't listed as channels.
+	chs, err := n.Channels(forum.GuildID, []discord.ChannelType{
+		discord.GuildText, discord.GuildForum, discord.GuildPublicThread,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chs) != 3 {
+		t.Errorf("got %d channels, want the text channel, its thread and the forum", len(chs))
+	}
+	for _, ch := range chs {
+		if ch.ParentID == forumID {
+			t.Errorf("forum post %d listed as a channel", ch.ID)
+		}
+	}
+}
+
+func TestForumReadState(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Threads)
+
+	const (
+		guildID = 200000000000000011
+		forumID = 300000000000000102
+		postID  = 300000000000000112
+	)
+
+	// The forum's own read state is behind its last post, but that doesn't
+	// make it unread.
+	if got := n.ChannelIsUnread(forumID, ningen.UnreadOpts{}); got != ningen.ChannelRead {
+		t.Fatalf("forum with a stale read state: got %d, want read", got)
+	}
+
+	var acked []string
+	n.Client.Client.Retries = 1
+	n.Client.Client.Client = httpdriver.WrapClient(http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			b, _ := io.ReadAll(r.Body)
+			acked = append(acked, string(b))
+			return &http.Response{StatusCode: 204, Body: io.NopCloser(strings.NewReader(""))}, nil
+		}),
+	})
+
+	ningentest.Dispatch(n, &gateway.MessageCreateEvent{Message: discord.Message{
+		ID:        900000000000002200,
+		ChannelID: postID,
+		GuildID:   guildID,
+		Author:    discord.User{ID: 100000000000000002},
+	}})
+
+	if got := n.ChannelIsUnread(forumID, ningen.UnreadOpts{}); got != ningen.ChannelUnread {
+		t.Fatalf("forum with an unread post: got %d, want unread", got)
+	}
+
+	// Marking the forum as read marks its followed posts as read.
+	n.ReadState.MarkRead(forumID, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := n.ReadState.Flush(ctx); err != nil {
+		t.Fatal("cannot flush read state:", err)
+	}
+
+	if got := n.ChannelIsUnread(forumID, ningen.UnreadOpts{}); got != ningen.ChannelRead {
+		t.Fatalf("forum after marking it read: got %d, want read", got)
+	}
+	if rs := n.ReadState.ReadState(postID); rs == nil || rs.LastMessageID != 900000000000002200 {
+		t.Fatalf("post read state not updated: %+v", rs)
+	}
+	if len(acked) != 1 || !strings.Contains(acked[0], `"300000000000000112"`) {
+		t.Fatalf("got acks %q", acked)
+	}
+	// The forum itself is acked up to its last post, but the post without a
+	// read state isn't acked.
+	if !strings.Contains(acked[0], `"300000000000000102"`) || strings.Contains(acked[0], `"300000000000000113"`) {
+		t.Fatalf("got acks %q, want the forum and its followed post", acked)
+	}
+}
+
+func TestArchivedThreads(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Threads)
+
+	const parentID = 300000000000000101
+
+	var paths []string
+	n.Client.Client.Retries = 1
+	n.Client.Client.Client = httpdriver.WrapClient(http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			paths = append(paths, r.URL.Path)
+			return &http.Response{
+				StatusCode: 200,
+				Header:     http.Header{"Content-Type": {"application/json"}},
+				Body: io.NopCloser(strings.NewReader(
+					`{"threads":[` +
+						`{"id":"300000000000000121","type":11,"parent_id":"300000000000000101",` +
+						`"thread_metadata":{"archived":true,"archive_timestamp":"2022-11-01T00:00:00+00:00"}},` +
+						`{"id":"300000000000000122","type":11,"parent_id":"300000000000000101",` +
+						`"thread_metadata":{"archived":true,"archive_timestamp":"2022-12-01T00:00:00+00:00"}}` +
+						`],"has_more":false}`,
+				)),
+			}, nil
+		}),
+	})
+
+	threads, more, err := n.ThreadState.ArchivedThreads(parentID, discord.Timestamp{}, 0)
+	if err != nil {
+		t.Fatal("cannot get archived threads:", err)
+	}
+	if more {
+		t.Error("unexpected more archived threads")
+	}
+	if len(threads) != 2 || threads[0].ID != 300000000000000122 || threads[1].ID != 300000000000000121 {
+		t.Fatalf("got archived threads %+v", threads)
+	}
+	if len(paths) != 1 || !strings.HasSuffix(paths[0], "/threads/archived/public") {
+		t.Fatalf("got requests %q", paths)
+	}
+
+	if _, _, err := n.ThreadState.ArchivedThreads(parentID, discord.Timestamp{}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 {
+		t.Fatalf("archived threads not cached, got requests %q", paths)
+	}
+
+	// Unarchiving a thread removes it from the cache without fetching again.
+	ningentest.Dispatch(n, &gateway.ThreadUpdateEvent{Channel: discord.Channel{
+		ID: 300000000000000122, ParentID: parentID, Type: discord.GuildPublicThread,
+	}})
+
+	threads, more, err = n.ThreadState.ArchivedThreads(parentID, discord.Timestamp{}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 {
+		t.Fatalf("archived threads fetched again, got requests %q", paths)
+	}
+	if more || len(threads) != 1 || threads[0].ID != 300000000000000121 {
+		t.Fatalf("got archived threads %+v, more %v", threads, more)
+	}
+}
+
+func TestMessageMentionsRoles(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	const guildID = 200000000000000001
+	const roleID = 400000000000000001
+
+	msg := &discord.Message{
+		ID:             900000000000000050,
+		ChannelID:      300000000000000002,
+		GuildID:        guildID,
+		Author:         discord.User{ID: 100000000000000002},
+		MentionRoleIDs: []discord.RoleID{roleID},
+	}
+
+	if n.MessageMentions(msg).Has(ningen.MessageMentions) {
+		t.Fatal("message mentions a role that the user doesn't have")
+	}
+
+	me, err := n.Cabinet.Member(guildID, 100000000000000001)
+	if err != nil {
+		t.Fatal("cannot get own member:", err)
+	}
+	me.RoleIDs = []discord.RoleID{roleID}
+	n.Cabinet.MemberSet(guildID, me, true)
+
+	if !n.MessageMentions(msg).Has(ningen.MessageMentions) {
+		t.Fatal("message doesn't mention the user's role")
+	}
+
+	ningentest.Dispatch(n, &gateway.UserGuildSettingsUpdateEvent{
+		UserGuildSetting: gateway.UserGuildSetting{
+			GuildID:       guildID,
+			SuppressRoles: true,
+			Notifications: gateway.OnlyMentions,
+		},
+	})
+
+	if flags := n.MessageMentions(msg); flags != 0 {
+		t.Fatalf("suppressed role mention has flags %d", flags)
+	}
+}
+
+func TestStickers(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	guilds, err := n.StickerState.ForGuild(200000000000000001)
+	if err != nil {
+		t.Fatal("cannot get stickers:", err)
+	}
+
+	if len(guilds) != 1 || len(guilds[0].Stickers) != 1 {
+		t.Fatalf("got %+v, want only the available sticker", guilds)
+	}
+	if name := guilds[0].Stickers[0].Name; name != "wave" {
+		t.Fatalf("got sticker %q, want wave", name)
+	}
+}
+
+func TestGuildInfo(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	if info, ok := n.GuildState.Info(200000000000000001); !ok || info.VanityURL() != "" {
+		t.Fatalf("unexpected info %+v (%v) from Ready", info, ok)
+	}
+
+	g, _ := n.Cabinet.Guild(200000000000000001)
+	g.VanityURLCode = "ningen"
+	g.Features = []discord.GuildFeature{discord.Discoverable}
+
+	ningentest.Dispatch(n, &gateway.GuildUpdateEvent{Guild: *g})
+
+	info, _ := n.GuildState.Info(200000000000000001)
+	if info.VanityURL() != "https://discord.gg/ningen" || !info.Discoverable() {
+		t.Errorf("info not updated: %+v", info)
+	}
+}
+
+func TestReadStateOrdering(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	const chID = 300000000000000003
+
+	var mutex sync.Mutex
+	var got []discord.MessageID
+
+	n.AddSyncHandler(func(ev *read.UpdateEvent) {
+		if ev.ChannelID != chID {
+			return
+		}
+		mutex.Lock()
+		got = append(got, ev.LastMessageID)
+		mutex.Unlock()
+	})
+
+	const acks = 50
+	for i := 0; i < acks; i++ {
+		ningentest.Dispatch(n, &gateway.MessageAckEvent{
+			ChannelID: chID,
+			MessageID: discord.MessageID(900000000000001000 + i),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := n.ReadState.Flush(ctx); err != nil {
+		t.Fatal("cannot flush read state:", err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(got) != acks {
+		t.Fatalf("got %d UpdateEvents, want %d", len(got), acks)
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i] < got[i-1] {
+			t.Fatalf("UpdateEvents out of order at %d: %d after %d", i, got[i], got[i-1])
+		}
+	}
+}
+
+func TestNoteUpdateEvent(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	var updates []*note.UpdateEvent
+	n.AddSyncHandler(func(ev *note.UpdateEvent) { updates = append(updates, ev) })
+
+	ev := &gateway.UserNoteUpdateEvent{ID: 100000000000000002, Note: "friend from school"}
+	ningentest.Dispatch(n, ev)
+	// The same note again doesn't change anything.
+	ningentest.Dispatch(n, ev)
+
+	if len(updates) != 1 || updates[0].UserID != ev.ID || updates[0].Note != ev.Note {
+		t.Fatalf("got updates %+v", updates)
+	}
+
+	if got := n.NoteState.Note(ev.ID); got != ev.Note {
+		t.Errorf("got note %q, want %q", got, ev.Note)
+	}
+}
+
+func TestFriends(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.GroupDMs)
+
+	const (
+		aliceID = 100000000000000002
+		bobID   = 100000000000000003
+	)
+
+	var updates []*relationship.FriendPresenceUpdateEvent
+	n.AddSyncHandler(func(ev *relationship.FriendPresenceUpdateEvent) { updates = append(updates, ev) })
+
+	friends := n.RelationshipState.Friends()
+	if len(friends) != 2 || friends[0].ID != aliceID || friends[1].ID != bobID {
+		t.Fatalf("got friends %+v", friends)
+	}
+	if friends[0].Username != "alice" || friends[0].Status() != discord.OfflineStatus {
+		t.Errorf("got friend %+v", friends[0])
+	}
+
+	ningentest.Dispatch(n, &gateway.PresenceUpdateEvent{Presence: discord.Presence{
+		User:   discord.User{ID: bobID, Username: "bob"},
+		Status: discord.OnlineStatus,
+	}})
+
+	// Presences of blocked users aren't friend updates.
+	ningentest.Dispatch(n, &gateway.PresenceUpdateEvent{Presence: discord.Presence{
+		User:   discord.User{ID: 100000000000000005},
+		Status: discord.OnlineStatus,
+	}})
+
+	if len(updates) != 1 || updates[0].ID != bobID || updates[0].Status() != discord.OnlineStatus {
+		t.Fatalf("got updates %+v", updates)
+	}
+
+	friends = n.RelationshipState.Friends()
+	if len(friends) != 2 || friends[0].ID != bobID {
+		t.Fatalf("online friend isn't first: %+v", friends)
+	}
+}
+
+func TestRelationshipMutations(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.GroupDMs)
+
+	const (
+		friendID  = 100000000000000002
+		blockedID = 100000000000000005
+	)
+
+	var updates []*relationship.UpdateEvent
+	n.AddSyncHandler(func(ev *relationship.UpdateEvent) { updates = append(updates, ev) })
+
+	var requests []string
+	fail := false
+	n.Client.Client.Retries = 1
+	n.Client.Client.Client = httpdriver.WrapClient(http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			var body []byte
+			if r.Body != nil {
+				body, _ = io.ReadAll(r.Body)
+			}
+			requests = append(requests, r.Method+" "+r.URL.Path+" "+string(body))
+
+			status := 204
+			if fail {
+				status = 400
+			}
+			return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(""))}, nil
+		}),
+	})
+
+	if err := n.RelationshipState.Unblock(blockedID); err != nil {
+		t.Fatal("cannot unblock:", err)
+	}
+	if n.RelationshipState.IsBlocked(blockedID) {
+		t.Error("user is still blocked")
+	}
+
+	// A failed block is reverted.
+	fail = true
+	if err := n.RelationshipState.Block(friendID); err == nil {
+		t.Fatal("expected block to fail")
+	}
+	if got := n.RelationshipState.Relationship(friendID); got != discord.FriendRelationship {
+		t.Errorf("got relationship %d after failed block, want friend", got)
+	}
+
+	fail = false
+	if err := n.RelationshipState.SendFriendRequest("mallory#1234"); err != nil {
+		t.Fatal("cannot send friend request:", err)
+	}
+
+	if err := n.Flush(context.Background()); err != nil {
+		t.Fatal("cannot flush:", err)
+	}
+
+	want := []relationship.UpdateEvent{
+		{UserID: blockedID, Type: 0},
+		{UserID: friendID, Type: discord.BlockedRelationship},
+		{UserID: friendID, Type: discord.FriendRelationship},
+	}
+	if len(updates) != len(want) {
+		t.Fatalf("got updates %+v", updates)
+	}
+	for i, ev := range updates {
+		if *ev != want[i] {
+			t.Errorf("update %d: got %+v, want %+v", i, *ev, want[i])
+		}
+	}
+
+	if len(requests) != 3 ||
+		!strings.HasPrefix(requests[0], "DELETE ") ||
+		!strings.Contains(requests[2], `{"username":"mallory","discriminator":"1234"}`) {
+		t.Errorf("got requests %q", requests)
+	}
+}
+
+// waitFor waits until cond returns true, failing the test if it doesn't within
+// a few seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
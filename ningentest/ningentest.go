@@ -0,0 +1,174 @@
+// Package ningentest provides recorded and sanitized Ready payloads as well as
+// helpers to boot a ningen State from them. It is meant for downstream
+// projects that want to regression-test their sidebar or unread logic against
+// realistic payloads without connecting to Discord.
+package ningentest
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/state"
+	"github.com/diamondburned/ningen/v3"
+)
+
+//go:embed fixtures/*.json
+var fixturesFS embed.FS
+
+const supplementalSuffix = "_supplemental"
+
+// Fixture is a single recorded account shape. All IDs and names inside the
+// fixtures are sanitized.
+type Fixture struct {
+	// Name is the name of the fixture, which is the file name without the
+	// extension.
+	Name string
+	// Ready is the raw READY event body.
+	Ready json.RawMessage
+	// ReadySupplemental is the raw READY_SUPPLEMENTAL event body. It is nil
+	// if the fixture doesn't have one.
+	ReadySupplemental json.RawMessage
+}
+
+// Known fixture names.
+const (
+	// Guilds is an account in several guilds, one of which is muted. It
+	// contains read, unread and mentioned channels as well as a hidden
+	// channel and an empty category.
+	Guilds = "guilds"
+	// GroupDMs is an account with no guilds but with direct messages, a group
+	// DM and a few relationships.
+	GroupDMs = "group_dms"
+	// Threads is an account in a guild with joined threads and a forum post.
+	// The forum itself has a stale read state, like in some real servers.
+	Threads = "threads"
+)
+
+// FixtureNames returns the names of all available fixtures in sorted order.
+func FixtureNames() []string {
+	entries, err := fixturesFS.ReadDir("fixtures")
+	if err != nil {
+		panic("ningentest: cannot read embedded fixtures: " + err.Error())
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".json")
+		if strings.HasSuffix(name, supplementalSuffix) {
+			continue
+		}
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// LoadFixture loads the fixture with the given name.
+func LoadFixture(name string) (*Fixture, error) {
+	ready, err := fixturesFS.ReadFile(path.Join("fixtures", name+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("unknown fixture %q: %w", name, err)
+	}
+
+	fixture := &Fixture{
+		Name:  name,
+		Ready: ready,
+	}
+
+	supplemental, err := fixturesFS.ReadFile(path.Join("fixtures", name+supplementalSuffix+".json"))
+	if err == nil {
+		fixture.ReadySupplemental = supplemental
+	}
+
+	return fixture, nil
+}
+
+// ReadyEvent decodes the fixture's Ready event. The raw event body is kept, so
+// ningen's Ready handlers see the same payload as they would from Discord.
+func (f *Fixture) ReadyEvent() (*gateway.ReadyEvent, error) {
+	var ev gateway.ReadyEvent
+	if err := json.Unmarshal(f.Ready, &ev); err != nil {
+		return nil, fmt.Errorf("cannot decode Ready fixture %q: %w", f.Name, err)
+	}
+	return &ev, nil
+}
+
+// ReadySupplementalEvent decodes the fixture's ReadySupplemental event. Nil is
+// returned if the fixture doesn't have one.
+func (f *Fixture) ReadySupplementalEvent() (*gateway.ReadySupplementalEvent, error) {
+	if f.ReadySupplemental == nil {
+		return nil, nil
+	}
+
+	var ev gateway.ReadySupplementalEvent
+	if err := json.Unmarshal(f.ReadySupplemental, &ev); err != nil {
+		return nil, fmt.Errorf("cannot decode ReadySupplemental fixture %q: %w", f.Name, err)
+	}
+	return &ev, nil
+}
+
+// NewState creates a new ningen State from the fixture. The returned State is
+// never connected to Discord; the fixture's events are dispatched directly
+// into the handler chain, just like the gateway would.
+func (f *Fixture) NewState() (*ningen.State, error) {
+	ready, err := f.ReadyEvent()
+	if err != nil {
+		return nil, err
+	}
+
+	supplemental, err := f.ReadySupplementalEvent()
+	if err != nil {
+		return nil, err
+	}
+
+	id := gateway.DefaultIdentifier("ningentest")
+	n := ningen.FromState(state.NewWithIdentifier(id))
+
+	Dispatch(n, ready)
+	if supplemental != nil {
+		Dispatch(n, supplemental)
+	}
+
+	return n, nil
+}
+
+// TB is the part of testing.TB that NewState uses. It is declared here so that
+// importing ningentest doesn't import the testing package and its flags.
+type TB interface {
+	Helper()
+	Fatal(args ...interface{})
+}
+
+// NewState loads the fixture with the given name and boots a ningen State from
+// it. The test fails immediately if the fixture cannot be loaded.
+func NewState(tb TB, name string) *ningen.State {
+	tb.Helper()
+
+	fixture, err := LoadFixture(name)
+	if err != nil {
+		tb.Fatal("ningentest:", err)
+	}
+
+	n, err := fixture.NewState()
+	if err != nil {
+		tb.Fatal("ningentest:", err)
+	}
+
+	return n
+}
+
+// Dispatch dispatches the given event into the State as if it came from the
+// gateway. Synchronous handlers, along with the events that ningen dispatches
+// in the background because of the event, are done by the time Dispatch
+// returns.
+func Dispatch(n *ningen.State, ev gateway.Event) {
+	n.Session.Handler.Call(ev)
+	n.Flush(context.Background())
+}
@@ -0,0 +1,197 @@
+// Package notifier turns ningen's NotificationEvents into a stream of
+// ready-to-show notifications, for headless clients such as desktop
+// notification daemons. It combines the notification engine with a message
+// preview builder and the user's presence rules.
+package notifier
+
+import (
+	"sync"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/ningen/v3"
+)
+
+// DefaultBuffer is the default number of notifications buffered before new
+// ones are dropped.
+const DefaultBuffer = 16
+
+// Notification is a notification ready to be shown.
+type Notification struct {
+	// Title is the message author, followed by where the message was sent.
+	Title string
+	// Body is the preview of the message.
+	Body string
+	// IconURL is the author's avatar URL.
+	IconURL string
+
+	GuildID   discord.GuildID
+	ChannelID discord.ChannelID
+	MessageID discord.MessageID
+	Reason    ningen.NotificationReason
+}
+
+// Rules decides which notifications are emitted on top of the notification
+// settings that the State already respects.
+type Rules struct {
+	// Statuses are the user's statuses in which notifications are dropped.
+	// Do Not Disturb is always dropped.
+	Statuses []discord.Status
+	// Focused, if not nil, returns the channel that the user is currently
+	// looking at. Notifications for it are dropped.
+	Focused func() discord.ChannelID
+	// PreviewLength is the maximum length of the body in characters. If it is
+	// 0, DefaultPreviewLength is used.
+	PreviewLength int
+	// HideContent replaces the body with a generic text, like the official
+	// client's "Show message content" setting being off. The content of
+	// messages flagged by a content filter is always hidden.
+	HideContent bool
+	// Buffer is the number of notifications buffered. If it is 0,
+	// DefaultBuffer is used.
+	Buffer int
+}
+
+// Notifier emits Notifications for the NotificationEvents of a State.
+type Notifier struct {
+	state *ningen.State
+	rules Rules
+	ch    chan Notification
+	rm    func()
+
+	mutex   sync.Mutex
+	closed  bool
+	dropped int
+}
+
+// New creates a new Notifier that listens to the given State. Notifier must
+// be closed after use.
+func New(state *ningen.State, rules Rules) *Notifier {
+	if rules.PreviewLength == 0 {
+		rules.PreviewLength = DefaultPreviewLength
+	}
+	if rules.Buffer == 0 {
+		rules.Buffer = DefaultBuffer
+	}
+
+	n := &Notifier{
+		state: state,
+		rules: rules,
+		ch:    make(chan Notification, rules.Buffer),
+	}
+
+	n.rm = state.AddSyncHandler(func(ev *ningen.NotificationEvent) {
+		if !n.allows(ev) {
+			return
+		}
+		n.send(n.build(ev))
+	})
+
+	return n
+}
+
+// Notifications returns the channel that Notifications are sent to. It is
+// closed when the Notifier is closed.
+func (n *Notifier) Notifications() <-chan Notification {
+	return n.ch
+}
+
+// Dropped returns the number of notifications dropped because the buffer was
+// full.
+func (n *Notifier) Dropped() int {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return n.dropped
+}
+
+// Close stops listening to the State and closes the Notifications channel.
+func (n *Notifier) Close() {
+	n.rm()
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if !n.closed {
+		n.closed = true
+		close(n.ch)
+	}
+}
+
+// send sends the notification without blocking the gateway.
+func (n *Notifier) send(notif Notification) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.closed {
+		return
+	}
+
+	select {
+	case n.ch <- notif:
+	default:
+		n.dropped++
+	}
+}
+
+func (n *Notifier) allows(ev *ningen.NotificationEvent) bool {
+	if !ev.Notifies() {
+		return false
+	}
+
+	if len(n.rules.Statuses) > 0 {
+		status := n.state.Status()
+		for _, s := range n.rules.Statuses {
+			if s == status {
+				return false
+			}
+		}
+	}
+
+	if n.rules.Focused != nil && n.rules.Focused() == ev.Message.ChannelID {
+		return false
+	}
+
+	return true
+}
+
+func (n *Notifier) build(ev *ningen.NotificationEvent) Notification {
+	msg := ev.Message
+
+	notif := Notification{
+		Title:     authorName(n.state, msg),
+		IconURL:   msg.Author.AvatarURL(),
+		GuildID:   msg.GuildID,
+		ChannelID: msg.ChannelID,
+		MessageID: msg.ID,
+		Reason:    ev.Reason,
+	}
+
+	switch {
+	case ev.GuildName != "":
+		notif.Title += " (#" + ev.ChannelName + ", " + ev.GuildName + ")"
+	case ev.ChannelName != "" && ev.ChannelName != msg.Author.DisplayOrUsername():
+		// Group DMs; direct messages already have the author as the name.
+		notif.Title += " (" + ev.ChannelName + ")"
+	}
+
+	if n.rules.HideContent || ev.Flagged {
+		notif.Body = "New message"
+	} else {
+		notif.Body = Preview(*n.state.Cabinet, msg, n.rules.PreviewLength)
+	}
+
+	return notif
+}
+
+// authorName returns the author's nickname in the guild, falling back to
+// their display name.
+func authorName(state *ningen.State, msg *discord.Message) string {
+	if msg.GuildID.IsValid() {
+		m, _ := state.Cabinet.Member(msg.GuildID, msg.Author.ID)
+		if m != nil && m.Nick != "" {
+			return m.Nick
+		}
+	}
+
+	return msg.Author.DisplayOrUsername()
+}
@@ -0,0 +1,107 @@
+package notifier
+
+import (
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/state/store"
+	"github.com/diamondburned/ningen/v3"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestNotifier(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	var focused discord.ChannelID
+	notifier := New(n, Rules{
+		Statuses: []discord.Status{discord.IdleStatus},
+		Focused:  func() discord.ChannelID { return focused },
+	})
+	defer notifier.Close()
+
+	send := func(id discord.MessageID, content string) {
+		ningentest.Dispatch(n, &gateway.MessageCreateEvent{Message: discord.Message{
+			ID:        id,
+			ChannelID: 300000000000000002,
+			GuildID:   200000000000000001,
+			Author:    discord.User{ID: 100000000000000002, Username: "other"},
+			Content:   content,
+			Mentions:  []discord.GuildUser{{User: discord.User{ID: 100000000000000001}}},
+		}})
+	}
+
+	receive := func() (Notification, bool) {
+		select {
+		case notif := <-notifier.Notifications():
+			return notif, true
+		default:
+			return Notification{}, false
+		}
+	}
+
+	send(900000000000000080, "hello **<#300000000000000003>**,\n  how are you")
+
+	notif, ok := receive()
+	if !ok {
+		t.Fatal("no notification for a mention")
+	}
+	if notif.Title != "other (#general, First Guild)" {
+		t.Errorf("unexpected title %q", notif.Title)
+	}
+	if notif.Body != "hello #random, how are you" {
+		t.Errorf("unexpected body %q", notif.Body)
+	}
+	if notif.Reason != ningen.MentionReason {
+		t.Errorf("unexpected reason %v", notif.Reason)
+	}
+
+	focused = 300000000000000002
+	send(900000000000000081, "focused")
+	if notif, ok := receive(); ok {
+		t.Errorf("unexpected notification for the focused channel: %+v", notif)
+	}
+	focused = 0
+
+	me, _ := n.Cabinet.Me()
+	n.PresenceStore.PresenceSet(0, &discord.Presence{User: *me, Status: discord.IdleStatus}, true)
+
+	send(900000000000000082, "idle")
+	if notif, ok := receive(); ok {
+		t.Errorf("unexpected notification while idle: %+v", notif)
+	}
+}
+
+func TestPreview(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  discord.Message
+		max  int
+		want string
+	}{
+		{
+			name: "truncated",
+			msg:  discord.Message{Content: "the quick brown fox"},
+			max:  10,
+			want: "the quick…",
+		},
+		{
+			name: "attachments",
+			msg:  discord.Message{Attachments: make([]discord.Attachment, 2)},
+			want: "Sent 2 attachments",
+		},
+		{
+			name: "sticker",
+			msg:  discord.Message{Stickers: []discord.StickerItem{{Name: "wave"}}},
+			want: "Sent a sticker: wave",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Preview(store.Cabinet{}, &test.msg, test.max); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
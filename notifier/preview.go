@@ -0,0 +1,67 @@
+package notifier
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/state/store"
+	"github.com/diamondburned/ningen/v3/discordmd"
+)
+
+// DefaultPreviewLength is the default maximum length of a preview.
+const DefaultPreviewLength = 200
+
+// Preview returns a single-line plain text preview of the message, truncated
+// to maxLen characters. Mentions are resolved using the cabinet. Messages
+// without content are described by what they contain instead.
+func Preview(cab store.Cabinet, msg *discord.Message, maxLen int) string {
+	if msg.Content == "" {
+		return describe(msg)
+	}
+
+	src := []byte(msg.Content)
+	node := discordmd.ParseWithMessage(src, cab, msg, true)
+
+	var buf bytes.Buffer
+	if err := discordmd.DefaultRenderer.Render(&buf, src, node); err != nil {
+		return truncate(msg.Content, maxLen)
+	}
+
+	preview := strings.Join(strings.Fields(buf.String()), " ")
+	if preview == "" {
+		return describe(msg)
+	}
+
+	return truncate(preview, maxLen)
+}
+
+// describe describes a message without content.
+func describe(msg *discord.Message) string {
+	switch {
+	case len(msg.Attachments) == 1:
+		return "Sent an attachment"
+	case len(msg.Attachments) > 1:
+		return "Sent " + strconv.Itoa(len(msg.Attachments)) + " attachments"
+	case len(msg.Stickers) > 0:
+		return "Sent a sticker: " + msg.Stickers[0].Name
+	case len(msg.Embeds) > 0:
+		return "Sent an embed"
+	default:
+		return "Sent a message"
+	}
+}
+
+func truncate(s string, maxLen int) string {
+	if maxLen <= 0 {
+		return s
+	}
+
+	runes := []rune(s)
+	if len(runes) <= maxLen {
+		return s
+	}
+
+	return strings.TrimSpace(string(runes[:maxLen-1])) + "…"
+}
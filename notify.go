@@ -0,0 +1,155 @@
+package ningen
+
+import (
+	"sync"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+)
+
+// NotificationReason is the reason that a message mentions or notifies the
+// user.
+type NotificationReason uint8
+
+const (
+	// NoReason is when the message neither mentions nor notifies the user.
+	NoReason NotificationReason = iota
+	// MentionReason is when the message mentions the user directly.
+	MentionReason
+	// RoleMentionReason is when the message mentions a role that the user has.
+	RoleMentionReason
+	// EveryoneMentionReason is when the message mentions @everyone or @here.
+	EveryoneMentionReason
+	// HighlightReason is when the highlighter set using SetHighlighter matches
+	// the message.
+	HighlightReason
+	// DMReason is when the message is sent in a private channel.
+	DMReason
+	// AllMessagesReason is when the notification settings ask for all
+	// messages.
+	AllMessagesReason
+)
+
+// String returns the reason in words.
+func (r NotificationReason) String() string {
+	switch r {
+	case NoReason:
+		return "none"
+	case MentionReason:
+		return "mention"
+	case RoleMentionReason:
+		return "role mention"
+	case EveryoneMentionReason:
+		return "everyone mention"
+	case HighlightReason:
+		return "highlight"
+	case DMReason:
+		return "direct message"
+	case AllMessagesReason:
+		return "all messages"
+	default:
+		return "unknown"
+	}
+}
+
+// NotificationEvent is dispatched after every MessageCreateEvent. It carries
+// what MessageMentions computed for the message, so clients only have to
+// decide how to show the notification.
+type NotificationEvent struct {
+	Message *discord.Message
+	Flags   MessageMentionFlags
+	Reason  NotificationReason
+	// Silenced is true if MessageNotifies was dropped from Flags, because the
+	// user is in Do Not Disturb or the message was sent with @silent.
+	Silenced bool
+	// Flagged is true if a content filter flagged the message, so its content
+	// shouldn't be previewed. See AddContentFilter.
+	Flagged bool
+	// GuildName is the name of the message's guild. It is empty for private
+	// channels.
+	GuildName string
+	// ChannelName is the name of the message's channel. For direct messages,
+	// it is the display name of the recipient.
+	ChannelName string
+}
+
+var _ gateway.Event = (*NotificationEvent)(nil)
+
+func (ev NotificationEvent) Op() ws.OpCode           { return -1 }
+func (ev NotificationEvent) EventType() ws.EventType { return "__ningen.NotificationEvent" }
+
+// Notifies returns true if the client should show a visible notification.
+func (ev *NotificationEvent) Notifies() bool {
+	return ev.Flags.Has(MessageNotifies)
+}
+
+type notifier struct {
+	mutex       sync.RWMutex
+	highlighter func(*discord.Message) bool
+	reactions   ReactionNotifications
+}
+
+func (n *notifier) highlights(msg *discord.Message) bool {
+	n.mutex.RLock()
+	highlighter := n.highlighter
+	n.mutex.RUnlock()
+
+	return highlighter != nil && highlighter(msg)
+}
+
+// SetHighlighter sets the function that decides whether a message that
+// doesn't mention the user should be treated like a mention, such as when it
+// contains one of the user's keywords. The function must be fast and
+// concurrency-safe. Passing nil removes the highlighter.
+func (s *State) SetHighlighter(highlighter func(*discord.Message) bool) {
+	s.notifier.mutex.Lock()
+	defer s.notifier.mutex.Unlock()
+
+	s.notifier.highlighter = highlighter
+}
+
+// notify dispatches a NotificationEvent for the message.
+func (s *State) notify(msg *discord.Message) {
+	flags, reason := s.messageNotification(msg)
+
+	ev := &NotificationEvent{
+		Message: msg,
+		Flags:   flags,
+		Reason:  reason,
+		Flagged: s.MessageIsFlagged(msg.ID),
+	}
+
+	if flags.Has(MessageNotifies) &&
+		(s.Status() == discord.DoNotDisturbStatus || msg.Flags&discord.SuppressNotifications != 0) {
+
+		ev.Flags &^= MessageNotifies
+		ev.Silenced = true
+	}
+
+	if msg.GuildID.IsValid() {
+		if g, err := s.Cabinet.Guild(msg.GuildID); err == nil {
+			ev.GuildName = g.Name
+		}
+	}
+
+	if ch, err := s.Cabinet.Channel(msg.ChannelID); err == nil {
+		ev.ChannelName = channelName(ch)
+	}
+
+	s.dispatch(ev)
+}
+
+// channelName returns the name of the channel as the official client shows it.
+func channelName(ch *discord.Channel) string {
+	if ch.Name != "" || len(ch.DMRecipients) == 0 {
+		return ch.Name
+	}
+
+	name := ch.DMRecipients[0].DisplayOrUsername()
+	for _, u := range ch.DMRecipients[1:] {
+		name += ", " + u.DisplayOrUsername()
+	}
+
+	return name
+}
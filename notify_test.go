@@ -0,0 +1,111 @@
+package ningen_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/ningen/v3"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestNotificationEvent(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	var last *ningen.NotificationEvent
+	n.AddSyncHandler(func(ev *ningen.NotificationEvent) { last = ev })
+
+	send := func(id discord.MessageID, content string, mentions ...discord.UserID) *ningen.NotificationEvent {
+		msg := discord.Message{
+			ID:        id,
+			ChannelID: 300000000000000002,
+			GuildID:   200000000000000001,
+			Author:    discord.User{ID: 100000000000000002},
+			Content:   content,
+		}
+		for _, id := range mentions {
+			msg.Mentions = append(msg.Mentions, discord.GuildUser{User: discord.User{ID: id}})
+		}
+
+		last = nil
+		ningentest.Dispatch(n, &gateway.MessageCreateEvent{Message: msg})
+		if last == nil {
+			t.Fatal("no NotificationEvent dispatched")
+		}
+		return last
+	}
+
+	ev := send(900000000000000070, "hi", 100000000000000001)
+	if ev.Reason != ningen.MentionReason || !ev.Notifies() {
+		t.Errorf("mention: got reason %v, flags %d", ev.Reason, ev.Flags)
+	}
+	if ev.GuildName != "First Guild" || ev.ChannelName != "general" {
+		t.Errorf("mention: got names %q, %q", ev.GuildName, ev.ChannelName)
+	}
+
+	n.SetHighlighter(func(msg *discord.Message) bool {
+		return strings.Contains(msg.Content, "ningen")
+	})
+
+	if ev := send(900000000000000071, "about ningen"); ev.Reason != ningen.HighlightReason {
+		t.Errorf("highlight: got reason %v", ev.Reason)
+	}
+
+	me, _ := n.Cabinet.Me()
+	n.PresenceStore.PresenceSet(0, &discord.Presence{User: *me, Status: discord.DoNotDisturbStatus}, true)
+
+	ev = send(900000000000000072, "hi again", 100000000000000001)
+	if !ev.Silenced || ev.Notifies() || !ev.Flags.Has(ningen.MessageMentions) {
+		t.Errorf("do not disturb: got flags %d, silenced %v", ev.Flags, ev.Silenced)
+	}
+}
+
+func TestReactionNotificationEvent(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.GroupDMs)
+
+	var events []*ningen.ReactionNotificationEvent
+	n.AddSyncHandler(func(ev *ningen.ReactionNotificationEvent) { events = append(events, ev) })
+
+	n.Cabinet.MessageSet(&discord.Message{
+		ID:        900000000000001100,
+		ChannelID: 400000000000000001,
+		Author:    discord.User{ID: 100000000000000001},
+	}, false)
+
+	react := func(userID discord.UserID) int {
+		events = nil
+		ningentest.Dispatch(n, &gateway.MessageReactionAddEvent{
+			UserID:    userID,
+			ChannelID: 400000000000000001,
+			MessageID: 900000000000001100,
+			Emoji:     discord.Emoji{Name: "👍"},
+		})
+		return len(events)
+	}
+
+	if n.ReactionNotifications() != ningen.AllReactionNotifications {
+		t.Errorf("got default setting %v", n.ReactionNotifications())
+	}
+
+	if react(100000000000000002) != 1 {
+		t.Fatal("no event for a reaction to the user's message")
+	}
+	if ev := events[0]; ev.Message.ID != 900000000000001100 || ev.Silenced || ev.ChannelName == "" {
+		t.Errorf("got event %+v", ev)
+	}
+
+	if react(100000000000000001) != 0 {
+		t.Error("the user's own reaction notifies")
+	}
+
+	n.SetReactionNotifications(ningen.DMReactionNotifications)
+	if react(100000000000000002) != 1 {
+		t.Error("reaction in a DM doesn't notify with DMReactionNotifications")
+	}
+
+	n.SetReactionNotifications(ningen.NoReactionNotifications)
+	if react(100000000000000002) != 0 {
+		t.Error("reaction notifies with NoReactionNotifications")
+	}
+}
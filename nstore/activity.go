@@ -0,0 +1,94 @@
+package nstore
+
+import "github.com/diamondburned/arikawa/v3/discord"
+
+// activityPriority is the order in which activities are considered for the
+// activity line after the custom status, following the official client.
+var activityPriority = []discord.ActivityType{
+	discord.StreamingActivity,
+	discord.GameActivity,
+	discord.ListeningActivity,
+	discord.WatchingActivity,
+	discord.CompetingActivity,
+}
+
+// ActivityLine returns the line that describes what the user is doing, such as
+// "Playing X" or the text of their custom status, using the same precedence as
+// the official client: the custom status comes first, then streaming, playing,
+// listening, watching and competing activities. The returned emoji is the
+// custom status emoji, if any; it is not included in the text. An empty string
+// and nil are returned if the user has no presence or no activity.
+func (pres *PresenceStore) ActivityLine(userID discord.UserID) (string, *discord.Emoji) {
+	pres.mut.RLock()
+	defer pres.mut.RUnlock()
+
+	p := pres.presence(0, userID)
+	if p == nil {
+		return "", nil
+	}
+
+	for i := range p.Activities {
+		if p.Activities[i].Type != discord.CustomActivity {
+			continue
+		}
+
+		text := CustomStatusText(&p.Activities[i])
+		emoji := p.Activities[i].Emoji
+		if text != "" || emoji != nil {
+			if emoji != nil {
+				cpy := *emoji
+				emoji = &cpy
+			}
+			return text, emoji
+		}
+	}
+
+	for _, typ := range activityPriority {
+		for i := range p.Activities {
+			if p.Activities[i].Type == typ {
+				return FormatActivity(&p.Activities[i]), nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// CustomStatusText returns the text of a custom status activity. The text is
+// in State with "Custom Status" as a placeholder Name, both for custom statuses
+// from the gateway and for the ones that ningen creates from the user settings
+// and SetStatus. A Name other than the placeholder is used if State is empty,
+// since some clients put the text there.
+func CustomStatusText(a *discord.Activity) string {
+	if a.State != "" {
+		return a.State
+	}
+	if a.Name != "Custom Status" {
+		return a.Name
+	}
+	return ""
+}
+
+// FormatActivity formats the activity into a short line like the ones in the
+// official client's member list, e.g. "Listening to Spotify".
+func FormatActivity(a *discord.Activity) string {
+	switch a.Type {
+	case discord.GameActivity:
+		return "Playing " + a.Name
+	case discord.StreamingActivity:
+		if a.Details != "" {
+			return "Streaming " + a.Details
+		}
+		return "Streaming " + a.Name
+	case discord.ListeningActivity:
+		return "Listening to " + a.Name
+	case discord.WatchingActivity:
+		return "Watching " + a.Name
+	case discord.CompetingActivity:
+		return "Competing in " + a.Name
+	case discord.CustomActivity:
+		return CustomStatusText(a)
+	default:
+		return a.Name
+	}
+}
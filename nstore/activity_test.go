@@ -0,0 +1,84 @@
+package nstore
+
+import (
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+func TestActivityLine(t *testing.T) {
+	tests := []struct {
+		name       string
+		activities []discord.Activity
+		text       string
+		emoji      string
+	}{
+		{
+			name: "none",
+		},
+		{
+			name: "custom status first",
+			activities: []discord.Activity{
+				{Type: discord.GameActivity, Name: "Go"},
+				{Type: discord.CustomActivity, Name: "Custom Status", State: "busy", Emoji: &discord.Emoji{Name: "🔨"}},
+			},
+			text:  "busy",
+			emoji: "🔨",
+		},
+		{
+			name: "emoji only custom status",
+			activities: []discord.Activity{
+				{Type: discord.CustomActivity, Name: "Custom Status", Emoji: &discord.Emoji{Name: "💤"}},
+			},
+			emoji: "💤",
+		},
+		{
+			name: "empty custom status",
+			activities: []discord.Activity{
+				{Type: discord.CustomActivity, Name: "Custom Status"},
+				{Type: discord.ListeningActivity, Name: "Spotify"},
+			},
+			text: "Listening to Spotify",
+		},
+		{
+			name: "streaming over playing",
+			activities: []discord.Activity{
+				{Type: discord.GameActivity, Name: "Go"},
+				{Type: discord.StreamingActivity, Name: "Twitch", Details: "coding"},
+			},
+			text: "Streaming coding",
+		},
+		{
+			name: "competing",
+			activities: []discord.Activity{
+				{Type: discord.CompetingActivity, Name: "a contest"},
+			},
+			text: "Competing in a contest",
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			userID := discord.UserID(i + 1)
+
+			pres := NewPresenceStore()
+			pres.PresenceSet(0, &discord.Presence{
+				User:       discord.User{ID: userID},
+				Activities: test.activities,
+			}, false)
+
+			text, emoji := pres.ActivityLine(userID)
+			if text != test.text {
+				t.Errorf("got text %q, want %q", text, test.text)
+			}
+
+			var emojiName string
+			if emoji != nil {
+				emojiName = emoji.Name
+			}
+			if emojiName != test.emoji {
+				t.Errorf("got emoji %q, want %q", emojiName, test.emoji)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package nstore
+
+import (
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+)
+
+// PresenceDiffEvent is the difference between a user's previous and new
+// presence. ningen dispatches it when the status or activities of a user
+// change, before the PresenceUpdateEvent itself, so clients can show toasts
+// like "X is now playing Y" without keeping their own copies of presences.
+//
+// The activities are shared with the PresenceStore and must not be modified.
+type PresenceDiffEvent struct {
+	UserID discord.UserID
+	// GuildID is the guild of the new presence, which is null for presences
+	// that don't belong to a guild, such as those of friends.
+	GuildID discord.GuildID
+
+	OldStatus discord.Status
+	NewStatus discord.Status
+
+	OldActivities []discord.Activity
+	NewActivities []discord.Activity
+}
+
+var _ gateway.Event = (*PresenceDiffEvent)(nil)
+
+func (ev PresenceDiffEvent) Op() ws.OpCode           { return -1 }
+func (ev PresenceDiffEvent) EventType() ws.EventType { return "__nstore.PresenceDiffEvent" }
+
+// StatusChanged returns true if the user's status changed.
+func (ev *PresenceDiffEvent) StatusChanged() bool {
+	return ev.OldStatus != ev.NewStatus
+}
+
+// StartedActivities returns the new activities that the user wasn't doing
+// before. Activities are told apart by their type and name, so a song change
+// on Spotify isn't a new activity.
+func (ev *PresenceDiffEvent) StartedActivities() []discord.Activity {
+	return activitiesExcept(ev.NewActivities, ev.OldActivities)
+}
+
+// StoppedActivities returns the old activities that the user isn't doing
+// anymore. See StartedActivities.
+func (ev *PresenceDiffEvent) StoppedActivities() []discord.Activity {
+	return activitiesExcept(ev.OldActivities, ev.NewActivities)
+}
+
+// activitiesExcept returns the activities in a that aren't in b.
+func activitiesExcept(a, b []discord.Activity) []discord.Activity {
+	var diff []discord.Activity
+
+outer:
+	for _, activity := range a {
+		for _, other := range b {
+			if activity.Type == other.Type && activity.Name == other.Name {
+				continue outer
+			}
+		}
+		diff = append(diff, activity)
+	}
+
+	return diff
+}
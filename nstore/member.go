@@ -39,6 +39,21 @@ func (s *MemberStore) Reset() error {
 	return nil
 }
 
+// Len returns the number of members in the store across all guilds.
+func (s *MemberStore) Len() int {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	var n int
+	for _, gm := range s.guilds {
+		gm.mut.RLock()
+		n += len(gm.members)
+		gm.mut.RUnlock()
+	}
+
+	return n
+}
+
 func (s *MemberStore) Member(guildID discord.GuildID, userID discord.UserID) (*discord.Member, error) {
 	s.mut.Lock()
 	gm, ok := s.guilds[guildID]
@@ -1,15 +1,29 @@
 package nstore
 
 import (
+	"reflect"
 	"sync"
 
 	"github.com/diamondburned/arikawa/v3/discord"
 	"github.com/diamondburned/arikawa/v3/state/store"
 )
 
+// MaxUserPresences is the maximum number of guild presences kept per user.
+// Once a user has more, the least recently updated ones are dropped, except for
+// the presence without a guild. Presence then falls back to the latest
+// presence for the dropped guilds, which is usually the same.
+var MaxUserPresences = 8
+
 // PresenceStore is a presence store that allows searching for a user presence
-// regardless of the guild they're from.
+// regardless of the guild they're from. Identical activities of the same user
+// in different guilds are only stored once.
 type PresenceStore struct {
+	// OnDiff, if set, is called with the difference whenever PresenceSet
+	// changes the status or activities of a user who already had a presence.
+	// It is called after the store is unlocked, so it may use the store. It
+	// must be set before the store is used.
+	OnDiff func(*PresenceDiffEvent)
+
 	mut       sync.RWMutex
 	presences map[discord.UserID][]discord.Presence
 }
@@ -29,6 +43,14 @@ func (pres *PresenceStore) Reset() error {
 	return nil
 }
 
+// Len returns the number of users with a presence in the store.
+func (pres *PresenceStore) Len() int {
+	pres.mut.RLock()
+	defer pres.mut.RUnlock()
+
+	return len(pres.presences)
+}
+
 func (pres *PresenceStore) Presence(
 	guild discord.GuildID, user discord.UserID) (*discord.Presence, error) {
 
@@ -103,16 +125,29 @@ func (pres *PresenceStore) PresenceSet(guild discord.GuildID, p *discord.Presenc
 	cpy.GuildID = guild
 
 	pres.mut.Lock()
-	defer pres.mut.Unlock()
+	diff := pres.set(cpy)
+	pres.mut.Unlock()
 
-	presences, ok := pres.presences[p.User.ID]
+	if diff != nil && pres.OnDiff != nil {
+		pres.OnDiff(diff)
+	}
+
+	return nil
+}
+
+// set sets the presence and returns the difference to the user's previous
+// presence, if any. pres.mut must be held.
+func (pres *PresenceStore) set(cpy discord.Presence) *PresenceDiffEvent {
+	presences, ok := pres.presences[cpy.User.ID]
 	if !ok {
-		pres.presences[p.User.ID] = []discord.Presence{cpy}
+		pres.presences[cpy.User.ID] = []discord.Presence{cpy}
 		return nil
 	}
 
+	old := presences[len(presences)-1]
+
 	for i, presence := range presences {
-		if presence.GuildID == guild {
+		if presence.GuildID == cpy.GuildID {
 			// Delete this entry and break out of the loop. Add this one to the
 			// end of the list always.
 			presences = append(presences[:i], presences[i+1:]...)
@@ -120,10 +155,41 @@ func (pres *PresenceStore) PresenceSet(guild discord.GuildID, p *discord.Presenc
 		}
 	}
 
+	// Users usually have the same activities in every guild, so share them
+	// instead of keeping a copy per guild.
+	if len(cpy.Activities) > 0 {
+		for _, presence := range presences {
+			if activitiesEqual(presence.Activities, cpy.Activities) {
+				cpy.Activities = presence.Activities
+				break
+			}
+		}
+	}
+
 	presences = append(presences, cpy)
-	pres.presences[p.User.ID] = presences
 
-	return nil
+	for len(presences) > MaxUserPresences && MaxUserPresences > 0 {
+		i := 0
+		if !presences[0].GuildID.IsValid() && len(presences) > 2 {
+			i = 1
+		}
+		presences = append(presences[:i], presences[i+1:]...)
+	}
+
+	pres.presences[cpy.User.ID] = presences
+
+	if old.Status == cpy.Status && activitiesEqual(old.Activities, cpy.Activities) {
+		return nil
+	}
+
+	return &PresenceDiffEvent{
+		UserID:        cpy.User.ID,
+		GuildID:       cpy.GuildID,
+		OldStatus:     old.Status,
+		NewStatus:     cpy.Status,
+		OldActivities: old.Activities,
+		NewActivities: cpy.Activities,
+	}
 }
 
 func (pres *PresenceStore) PresenceRemove(guild discord.GuildID, user discord.UserID) error {
@@ -150,3 +216,11 @@ func (pres *PresenceStore) PresenceRemove(guild discord.GuildID, user discord.Us
 
 	return nil
 }
+
+// activitiesEqual returns true if both lists of activities are the same.
+func activitiesEqual(a, b []discord.Activity) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	return len(a) == 0 || reflect.DeepEqual(a, b)
+}
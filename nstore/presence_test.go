@@ -0,0 +1,115 @@
+package nstore
+
+import (
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+func TestPresenceStoreSharesActivities(t *testing.T) {
+	store := NewPresenceStore()
+
+	activities := func() []discord.Activity {
+		return []discord.Activity{{Type: discord.GameActivity, Name: "Go"}}
+	}
+
+	const userID = 100000000000000002
+
+	for guildID := discord.GuildID(1); guildID <= 3; guildID++ {
+		store.PresenceSet(guildID, &discord.Presence{
+			User:       discord.User{ID: userID},
+			Status:     discord.OnlineStatus,
+			Activities: activities(),
+		}, true)
+	}
+
+	p1, _ := store.Presence(1, userID)
+	p3, _ := store.Presence(3, userID)
+	if &p1.Activities[0] != &p3.Activities[0] {
+		t.Error("identical activities aren't shared")
+	}
+
+	store.PresenceSet(2, &discord.Presence{
+		User:       discord.User{ID: userID},
+		Activities: []discord.Activity{{Type: discord.GameActivity, Name: "Rust"}},
+	}, true)
+
+	if p, _ := store.Presence(2, userID); p.Activities[0].Name != "Rust" {
+		t.Errorf("got activities %+v in guild 2", p.Activities)
+	}
+	if p, _ := store.Presence(1, userID); p.Activities[0].Name != "Go" {
+		t.Errorf("got activities %+v in guild 1", p.Activities)
+	}
+}
+
+func TestPresenceStoreCap(t *testing.T) {
+	store := NewPresenceStore()
+
+	const userID = 100000000000000002
+
+	store.PresenceSet(0, &discord.Presence{User: discord.User{ID: userID, Username: "alice"}}, true)
+	for guildID := discord.GuildID(1); guildID <= discord.GuildID(MaxUserPresences*2); guildID++ {
+		store.PresenceSet(guildID, &discord.Presence{User: discord.User{ID: userID}}, true)
+	}
+
+	presences := store.presences[userID]
+	if len(presences) != MaxUserPresences {
+		t.Fatalf("got %d presences, want %d", len(presences), MaxUserPresences)
+	}
+
+	// The presence without a guild is kept.
+	if presences[0].GuildID.IsValid() || presences[0].User.Username != "alice" {
+		t.Errorf("got first presence %+v, want the one without a guild", presences[0])
+	}
+	if last := presences[len(presences)-1]; last.GuildID != discord.GuildID(MaxUserPresences*2) {
+		t.Errorf("got latest presence from guild %d", last.GuildID)
+	}
+}
+
+func TestPresenceStoreDiff(t *testing.T) {
+	store := NewPresenceStore()
+
+	var diffs []*PresenceDiffEvent
+	store.OnDiff = func(ev *PresenceDiffEvent) { diffs = append(diffs, ev) }
+
+	const userID = 100000000000000002
+
+	set := func(guildID discord.GuildID, status discord.Status, activities ...discord.Activity) {
+		store.PresenceSet(guildID, &discord.Presence{
+			User:       discord.User{ID: userID},
+			Status:     status,
+			Activities: activities,
+		}, true)
+	}
+
+	game := discord.Activity{Type: discord.GameActivity, Name: "Go"}
+	song := discord.Activity{Type: discord.ListeningActivity, Name: "Spotify", Details: "A"}
+
+	set(1, discord.OnlineStatus, song)
+	if len(diffs) != 0 {
+		t.Fatalf("got diffs %+v for the first presence", diffs)
+	}
+
+	// The same presence from another guild isn't a change.
+	set(2, discord.OnlineStatus, song)
+	if len(diffs) != 0 {
+		t.Fatalf("got diffs %+v for an unchanged presence", diffs)
+	}
+
+	song.Details = "B"
+	set(2, discord.IdleStatus, song, game)
+	if len(diffs) != 1 {
+		t.Fatalf("got %d diffs, want 1", len(diffs))
+	}
+
+	diff := diffs[0]
+	if !diff.StatusChanged() || diff.OldStatus != discord.OnlineStatus || diff.NewStatus != discord.IdleStatus {
+		t.Errorf("got status change %q -> %q", diff.OldStatus, diff.NewStatus)
+	}
+	if started := diff.StartedActivities(); len(started) != 1 || started[0].Name != "Go" {
+		t.Errorf("got started activities %+v", started)
+	}
+	if stopped := diff.StoppedActivities(); len(stopped) != 0 {
+		t.Errorf("got stopped activities %+v", stopped)
+	}
+}
@@ -0,0 +1,68 @@
+package ningen
+
+import "github.com/diamondburned/arikawa/v3/discord"
+
+// permissionNames are the names of permissions as Discord shows them.
+var permissionNames = []struct {
+	perm discord.Permissions
+	name string
+}{
+	{discord.PermissionCreateInstantInvite, "Create Invite"},
+	{discord.PermissionKickMembers, "Kick Members"},
+	{discord.PermissionBanMembers, "Ban Members"},
+	{discord.PermissionAdministrator, "Administrator"},
+	{discord.PermissionManageChannels, "Manage Channels"},
+	{discord.PermissionManageGuild, "Manage Server"},
+	{discord.PermissionAddReactions, "Add Reactions"},
+	{discord.PermissionViewAuditLog, "View Audit Log"},
+	{discord.PermissionPrioritySpeaker, "Priority Speaker"},
+	{discord.PermissionStream, "Video"},
+	{discord.PermissionViewChannel, "View Channel"},
+	{discord.PermissionSendMessages, "Send Messages"},
+	{discord.PermissionSendTTSMessages, "Send Text-to-Speech Messages"},
+	{discord.PermissionManageMessages, "Manage Messages"},
+	{discord.PermissionEmbedLinks, "Embed Links"},
+	{discord.PermissionAttachFiles, "Attach Files"},
+	{discord.PermissionReadMessageHistory, "Read Message History"},
+	{discord.PermissionMentionEveryone, "Mention @everyone, @here, and All Roles"},
+	{discord.PermissionUseExternalEmojis, "Use External Emoji"},
+	{discord.PermissionViewGuildInsights, "View Server Insights"},
+	{discord.PermissionConnect, "Connect"},
+	{discord.PermissionSpeak, "Speak"},
+	{discord.PermissionMuteMembers, "Mute Members"},
+	{discord.PermissionDeafenMembers, "Deafen Members"},
+	{discord.PermissionMoveMembers, "Move Members"},
+	{discord.PermissionUseVAD, "Use Voice Activity"},
+	{discord.PermissionChangeNickname, "Change Nickname"},
+	{discord.PermissionManageNicknames, "Manage Nicknames"},
+	{discord.PermissionManageRoles, "Manage Roles"},
+	{discord.PermissionManageWebhooks, "Manage Webhooks"},
+	{discord.PermissionManageEmojisAndStickers, "Manage Emojis and Stickers"},
+	{discord.PermissionUseSlashCommands, "Use Application Commands"},
+	{discord.PermissionRequestToSpeak, "Request to Speak"},
+	{discord.PermissionManageEvents, "Manage Events"},
+	{discord.PermissionManageThreads, "Manage Threads"},
+	{discord.PermissionCreatePublicThreads, "Create Public Threads"},
+	{discord.PermissionCreatePrivateThreads, "Create Private Threads"},
+	{discord.PermissionUseExternalStickers, "Use External Stickers"},
+	{discord.PermissionSendMessagesInThreads, "Send Messages in Threads"},
+	{discord.PermissionStartEmbeddedActivities, "Use Activities"},
+	{discord.PermissionModerateMembers, "Timeout Members"},
+	{discord.PermissionViewCreatorMonetizationAnalytics, "View Creator Monetization Analytics"},
+	{discord.PermissionUseSoundboard, "Use Soundboard"},
+	{discord.PermissionUseExternalSounds, "Use External Sounds"},
+	{discord.PermissionSendVoiceMessages, "Send Voice Messages"},
+}
+
+// PermissionNames returns the names of the given permissions as Discord shows
+// them, such as "Send Messages", in the order of their bits. Unknown
+// permissions are skipped.
+func PermissionNames(perms discord.Permissions) []string {
+	var names []string
+	for _, p := range permissionNames {
+		if perms.Has(p.perm) {
+			names = append(names, p.name)
+		}
+	}
+	return names
+}
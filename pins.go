@@ -0,0 +1,34 @@
+package ningen
+
+import (
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// PinMessage pins the given message. Unlike the API method that it overrides,
+// it asserts that the user can manage messages in guild channels first, and it
+// updates the PinState cache right away, so pin lists refresh without a
+// refetch.
+func (s *State) PinMessage(chID discord.ChannelID, msgID discord.MessageID, reason api.AuditLogReason) error {
+	if err := s.assertCanPin(chID); err != nil {
+		return err
+	}
+	return s.PinState.Pin(chID, msgID, reason)
+}
+
+// UnpinMessage unpins the given message. See PinMessage.
+func (s *State) UnpinMessage(chID discord.ChannelID, msgID discord.MessageID, reason api.AuditLogReason) error {
+	if err := s.assertCanPin(chID); err != nil {
+		return err
+	}
+	return s.PinState.Unpin(chID, msgID, reason)
+}
+
+func (s *State) assertCanPin(chID discord.ChannelID) error {
+	ch, err := s.Cabinet.Channel(chID)
+	if err == nil && !ch.GuildID.IsValid() {
+		// Anyone can pin messages in private channels.
+		return nil
+	}
+	return s.AssertPermissions(chID, discord.PermissionManageMessages)
+}
@@ -0,0 +1,32 @@
+package ningen_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/diamondburned/ningen/v3"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestPinMessageNoPermission(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	err := n.PinMessage(300000000000000002, 900000000000000001, "")
+
+	var permErr *ningen.NoPermissionError
+	if !errors.As(err, &permErr) {
+		t.Fatalf("got error %v, want NoPermissionError", err)
+	}
+
+	if !errors.Is(err, ningen.ErrNoPermission) {
+		t.Error("error doesn't match ErrNoPermission")
+	}
+	if permErr.ChannelID != 300000000000000002 {
+		t.Errorf("got channel %d", permErr.ChannelID)
+	}
+
+	want := "user is missing permission Manage Messages in channel 300000000000000002"
+	if msg := permErr.Error(); msg != want {
+		t.Errorf("got message %q, want %q", msg, want)
+	}
+}
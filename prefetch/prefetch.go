@@ -0,0 +1,200 @@
+// Package prefetch provides a scheduler for background fetches. Subsystems
+// schedule their fetches with a priority instead of spawning their own
+// goroutines, so that the number of concurrent fetches stays bounded and
+// fetches for what the user is looking at run first.
+package prefetch
+
+import (
+	"context"
+	"sync"
+)
+
+// Priority is the priority tier of a scheduled fetch.
+type Priority uint8
+
+const (
+	// Background is for fetches that aren't needed by any view.
+	Background Priority = iota
+	// Adjacent is for fetches that are likely to be needed soon, such as
+	// for the neighbors of the visible channel.
+	Adjacent
+	// Visible is for fetches needed by what the user is looking at.
+	Visible
+
+	numPriorities
+)
+
+// String returns the name of the priority.
+func (p Priority) String() string {
+	switch p {
+	case Background:
+		return "background"
+	case Adjacent:
+		return "adjacent"
+	case Visible:
+		return "visible"
+	default:
+		return "unknown"
+	}
+}
+
+// DefaultWorkers is the default maximum number of fetches that a Scheduler
+// runs concurrently.
+const DefaultWorkers = 4
+
+type task struct {
+	ctx context.Context
+	fn  func(context.Context)
+}
+
+// Scheduler runs scheduled fetches using a bounded number of goroutines,
+// highest priority first. Workers only exist while there are fetches queued.
+//
+// A nil *Scheduler is valid: it runs every fetch in its own goroutine.
+type Scheduler struct {
+	mutex   sync.Mutex
+	queues  [numPriorities][]task
+	running int
+	workers int
+	closed  bool
+}
+
+// NewScheduler creates a new scheduler that runs up to workers fetches
+// concurrently. If workers is 0 or less, DefaultWorkers is used.
+func NewScheduler(workers int) *Scheduler {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	return &Scheduler{workers: workers}
+}
+
+// Go schedules fn to be called with the given priority. fn is always called
+// exactly once: if ctx is canceled before fn is started, or if the fetch is
+// dropped by Close, fn is called with a canceled context instead. This lets
+// callers clear their in-flight state in one place, so fn should check the
+// context before fetching anything. Views can cancel their pending fetches by
+// canceling their context when they close.
+func (s *Scheduler) Go(ctx context.Context, p Priority, fn func(context.Context)) {
+	if p >= numPriorities {
+		p = Visible
+	}
+
+	if s == nil {
+		go fn(ctx)
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		go fn(canceled(ctx))
+		return
+	}
+
+	s.queues[p] = append(s.queues[p], task{ctx, fn})
+
+	if s.running < s.workers {
+		s.running++
+		go s.work()
+	}
+}
+
+func (s *Scheduler) work() {
+	for {
+		s.mutex.Lock()
+		t, ok := s.next()
+		if !ok {
+			s.running--
+			s.mutex.Unlock()
+			return
+		}
+		s.mutex.Unlock()
+
+		t.fn(t.ctx)
+	}
+}
+
+// next pops the next task. Canceled tasks are popped as well, since their
+// functions still have to be called. s.mutex must be held.
+func (s *Scheduler) next() (task, bool) {
+	for p := int(numPriorities) - 1; p >= 0; p-- {
+		if len(s.queues[p]) > 0 {
+			t := s.queues[p][0]
+			s.queues[p][0] = task{}
+			s.queues[p] = s.queues[p][1:]
+			return t, true
+		}
+	}
+	return task{}, false
+}
+
+func canceled(ctx context.Context) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	return ctx
+}
+
+// Stats describes the current load of a Scheduler.
+type Stats struct {
+	// Queued is the number of fetches waiting to run per priority.
+	Queued [numPriorities]int
+	// Running is the number of worker goroutines.
+	Running int
+}
+
+// Stats returns the current load of the scheduler.
+func (s *Scheduler) Stats() Stats {
+	if s == nil {
+		return Stats{}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var stats Stats
+	for p, queue := range s.queues {
+		stats.Queued[p] = len(queue)
+	}
+	stats.Running = s.running
+
+	return stats
+}
+
+// Close drops all queued fetches and makes the scheduler drop new ones until
+// Open is called. The functions of the dropped fetches are called with a
+// canceled context. Fetches that are already running are not interrupted.
+func (s *Scheduler) Close() {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+
+	s.closed = true
+
+	var dropped []task
+	for p := range s.queues {
+		dropped = append(dropped, s.queues[p]...)
+		s.queues[p] = nil
+	}
+
+	s.mutex.Unlock()
+
+	for _, t := range dropped {
+		go t.fn(canceled(t.ctx))
+	}
+}
+
+// Open undoes Close, so that new fetches are scheduled again, e.g. once the
+// session is opened again. A new scheduler is already open.
+func (s *Scheduler) Open() {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.closed = false
+}
@@ -0,0 +1,93 @@
+package prefetch
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestSchedulerPriority(t *testing.T) {
+	s := NewScheduler(1)
+
+	block := make(chan struct{})
+	started := make(chan struct{})
+	s.Go(context.Background(), Background, func(context.Context) {
+		close(started)
+		<-block
+	})
+	<-started
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+
+	schedule := func(ctx context.Context, p Priority, name string) {
+		wg.Add(1)
+		s.Go(ctx, p, func(context.Context) {
+			defer wg.Done()
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+		})
+	}
+
+	schedule(context.Background(), Background, "background")
+	schedule(context.Background(), Adjacent, "adjacent")
+	s.Go(canceled, Visible, func(ctx context.Context) {
+		if ctx.Err() == nil {
+			t.Error("canceled fetch was run with a live context")
+		}
+	})
+	schedule(context.Background(), Visible, "visible")
+
+	if stats := s.Stats(); stats.Running != 1 || stats.Queued != [numPriorities]int{1, 1, 2} {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	close(block)
+	wg.Wait()
+
+	want := []string{"visible", "adjacent", "background"}
+	for i := range want {
+		if i >= len(order) || order[i] != want[i] {
+			t.Fatalf("got order %v, want %v", order, want)
+		}
+	}
+}
+
+func TestSchedulerClose(t *testing.T) {
+	s := NewScheduler(1)
+
+	block := make(chan struct{})
+	started := make(chan struct{})
+	s.Go(context.Background(), Visible, func(context.Context) {
+		close(started)
+		<-block
+	})
+	<-started
+
+	dropped := make(chan error, 2)
+	s.Go(context.Background(), Visible, func(ctx context.Context) { dropped <- ctx.Err() })
+
+	s.Close()
+	s.Go(context.Background(), Visible, func(ctx context.Context) { dropped <- ctx.Err() })
+
+	for i := 0; i < 2; i++ {
+		if err := <-dropped; err == nil {
+			t.Error("dropped fetch was called with a live context")
+		}
+	}
+
+	close(block)
+
+	s.Open()
+
+	ran := make(chan error)
+	s.Go(context.Background(), Visible, func(ctx context.Context) { ran <- ctx.Err() })
+	if err := <-ran; err != nil {
+		t.Error("fetch after reopening was canceled:", err)
+	}
+}
@@ -0,0 +1,220 @@
+package ningen
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/ningen/v3/readyextra"
+)
+
+// SubscriptionRole is a role that members get by buying a role subscription
+// in the guild.
+type SubscriptionRole struct {
+	discord.Role
+	// ListingID is the ID of the role subscription listing that grants the
+	// role.
+	ListingID discord.Snowflake
+	// Purchasable is true if the subscription can currently be bought.
+	Purchasable bool
+}
+
+// ChannelLock describes a channel that the user can only see by buying a role
+// subscription.
+type ChannelLock struct {
+	Channel discord.Channel
+	// Roles are the subscription roles that would let the user see the
+	// channel, sorted by position, highest first.
+	Roles []SubscriptionRole
+}
+
+// Purchasable returns true if any of the subscriptions that unlock the
+// channel can be bought right now.
+func (l *ChannelLock) Purchasable() bool {
+	for _, role := range l.Roles {
+		if role.Purchasable {
+			return true
+		}
+	}
+	return false
+}
+
+// SubscriptionRoles returns the roles of the guild that are granted by role
+// subscriptions.
+//
+// arikawa doesn't decode the subscription tags of roles, so only the roles
+// sent in the Ready event are known; roles created afterwards are only known
+// after reconnecting.
+func (s *State) SubscriptionRoles(guildID discord.GuildID) []SubscriptionRole {
+	tags := s.subscriptions.guildTags(guildID)
+	if len(tags) == 0 {
+		return nil
+	}
+
+	roles, err := s.Cabinet.Roles(guildID)
+	if err != nil {
+		return nil
+	}
+
+	var subRoles []SubscriptionRole
+	for _, role := range roles {
+		tag, ok := tags[role.ID]
+		if !ok {
+			continue
+		}
+
+		subRoles = append(subRoles, SubscriptionRole{
+			Role:        role,
+			ListingID:   tag.ListingID,
+			Purchasable: tag.Purchasable,
+		})
+	}
+
+	sort.SliceStable(subRoles, func(i, j int) bool {
+		return subRoles[i].Position > subRoles[j].Position
+	})
+
+	return subRoles
+}
+
+// ChannelLock returns the subscription roles that would let the user see the
+// channel, or nil if the user can already see it or no subscription unlocks
+// it. Clients can use it to show a locked channel instead of a channel that
+// fails to load.
+func (s *State) ChannelLock(chID discord.ChannelID) *ChannelLock {
+	ch, err := s.Cabinet.Channel(chID)
+	if err != nil || !ch.GuildID.IsValid() {
+		return nil
+	}
+
+	return s.channelLock(ch, s.guildPermissions(ch.GuildID))
+}
+
+// LockedChannels returns the channels of the guild that Channels hides because
+// the user can only see them by buying a role subscription, in the same order
+// as the cabinet.
+func (s *State) LockedChannels(guildID discord.GuildID) []ChannelLock {
+	perms := s.guildPermissions(guildID)
+	if perms == nil || len(s.subscriptions.guildTags(guildID)) == 0 {
+		return nil
+	}
+
+	chs, err := s.Cabinet.Channels(guildID)
+	if err != nil {
+		return nil
+	}
+
+	var locks []ChannelLock
+	for i := range chs {
+		if chs[i].Type == discord.GuildCategory {
+			continue
+		}
+
+		if lock := s.channelLock(&chs[i], perms); lock != nil {
+			locks = append(locks, *lock)
+		}
+	}
+
+	return locks
+}
+
+func (s *State) channelLock(ch *discord.Channel, perms *guildPermissions) *ChannelLock {
+	if perms == nil || perms.guild.ID != ch.GuildID {
+		return nil
+	}
+
+	if s.channelHasPermissions(ch, perms, discord.PermissionViewChannel) {
+		return nil
+	}
+
+	var lock *ChannelLock
+
+	for _, role := range s.SubscriptionRoles(ch.GuildID) {
+		// Pretend that the user has the role and see if that's enough.
+		member := *perms.member
+		member.RoleIDs = append(append([]discord.RoleID(nil), member.RoleIDs...), role.ID)
+
+		p := discord.CalcOverrides(*perms.guild, *ch, member, perms.roles)
+		if !p.Has(discord.PermissionViewChannel) {
+			continue
+		}
+
+		if lock == nil {
+			lock = &ChannelLock{Channel: *ch}
+		}
+		lock.Roles = append(lock.Roles, role)
+	}
+
+	return lock
+}
+
+// roleSubscriptionTag is the subscription part of a role's tags.
+type roleSubscriptionTag struct {
+	ListingID   discord.Snowflake
+	Purchasable bool
+}
+
+// roleSubscriptions keeps the subscription tags of roles, which arikawa
+// doesn't decode.
+type roleSubscriptions struct {
+	extras *readyextra.Cache
+	mutex  sync.Mutex
+	guilds map[discord.GuildID]map[discord.RoleID]roleSubscriptionTag
+}
+
+func newRoleSubscriptions(extras *readyextra.Cache) *roleSubscriptions {
+	return &roleSubscriptions{
+		extras: extras,
+		guilds: make(map[discord.GuildID]map[discord.RoleID]roleSubscriptionTag),
+	}
+}
+
+func (r *roleSubscriptions) handle(ev gateway.Event) {
+	switch ev := ev.(type) {
+	case *gateway.ReadyEvent:
+		guilds := make(map[discord.GuildID]map[discord.RoleID]roleSubscriptionTag)
+		for _, g := range r.extras.Of(ev).Guilds {
+			for _, role := range g.Roles {
+				if !role.Tags.ListingID.IsValid() {
+					continue
+				}
+
+				if guilds[g.ID] == nil {
+					guilds[g.ID] = make(map[discord.RoleID]roleSubscriptionTag)
+				}
+
+				guilds[g.ID][role.ID] = roleSubscriptionTag{
+					ListingID:   role.Tags.ListingID,
+					Purchasable: role.Tags.AvailableForPurchase != nil,
+				}
+			}
+		}
+
+		r.mutex.Lock()
+		r.guilds = guilds
+		r.mutex.Unlock()
+
+	case *gateway.GuildRoleDeleteEvent:
+		r.mutex.Lock()
+		delete(r.guilds[ev.GuildID], ev.RoleID)
+		r.mutex.Unlock()
+
+	case *gateway.GuildDeleteEvent:
+		r.mutex.Lock()
+		delete(r.guilds, ev.ID)
+		r.mutex.Unlock()
+	}
+}
+
+// guildTags returns a copy of the subscription tags of the guild's roles.
+func (r *roleSubscriptions) guildTags(guildID discord.GuildID) map[discord.RoleID]roleSubscriptionTag {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	tags := make(map[discord.RoleID]roleSubscriptionTag, len(r.guilds[guildID]))
+	for id, tag := range r.guilds[guildID] {
+		tags[id] = tag
+	}
+	return tags
+}
@@ -0,0 +1,101 @@
+package ningen_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestChannelLock(t *testing.T) {
+	const (
+		guildID   = 200000000000000001
+		roleID    = 200000000000000050
+		lockedID  = 300000000000000050
+		hiddenID  = 300000000000000005
+		listingID = 900000000000000001
+	)
+
+	fixture, err := ningentest.LoadFixture(ningentest.Guilds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ready map[string]interface{}
+	if err := json.Unmarshal(fixture.Ready, &ready); err != nil {
+		t.Fatal(err)
+	}
+
+	guild := ready["guilds"].([]interface{})[0].(map[string]interface{})
+	guild["roles"] = append(guild["roles"].([]interface{}), map[string]interface{}{
+		"id":          "200000000000000050",
+		"name":        "Supporter",
+		"position":    1,
+		"permissions": "0",
+		"tags": map[string]interface{}{
+			"subscription_listing_id": "900000000000000001",
+			"available_for_purchase":  nil,
+		},
+	})
+	guild["channels"] = append(guild["channels"].([]interface{}), map[string]interface{}{
+		"id":        "300000000000000050",
+		"type":      0,
+		"name":      "supporters",
+		"parent_id": "300000000000000001",
+		"permission_overwrites": []interface{}{
+			map[string]interface{}{"id": "200000000000000001", "type": 0, "allow": "0", "deny": "1024"},
+			map[string]interface{}{"id": "200000000000000050", "type": 0, "allow": "1024", "deny": "0"},
+		},
+	})
+
+	fixture.Ready, err = json.Marshal(ready)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := fixture.NewState()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roles := n.SubscriptionRoles(guildID)
+	if len(roles) != 1 || roles[0].ID != roleID {
+		t.Fatalf("unexpected subscription roles: %+v", roles)
+	}
+	if roles[0].ListingID != listingID || !roles[0].Purchasable {
+		t.Fatalf("unexpected subscription role tags: %+v", roles[0])
+	}
+
+	lock := n.ChannelLock(lockedID)
+	if lock == nil {
+		t.Fatal("subscription channel is not locked")
+	}
+	if len(lock.Roles) != 1 || lock.Roles[0].ID != roleID || !lock.Purchasable() {
+		t.Fatalf("unexpected lock: %+v", lock)
+	}
+
+	if lock := n.ChannelLock(hiddenID); lock != nil {
+		t.Fatalf("hidden channel without subscriptions is locked: %+v", lock)
+	}
+	if lock := n.ChannelLock(300000000000000002); lock != nil {
+		t.Fatalf("visible channel is locked: %+v", lock)
+	}
+
+	locks := n.LockedChannels(guildID)
+	if len(locks) != 1 || locks[0].Channel.ID != lockedID {
+		t.Fatalf("unexpected locked channels: %+v", locks)
+	}
+
+	ningentest.Dispatch(n, &gateway.GuildRoleDeleteEvent{
+		GuildID: guildID,
+		RoleID:  roleID,
+	})
+
+	if lock := n.ChannelLock(lockedID); lock != nil {
+		t.Fatalf("channel is still locked after the role was deleted: %+v", lock)
+	}
+	if roles := n.SubscriptionRoles(guildID); len(roles) != 0 {
+		t.Fatalf("subscription roles not removed: %+v", roles)
+	}
+}
@@ -0,0 +1,162 @@
+package ningen
+
+import (
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/ningen/v3/handlerrepo"
+)
+
+// DefaultPresenceCoalesceWindow is the default window of CoalescePresences.
+const DefaultPresenceCoalesceWindow = 500 * time.Millisecond
+
+// PresencesChangedEvent is a batch of presence updates coalesced by
+// CoalescePresences. Each user appears at most once per guild with their
+// latest presence, in the order that their first update arrived.
+type PresencesChangedEvent struct {
+	Presences []discord.Presence
+}
+
+// PresenceCoalesceOpts are the options of CoalescePresences.
+type PresenceCoalesceOpts struct {
+	// Window is the duration that presence updates are collected for before
+	// they're emitted. If it is 0, DefaultPresenceCoalesceWindow is used.
+	Window time.Duration
+	// MaxBatch emits the batch early once it has this many presences. If it
+	// is 0, batches are only emitted after Window.
+	MaxBatch int
+	// GuildID, if valid, only coalesces the presence updates of that guild.
+	GuildID discord.GuildID
+}
+
+// CoalescePresences calls fn with batches of the PresenceUpdateEvents instead
+// of with every single one, which large guilds send in floods. Each call
+// creates its own subscriber with its own options; the individual events are
+// still dispatched as usual. fn is called from a background goroutine, one
+// batch at a time. The returned function unsubscribes and drops the pending
+// batch.
+func (s *State) CoalescePresences(opts PresenceCoalesceOpts, fn func(*PresencesChangedEvent)) (cancel func()) {
+	if opts.Window == 0 {
+		opts.Window = DefaultPresenceCoalesceWindow
+	}
+
+	c := &presenceCoalescer{
+		opts:     opts,
+		dispatch: fn,
+		indices:  make(map[presenceKey]int),
+	}
+
+	rm := s.AddSyncHandler(c.add)
+
+	return func() {
+		rm()
+		c.stop()
+	}
+}
+
+type presenceKey struct {
+	guildID discord.GuildID
+	userID  discord.UserID
+}
+
+type presenceCoalescer struct {
+	opts     PresenceCoalesceOpts
+	dispatch func(*PresencesChangedEvent)
+	// ordered keeps the batches in order, since they may be taken by either
+	// the timer or add.
+	ordered handlerrepo.Ordered
+
+	mutex     sync.Mutex
+	presences []discord.Presence
+	indices   map[presenceKey]int
+	timer     *time.Timer
+	batch     uint64 // incremented on every take
+	stopped   bool
+}
+
+func (c *presenceCoalescer) add(ev *gateway.PresenceUpdateEvent) {
+	if c.opts.GuildID.IsValid() && ev.GuildID != c.opts.GuildID {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.stopped {
+		return
+	}
+
+	key := presenceKey{ev.GuildID, ev.User.ID}
+	if i, ok := c.indices[key]; ok {
+		c.presences[i] = ev.Presence
+		return
+	}
+
+	c.indices[key] = len(c.presences)
+	c.presences = append(c.presences, ev.Presence)
+
+	if c.opts.MaxBatch > 0 && len(c.presences) >= c.opts.MaxBatch {
+		c.send(c.take())
+		return
+	}
+
+	if c.timer == nil {
+		batch := c.batch
+		c.timer = time.AfterFunc(c.opts.Window, func() { c.flush(batch) })
+	}
+}
+
+// take takes the pending batch. c.mutex must be held.
+func (c *presenceCoalescer) take() []discord.Presence {
+	presences := c.presences
+	c.presences = nil
+	c.batch++
+
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+
+	for key := range c.indices {
+		delete(c.indices, key)
+	}
+
+	return presences
+}
+
+// flush flushes the batch if it hasn't been taken already.
+func (c *presenceCoalescer) flush(batch uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.stopped && c.batch == batch {
+		c.send(c.take())
+	}
+}
+
+// send queues the dispatch of the presences. c.mutex must be held.
+func (c *presenceCoalescer) send(presences []discord.Presence) {
+	if len(presences) == 0 {
+		return
+	}
+
+	c.ordered.Go(0, func() {
+		c.mutex.Lock()
+		stopped := c.stopped
+		c.mutex.Unlock()
+
+		if !stopped {
+			c.dispatch(&PresencesChangedEvent{Presences: presences})
+		}
+	})
+}
+
+func (c *presenceCoalescer) stop() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.stopped = true
+	c.take()
+}
@@ -0,0 +1,78 @@
+package ningen_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/ningen/v3"
+	"github.com/diamondburned/ningen/v3/ningentest"
+	"github.com/diamondburned/ningen/v3/nstore"
+)
+
+func TestCoalescePresences(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	batches := make(chan *ningen.PresencesChangedEvent, 4)
+	cancel := n.CoalescePresences(ningen.PresenceCoalesceOpts{
+		Window: 10 * time.Millisecond,
+	}, func(ev *ningen.PresencesChangedEvent) { batches <- ev })
+	defer cancel()
+
+	update := func(userID discord.UserID, status discord.Status) {
+		ningentest.Dispatch(n, &gateway.PresenceUpdateEvent{Presence: discord.Presence{
+			User:    discord.User{ID: userID},
+			GuildID: 200000000000000001,
+			Status:  status,
+		}})
+	}
+
+	update(100000000000000002, discord.OnlineStatus)
+	update(100000000000000003, discord.OnlineStatus)
+	update(100000000000000002, discord.IdleStatus)
+
+	var batch *ningen.PresencesChangedEvent
+	select {
+	case batch = <-batches:
+	case <-time.After(time.Second):
+		t.Fatal("no batch emitted")
+	}
+
+	if len(batch.Presences) != 2 {
+		t.Fatalf("got %d presences, want 2", len(batch.Presences))
+	}
+	if p := batch.Presences[0]; p.User.ID != 100000000000000002 || p.Status != discord.IdleStatus {
+		t.Errorf("first presence is %v %q, want the latest idle presence", p.User.ID, p.Status)
+	}
+
+	select {
+	case batch := <-batches:
+		t.Errorf("unexpected second batch %+v", batch)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestPresenceDiffEvent(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.GroupDMs)
+
+	var diffs []*nstore.PresenceDiffEvent
+	n.AddSyncHandler(func(ev *nstore.PresenceDiffEvent) { diffs = append(diffs, ev) })
+
+	// Bob only has the offline presence from Ready.
+	ningentest.Dispatch(n, &gateway.PresenceUpdateEvent{Presence: discord.Presence{
+		User:       discord.User{ID: 100000000000000003},
+		Status:     discord.OnlineStatus,
+		Activities: []discord.Activity{{Type: discord.GameActivity, Name: "Go"}},
+	}})
+
+	if len(diffs) != 1 {
+		t.Fatalf("got %d diffs, want 1", len(diffs))
+	}
+	if diffs[0].OldStatus != discord.OfflineStatus || diffs[0].NewStatus != discord.OnlineStatus {
+		t.Errorf("got status change %q -> %q", diffs[0].OldStatus, diffs[0].NewStatus)
+	}
+	if started := diffs[0].StartedActivities(); len(started) != 1 || started[0].Name != "Go" {
+		t.Errorf("got started activities %+v", started)
+	}
+}
@@ -0,0 +1,81 @@
+package ningen
+
+import (
+	"sync"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/pkg/errors"
+)
+
+// PrimeMessageLimit is the number of recent messages that PrimeGuild fetches.
+var PrimeMessageLimit uint = 50
+
+// PrimeGuild loads the data needed to show the given guild right away. It is
+// meant to be called right after Ready for the guild and channel that the user
+// last had open, before any background work, to improve the perceived startup
+// time.
+//
+// The guild is subscribed and its first member list chunk is requested, while
+// the recent messages of the channel and the active threads of the guild are
+// fetched concurrently. If chID is 0, the first visible text channel is used.
+func (s *State) PrimeGuild(guildID discord.GuildID, chID discord.ChannelID) error {
+	if !chID.IsValid() {
+		chs, err := s.Channels(guildID, []discord.ChannelType{
+			discord.GuildText,
+			discord.GuildAnnouncement,
+		})
+		if err != nil {
+			return errors.Wrap(err, "cannot get channels")
+		}
+		if len(chs) > 0 {
+			chID = chs[0].ID
+		}
+	}
+
+	if chID.IsValid() {
+		s.MemberState.RequestMemberList(guildID, chID, 0)
+	} else {
+		s.MemberState.Subscribe(guildID)
+	}
+
+	var wg sync.WaitGroup
+	var msgErr, threadErr error
+
+	if chID.IsValid() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := s.Messages(chID, PrimeMessageLimit)
+			if err != nil {
+				msgErr = errors.Wrap(err, "cannot fetch recent messages")
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		active, err := s.ActiveThreads(guildID)
+		if err != nil {
+			threadErr = errors.Wrap(err, "cannot fetch active threads")
+			return
+		}
+
+		for i := range active.Threads {
+			thread := &active.Threads[i]
+			if !thread.GuildID.IsValid() {
+				thread.GuildID = guildID
+			}
+			s.Cabinet.ChannelSet(thread, true)
+		}
+	}()
+
+	wg.Wait()
+
+	if msgErr != nil {
+		return msgErr
+	}
+	return threadErr
+}
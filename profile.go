@@ -0,0 +1,93 @@
+package ningen
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/pkg/errors"
+)
+
+// MutualGuild is a guild that the current user shares with another user.
+type MutualGuild struct {
+	discord.Guild
+	// Nick is the other user's nickname in the guild, if they have one.
+	Nick string
+}
+
+// MutualGuilds returns the guilds that the current user shares with the given
+// user, sorted by name. Only the members in the member store are known, so if
+// fetch is true, the user's profile is also fetched from ProfileState to find
+// the rest. Profiles can't be fetched by bots, so fetch is ignored for them;
+// see Features.
+//
+// If fetching the profile fails, the guilds found in the member store are
+// returned along with the error.
+func (s *State) MutualGuilds(userID discord.UserID, fetch bool) ([]MutualGuild, error) {
+	guilds, err := s.Cabinet.Guilds()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get guilds")
+	}
+
+	mutuals := make([]MutualGuild, 0, 4)
+	known := make(map[discord.GuildID]bool, len(guilds))
+
+	for _, guild := range guilds {
+		m, err := s.Cabinet.Member(guild.ID, userID)
+		if err != nil {
+			continue
+		}
+
+		mutuals = append(mutuals, MutualGuild{Guild: guild, Nick: m.Nick})
+		known[guild.ID] = true
+	}
+
+	var fetchErr error
+
+	if fetch && s.Features().Profiles {
+		profile, err := s.ProfileState.Fetch(s.Context(), userID)
+		if err != nil {
+			fetchErr = err
+		} else {
+			for _, mutual := range profile.MutualGuilds {
+				if known[mutual.ID] {
+					continue
+				}
+
+				guild, err := s.Cabinet.Guild(mutual.ID)
+				if err != nil {
+					continue
+				}
+
+				mutuals = append(mutuals, MutualGuild{Guild: *guild, Nick: mutual.Nick})
+				known[mutual.ID] = true
+			}
+		}
+	}
+
+	sort.Slice(mutuals, func(i, j int) bool {
+		ni, nj := strings.ToLower(mutuals[i].Name), strings.ToLower(mutuals[j].Name)
+		if ni != nj {
+			return ni < nj
+		}
+		return mutuals[i].ID < mutuals[j].ID
+	})
+
+	return mutuals, fetchErr
+}
+
+// MutualFriends returns the friends that the current user shares with the
+// given user, fetched from the user's profile using ProfileState. An error is
+// returned if profiles aren't available; see Features.
+func (s *State) MutualFriends(userID discord.UserID) ([]discord.User, error) {
+	if !s.Features().Profiles {
+		return nil, errors.New("profiles are not available to this session")
+	}
+
+	profile, err := s.ProfileState.Fetch(s.Context(), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]discord.User(nil), profile.MutualFriends...), nil
+}
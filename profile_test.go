@@ -0,0 +1,242 @@
+package ningen_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/httputil/httpdriver"
+	"github.com/diamondburned/ningen/v3/ningentest"
+	"github.com/diamondburned/ningen/v3/prefetch"
+	"github.com/diamondburned/ningen/v3/states/profile"
+)
+
+func TestMutualGuilds(t *testing.T) {
+	const aliceID = 100000000000000002
+
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	var fetches int32
+	n.Client.Client.Retries = 1
+	n.Client.Client.Client = httpdriver.WrapClient(http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			atomic.AddInt32(&fetches, 1)
+			if !strings.HasSuffix(r.URL.Path, "/users/100000000000000002/profile") {
+				t.Errorf("unexpected request to %s", r.URL.Path)
+			}
+			body := `{
+				"mutual_guilds": [
+					{"id": "200000000000000001", "nick": null},
+					{"id": "200000000000000003", "nick": "ali"},
+					{"id": "200000000000000099"}
+				],
+				"mutual_friends": [{"id": "100000000000000003", "username": "bob"}]
+			}`
+			return &http.Response{
+				StatusCode: 200,
+				Header:     http.Header{"Content-Type": {"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(body)),
+			}, nil
+		}),
+	})
+
+	ningentest.Dispatch(n, &gateway.GuildMemberAddEvent{
+		GuildID: 200000000000000002,
+		Member:  discord.Member{User: discord.User{ID: aliceID, Username: "alice"}, Nick: "al"},
+	})
+
+	mutuals, err := n.MutualGuilds(aliceID, false)
+	if err != nil {
+		t.Fatal("cannot get mutual guilds:", err)
+	}
+	if len(mutuals) != 1 || mutuals[0].ID != 200000000000000002 || mutuals[0].Nick != "al" {
+		t.Fatalf("got mutual guilds %+v from the member store", mutuals)
+	}
+
+	mutuals, err = n.MutualGuilds(aliceID, true)
+	if err != nil {
+		t.Fatal("cannot fetch mutual guilds:", err)
+	}
+
+	// Guilds that aren't in the cabinet are skipped.
+	want := []discord.GuildID{200000000000000001, 200000000000000002, 200000000000000003}
+	if len(mutuals) != len(want) {
+		t.Fatalf("got %d mutual guilds, want %d", len(mutuals), len(want))
+	}
+	for i, id := range want {
+		if mutuals[i].ID != id {
+			t.Errorf("mutual guild %d is %d, want %d", i, mutuals[i].ID, id)
+		}
+	}
+	if mutuals[2].Nick != "ali" {
+		t.Errorf("got nick %q, want ali", mutuals[2].Nick)
+	}
+
+	friends, err := n.MutualFriends(aliceID)
+	if err != nil {
+		t.Fatal("cannot get mutual friends:", err)
+	}
+	if len(friends) != 1 || friends[0].Username != "bob" {
+		t.Errorf("got mutual friends %+v", friends)
+	}
+
+	if got := atomic.LoadInt32(&fetches); got != 1 {
+		t.Errorf("fetched %d times, want once", got)
+	}
+}
+
+func TestProfileState(t *testing.T) {
+	const aliceID = 100000000000000002
+
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	var fetches int32
+	release := make(chan struct{})
+
+	n.Client.Client.Retries = 1
+	n.Client.Client.Client = httpdriver.WrapClient(http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			atomic.AddInt32(&fetches, 1)
+			<-release
+			body := `{
+				"user": {"id": "100000000000000002", "username": "alice"},
+				"user_profile": {"bio": "hi", "pronouns": "they/them"},
+				"connected_accounts": [{"type": "github", "id": "1", "name": "alice", "verified": true}],
+				"premium_since": null,
+				"badges": [{"id": "early_supporter", "description": "Early Supporter", "icon": "abc"}]
+			}`
+			return &http.Response{
+				StatusCode: 200,
+				Header:     http.Header{"Content-Type": {"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(body)),
+			}, nil
+		}),
+	})
+
+	updates := make(chan *profile.UpdateEvent, 1)
+	n.AddSyncHandler(func(ev *profile.UpdateEvent) { updates <- ev })
+
+	if p := n.ProfileState.Profile(context.Background(), aliceID); p != nil {
+		t.Fatalf("got profile %+v before fetching", p)
+	}
+
+	// The background fetch and these fetches share a single request.
+	results := make(chan *profile.Profile, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			p, err := n.ProfileState.Fetch(context.Background(), aliceID)
+			if err != nil {
+				t.Error("cannot fetch profile:", err)
+			}
+			results <- p
+		}()
+	}
+
+	close(release)
+
+	p := (<-updates).Profile
+	for i := 0; i < 2; i++ {
+		if got := <-results; got != p {
+			t.Errorf("got profile %p, want shared %p", got, p)
+		}
+	}
+
+	if p.User.Username != "alice" || p.Bio != "hi" || p.Pronouns != "they/them" {
+		t.Errorf("got profile %+v", p)
+	}
+	if len(p.ConnectedAccounts) != 1 || p.ConnectedAccounts[0].Type != "github" {
+		t.Errorf("got connected accounts %+v", p.ConnectedAccounts)
+	}
+	if len(p.Badges) != 1 || p.Badges[0].IconURL() != "https://cdn.discordapp.com/badge-icons/abc.png" {
+		t.Errorf("got badges %+v", p.Badges)
+	}
+
+	if got := n.ProfileState.Profile(context.Background(), aliceID); got != p {
+		t.Errorf("got cached profile %p, want %p", got, p)
+	}
+	if got := atomic.LoadInt32(&fetches); got != 1 {
+		t.Errorf("fetched %d times, want once", got)
+	}
+
+	ningentest.Dispatch(n, &gateway.GuildMemberRemoveEvent{
+		GuildID: 200000000000000001,
+		User:    discord.User{ID: aliceID},
+	})
+
+	if _, err := n.ProfileState.Fetch(context.Background(), aliceID); err != nil {
+		t.Fatal("cannot fetch profile again:", err)
+	}
+	if got := atomic.LoadInt32(&fetches); got != 2 {
+		t.Errorf("fetched %d times after the member left, want twice", got)
+	}
+}
+
+func TestProfileError(t *testing.T) {
+	const aliceID = 100000000000000002
+
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	var fetches int32
+	n.Client.Client.Retries = 1
+	n.Client.Client.Client = httpdriver.WrapClient(http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			atomic.AddInt32(&fetches, 1)
+			return &http.Response{
+				StatusCode: 400,
+				Header:     http.Header{"Content-Type": {"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(`{"code": 0, "message": "oops"}`)),
+			}, nil
+		}),
+	})
+
+	for i := 0; i < 2; i++ {
+		if _, err := n.ProfileState.Fetch(context.Background(), aliceID); err == nil {
+			t.Fatal("fetch did not fail")
+		}
+	}
+	if got := atomic.LoadInt32(&fetches); got != 1 {
+		t.Fatalf("fetched %d times, want the error to be cached", got)
+	}
+
+	// Errors are only cached briefly.
+	n.ProfileState.ErrorTTL = time.Nanosecond
+	if _, err := n.ProfileState.Fetch(context.Background(), aliceID); err == nil {
+		t.Fatal("fetch did not fail")
+	}
+	if got := atomic.LoadInt32(&fetches); got != 2 {
+		t.Fatalf("fetched %d times after the error expired, want twice", got)
+	}
+}
+
+func TestProfileQueued(t *testing.T) {
+	const aliceID = 100000000000000002
+
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	s := prefetch.NewScheduler(1)
+	n.ProfileState.Scheduler = s
+
+	block := make(chan struct{})
+	defer close(block)
+	started := make(chan struct{})
+	s.Go(context.Background(), prefetch.Visible, func(context.Context) {
+		close(started)
+		<-block
+	})
+	<-started
+
+	// Profiles asked for while the fetch is still queued don't queue another.
+	for i := 0; i < 3; i++ {
+		n.ProfileState.Profile(context.Background(), aliceID)
+	}
+
+	if queued := s.Stats().Queued[prefetch.Visible]; queued != 1 {
+		t.Errorf("%d profile fetches queued, want 1", queued)
+	}
+}
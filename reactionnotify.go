@@ -0,0 +1,138 @@
+package ningen
+
+import (
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+)
+
+// ReactionNotifications is the user's setting for which reactions to their
+// messages notify them.
+type ReactionNotifications uint8
+
+const (
+	// AllReactionNotifications notifies of reactions everywhere.
+	AllReactionNotifications ReactionNotifications = iota
+	// DMReactionNotifications only notifies of reactions in private
+	// channels.
+	DMReactionNotifications
+	// NoReactionNotifications never notifies of reactions.
+	NoReactionNotifications
+)
+
+// String returns the setting in words.
+func (n ReactionNotifications) String() string {
+	switch n {
+	case AllReactionNotifications:
+		return "all"
+	case DMReactionNotifications:
+		return "direct messages only"
+	case NoReactionNotifications:
+		return "none"
+	default:
+		return "unknown"
+	}
+}
+
+// ReactionNotificationEvent is dispatched when someone reacts to one of the
+// user's messages and the user's ReactionNotifications allow it. Reactions in
+// muted channels and guilds and reactions from blocked users are ignored.
+type ReactionNotificationEvent struct {
+	Reaction *gateway.MessageReactionAddEvent
+	// Message is the message that was reacted to.
+	Message *discord.Message
+	// Silenced is true if the user is in Do Not Disturb, in which case the
+	// client shouldn't show a visible notification.
+	Silenced bool
+	// GuildName is the name of the message's guild. It is empty for private
+	// channels.
+	GuildName string
+	// ChannelName is the name of the message's channel. For direct messages,
+	// it is the display name of the recipient.
+	ChannelName string
+}
+
+var _ gateway.Event = (*ReactionNotificationEvent)(nil)
+
+func (ev ReactionNotificationEvent) Op() ws.OpCode { return -1 }
+func (ev ReactionNotificationEvent) EventType() ws.EventType {
+	return "__ningen.ReactionNotificationEvent"
+}
+
+// ReactionNotifications returns the user's reaction notification setting,
+// which is read from the user settings in the Ready event.
+func (s *State) ReactionNotifications() ReactionNotifications {
+	s.notifier.mutex.RLock()
+	defer s.notifier.mutex.RUnlock()
+
+	return s.notifier.reactions
+}
+
+// SetReactionNotifications overrides the reaction notification setting, such
+// as after the user changes it. Nothing is sent to Discord.
+func (s *State) SetReactionNotifications(n ReactionNotifications) {
+	s.notifier.mutex.Lock()
+	defer s.notifier.mutex.Unlock()
+
+	s.notifier.reactions = n
+}
+
+// readReactionNotifications reads the reaction notification setting from the
+// Ready event, which arikawa doesn't parse.
+func (s *State) readReactionNotifications(ev *gateway.ReadyEvent) {
+	var n ReactionNotifications
+	if settings := s.ReadyExtras.Of(ev).UserSettings; settings != nil {
+		n = ReactionNotifications(settings.ReactionNotifications)
+	}
+
+	s.SetReactionNotifications(n)
+}
+
+// notifyReaction dispatches a ReactionNotificationEvent for the reaction if it
+// should notify the user. The message must be in the cabinet, since the
+// reaction event doesn't say who wrote it.
+func (s *State) notifyReaction(ev *gateway.MessageReactionAddEvent) {
+	me, _ := s.Cabinet.Me()
+	if me == nil || ev.UserID == me.ID || s.UserIsBlocked(ev.UserID) {
+		return
+	}
+
+	msg, err := s.Cabinet.Message(ev.ChannelID, ev.MessageID)
+	if err != nil || msg.Author.ID != me.ID {
+		return
+	}
+
+	switch s.ReactionNotifications() {
+	case NoReactionNotifications:
+		return
+	case DMReactionNotifications:
+		if ev.GuildID.IsValid() {
+			return
+		}
+	}
+
+	if s.MutedState.ChannelOverrides(ev.ChannelID).Muted {
+		return
+	}
+	if ev.GuildID.IsValid() && s.MutedState.GuildSettings(ev.GuildID).Muted {
+		return
+	}
+
+	notification := &ReactionNotificationEvent{
+		Reaction: ev,
+		Message:  msg,
+		Silenced: s.Status() == discord.DoNotDisturbStatus,
+	}
+
+	if ev.GuildID.IsValid() {
+		if g, err := s.Cabinet.Guild(ev.GuildID); err == nil {
+			notification.GuildName = g.Name
+		}
+	}
+
+	if ch, err := s.Cabinet.Channel(ev.ChannelID); err == nil {
+		notification.ChannelName = channelName(ch)
+	}
+
+	s.dispatch(notification)
+}
@@ -0,0 +1,80 @@
+package ningen
+
+import (
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/ningen/v3/states/emoji"
+)
+
+// SuggestedReactions returns up to limit emojis to suggest in a quick-react
+// bar for messages in the given channel. The suggestions are, in order:
+//
+//   - the default reaction emoji of the forum if the channel is a forum post,
+//   - the emojis recently reacted with in the channel, newest message first,
+//   - the emojis frequently used by the current user.
+//
+// Duplicates and custom emojis that the user cannot use in the channel are
+// omitted.
+func (s *State) SuggestedReactions(chID discord.ChannelID, limit int) []discord.Emoji {
+	if limit <= 0 {
+		return nil
+	}
+
+	ch, _ := s.Cabinet.Channel(chID)
+	if ch == nil {
+		return nil
+	}
+
+	hasNitro := s.EmojiState.HasNitro()
+	suggestions := make([]discord.Emoji, 0, limit)
+
+	add := func(e discord.Emoji) bool {
+		if e.IsCustom() && !hasNitro {
+			// Without Nitro, custom emojis are only usable within their guild.
+			if !ch.GuildID.IsValid() {
+				return true
+			}
+			if _, err := s.Cabinet.Emoji(ch.GuildID, e.ID); err != nil {
+				return true
+			}
+		}
+
+		for _, suggested := range suggestions {
+			if emoji.SameEmoji(suggested, e) {
+				return true
+			}
+		}
+
+		suggestions = append(suggestions, e)
+		return len(suggestions) < limit
+	}
+
+	if ch.ParentID.IsValid() {
+		parent, _ := s.Cabinet.Channel(ch.ParentID)
+		if parent != nil && parent.DefaultReactionEmoji != nil {
+			e := discord.Emoji{ID: parent.DefaultReactionEmoji.EmojiID}
+			if name := parent.DefaultReactionEmoji.EmojiName; name != nil {
+				e.Name = *name
+			}
+			if !add(e) {
+				return suggestions
+			}
+		}
+	}
+
+	msgs, _ := s.Cabinet.Messages(chID)
+	for _, msg := range msgs {
+		for _, reaction := range msg.Reactions {
+			if !add(reaction.Emoji) {
+				return suggestions
+			}
+		}
+	}
+
+	for _, e := range s.EmojiState.FrequentlyUsed(0) {
+		if !add(e) {
+			return suggestions
+		}
+	}
+
+	return suggestions
+}
@@ -0,0 +1,104 @@
+package ningen_test
+
+import (
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestSuggestedReactions(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Threads)
+
+	const postID = 300000000000000112
+
+	ningentest.Dispatch(n, &gateway.MessageCreateEvent{
+		Message: discord.Message{
+			ID:        900000000000002120,
+			ChannelID: postID,
+			GuildID:   200000000000000011,
+			Reactions: []discord.Reaction{
+				{Count: 2, Emoji: discord.Emoji{Name: "🎉"}},
+				{Count: 1, Emoji: discord.Emoji{Name: "👍"}},
+				// Custom emoji from another guild without Nitro.
+				{Count: 1, Emoji: discord.Emoji{ID: 1, Name: "foreign"}},
+			},
+		},
+	})
+
+	for _, name := range []string{"🔥", "🎉", "🔥"} {
+		ningentest.Dispatch(n, &gateway.MessageReactionAddEvent{
+			UserID:    100000000000000001,
+			ChannelID: 300000000000000101,
+			MessageID: 900000000000002010,
+			Emoji:     discord.Emoji{Name: name},
+		})
+	}
+
+	got := n.SuggestedReactions(postID, 3)
+	want := []string{"👍", "🎉", "🔥"}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d suggestions, want %d: %v", len(got), len(want), got)
+	}
+	for i, e := range got {
+		if e.Name != want[i] {
+			t.Errorf("suggestion %d: got %q, want %q", i, e.Name, want[i])
+		}
+	}
+
+	if got := n.SuggestedReactions(postID, 1); len(got) != 1 || got[0].Name != "👍" {
+		t.Errorf("limited suggestions: got %v, want only the default reaction", got)
+	}
+}
+
+func TestReactionState(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	const chID = 300000000000000002
+	const me, other = 100000000000000001, 100000000000000002
+
+	tada := discord.Emoji{Name: "🎉"}
+
+	ningentest.Dispatch(n, &gateway.MessageCreateEvent{
+		Message: discord.Message{
+			ID:        900000000000000060,
+			ChannelID: chID,
+			GuildID:   200000000000000001,
+			Reactions: []discord.Reaction{{Count: 2, Emoji: tada}},
+		},
+	})
+
+	react := func(msgID discord.MessageID, userID discord.UserID) {
+		ningentest.Dispatch(n, &gateway.MessageReactionAddEvent{
+			UserID:    userID,
+			ChannelID: chID,
+			MessageID: msgID,
+			Emoji:     tada,
+		})
+	}
+
+	react(900000000000000060, me)
+
+	reactions := n.ReactionState.Reactions(chID, 900000000000000060)
+	if len(reactions) != 1 || reactions[0].Count != 3 || !reactions[0].Me {
+		t.Fatalf("stored message: got %+v, want 3 reactions including mine", reactions)
+	}
+
+	// This message isn't in the message store.
+	react(900000000000000061, other)
+	react(900000000000000061, me)
+
+	ningentest.Dispatch(n, &gateway.MessageReactionRemoveEvent{
+		UserID:    me,
+		ChannelID: chID,
+		MessageID: 900000000000000061,
+		Emoji:     tada,
+	})
+
+	reactions = n.ReactionState.Reactions(chID, 900000000000000061)
+	if len(reactions) != 1 || reactions[0].Count != 1 || reactions[0].Me {
+		t.Fatalf("evicted message: got %+v, want 1 reaction not mine", reactions)
+	}
+}
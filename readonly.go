@@ -0,0 +1,109 @@
+package ningen
+
+import (
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// ReadOnlyReason is the reason that the user can't send messages in a channel
+// that they can see.
+type ReadOnlyReason uint8
+
+const (
+	// ChannelWritable means that the user can send messages.
+	ChannelWritable ReadOnlyReason = iota
+	// ReadOnlyNoPermission means that the user isn't allowed to send
+	// messages in an ordinary channel.
+	ReadOnlyNoPermission
+	// ReadOnlyAnnouncement means that the channel is an announcement channel
+	// that only some members can post in.
+	ReadOnlyAnnouncement
+	// ReadOnlyRules means that the channel is the guild's rules channel.
+	ReadOnlyRules
+	// ReadOnlyLockedThread means that the thread was locked by a moderator.
+	ReadOnlyLockedThread
+)
+
+// Placeholder returns the text that the official client shows in place of
+// the composer, or an empty string for ChannelWritable.
+func (r ReadOnlyReason) Placeholder() string {
+	switch r {
+	case ChannelWritable:
+		return ""
+	case ReadOnlyAnnouncement:
+		return "This is an announcement channel. Only certain members can post here."
+	case ReadOnlyRules:
+		return "This channel contains the server's rules. Only certain members can post here."
+	case ReadOnlyLockedThread:
+		return "This thread is locked. Only moderators can send messages."
+	default:
+		return "You do not have permission to send messages in this channel."
+	}
+}
+
+// ChannelReadOnly returns why the user can't send messages in the channel, or
+// ChannelWritable if they can. Private channels are always writable. Archived
+// threads that aren't locked are writable, since sending a message in them
+// unarchives them.
+func (s *State) ChannelReadOnly(chID discord.ChannelID) ReadOnlyReason {
+	ch, err := s.Cabinet.Channel(chID)
+	if err != nil || !ch.GuildID.IsValid() {
+		return ChannelWritable
+	}
+
+	me, err := s.Cabinet.Me()
+	if err != nil {
+		return ChannelWritable
+	}
+
+	perms, err := s.Permissions(chID, me.ID)
+	if err != nil {
+		// The member may not be cached or fetchable, e.g. right after
+		// joining, so fall back to what a member without roles can do.
+		var ok bool
+		if perms, ok = s.defaultPermissions(ch, me); !ok {
+			return ChannelWritable
+		}
+	}
+
+	switch ch.Type {
+	case discord.GuildPublicThread, discord.GuildPrivateThread, discord.GuildAnnouncementThread:
+		if ch.ThreadMetadata != nil && ch.ThreadMetadata.Locked && !perms.Has(discord.PermissionManageThreads) {
+			return ReadOnlyLockedThread
+		}
+		if !perms.Has(discord.PermissionSendMessagesInThreads) {
+			return ReadOnlyNoPermission
+		}
+		return ChannelWritable
+	}
+
+	if perms.Has(discord.PermissionSendMessages) {
+		return ChannelWritable
+	}
+
+	if ch.Type == discord.GuildAnnouncement {
+		return ReadOnlyAnnouncement
+	}
+
+	if g, err := s.Cabinet.Guild(ch.GuildID); err == nil && g.RulesChannelID == ch.ID {
+		return ReadOnlyRules
+	}
+
+	return ReadOnlyNoPermission
+}
+
+// defaultPermissions returns the permissions that the user has in the channel
+// as a member without any roles, computed from the cached guild and roles. It
+// returns false if they aren't cached.
+func (s *State) defaultPermissions(ch *discord.Channel, me *discord.User) (discord.Permissions, bool) {
+	g, err := s.Cabinet.Guild(ch.GuildID)
+	if err != nil {
+		return 0, false
+	}
+
+	roles, err := s.Cabinet.Roles(ch.GuildID)
+	if err != nil {
+		return 0, false
+	}
+
+	return discord.CalcOverrides(*g, *ch, discord.Member{User: *me}, roles), true
+}
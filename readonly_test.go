@@ -0,0 +1,107 @@
+package ningen_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/utils/httputil/httpdriver"
+	"github.com/diamondburned/ningen/v3"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestChannelReadOnly(t *testing.T) {
+	const guildID = 200000000000000001
+
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	denySend := []discord.Overwrite{{
+		ID:   discord.Snowflake(guildID), // @everyone
+		Type: discord.OverwriteRole,
+		Deny: discord.PermissionSendMessages,
+	}}
+
+	n.ChannelSet(&discord.Channel{
+		ID: 300000000000000101, GuildID: guildID, Type: discord.GuildAnnouncement,
+		Overwrites: denySend,
+	}, false)
+	n.ChannelSet(&discord.Channel{
+		ID: 300000000000000102, GuildID: guildID, Type: discord.GuildText,
+		Overwrites: denySend,
+	}, false)
+	n.ChannelSet(&discord.Channel{
+		ID: 300000000000000103, GuildID: guildID, Type: discord.GuildText,
+		Overwrites: denySend,
+	}, false)
+	n.ChannelSet(&discord.Channel{
+		ID: 300000000000000104, GuildID: guildID, Type: discord.GuildPublicThread,
+		ParentID:       300000000000000002,
+		ThreadMetadata: &discord.ThreadMetadata{Locked: true},
+	}, false)
+
+	g, err := n.Cabinet.Guild(guildID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := *g
+	rules.RulesChannelID = 300000000000000102
+	n.GuildSet(&rules, true)
+
+	tests := []struct {
+		chID discord.ChannelID
+		want ningen.ReadOnlyReason
+	}{
+		{300000000000000002, ningen.ChannelWritable},
+		{300000000000000101, ningen.ReadOnlyAnnouncement},
+		{300000000000000102, ningen.ReadOnlyRules},
+		{300000000000000103, ningen.ReadOnlyNoPermission},
+		{300000000000000104, ningen.ReadOnlyLockedThread},
+	}
+
+	for _, test := range tests {
+		if got := n.ChannelReadOnly(test.chID); got != test.want {
+			t.Errorf("channel %d: got %d (%q), want %d", test.chID, got, got.Placeholder(), test.want)
+		}
+	}
+}
+
+func TestChannelReadOnlyWithoutMember(t *testing.T) {
+	const guildID = 200000000000000001
+
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	n.Client.Client.Retries = 1
+	n.Client.Client.Client = httpdriver.WrapClient(http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: 404,
+				Header:     http.Header{"Content-Type": {"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(`{"code": 10007, "message": "Unknown Member"}`)),
+			}, nil
+		}),
+	})
+
+	me, _ := n.Cabinet.Me()
+	if err := n.Cabinet.MemberRemove(guildID, me.ID); err != nil {
+		t.Fatal("cannot remove own member:", err)
+	}
+
+	n.ChannelSet(&discord.Channel{
+		ID: 300000000000000103, GuildID: guildID, Type: discord.GuildText,
+		Overwrites: []discord.Overwrite{{
+			ID:   discord.Snowflake(guildID), // @everyone
+			Type: discord.OverwriteRole,
+			Deny: discord.PermissionSendMessages,
+		}},
+	}, false)
+
+	// Without the member, the permissions of @everyone are used.
+	if got := n.ChannelReadOnly(300000000000000002); got != ningen.ChannelWritable {
+		t.Errorf("ordinary channel: got %d, want writable", got)
+	}
+	if got := n.ChannelReadOnly(300000000000000103); got != ningen.ReadOnlyNoPermission {
+		t.Errorf("denied channel: got %d, want no permission", got)
+	}
+}
@@ -0,0 +1,271 @@
+// Package readyextra decodes the undocumented parts of the Ready event that
+// arikawa doesn't. The raw Ready event is several megabytes on big accounts, so
+// it is decoded once per ningen State and shared by all of its states instead
+// of each state decoding it again.
+//
+// Which parts are present and what shape they have depends on the
+// capabilities given when identifying, so every field may be empty.
+package readyextra
+
+import (
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/json"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	gateway.ReadyEventKeepRaw = true
+}
+
+// Extras contains the undocumented parts of the Ready event.
+type Extras struct {
+	ReadStates   ReadStates    `json:"read_state"`
+	UserSettings *UserSettings `json:"user_settings"`
+	// UserSettingsProto is true if the user settings are given as protobuf,
+	// which is the case with newer capabilities.
+	UserSettingsProto Present `json:"user_settings_proto"`
+	UserGuildSettings Present `json:"user_guild_settings"`
+	Relationships     Present `json:"relationships"`
+
+	// Users are the users referenced by the other fields, such as the
+	// recipients of private channels.
+	Users []discord.User `json:"users"`
+	// PrivateChannels are the private channels, which may only have the IDs
+	// of their recipients.
+	PrivateChannels []PrivateChannel `json:"private_channels"`
+	// Notes are the notes that the user has written about other users.
+	Notes map[discord.UserID]string `json:"notes"`
+	// Guilds contains the parts of the guilds that arikawa doesn't decode.
+	Guilds []Guild `json:"guilds"`
+
+	RequiredAction string `json:"required_action"`
+
+	// Err is the first error from decoding the extras, if any. The fields
+	// that failed to decode are left empty, while the others are still
+	// filled.
+	Err error `json:"-"`
+}
+
+// Present is true if a field is in the Ready event and isn't null. The field
+// itself is skipped.
+type Present bool
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (p *Present) UnmarshalJSON(b []byte) error {
+	*p = string(b) != "null"
+	return nil
+}
+
+// ReadStates contains the read states of the Ready event, which are either an
+// array or, with the versioned read states capability, an object with the
+// array in its entries.
+type ReadStates struct {
+	Entries []gateway.ReadState
+	// Versioned is true if the read states were given as an object.
+	Versioned bool
+	// Present is true if the read states were in the Ready event at all.
+	Present bool
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (r *ReadStates) UnmarshalJSON(b []byte) error {
+	switch {
+	case string(b) == "null":
+		return nil
+	case len(b) > 0 && b[0] == '[':
+		r.Present = true
+		return json.Unmarshal(b, &r.Entries)
+	}
+
+	var versioned struct {
+		Entries []gateway.ReadState `json:"entries"`
+	}
+	if err := json.Unmarshal(b, &versioned); err != nil {
+		return err
+	}
+
+	*r = ReadStates{
+		Entries:   versioned.Entries,
+		Versioned: true,
+		Present:   true,
+	}
+	return nil
+}
+
+// UserSettings contains the user settings that arikawa doesn't decode.
+type UserSettings struct {
+	ReactionNotifications int `json:"reaction_notifications"`
+	// EmojiUsage is the usage of the emojis that the user has used, keyed by
+	// the ID of custom emojis and the name of Unicode emojis.
+	EmojiUsage map[string]EmojiUsage `json:"emoji_usage"`
+}
+
+// EmojiUsage is how often an emoji was used, which Discord keeps across
+// clients.
+type EmojiUsage struct {
+	TotalUses  int                       `json:"total_uses"`
+	RecentUses []discord.UnixMsTimestamp `json:"recent_uses"`
+}
+
+// LastUsed returns the time of the most recent use, or the zero time if it
+// isn't known.
+func (u EmojiUsage) LastUsed() time.Time {
+	var last discord.UnixMsTimestamp
+	for _, use := range u.RecentUses {
+		if use > last {
+			last = use
+		}
+	}
+
+	if last == 0 {
+		return time.Time{}
+	}
+	return last.Time()
+}
+
+// PrivateChannel is a private channel along with the IDs of its recipients.
+type PrivateChannel struct {
+	discord.Channel
+	RecipientIDs []discord.UserID `json:"recipient_ids,omitempty"`
+}
+
+// UnmarshalJSON unmarshals both the channel and the recipient IDs. This is
+// needed because discord.Channel's own UnmarshalJSON would otherwise be
+// promoted and skip RecipientIDs.
+func (ch *PrivateChannel) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &ch.Channel); err != nil {
+		return err
+	}
+
+	var recipients struct {
+		RecipientIDs []discord.UserID `json:"recipient_ids,omitempty"`
+	}
+	if err := json.Unmarshal(b, &recipients); err != nil {
+		return err
+	}
+
+	ch.RecipientIDs = recipients.RecipientIDs
+	return nil
+}
+
+// Guild contains the parts of a guild that arikawa doesn't decode.
+type Guild struct {
+	ID       discord.GuildID   `json:"id"`
+	Stickers []discord.Sticker `json:"stickers"`
+	Roles    []Role            `json:"roles"`
+}
+
+// Role contains the parts of a role that arikawa doesn't decode.
+type Role struct {
+	ID   discord.RoleID `json:"id"`
+	Tags struct {
+		ListingID discord.Snowflake `json:"subscription_listing_id"`
+		// AvailableForPurchase is null if the role can be bought and
+		// missing otherwise.
+		AvailableForPurchase json.Raw `json:"available_for_purchase"`
+	} `json:"tags"`
+}
+
+// rawExtras holds the fields of Extras undecoded, so that they can be decoded
+// one by one.
+type rawExtras struct {
+	ReadStates        json.Raw `json:"read_state"`
+	UserSettings      json.Raw `json:"user_settings"`
+	UserSettingsProto json.Raw `json:"user_settings_proto"`
+	UserGuildSettings json.Raw `json:"user_guild_settings"`
+	Relationships     json.Raw `json:"relationships"`
+	Users             json.Raw `json:"users"`
+	PrivateChannels   json.Raw `json:"private_channels"`
+	Notes             json.Raw `json:"notes"`
+	Guilds            json.Raw `json:"guilds"`
+	RequiredAction    json.Raw `json:"required_action"`
+}
+
+// Decode decodes the extras from the raw Ready event. The event is only
+// scanned once to pick out the fields, and each field is then decoded on its
+// own, so that a field with an unexpected shape doesn't lose the others. An
+// empty event has no extras.
+func Decode(raw json.Raw) *Extras {
+	var extras Extras
+	if len(raw) == 0 {
+		return &extras
+	}
+
+	var fields rawExtras
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		extras.Err = errors.Wrap(err, "cannot decode Ready")
+		return &extras
+	}
+
+	decode := func(name string, b json.Raw, v interface{}) {
+		if b == nil {
+			return
+		}
+		if err := b.UnmarshalTo(v); err != nil && extras.Err == nil {
+			extras.Err = errors.Wrapf(err, "cannot decode %s", name)
+		}
+	}
+
+	decode("read_state", fields.ReadStates, &extras.ReadStates)
+	decode("user_settings", fields.UserSettings, &extras.UserSettings)
+	decode("user_settings_proto", fields.UserSettingsProto, &extras.UserSettingsProto)
+	decode("user_guild_settings", fields.UserGuildSettings, &extras.UserGuildSettings)
+	decode("relationships", fields.Relationships, &extras.Relationships)
+	decode("users", fields.Users, &extras.Users)
+	decode("private_channels", fields.PrivateChannels, &extras.PrivateChannels)
+	decode("notes", fields.Notes, &extras.Notes)
+	decode("guilds", fields.Guilds, &extras.Guilds)
+	decode("required_action", fields.RequiredAction, &extras.RequiredAction)
+
+	return &extras
+}
+
+// Cache shares the extras of a Ready event between the handlers of a State,
+// so that they are decoded once per event. Each State has its own Cache, so
+// that sessions don't evict each other's extras. A nil Cache decodes the
+// extras on every call.
+type Cache struct {
+	mutex  sync.Mutex
+	ev     *gateway.ReadyEvent
+	extras *Extras
+}
+
+// Of returns the extras of the Ready event. They are only decoded by the first
+// call for the event, and the same Extras is returned until Release is
+// called, so it must not be modified.
+func (c *Cache) Of(ev *gateway.ReadyEvent) *Extras {
+	if c == nil {
+		return Decode(ev.RawEventBody)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.ev != ev {
+		c.ev = ev
+		c.extras = Decode(ev.RawEventBody)
+	}
+
+	return c.extras
+}
+
+// Release drops the extras of the Ready event, along with the event itself,
+// so that they can be garbage collected. ningen calls it once all of its
+// handlers have seen the event. A later call to Of decodes the extras again.
+func (c *Cache) Release(ev *gateway.ReadyEvent) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.ev == ev {
+		c.ev = nil
+		c.extras = nil
+	}
+}
@@ -0,0 +1,113 @@
+package readyextra
+
+import (
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+func TestDecode(t *testing.T) {
+	extras := Decode([]byte(`{
+		"read_state": {"version": 1, "partial": false, "entries": [{"id": "1", "last_message_id": "2"}]},
+		"user_settings_proto": "CgIYAQ==",
+		"relationships": [],
+		"user_guild_settings": null,
+		"private_channels": [{"id": "3", "type": 1, "recipient_ids": ["4"]}],
+		"notes": {"4": "hi"},
+		"guilds": [{"id": "5", "roles": [{"id": "6", "tags": {"subscription_listing_id": "7", "available_for_purchase": null}}]}],
+		"required_action": "REQUIRE_VERIFIED_EMAIL"
+	}`))
+
+	if extras.Err != nil {
+		t.Fatal("cannot decode:", extras.Err)
+	}
+
+	rs := extras.ReadStates
+	if !rs.Present || !rs.Versioned || len(rs.Entries) != 1 || rs.Entries[0].LastMessageID != 2 {
+		t.Errorf("got read states %+v", rs)
+	}
+	if extras.UserSettings != nil || !extras.UserSettingsProto || !extras.Relationships || extras.UserGuildSettings {
+		t.Errorf("got wrong presence of settings: %+v", extras)
+	}
+	if chs := extras.PrivateChannels; len(chs) != 1 || chs[0].ID != 3 || len(chs[0].RecipientIDs) != 1 {
+		t.Errorf("got private channels %+v", chs)
+	}
+	if extras.Notes[4] != "hi" {
+		t.Errorf("got notes %v", extras.Notes)
+	}
+	if g := extras.Guilds; len(g) != 1 || len(g[0].Roles) != 1 || g[0].Roles[0].Tags.AvailableForPurchase == nil {
+		t.Errorf("got guilds %+v", g)
+	}
+	if extras.RequiredAction != "REQUIRE_VERIFIED_EMAIL" {
+		t.Errorf("got required action %q", extras.RequiredAction)
+	}
+
+	extras = Decode([]byte(`{"read_state": [{"id": "1"}]}`))
+	if rs := extras.ReadStates; !rs.Present || rs.Versioned || len(rs.Entries) != 1 {
+		t.Errorf("got unversioned read states %+v", rs)
+	}
+
+	extras = Decode([]byte(`{"user_settings": {
+		"reaction_notifications": 1,
+		"emoji_usage": {"8": {"total_uses": 3, "recent_uses": [1000, 3000, 2000]}}
+	}}`))
+	if extras.Err != nil {
+		t.Fatal("cannot decode user settings:", extras.Err)
+	}
+	usage := extras.UserSettings.EmojiUsage["8"]
+	if usage.TotalUses != 3 || usage.LastUsed().UnixMilli() != 3000 {
+		t.Errorf("got emoji usage %+v", usage)
+	}
+}
+
+func TestDecodePartial(t *testing.T) {
+	extras := Decode([]byte(`{
+		"read_state": 5,
+		"notes": {"4": "hi"},
+		"required_action": "AGREEMENTS"
+	}`))
+
+	if extras.Err == nil {
+		t.Error("no error for the malformed read states")
+	}
+	if extras.ReadStates.Present {
+		t.Errorf("got read states %+v", extras.ReadStates)
+	}
+	if extras.Notes[4] != "hi" || extras.RequiredAction != "AGREEMENTS" {
+		t.Errorf("lost the other fields: %+v", extras)
+	}
+}
+
+func TestCache(t *testing.T) {
+	ev := &gateway.ReadyEvent{}
+	ev.RawEventBody = []byte(`{"required_action": "AGREEMENTS"}`)
+
+	var cache Cache
+
+	extras := cache.Of(ev)
+	if extras.RequiredAction != "AGREEMENTS" {
+		t.Fatalf("got required action %q", extras.RequiredAction)
+	}
+	if cache.Of(ev) != extras {
+		t.Error("extras were decoded again for the same event")
+	}
+
+	// Another State's cache doesn't evict this one.
+	var other Cache
+	other.Of(&gateway.ReadyEvent{})
+	if cache.Of(ev) != extras {
+		t.Error("extras were evicted by another cache")
+	}
+
+	cache.Release(ev)
+	if cache.Of(ev) == extras {
+		t.Error("extras were kept after Release")
+	}
+	cache.Release(ev)
+
+	var nilCache *Cache
+	if nilCache.Of(ev).RequiredAction != "AGREEMENTS" {
+		t.Error("nil cache didn't decode the extras")
+	}
+	nilCache.Release(ev)
+}
@@ -0,0 +1,84 @@
+package ningen
+
+import (
+	"sync"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+)
+
+// ReadyProgressEvent is dispatched when Ready arrives and then each time one
+// of the guilds that were unavailable in Ready is loaded by a GuildCreateEvent.
+// UIs can use it to show how many guilds are still loading, such as "Loading
+// guilds 50/180", while already being interactive.
+//
+// The Ready payload itself isn't decoded incrementally: arikawa decodes the
+// whole event before dispatching it, so there is no progress to report until
+// it arrives.
+type ReadyProgressEvent struct {
+	LoadedGuilds int
+	TotalGuilds  int
+}
+
+var _ gateway.Event = (*ReadyProgressEvent)(nil)
+
+func (ev ReadyProgressEvent) Op() ws.OpCode           { return -1 }
+func (ev ReadyProgressEvent) EventType() ws.EventType { return "__ningen.ReadyProgressEvent" }
+
+// Done returns true if all guilds are loaded.
+func (ev ReadyProgressEvent) Done() bool {
+	return ev.LoadedGuilds >= ev.TotalGuilds
+}
+
+type readyProgress struct {
+	mutex    sync.Mutex
+	pending  map[discord.GuildID]struct{}
+	total    int
+	dispatch func(*ReadyProgressEvent)
+}
+
+func newReadyProgress(dispatch func(*ReadyProgressEvent)) *readyProgress {
+	return &readyProgress{dispatch: dispatch}
+}
+
+func (p *readyProgress) handle(ev gateway.Event) {
+	var progress ReadyProgressEvent
+
+	switch ev := ev.(type) {
+	case *gateway.ReadyEvent:
+		p.mutex.Lock()
+		p.total = len(ev.Guilds)
+		p.pending = make(map[discord.GuildID]struct{})
+		for _, guild := range ev.Guilds {
+			if guild.Unavailable {
+				p.pending[guild.ID] = struct{}{}
+			}
+		}
+		progress = p.progress()
+		p.mutex.Unlock()
+
+	case *gateway.GuildCreateEvent:
+		p.mutex.Lock()
+		if _, ok := p.pending[ev.ID]; !ok || ev.Unavailable {
+			p.mutex.Unlock()
+			return
+		}
+		delete(p.pending, ev.ID)
+		progress = p.progress()
+		p.mutex.Unlock()
+
+	default:
+		return
+	}
+
+	p.dispatch(&progress)
+}
+
+// progress returns the current progress. p.mutex must be held.
+func (p *readyProgress) progress() ReadyProgressEvent {
+	return ReadyProgressEvent{
+		LoadedGuilds: p.total - len(p.pending),
+		TotalGuilds:  p.total,
+	}
+}
@@ -0,0 +1,58 @@
+package ningen_test
+
+import (
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/ningen/v3"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestReadyProgressEvent(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	var events []ningen.ReadyProgressEvent
+	n.AddSyncHandler(func(ev *ningen.ReadyProgressEvent) { events = append(events, *ev) })
+
+	fixture, err := ningentest.LoadFixture(ningentest.Guilds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ready, err := fixture.ReadyEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unavailable := map[discord.GuildID]gateway.GuildCreateEvent{}
+	for i := range ready.Guilds[1:] {
+		guild := &ready.Guilds[i+1]
+		unavailable[guild.ID] = *guild
+		*guild = gateway.GuildCreateEvent{
+			Guild:       discord.Guild{ID: guild.ID},
+			Unavailable: true,
+		}
+	}
+
+	ningentest.Dispatch(n, ready)
+	for _, guild := range unavailable {
+		guild := guild
+		ningentest.Dispatch(n, &guild)
+	}
+
+	total := len(ready.Guilds)
+	if len(events) != len(unavailable)+1 {
+		t.Fatalf("got %d progress events, want %d", len(events), len(unavailable)+1)
+	}
+
+	for i, ev := range events {
+		if ev.TotalGuilds != total || ev.LoadedGuilds != i+1 {
+			t.Errorf("event %d: got %d/%d, want %d/%d", i, ev.LoadedGuilds, ev.TotalGuilds, i+1, total)
+		}
+	}
+
+	if !events[len(events)-1].Done() {
+		t.Error("last progress event is not done")
+	}
+}
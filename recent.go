@@ -0,0 +1,153 @@
+package ningen
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+	"github.com/diamondburned/ningen/v3/states/read"
+)
+
+// RecentConversationsChangedEvent is dispatched when a channel has moved up in
+// RecentConversations, such as when a message is sent to it or it is read.
+type RecentConversationsChangedEvent struct {
+	ChannelID discord.ChannelID
+}
+
+var _ gateway.Event = (*RecentConversationsChangedEvent)(nil)
+
+func (ev RecentConversationsChangedEvent) Op() ws.OpCode { return -1 }
+func (ev RecentConversationsChangedEvent) EventType() ws.EventType {
+	return "__ningen.RecentConversationsChangedEvent"
+}
+
+// RecentConversations returns the channels that the user has been active in
+// lately, most recent first, for pickers such as the targets of a forwarded
+// message. It mixes DMs and group DMs, which count as active whenever a
+// message is sent in them, with guild channels, which count as active when the
+// user sends a message or reads them. Before any of that happens, the read
+// states and the last messages from the Ready event are used.
+//
+// Channels that the user can't send messages in are skipped. At most limit
+// channels are returned, or all of them if limit is 0 or less.
+func (s *State) RecentConversations(limit int) []discord.Channel {
+	type activity struct {
+		chID discord.ChannelID
+		last discord.Snowflake
+	}
+
+	c := s.conversations
+
+	c.mutex.Lock()
+	active := make([]activity, 0, len(c.active))
+	for chID, last := range c.active {
+		active = append(active, activity{chID, last})
+	}
+	c.mutex.Unlock()
+
+	sort.Slice(active, func(i, j int) bool {
+		if active[i].last != active[j].last {
+			return active[i].last > active[j].last
+		}
+		return active[i].chID > active[j].chID
+	})
+
+	var channels []discord.Channel
+	for _, a := range active {
+		if limit > 0 && len(channels) == limit {
+			break
+		}
+
+		ch, err := s.Cabinet.Channel(a.chID)
+		if err != nil {
+			continue
+		}
+		if ch.GuildID.IsValid() && !s.HasPermissions(ch.ID, discord.PermissionSendMessages) {
+			continue
+		}
+
+		channels = append(channels, *ch)
+	}
+
+	return channels
+}
+
+// conversationTracker keeps the IDs of the messages that the user was last
+// active around in each channel. IDs are compared rather than their times,
+// since they are just as ordered but more precise.
+type conversationTracker struct {
+	mutex  sync.Mutex
+	active map[discord.ChannelID]discord.Snowflake
+
+	state    *State
+	dispatch func(*RecentConversationsChangedEvent)
+}
+
+func newConversationTracker(state *State, dispatch func(*RecentConversationsChangedEvent)) *conversationTracker {
+	return &conversationTracker{
+		active:   make(map[discord.ChannelID]discord.Snowflake),
+		state:    state,
+		dispatch: dispatch,
+	}
+}
+
+func (c *conversationTracker) handle(ev gateway.Event) {
+	switch ev := ev.(type) {
+	case *gateway.ReadyEvent:
+		c.mutex.Lock()
+		c.active = make(map[discord.ChannelID]discord.Snowflake, len(ev.ReadStates))
+		for _, rs := range ev.ReadStates {
+			c.bump(rs.ChannelID, discord.Snowflake(rs.LastMessageID))
+		}
+		for _, ch := range ev.PrivateChannels {
+			c.bump(ch.ID, discord.Snowflake(ch.LastMessageID))
+		}
+		c.mutex.Unlock()
+
+	case *gateway.MessageCreateEvent:
+		if ev.GuildID.IsValid() {
+			if me, _ := c.state.Me(); me == nil || me.ID != ev.Author.ID {
+				break
+			}
+		}
+		c.update(ev.ChannelID, discord.Snowflake(ev.ID))
+
+	case *read.UpdateEvent:
+		if !ev.Unread {
+			c.update(ev.ChannelID, discord.Snowflake(ev.LastMessageID))
+		}
+
+	case *gateway.ChannelDeleteEvent:
+		c.mutex.Lock()
+		delete(c.active, ev.ID)
+		c.mutex.Unlock()
+	}
+}
+
+// update bumps the channel and dispatches an event if it has moved up.
+func (c *conversationTracker) update(chID discord.ChannelID, id discord.Snowflake) {
+	c.mutex.Lock()
+	bumped := c.bump(chID, id)
+	c.mutex.Unlock()
+
+	if bumped {
+		c.dispatch(&RecentConversationsChangedEvent{ChannelID: chID})
+	}
+}
+
+// bump sets the channel's activity to the given ID if it is later. c.mutex
+// must be held.
+func (c *conversationTracker) bump(chID discord.ChannelID, id discord.Snowflake) bool {
+	if !id.IsValid() {
+		return false
+	}
+
+	if old, ok := c.active[chID]; ok && id <= old {
+		return false
+	}
+
+	c.active[chID] = id
+	return true
+}
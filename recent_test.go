@@ -0,0 +1,57 @@
+package ningen_test
+
+import (
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/ningen/v3"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestRecentConversations(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.GroupDMs)
+
+	var events []*ningen.RecentConversationsChangedEvent
+	n.AddSyncHandler(func(ev *ningen.RecentConversationsChangedEvent) { events = append(events, ev) })
+
+	assertOrder := func(want ...discord.ChannelID) {
+		t.Helper()
+
+		got := n.RecentConversations(0)
+		if len(got) != len(want) {
+			t.Fatalf("got %d conversations, want %d", len(got), len(want))
+		}
+		for i, ch := range got {
+			if ch.ID != want[i] {
+				t.Errorf("conversation %d is %d, want %d", i, ch.ID, want[i])
+			}
+		}
+	}
+
+	// The group DM's last message is newer than its read state.
+	assertOrder(400000000000000002, 400000000000000001, 400000000000000003)
+
+	ningentest.Dispatch(n, &gateway.MessageCreateEvent{
+		Message: discord.Message{
+			ID:        900000000000001100,
+			ChannelID: 400000000000000003,
+			Author:    discord.User{ID: 100000000000000003},
+		},
+	})
+
+	assertOrder(400000000000000003, 400000000000000002, 400000000000000001)
+	if len(events) != 1 || events[0].ChannelID != 400000000000000003 {
+		t.Errorf("got events %+v, want one for the DM", events)
+	}
+
+	// Reading an old message doesn't move the channel.
+	n.ReadState.MarkRead(400000000000000001, 900000000000001010)
+	if len(events) != 1 {
+		t.Errorf("got %d events after reading an old message", len(events))
+	}
+
+	if got := n.RecentConversations(1); len(got) != 1 || got[0].ID != 400000000000000003 {
+		t.Errorf("got %+v, want only the latest conversation", got)
+	}
+}
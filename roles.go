@@ -0,0 +1,163 @@
+package ningen
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+)
+
+// RolesChangedEvent is dispatched when the roles of a guild are created,
+// updated or deleted, after the roles returned by RolesSorted have changed.
+type RolesChangedEvent struct {
+	GuildID discord.GuildID
+	// Version is the new version of the guild's roles; see RolesSorted.
+	Version uint64
+}
+
+var _ gateway.Event = (*RolesChangedEvent)(nil)
+
+func (ev RolesChangedEvent) Op() ws.OpCode           { return -1 }
+func (ev RolesChangedEvent) EventType() ws.EventType { return "__ningen.RolesChangedEvent" }
+
+// RolesSorted returns the roles of the guild sorted from the highest to the
+// lowest, which is the order that role pickers and member lists show them in.
+// Roles with the same position are sorted by their IDs. The sorted roles are
+// cached until the roles change, so the returned slice must not be modified.
+//
+// The version is incremented every time the roles of the guild change, so
+// views that derive something from the roles, such as mention completions,
+// only have to redo it if the version has changed. A RolesChangedEvent is
+// dispatched along with it.
+func (s *State) RolesSorted(guildID discord.GuildID) (roles []discord.Role, version uint64) {
+	c := s.roles
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	version = c.versions[guildID]
+	if roles, ok := c.sorted[guildID]; ok {
+		return roles, version
+	}
+
+	roles, err := s.Cabinet.Roles(guildID)
+	if err != nil {
+		return nil, version
+	}
+
+	sort.Slice(roles, func(i, j int) bool {
+		if roles[i].Position != roles[j].Position {
+			return roles[i].Position > roles[j].Position
+		}
+		return roles[i].ID < roles[j].ID
+	})
+
+	c.sorted[guildID] = roles
+	return roles, version
+}
+
+// MemberColor returns the color of the member's highest role that has a
+// color. It overrides the embedded State's MemberColor to use RolesSorted.
+func (s *State) MemberColor(guildID discord.GuildID, userID discord.UserID) (discord.Color, bool) {
+	m, err := s.Member(guildID, userID)
+	if err != nil || len(m.RoleIDs) == 0 {
+		return discord.NullColor, false
+	}
+
+	roles, _ := s.RolesSorted(guildID)
+	for _, role := range roles {
+		if role.Color <= 0 {
+			continue
+		}
+		for _, roleID := range m.RoleIDs {
+			if roleID == role.ID {
+				return role.Color, true
+			}
+		}
+	}
+
+	return discord.NullColor, false
+}
+
+// MentionableRoles returns the roles that the user can mention in the channel
+// such that their members are notified, sorted like RolesSorted. Roles that
+// aren't mentionable can only be mentioned with the Mention Everyone
+// permission; mentioning them without it silently does nothing. The @everyone
+// role isn't included, since it is mentioned as @everyone instead. Private
+// channels have no roles.
+func (s *State) MentionableRoles(chID discord.ChannelID) []discord.Role {
+	ch, err := s.Cabinet.Channel(chID)
+	if err != nil || !ch.GuildID.IsValid() {
+		return nil
+	}
+
+	roles, _ := s.RolesSorted(ch.GuildID)
+	everyone := s.HasPermissions(chID, discord.PermissionMentionEveryone)
+
+	mentionable := make([]discord.Role, 0, len(roles))
+	for _, role := range roles {
+		if role.ID == discord.RoleID(ch.GuildID) {
+			continue
+		}
+		if role.Mentionable || everyone {
+			mentionable = append(mentionable, role)
+		}
+	}
+
+	return mentionable
+}
+
+// roleCache caches the sorted roles of guilds.
+type roleCache struct {
+	mutex    sync.Mutex
+	sorted   map[discord.GuildID][]discord.Role
+	versions map[discord.GuildID]uint64
+	dispatch func(*RolesChangedEvent)
+}
+
+func newRoleCache(dispatch func(*RolesChangedEvent)) *roleCache {
+	return &roleCache{
+		sorted:   make(map[discord.GuildID][]discord.Role),
+		versions: make(map[discord.GuildID]uint64),
+		dispatch: dispatch,
+	}
+}
+
+func (c *roleCache) handle(ev gateway.Event) {
+	switch ev := ev.(type) {
+	case *gateway.ReadyEvent:
+		c.mutex.Lock()
+		c.sorted = make(map[discord.GuildID][]discord.Role)
+		c.mutex.Unlock()
+
+	case *gateway.GuildCreateEvent:
+		c.invalidate(ev.ID, false)
+	case *gateway.GuildUpdateEvent:
+		c.invalidate(ev.ID, true)
+	case *gateway.GuildDeleteEvent:
+		c.invalidate(ev.ID, false)
+
+	case *gateway.GuildRoleCreateEvent:
+		c.invalidate(ev.GuildID, true)
+	case *gateway.GuildRoleUpdateEvent:
+		c.invalidate(ev.GuildID, true)
+	case *gateway.GuildRoleDeleteEvent:
+		c.invalidate(ev.GuildID, true)
+	}
+}
+
+// invalidate drops the sorted roles of the guild and increments its version.
+// A RolesChangedEvent is dispatched if dispatch is true.
+func (c *roleCache) invalidate(guildID discord.GuildID, dispatch bool) {
+	c.mutex.Lock()
+	delete(c.sorted, guildID)
+	c.versions[guildID]++
+	version := c.versions[guildID]
+	c.mutex.Unlock()
+
+	if dispatch {
+		c.dispatch(&RolesChangedEvent{GuildID: guildID, Version: version})
+	}
+}
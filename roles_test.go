@@ -0,0 +1,98 @@
+package ningen_test
+
+import (
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/ningen/v3"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestRolesSorted(t *testing.T) {
+	const guildID = 200000000000000001
+	const userID = 100000000000000002
+
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	var events []*ningen.RolesChangedEvent
+	n.AddSyncHandler(func(ev *ningen.RolesChangedEvent) { events = append(events, ev) })
+
+	roles, version := n.RolesSorted(guildID)
+	if len(roles) != 1 || roles[0].ID != guildID {
+		t.Fatalf("got roles %+v, want only @everyone", roles)
+	}
+
+	for _, role := range []discord.Role{
+		{ID: 600000000000000001, Name: "mods", Position: 2, Color: 0x00ff00},
+		{ID: 600000000000000002, Name: "admins", Position: 3},
+		{ID: 600000000000000003, Name: "helpers", Position: 2, Color: 0x0000ff},
+	} {
+		ningentest.Dispatch(n, &gateway.GuildRoleCreateEvent{GuildID: guildID, Role: role})
+	}
+
+	if len(events) != 3 || events[2].GuildID != guildID {
+		t.Fatalf("got %d events, want 3", len(events))
+	}
+
+	roles, newVersion := n.RolesSorted(guildID)
+	if newVersion == version || newVersion != events[2].Version {
+		t.Errorf("got version %d, was %d and the last event has %d", newVersion, version, events[2].Version)
+	}
+
+	want := []discord.RoleID{600000000000000002, 600000000000000001, 600000000000000003, guildID}
+	if len(roles) != len(want) {
+		t.Fatalf("got %d roles, want %d", len(roles), len(want))
+	}
+	for i, id := range want {
+		if roles[i].ID != id {
+			t.Errorf("role %d is %d, want %d", i, roles[i].ID, id)
+		}
+	}
+
+	if again, _ := n.RolesSorted(guildID); &again[0] != &roles[0] {
+		t.Error("sorted roles aren't cached")
+	}
+
+	ningentest.Dispatch(n, &gateway.GuildMemberAddEvent{
+		GuildID: guildID,
+		Member: discord.Member{
+			User:    discord.User{ID: userID, Username: "alice"},
+			RoleIDs: []discord.RoleID{600000000000000002, 600000000000000003},
+		},
+	})
+
+	// Admins have no color, so the color of helpers is used.
+	if color, ok := n.MemberColor(guildID, userID); !ok || color != 0x0000ff {
+		t.Errorf("got member color %06x (%v), want 0000ff", color, ok)
+	}
+}
+
+func TestMentionableRoles(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	// The user can't mention everyone in the first guild but owns the third.
+	for _, guildID := range []discord.GuildID{200000000000000001, 200000000000000003} {
+		for _, role := range []discord.Role{
+			{ID: discord.RoleID(guildID) + 10, Name: "mods", Position: 2, Mentionable: true},
+			{ID: discord.RoleID(guildID) + 20, Name: "admins", Position: 3},
+		} {
+			ningentest.Dispatch(n, &gateway.GuildRoleCreateEvent{GuildID: guildID, Role: role})
+		}
+	}
+
+	roleIDs := func(chID discord.ChannelID) []discord.RoleID {
+		var ids []discord.RoleID
+		for _, role := range n.MentionableRoles(chID) {
+			ids = append(ids, role.ID)
+		}
+		return ids
+	}
+
+	if ids := roleIDs(300000000000000002); len(ids) != 1 || ids[0] != 200000000000000011 {
+		t.Errorf("got roles %v without Mention Everyone, want only mods", ids)
+	}
+	if ids := roleIDs(300000000000000021); len(ids) != 2 || ids[0] != 200000000000000023 {
+		t.Errorf("got roles %v as the owner, want admins then mods", ids)
+	}
+}
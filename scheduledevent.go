@@ -0,0 +1,95 @@
+package ningen
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// ScheduledEventBaseURL is the base URL of the links made by
+// ScheduledEventLink.
+const ScheduledEventBaseURL = "https://discord.com/events/"
+
+// ScheduledEventLink returns the link to the guild's scheduled event, as copied
+// using "Copy Event Link" in the official client.
+func ScheduledEventLink(guildID discord.GuildID, eventID discord.EventID) string {
+	return ScheduledEventBaseURL + guildID.String() + "/" + eventID.String()
+}
+
+// ScheduledEventCoverURL returns the URL of the cover image of the scheduled
+// event, or an empty string if it has none.
+func ScheduledEventCoverURL(ev *discord.GuildScheduledEvent) string {
+	if ev.Image == "" {
+		return ""
+	}
+	return "https://cdn.discordapp.com/guild-events/" + ev.ID.String() + "/" + ev.Image + ".png"
+}
+
+// ScheduledEventView is a guild scheduled event with everything that an event
+// card shows resolved.
+type ScheduledEventView struct {
+	discord.GuildScheduledEvent
+	// Channel is the stage or voice channel that the event takes place in. It
+	// is nil for external events, and if the channel isn't in the cabinet or
+	// the user can't view it.
+	Channel *discord.Channel
+	// Location is where an external event takes place, or the name of
+	// Channel.
+	Location string
+	// LocationURL is the link to Channel, or the location of an external
+	// event if it is a web link. It is empty otherwise.
+	LocationURL string
+	// CoverURL is the URL of the event's cover image, or empty if it has
+	// none.
+	CoverURL string
+	// Link is the link to the event itself.
+	Link string
+}
+
+// ScheduledEventView resolves the scheduled event's location and images for
+// event cards. Only the cabinet is used, so it never blocks.
+func (s *State) ScheduledEventView(ev *discord.GuildScheduledEvent) ScheduledEventView {
+	view := ScheduledEventView{
+		GuildScheduledEvent: *ev,
+		CoverURL:            ScheduledEventCoverURL(ev),
+		Link:                ScheduledEventLink(ev.GuildID, ev.ID),
+	}
+
+	switch ev.EntityType {
+	case discord.StageInstanceEntity, discord.VoiceEntity:
+		if !ev.ChannelID.IsValid() {
+			break
+		}
+
+		ch, err := s.Cabinet.Channel(ev.ChannelID)
+		if err != nil || !s.HasPermissions(ch.ID, discord.PermissionViewChannel) {
+			break
+		}
+
+		view.Channel = ch
+		view.Location = ch.Name
+		view.LocationURL = ChannelLink(ch.GuildID, ch.ID)
+
+	case discord.ExternalEntity:
+		if ev.EntityMetadata == nil {
+			break
+		}
+
+		view.Location = ev.EntityMetadata.Location
+		if isWebLink(view.Location) {
+			view.LocationURL = strings.TrimSpace(view.Location)
+		}
+	}
+
+	return view
+}
+
+// isWebLink returns true if the string is an absolute HTTP or HTTPS URL.
+func isWebLink(s string) bool {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil || u.Host == "" {
+		return false
+	}
+	return u.Scheme == "http" || u.Scheme == "https"
+}
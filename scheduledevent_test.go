@@ -0,0 +1,57 @@
+package ningen_test
+
+import (
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestScheduledEventView(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	ev := &discord.GuildScheduledEvent{
+		ID:         700000000000000001,
+		GuildID:    200000000000000001,
+		ChannelID:  300000000000000002,
+		EntityType: discord.VoiceEntity,
+		Image:      "cover",
+	}
+
+	view := n.ScheduledEventView(ev)
+	if view.Channel == nil || view.Channel.ID != ev.ChannelID {
+		t.Fatalf("got channel %+v", view.Channel)
+	}
+	if view.LocationURL != "https://discord.com/channels/200000000000000001/300000000000000002" {
+		t.Errorf("got location URL %q", view.LocationURL)
+	}
+	if view.CoverURL != "https://cdn.discordapp.com/guild-events/700000000000000001/cover.png" {
+		t.Errorf("got cover URL %q", view.CoverURL)
+	}
+	if view.Link != "https://discord.com/events/200000000000000001/700000000000000001" {
+		t.Errorf("got link %q", view.Link)
+	}
+
+	// The user can't view the hidden channel.
+	ev.ChannelID = 300000000000000005
+	if view := n.ScheduledEventView(ev); view.Channel != nil || view.LocationURL != "" {
+		t.Errorf("got hidden channel %+v at %q", view.Channel, view.LocationURL)
+	}
+
+	external := &discord.GuildScheduledEvent{
+		ID:             700000000000000002,
+		GuildID:        200000000000000001,
+		EntityType:     discord.ExternalEntity,
+		EntityMetadata: &discord.EntityMetadata{Location: "https://example.com/stream"},
+	}
+
+	view = n.ScheduledEventView(external)
+	if view.Channel != nil || view.LocationURL != "https://example.com/stream" || view.CoverURL != "" {
+		t.Errorf("got external view %+v", view)
+	}
+
+	external.EntityMetadata.Location = "The Park"
+	if view := n.ScheduledEventView(external); view.Location != "The Park" || view.LocationURL != "" {
+		t.Errorf("got location %q at %q", view.Location, view.LocationURL)
+	}
+}
@@ -0,0 +1,152 @@
+package ningen_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/httputil/httpdriver"
+	"github.com/diamondburned/ningen/v3/ningentest"
+	"github.com/diamondburned/ningen/v3/states/send"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestQueueMessage(t *testing.T) {
+	const chID = 300000000000000002
+
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	var mu sync.Mutex
+	online := false
+
+	n.Client.Client.Retries = 1
+	n.Client.Client.Client = httpdriver.WrapClient(http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if !online {
+				return nil, errors.New("network is unreachable")
+			}
+
+			var data api.SendMessageData
+			if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+				return nil, err
+			}
+
+			body := `{"id":"900000000000000100","channel_id":"300000000000000002",` +
+				`"content":"` + data.Content + `","nonce":"` + data.Nonce + `",` +
+				`"author":{"id":"100000000000000001","username":"ningen"}}`
+
+			return &http.Response{
+				StatusCode: 200,
+				Header:     http.Header{"Content-Type": {"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(body)),
+			}, nil
+		}),
+	})
+
+	events := make(chan gateway.Event, 10)
+	n.AddSyncHandler(func(ev *send.SucceededEvent) { events <- ev })
+	n.AddSyncHandler(func(ev *send.FailedEvent) { events <- ev })
+
+	next := func() gateway.Event {
+		t.Helper()
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for send event")
+			return nil
+		}
+	}
+
+	msg := n.SendState.QueueMessage(chID, api.SendMessageData{Content: "hello"})
+	if msg.Nonce == "" || msg.Content != "hello" || msg.Author.ID != 100000000000000001 {
+		t.Fatalf("unexpected pending message %+v", msg)
+	}
+
+	failed, ok := next().(*send.FailedEvent)
+	if !ok || failed.Nonce != msg.Nonce || !failed.Retrying {
+		t.Fatalf("expected retrying FailedEvent, got %+v", failed)
+	}
+
+	if pending := n.SendState.PendingMessages(chID); len(pending) != 1 || pending[0].Nonce != msg.Nonce {
+		t.Fatalf("got pending messages %+v", pending)
+	}
+
+	mu.Lock()
+	online = true
+	mu.Unlock()
+
+	ningentest.Dispatch(n, &gateway.ResumedEvent{})
+
+	succeeded, ok := next().(*send.SucceededEvent)
+	if !ok || succeeded.Message.Nonce != msg.Nonce || succeeded.Message.ID != 900000000000000100 {
+		t.Fatalf("expected SucceededEvent, got %+v", succeeded)
+	}
+
+	// The gateway echo of the same message is ignored.
+	ningentest.Dispatch(n, &gateway.MessageCreateEvent{Message: succeeded.Message})
+
+	select {
+	case ev := <-events:
+		t.Fatalf("unexpected event %#v", ev)
+	default:
+	}
+
+	if pending := n.SendState.PendingMessages(chID); len(pending) != 0 {
+		t.Fatalf("got pending messages %+v after success", pending)
+	}
+}
+
+func TestQueueMessageNonces(t *testing.T) {
+	const chID = 300000000000000002
+
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	n.Client.Client.Retries = 1
+	n.Client.Client.Client = httpdriver.WrapClient(http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			return nil, errors.New("network is unreachable")
+		}),
+	})
+
+	failed := make(chan string, 2)
+	n.AddSyncHandler(func(ev *send.FailedEvent) { failed <- ev.Nonce })
+
+	// Both messages are queued within the same millisecond.
+	first := n.SendState.QueueMessage(chID, api.SendMessageData{Content: "first"})
+	second := n.SendState.QueueMessage(chID, api.SendMessageData{Content: "second"})
+
+	if first.Nonce == second.Nonce || first.ID >= second.ID {
+		t.Fatalf("got nonces %s and %s", first.Nonce, second.Nonce)
+	}
+
+	nonces := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case nonce := <-failed:
+			nonces[nonce] = true
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for FailedEvent")
+		}
+	}
+	if !nonces[first.Nonce] || !nonces[second.Nonce] {
+		t.Fatalf("got FailedEvents for %v", nonces)
+	}
+
+	if pending := n.SendState.PendingMessages(chID); len(pending) != 2 {
+		t.Fatalf("got %d pending messages, want 2", len(pending))
+	}
+}
@@ -0,0 +1,178 @@
+package ningen
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/ningen/v3/states/member"
+	"github.com/diamondburned/ningen/v3/states/mute"
+	"github.com/pkg/errors"
+)
+
+// Snapshot is a dump of the caches that decide unread indicators, mutes and
+// member lists. It is written by DumpSnapshot to be attached to bug reports.
+type Snapshot struct {
+	TakenAt time.Time `json:"taken_at"`
+	// Scrubbed is true if names were left out of the snapshot.
+	Scrubbed bool       `json:"scrubbed"`
+	Caches   CacheSizes `json:"caches"`
+
+	Guilds          []GuildSnapshot   `json:"guilds"`
+	PrivateChannels []ChannelSnapshot `json:"private_channels"`
+	LocalMutes      mute.LocalMutes   `json:"local_mutes"`
+}
+
+// GuildSnapshot is the state of a guild in a Snapshot.
+type GuildSnapshot struct {
+	ID   discord.GuildID `json:"id"`
+	Name string          `json:"name,omitempty"`
+
+	Muted    bool                     `json:"muted"`
+	Unread   string                   `json:"unread"`
+	Settings gateway.UserGuildSetting `json:"settings"`
+
+	// Counts is nil if the approximate counts of the guild aren't known.
+	Counts      *member.Counts       `json:"counts,omitempty"`
+	MemberLists []MemberListSnapshot `json:"member_lists,omitempty"`
+
+	Channels []ChannelSnapshot `json:"channels"`
+}
+
+// ChannelSnapshot is the state of a channel in a Snapshot.
+type ChannelSnapshot struct {
+	ID       discord.ChannelID   `json:"id"`
+	Type     discord.ChannelType `json:"type"`
+	ParentID discord.ChannelID   `json:"parent_id,omitempty"`
+	Position int                 `json:"position"`
+	Name     string              `json:"name,omitempty"`
+	// Recipients is the number of recipients of a private channel.
+	Recipients int `json:"recipients,omitempty"`
+
+	LastMessageID discord.MessageID `json:"last_message_id,omitempty"`
+	// ReadState is nil if the channel has no read state.
+	ReadState   *gateway.ReadState `json:"read_state,omitempty"`
+	ReadVersion uint64             `json:"read_version"`
+
+	Muted  bool   `json:"muted"`
+	Unread string `json:"unread"`
+}
+
+// MemberListSnapshot is the metadata of a member list in a Snapshot. The
+// members themselves are never included.
+type MemberListSnapshot struct {
+	ID          string                         `json:"id"`
+	Passive     bool                           `json:"passive"`
+	MemberCount int                            `json:"member_count"`
+	OnlineCount int                            `json:"online_count"`
+	Items       int                            `json:"items"`
+	NilItems    int                            `json:"nil_items"`
+	Groups      []gateway.GuildMemberListGroup `json:"groups"`
+}
+
+// DumpSnapshot writes a Snapshot of the State as indented JSON. It is meant to
+// be attached to bug reports about wrong unread indicators or member lists.
+//
+// If scrub is true, the names of guilds and channels are left out. Messages,
+// members and user names are never included. IDs are kept, since read states
+// can't be matched against the channels without them.
+func (s *State) DumpSnapshot(w io.Writer, scrub bool) error {
+	snapshot := s.snapshot(scrub)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+
+	if err := enc.Encode(snapshot); err != nil {
+		return errors.Wrap(err, "cannot encode snapshot")
+	}
+
+	return nil
+}
+
+func (s *State) snapshot(scrub bool) Snapshot {
+	snapshot := Snapshot{
+		TakenAt:    time.Now(),
+		Scrubbed:   scrub,
+		Caches:     s.Diagnostics().Caches,
+		LocalMutes: s.MutedState.LocalMutes(),
+	}
+
+	guilds, _ := s.Cabinet.Guilds()
+	sort.Slice(guilds, func(i, j int) bool { return guilds[i].ID < guilds[j].ID })
+
+	for _, guild := range guilds {
+		g := GuildSnapshot{
+			ID:       guild.ID,
+			Muted:    s.MutedState.Guild(guild.ID, false),
+			Unread:   s.GuildIsUnread(guild.ID, GuildUnreadOpts{}).String(),
+			Settings: s.MutedState.GuildSettings(guild.ID),
+		}
+		if !scrub {
+			g.Name = guild.Name
+		}
+
+		if counts, ok := s.MemberState.ApproximateCounts(guild.ID); ok {
+			g.Counts = &counts
+		}
+
+		for _, list := range s.MemberState.MemberLists(guild.ID) {
+			l := MemberListSnapshot{
+				ID:          list.ID(),
+				Passive:     list.Passive(),
+				MemberCount: list.MemberCount(),
+				OnlineCount: list.OnlineCount(),
+				NilItems:    list.CountNil(),
+			}
+			list.ViewItems(func(items []gateway.GuildMemberListOpItem) {
+				l.Items = len(items)
+			})
+			list.ViewGroups(func(groups []gateway.GuildMemberListGroup) {
+				l.Groups = append([]gateway.GuildMemberListGroup(nil), groups...)
+			})
+			g.MemberLists = append(g.MemberLists, l)
+		}
+
+		chs, _ := s.Cabinet.Channels(guild.ID)
+		g.Channels = s.snapshotChannels(chs, scrub)
+
+		snapshot.Guilds = append(snapshot.Guilds, g)
+	}
+
+	privates, _ := s.Cabinet.PrivateChannels()
+	snapshot.PrivateChannels = s.snapshotChannels(privates, scrub)
+
+	return snapshot
+}
+
+func (s *State) snapshotChannels(chs []discord.Channel, scrub bool) []ChannelSnapshot {
+	snapshots := make([]ChannelSnapshot, len(chs))
+
+	for i, ch := range chs {
+		snapshot := ChannelSnapshot{
+			ID:            ch.ID,
+			Type:          ch.Type,
+			ParentID:      ch.ParentID,
+			Position:      ch.Position,
+			Recipients:    len(ch.DMRecipients),
+			LastMessageID: ch.LastMessageID,
+			ReadVersion:   s.ReadState.Version(ch.ID),
+			Muted:         s.MutedState.Channel(ch.ID),
+			Unread:        s.ChannelIsUnread(ch.ID, UnreadOpts{}).String(),
+		}
+		if !scrub {
+			snapshot.Name = ch.Name
+		}
+
+		if readState, ok := s.ReadState.Entry(ch.ID); ok {
+			snapshot.ReadState = &readState
+		}
+
+		snapshots[i] = snapshot
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].ID < snapshots[j].ID })
+	return snapshots
+}
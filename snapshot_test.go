@@ -0,0 +1,57 @@
+package ningen_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/diamondburned/ningen/v3"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestDumpSnapshot(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	var buf bytes.Buffer
+	if err := n.DumpSnapshot(&buf, false); err != nil {
+		t.Fatal("cannot dump snapshot:", err)
+	}
+	if !strings.Contains(buf.String(), "First Guild") {
+		t.Error("unscrubbed snapshot has no guild names")
+	}
+
+	buf.Reset()
+	if err := n.DumpSnapshot(&buf, true); err != nil {
+		t.Fatal("cannot dump scrubbed snapshot:", err)
+	}
+	if strings.Contains(buf.String(), "First Guild") {
+		t.Error("scrubbed snapshot has guild names")
+	}
+
+	var snapshot ningen.Snapshot
+	if err := json.Unmarshal(buf.Bytes(), &snapshot); err != nil {
+		t.Fatal("cannot decode snapshot:", err)
+	}
+
+	if !snapshot.Scrubbed {
+		t.Error("snapshot isn't marked as scrubbed")
+	}
+	if len(snapshot.Guilds) != 3 {
+		t.Fatalf("got %d guilds, want 3", len(snapshot.Guilds))
+	}
+
+	g := snapshot.Guilds[1]
+	if g.ID != 200000000000000002 || !g.Muted {
+		t.Errorf("got guild %d muted=%v, want the muted guild", g.ID, g.Muted)
+	}
+
+	if len(snapshot.Guilds[0].Channels) == 0 {
+		t.Fatal("got no channels in the first guild")
+	}
+	for _, ch := range snapshot.Guilds[0].Channels {
+		if ch.Name != "" {
+			t.Errorf("channel %d has name %q", ch.ID, ch.Name)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+// Package ban provides a paginated and cached guild ban list for moderation
+// UIs.
+package ban
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/state"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+	"github.com/diamondburned/ningen/v3/handlerrepo"
+	"github.com/pkg/errors"
+)
+
+// PageSize is the number of bans fetched per page. Discord allows up to 1000.
+var PageSize = 100
+
+// ErrMissingPermission is returned if the user cannot ban members in the
+// guild.
+var ErrMissingPermission = errors.New("missing ban members permission")
+
+// UpdateEvent is dispatched when the cached ban list of a guild changes.
+type UpdateEvent struct {
+	GuildID discord.GuildID
+}
+
+var _ gateway.Event = (*UpdateEvent)(nil)
+
+func (ev UpdateEvent) Op() ws.OpCode           { return -1 }
+func (ev UpdateEvent) EventType() ws.EventType { return "__ban.UpdateEvent" }
+
+type guildBans struct {
+	// bans is sorted by user ID, which is the order that Discord paginates
+	// bans in.
+	bans     []discord.Ban
+	complete bool
+}
+
+// search returns the index of the ban of the given user, or the index that it
+// would be inserted at.
+func (g *guildBans) search(userID discord.UserID) (int, bool) {
+	i := sort.Search(len(g.bans), func(i int) bool {
+		return g.bans[i].User.ID >= userID
+	})
+	return i, i < len(g.bans) && g.bans[i].User.ID == userID
+}
+
+// State caches the ban lists of guilds.
+type State struct {
+	mutex  sync.Mutex
+	state  *state.State
+	guilds map[discord.GuildID]*guildBans
+
+	// ordered dispatches UpdateEvents in order per guild.
+	ordered handlerrepo.Ordered
+}
+
+func NewState(state *state.State, r handlerrepo.AddHandler) *State {
+	banState := &State{
+		state:  state,
+		guilds: map[discord.GuildID]*guildBans{},
+	}
+
+	r.AddSyncHandler(func(*gateway.ReadyEvent) {
+		banState.mutex.Lock()
+		defer banState.mutex.Unlock()
+
+		banState.guilds = map[discord.GuildID]*guildBans{}
+	})
+
+	r.AddSyncHandler(func(ev *gateway.GuildBanAddEvent) {
+		banState.mutex.Lock()
+
+		g, ok := banState.guilds[ev.GuildID]
+		if !ok {
+			banState.mutex.Unlock()
+			return
+		}
+
+		i, found := g.search(ev.User.ID)
+		// Only insert the ban if it falls within the pages that we have, so
+		// the next page doesn't skip or duplicate it.
+		if found || (!g.complete && i == len(g.bans)) {
+			banState.mutex.Unlock()
+			return
+		}
+
+		g.bans = append(g.bans, discord.Ban{})
+		copy(g.bans[i+1:], g.bans[i:])
+		g.bans[i] = discord.Ban{User: ev.User}
+
+		banState.mutex.Unlock()
+
+		banState.dispatch(&UpdateEvent{GuildID: ev.GuildID})
+	})
+
+	r.AddSyncHandler(func(ev *gateway.GuildBanRemoveEvent) {
+		banState.remove(ev.GuildID, ev.User.ID)
+	})
+
+	return banState
+}
+
+// dispatch dispatches ev in the background; see handlerrepo.Ordered.
+func (s *State) dispatch(ev *UpdateEvent) {
+	s.ordered.Go(discord.Snowflake(ev.GuildID), func() {
+		s.state.Handler.Call(ev)
+	})
+}
+
+// Bans returns the cached bans of the given guild, sorted by user ID. The
+// returned boolean is true if all bans have been fetched.
+func (s *State) Bans(guildID discord.GuildID) ([]discord.Ban, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	g, ok := s.guilds[guildID]
+	if !ok {
+		return nil, false
+	}
+
+	return append([]discord.Ban(nil), g.bans...), g.complete
+}
+
+// FetchNextPage fetches the next page of bans of the given guild into the
+// cache and returns it. An empty page is returned if all bans have already
+// been fetched.
+func (s *State) FetchNextPage(guildID discord.GuildID) ([]discord.Ban, error) {
+	if err := s.assertCanBan(guildID); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	g, ok := s.guilds[guildID]
+	if !ok {
+		g = &guildBans{}
+		s.guilds[guildID] = g
+	}
+
+	if g.complete {
+		s.mutex.Unlock()
+		return nil, nil
+	}
+
+	var after discord.UserID
+	if len(g.bans) > 0 {
+		after = g.bans[len(g.bans)-1].User.ID
+	}
+
+	s.mutex.Unlock()
+
+	q := url.Values{}
+	q.Set("limit", strconv.Itoa(PageSize))
+	if after.IsValid() {
+		q.Set("after", after.String())
+	}
+
+	var page []discord.Ban
+
+	err := s.state.RequestJSON(
+		&page, "GET",
+		api.EndpointGuilds+guildID.String()+"/bans?"+q.Encode(),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot fetch bans")
+	}
+
+	s.mutex.Lock()
+
+	for _, ban := range page {
+		i, found := g.search(ban.User.ID)
+		if found {
+			g.bans[i] = ban
+			continue
+		}
+
+		g.bans = append(g.bans, discord.Ban{})
+		copy(g.bans[i+1:], g.bans[i:])
+		g.bans[i] = ban
+	}
+
+	g.complete = len(page) < PageSize
+
+	s.mutex.Unlock()
+
+	s.dispatch(&UpdateEvent{GuildID: guildID})
+
+	return page, nil
+}
+
+// Search returns the cached bans whose user's username or display name
+// contains the query, case-insensitively. Only fetched pages are searched.
+func (s *State) Search(guildID discord.GuildID, query string) []discord.Ban {
+	query = strings.ToLower(query)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	g, ok := s.guilds[guildID]
+	if !ok {
+		return nil
+	}
+
+	var matches []discord.Ban
+	for _, ban := range g.bans {
+		if strings.Contains(strings.ToLower(ban.User.Username), query) ||
+			strings.Contains(strings.ToLower(ban.User.DisplayName), query) {
+			matches = append(matches, ban)
+		}
+	}
+
+	return matches
+}
+
+// Unban unbans the given user and removes the ban from the cache.
+func (s *State) Unban(guildID discord.GuildID, userID discord.UserID, reason api.AuditLogReason) error {
+	if err := s.assertCanBan(guildID); err != nil {
+		return err
+	}
+
+	if err := s.state.Unban(guildID, userID, reason); err != nil {
+		return errors.Wrap(err, "cannot unban")
+	}
+
+	s.remove(guildID, userID)
+	return nil
+}
+
+func (s *State) remove(guildID discord.GuildID, userID discord.UserID) {
+	s.mutex.Lock()
+
+	g, ok := s.guilds[guildID]
+	if !ok {
+		s.mutex.Unlock()
+		return
+	}
+
+	i, found := g.search(userID)
+	if !found {
+		s.mutex.Unlock()
+		return
+	}
+
+	g.bans = append(g.bans[:i], g.bans[i+1:]...)
+
+	s.mutex.Unlock()
+
+	s.dispatch(&UpdateEvent{GuildID: guildID})
+}
+
+// CanBan returns true if the current user can ban members in the given guild.
+func (s *State) CanBan(guildID discord.GuildID) bool {
+	return s.assertCanBan(guildID) == nil
+}
+
+func (s *State) assertCanBan(guildID discord.GuildID) error {
+	me, err := s.state.Cabinet.Me()
+	if err != nil {
+		return errors.Wrap(err, "cannot get current user")
+	}
+
+	g, err := s.state.Cabinet.Guild(guildID)
+	if err != nil {
+		return errors.Wrap(err, "cannot get guild")
+	}
+
+	m, err := s.state.Cabinet.Member(guildID, me.ID)
+	if err != nil {
+		return errors.Wrap(err, "cannot get current member")
+	}
+
+	roles, err := s.state.Cabinet.Roles(guildID)
+	if err != nil {
+		return errors.Wrap(err, "cannot get roles")
+	}
+
+	perms := discord.CalcOverrides(*g, discord.Channel{}, *m, roles)
+	if !perms.Has(discord.PermissionBanMembers) {
+		return ErrMissingPermission
+	}
+
+	return nil
+}
+
+// Flush behaves like handlerrepo.Ordered.Flush for the state's events.
+func (s *State) Flush(ctx context.Context) error {
+	return s.ordered.Flush(ctx)
+}
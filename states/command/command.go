@@ -0,0 +1,276 @@
+// Package command fetches and caches the application commands that the user
+// can use, for implementing the slash command picker.
+package command
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/state"
+	"github.com/diamondburned/arikawa/v3/utils/httputil"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+	"github.com/diamondburned/ningen/v3/handlerrepo"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	gateway.OpUnmarshalers.Add(
+		func() ws.Event { return new(GuildApplicationCommandsUpdateEvent) },
+	)
+}
+
+// GuildApplicationCommandsUpdateEvent is a dispatch event for
+// GUILD_APPLICATION_COMMANDS_UPDATE. Discord sends it when the application
+// commands available in a guild change. It is undocumented.
+type GuildApplicationCommandsUpdateEvent struct {
+	GuildID       discord.GuildID   `json:"guild_id"`
+	ApplicationID discord.AppID     `json:"application_id"`
+	Version       discord.Snowflake `json:"version"`
+}
+
+// Op implements ws.Event.
+func (*GuildApplicationCommandsUpdateEvent) Op() ws.OpCode { return 0 }
+
+// EventType implements ws.Event.
+func (*GuildApplicationCommandsUpdateEvent) EventType() ws.EventType {
+	return "GUILD_APPLICATION_COMMANDS_UPDATE"
+}
+
+// Application is an application that provides commands.
+type Application struct {
+	ID   discord.AppID `json:"id"`
+	Name string        `json:"name"`
+	Icon string        `json:"icon,omitempty"`
+}
+
+// Index is the list of application commands usable in a guild.
+type Index struct {
+	Applications []Application     `json:"applications"`
+	Commands     []discord.Command `json:"application_commands"`
+}
+
+// State caches the application command indices of guilds. The index of the
+// null guild ID contains the commands usable in private channels.
+//
+// Indices are fetched and cached in the user's locale, so that the localized
+// names and descriptions of commands are available.
+type State struct {
+	mutex   sync.Mutex
+	state   *state.State
+	indices map[indexKey]*Index
+	locale  discord.Language
+}
+
+type indexKey struct {
+	guildID discord.GuildID
+	locale  discord.Language
+}
+
+func NewState(state *state.State, r handlerrepo.AddHandler) *State {
+	commandState := &State{
+		state:   state,
+		indices: map[indexKey]*Index{},
+	}
+
+	r.AddSyncHandler(func(r *gateway.ReadyEvent) {
+		commandState.mutex.Lock()
+		defer commandState.mutex.Unlock()
+
+		commandState.indices = map[indexKey]*Index{}
+		commandState.locale = ""
+
+		if r.UserSettings != nil {
+			commandState.locale = discord.Language(r.UserSettings.Locale)
+		}
+	})
+
+	r.AddSyncHandler(func(ev *gateway.UserSettingsUpdateEvent) {
+		if ev.Locale == "" {
+			return
+		}
+
+		commandState.mutex.Lock()
+		defer commandState.mutex.Unlock()
+
+		commandState.locale = discord.Language(ev.Locale)
+	})
+
+	r.AddSyncHandler(func(ev *GuildApplicationCommandsUpdateEvent) {
+		commandState.Invalidate(ev.GuildID)
+	})
+
+	r.AddSyncHandler(func(ev *gateway.GuildDeleteEvent) {
+		commandState.Invalidate(ev.ID)
+	})
+
+	return commandState
+}
+
+// Invalidate drops the cached indices of the guild, so that they are fetched
+// again the next time they're needed.
+func (s *State) Invalidate(guildID discord.GuildID) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for key := range s.indices {
+		if key.guildID == guildID {
+			delete(s.indices, key)
+		}
+	}
+}
+
+// Locale returns the user's locale, which is used for localizing commands. It
+// is taken from the user settings, falling back to the user's account locale.
+func (s *State) Locale() discord.Language {
+	s.mutex.Lock()
+	locale := s.locale
+	s.mutex.Unlock()
+
+	if locale == "" {
+		if me, err := s.state.Cabinet.Me(); err == nil {
+			locale = discord.Language(me.Locale)
+		}
+	}
+
+	return locale
+}
+
+// Index returns the application command index of the given guild in the
+// user's locale. It is fetched from the API if it isn't cached. If guildID is
+// 0, the index of the commands usable in private channels is returned.
+func (s *State) Index(guildID discord.GuildID) (*Index, error) {
+	key := indexKey{guildID, s.Locale()}
+
+	s.mutex.Lock()
+	index, ok := s.indices[key]
+	s.mutex.Unlock()
+
+	if ok {
+		return index, nil
+	}
+
+	endpoint := api.EndpointMe + "/application-command-index"
+	if guildID.IsValid() {
+		endpoint = api.EndpointGuilds + guildID.String() + "/application-command-index"
+	}
+
+	var opts []httputil.RequestOption
+	if key.locale != "" {
+		opts = append(opts, httputil.WithHeaders(http.Header{
+			"X-Discord-Locale": {string(key.locale)},
+		}))
+	}
+
+	index = &Index{}
+
+	if err := s.state.RequestJSON(index, "GET", endpoint, opts...); err != nil {
+		return nil, errors.Wrap(err, "cannot fetch application command index")
+	}
+
+	s.mutex.Lock()
+	s.indices[key] = index
+	s.mutex.Unlock()
+
+	return index, nil
+}
+
+// ApplicationCommands returns the application commands usable in the given
+// guild. See Index.
+func (s *State) ApplicationCommands(guildID discord.GuildID) ([]discord.Command, error) {
+	index, err := s.Index(guildID)
+	if err != nil {
+		return nil, err
+	}
+	return index.Commands, nil
+}
+
+// LocalizedName returns the name of the command in the given locale. The
+// canonical name is returned if the command isn't localized.
+func LocalizedName(command discord.Command, locale discord.Language) string {
+	if name := command.NameLocalizations[locale]; name != "" {
+		return name
+	}
+	if command.LocalizedName != "" {
+		return command.LocalizedName
+	}
+	return command.Name
+}
+
+// LocalizedDescription returns the description of the command in the given
+// locale. The canonical description is returned if the command isn't
+// localized.
+func LocalizedDescription(command discord.Command, locale discord.Language) string {
+	if desc := command.DescriptionLocalizations[locale]; desc != "" {
+		return desc
+	}
+	if command.LocalizedDescription != "" {
+		return command.LocalizedDescription
+	}
+	return command.Description
+}
+
+// Search returns up to limit chat input commands in the given guild whose
+// localized or canonical name contains the query, ignoring case. Commands
+// whose name starts with the query come first; the rest are sorted by their
+// localized name. A limit of 0 or less returns all matches.
+func (s *State) Search(guildID discord.GuildID, query string, limit int) ([]discord.Command, error) {
+	commands, err := s.ApplicationCommands(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	return search(commands, s.Locale(), query, limit), nil
+}
+
+func search(commands []discord.Command, locale discord.Language, query string, limit int) []discord.Command {
+
+	query = strings.ToLower(strings.TrimPrefix(query, "/"))
+
+	type match struct {
+		discord.Command
+		name   string
+		prefix bool
+	}
+
+	var matches []match
+
+	for _, command := range commands {
+		if command.Type != discord.ChatInputCommand {
+			continue
+		}
+
+		name := LocalizedName(command, locale)
+
+		i := strings.Index(strings.ToLower(name), query)
+		if j := strings.Index(strings.ToLower(command.Name), query); i == -1 || j == 0 {
+			i = j
+		}
+
+		if i > -1 {
+			matches = append(matches, match{command, name, i == 0})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].prefix != matches[j].prefix {
+			return matches[i].prefix
+		}
+		return matches[i].name < matches[j].name
+	})
+
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	results := make([]discord.Command, len(matches))
+	for i, match := range matches {
+		results[i] = match.Command
+	}
+
+	return results
+}
@@ -0,0 +1,47 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+func TestSearch(t *testing.T) {
+	commands := []discord.Command{
+		{Type: discord.ChatInputCommand, Name: "play"},
+		{Type: discord.ChatInputCommand, Name: "replay"},
+		{Type: discord.ChatInputCommand, Name: "skip", NameLocalizations: discord.StringLocales{"fr": "passer"}},
+		{Type: discord.MessageCommand, Name: "playlist"},
+	}
+
+	tests := []struct {
+		query  string
+		locale discord.Language
+		want   []string
+	}{
+		{"/pla", "", []string{"play", "replay"}},
+		{"pass", "fr", []string{"skip"}},
+		{"skip", "fr", []string{"skip"}},
+		{"pass", "", nil},
+	}
+
+	for _, test := range tests {
+		got := search(commands, test.locale, test.query, 0)
+
+		names := make([]string, 0, len(got))
+		for _, c := range got {
+			names = append(names, c.Name)
+		}
+
+		if len(names) != len(test.want) {
+			t.Errorf("%q (%s): got %v, want %v", test.query, test.locale, names, test.want)
+			continue
+		}
+		for i := range names {
+			if names[i] != test.want[i] {
+				t.Errorf("%q (%s): got %v, want %v", test.query, test.locale, names, test.want)
+				break
+			}
+		}
+	}
+}
@@ -2,6 +2,8 @@ package emoji
 
 import (
 	"sort"
+	"sync"
+	"time"
 
 	"github.com/diamondburned/arikawa/v3/discord"
 	"github.com/diamondburned/arikawa/v3/state/store"
@@ -9,8 +11,18 @@ import (
 )
 
 type State struct {
+	// OnError is called with the errors of saving the emoji usage in the
+	// background. If nil, the errors are ignored; SaveUsage still returns
+	// them.
+	OnError func(error)
+
 	cab        *store.Cabinet
 	emojiStore store.EmojiStore
+
+	usageMut  sync.Mutex
+	usage     map[string]*emojiUsage
+	usagePath string
+	saveTimer *time.Timer
 }
 
 type Guild struct {
@@ -20,7 +32,8 @@ type Guild struct {
 
 func NewState(cab *store.Cabinet) *State {
 	return &State{
-		cab: cab,
+		cab:   cab,
+		usage: make(map[string]*emojiUsage),
 	}
 }
 
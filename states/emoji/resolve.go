@@ -0,0 +1,141 @@
+package emoji
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// Candidate is a custom emoji that a name may refer to.
+type Candidate struct {
+	discord.Emoji
+	GuildID discord.GuildID
+}
+
+// Resolve returns the custom emoji that :name: refers to when sent in the given
+// guild, along with the other usable emojis with the same name. The choice is
+// deterministic: emojis from preferGuild come first, then the most used ones
+// according to RecordUsage, then the oldest ones. Pickers should list
+// duplicate names in the same order so that the emoji they display is the one
+// that gets sent.
+//
+// Only emojis usable by the user are considered, so without Nitro, only the
+// non-animated emojis of preferGuild are. False is returned if no usable emoji
+// has the given name.
+func (s *State) Resolve(name string, preferGuild discord.GuildID) (Candidate, []Candidate, bool) {
+	candidates := s.candidates(name, preferGuild)
+	if len(candidates) == 0 {
+		return Candidate{}, nil, false
+	}
+
+	s.usageMut.Lock()
+	counts := make([]int, len(candidates))
+	for i, c := range candidates {
+		if usage, ok := s.usage[emojiKey(c.Emoji)]; ok {
+			counts[i] = usage.count
+		}
+	}
+	s.usageMut.Unlock()
+
+	sort.Sort(byPreference{candidates, counts, preferGuild})
+
+	return candidates[0], candidates[1:], true
+}
+
+func (s *State) candidates(name string, preferGuild discord.GuildID) []Candidate {
+	var guilds []discord.GuildID
+
+	nitro := s.HasNitro()
+	if nitro {
+		gs, err := s.cab.Guilds()
+		if err != nil {
+			return nil
+		}
+		guilds = make([]discord.GuildID, len(gs))
+		for i, g := range gs {
+			guilds[i] = g.ID
+		}
+	} else if preferGuild.IsValid() {
+		guilds = []discord.GuildID{preferGuild}
+	}
+
+	var candidates []Candidate
+
+	for _, guildID := range guilds {
+		emojis, err := s.cab.Emojis(guildID)
+		if err != nil {
+			continue
+		}
+
+		for _, e := range emojis {
+			if e.Name != name || !e.Available || (e.Animated && !nitro) {
+				continue
+			}
+			candidates = append(candidates, Candidate{Emoji: e, GuildID: guildID})
+		}
+	}
+
+	return candidates
+}
+
+type byPreference struct {
+	candidates  []Candidate
+	counts      []int
+	preferGuild discord.GuildID
+}
+
+func (b byPreference) Len() int { return len(b.candidates) }
+
+func (b byPreference) Swap(i, j int) {
+	b.candidates[i], b.candidates[j] = b.candidates[j], b.candidates[i]
+	b.counts[i], b.counts[j] = b.counts[j], b.counts[i]
+}
+
+func (b byPreference) Less(i, j int) bool {
+	ci, cj := b.candidates[i], b.candidates[j]
+
+	if pi, pj := ci.GuildID == b.preferGuild, cj.GuildID == b.preferGuild; pi != pj {
+		return pi
+	}
+	if b.counts[i] != b.counts[j] {
+		return b.counts[i] > b.counts[j]
+	}
+	return ci.ID < cj.ID
+}
+
+var nameRegex = regexp.MustCompile(`(<a?)?:([\w~]+):(\d+>)?`)
+
+// ReplaceNames replaces every :name: in the message content with the custom
+// emoji that Resolve picks for it, so that the message can be sent as-is.
+// Names that don't resolve, emojis that are already formatted and anything
+// inside code are left untouched.
+func (s *State) ReplaceNames(content string, guildID discord.GuildID) string {
+	if !strings.Contains(content, ":") {
+		return content
+	}
+
+	// Every odd part is inside a code span or block.
+	parts := strings.Split(content, "`")
+	for i := 0; i < len(parts); i += 2 {
+		parts[i] = nameRegex.ReplaceAllStringFunc(parts[i], func(match string) string {
+			m := nameRegex.FindStringSubmatch(match)
+			if m[1] != "" || m[3] != "" {
+				return match
+			}
+
+			c, _, ok := s.Resolve(m[2], guildID)
+			if !ok {
+				return match
+			}
+
+			if c.Animated {
+				return "<a:" + c.Name + ":" + c.ID.String() + ">"
+			}
+			return "<:" + c.Name + ":" + c.ID.String() + ">"
+		})
+	}
+
+	return strings.Join(parts, "`")
+}
@@ -0,0 +1,52 @@
+package emoji
+
+import (
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/state/store/defaultstore"
+)
+
+func TestResolve(t *testing.T) {
+	cab := defaultstore.New()
+	cab.MyselfSet(discord.User{ID: 1, Nitro: discord.NitroFull}, false)
+
+	for _, guildID := range []discord.GuildID{10, 20} {
+		cab.GuildSet(&discord.Guild{ID: guildID}, false)
+	}
+	cab.EmojiSet(10, []discord.Emoji{
+		{ID: 102, Name: "smile", Available: true},
+	}, false)
+	cab.EmojiSet(20, []discord.Emoji{
+		{ID: 201, Name: "smile", Available: true, Animated: true},
+		{ID: 200, Name: "gone", Available: false},
+	}, false)
+
+	s := NewState(cab)
+
+	c, alts, ok := s.Resolve("smile", 10)
+	if !ok || c.ID != 102 || len(alts) != 1 || alts[0].ID != 201 {
+		t.Fatalf("preferred guild: got %v %v %v", c.ID, alts, ok)
+	}
+
+	c, _, _ = s.Resolve("smile", 0)
+	if c.ID != 102 {
+		t.Fatalf("no preference: got %v, want the oldest emoji", c.ID)
+	}
+
+	s.RecordUsage(discord.Emoji{ID: 201, Name: "smile"})
+	c, _, _ = s.Resolve("smile", 0)
+	if c.ID != 201 {
+		t.Fatalf("after usage: got %v, want the used emoji", c.ID)
+	}
+
+	if _, _, ok := s.Resolve("gone", 20); ok {
+		t.Fatal("unavailable emoji resolved")
+	}
+
+	got := s.ReplaceNames(":smile: `:smile:` <:smile:102> :nope:", 10)
+	want := "<:smile:102> `:smile:` <:smile:102> :nope:"
+	if got != want {
+		t.Fatalf("ReplaceNames: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,125 @@
+package emoji
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/ningen/v3/internal/fuzzy"
+)
+
+// Search searches the names of the custom emojis that the user can use in the
+// given guild, ignoring case and the colons around the query. Exact matches
+// come first, then names that start with the query, then names with a word
+// that starts with it, then names that contain it, then names that contain
+// its characters in order. Equal matches are sorted by the current guild
+// first, then by RecordUsage, then by name.
+//
+// At most limit emojis are returned, or all of them if limit is 0 or less.
+// They are grouped by guild, with the current guild first and the other
+// guilds in the order of their best match. Like Resolve, only the
+// non-animated emojis of the current guild are searched without Nitro.
+func (s *State) Search(query string, guildID discord.GuildID, limit int) []Guild {
+	query = strings.ToLower(strings.Trim(strings.TrimSpace(query), ":"))
+	if query == "" {
+		return nil
+	}
+
+	var guilds []discord.Guild
+
+	nitro := s.HasNitro()
+	if nitro {
+		gs, err := s.cab.Guilds()
+		if err != nil {
+			return nil
+		}
+		guilds = gs
+	} else if guildID.IsValid() {
+		g, err := s.cab.Guild(guildID)
+		if err != nil {
+			return nil
+		}
+		guilds = []discord.Guild{*g}
+	}
+
+	type result struct {
+		emoji discord.Emoji
+		guild int // index into guilds
+		match fuzzy.Match
+		count int
+		name  string
+	}
+
+	var results []result
+
+	s.usageMut.Lock()
+	for i, g := range guilds {
+		emojis, err := s.cab.Emojis(g.ID)
+		if err != nil {
+			continue
+		}
+
+		for _, e := range emojis {
+			if !e.Available || (e.Animated && !nitro) {
+				continue
+			}
+
+			m := fuzzy.MatchName(query, e.Name, "_")
+			if m == fuzzy.None {
+				continue
+			}
+
+			r := result{
+				emoji: e,
+				guild: i,
+				match: m,
+				name:  strings.ToLower(e.Name),
+			}
+			if usage, ok := s.usage[emojiKey(e)]; ok {
+				r.count = usage.count
+			}
+
+			results = append(results, r)
+		}
+	}
+	s.usageMut.Unlock()
+
+	sort.Slice(results, func(i, j int) bool {
+		ri, rj := results[i], results[j]
+
+		if ri.match != rj.match {
+			return ri.match > rj.match
+		}
+		if ci, cj := guilds[ri.guild].ID == guildID, guilds[rj.guild].ID == guildID; ci != cj {
+			return ci
+		}
+		if ri.count != rj.count {
+			return ri.count > rj.count
+		}
+		if ri.name != rj.name {
+			return ri.name < rj.name
+		}
+		return ri.emoji.ID < rj.emoji.ID
+	})
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	// Group the results in the order of each guild's best match.
+	var grouped []Guild
+	groupOf := make(map[int]int)
+
+	for _, r := range results {
+		ix, ok := groupOf[r.guild]
+		if !ok {
+			ix = len(grouped)
+			groupOf[r.guild] = ix
+			grouped = append(grouped, Guild{Guild: guilds[r.guild]})
+		}
+		grouped[ix].Emojis = append(grouped[ix].Emojis, r.emoji)
+	}
+
+	PutGuildFirst(grouped, guildID)
+	return grouped
+}
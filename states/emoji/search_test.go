@@ -0,0 +1,79 @@
+package emoji
+
+import (
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/state/store/defaultstore"
+)
+
+func TestSearch(t *testing.T) {
+	cab := defaultstore.New()
+	cab.MyselfSet(discord.User{ID: 1, Nitro: discord.NitroFull}, false)
+	cab.GuildSet(&discord.Guild{ID: 10}, false)
+	cab.GuildSet(&discord.Guild{ID: 20}, false)
+	cab.EmojiSet(10, []discord.Emoji{
+		{ID: 11, Name: "catjam", Animated: true, Available: true},
+		{ID: 12, Name: "happy_cat", Available: true},
+		{ID: 13, Name: "dog", Available: true},
+		{ID: 14, Name: "cat_gone", Available: false},
+	}, false)
+	cab.EmojiSet(20, []discord.Emoji{
+		{ID: 21, Name: "cat", Available: true},
+		{ID: 22, Name: "cathy", Available: true},
+		{ID: 23, Name: "scatter", Available: true},
+	}, false)
+
+	s := NewState(cab)
+	s.RecordUsage(discord.Emoji{ID: 22, Name: "cathy"})
+
+	ids := func(guilds []Guild) [][]discord.EmojiID {
+		var ids [][]discord.EmojiID
+		for _, g := range guilds {
+			var group []discord.EmojiID
+			for _, e := range g.Emojis {
+				group = append(group, e.ID)
+			}
+			ids = append(ids, group)
+		}
+		return ids
+	}
+
+	assert := func(got []Guild, want [][]discord.EmojiID) {
+		t.Helper()
+
+		gotIDs := ids(got)
+		if len(gotIDs) != len(want) {
+			t.Fatalf("got groups %v, want %v", gotIDs, want)
+		}
+		for i := range want {
+			if len(gotIDs[i]) != len(want[i]) {
+				t.Fatalf("got groups %v, want %v", gotIDs, want)
+			}
+			for j := range want[i] {
+				if gotIDs[i][j] != want[i][j] {
+					t.Fatalf("got groups %v, want %v", gotIDs, want)
+				}
+			}
+		}
+	}
+
+	// The exact match in the other guild comes first, but the current guild's
+	// group is still first.
+	results := s.Search(":Cat", 10, 0)
+	assert(results, [][]discord.EmojiID{{11, 12}, {21, 22, 23}})
+	if results[0].ID != 10 {
+		t.Errorf("first group is guild %d, want the current guild", results[0].ID)
+	}
+
+	// The limit keeps the best matches across guilds.
+	assert(s.Search("cat", 10, 3), [][]discord.EmojiID{{11}, {21, 22}})
+
+	// Without Nitro, only the current guild's static emojis are searched.
+	cab.MyselfSet(discord.User{ID: 1}, true)
+	assert(s.Search("cat", 10, 0), [][]discord.EmojiID{{12}})
+
+	if results := s.Search("::", 10, 0); results != nil {
+		t.Errorf("got results %v for an empty query", results)
+	}
+}
@@ -0,0 +1,85 @@
+package emoji
+
+import (
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/pkg/errors"
+)
+
+// moreEmoji is the feature of guilds that have extra emoji slots regardless
+// of their boost level.
+const moreEmoji discord.GuildFeature = "MORE_EMOJI"
+
+// Slots is the number of emoji or sticker slots that a guild uses out of the
+// slots that it has.
+type Slots struct {
+	Used int
+	Max  int
+}
+
+// Free returns the number of slots left. It is 0 if the guild uses more
+// slots than it has, which happens when it loses boosts.
+func (s Slots) Free() int {
+	if s.Used >= s.Max {
+		return 0
+	}
+	return s.Max - s.Used
+}
+
+// GuildSlots is the usage of a guild's static and animated emoji slots, which
+// are counted separately.
+type GuildSlots struct {
+	Static   Slots
+	Animated Slots
+}
+
+// MaxEmojis returns the number of static emojis that the guild can have, which
+// is also the number of animated emojis that it can have.
+func MaxEmojis(g *discord.Guild) int {
+	max := 50
+	switch g.NitroBoost {
+	case discord.NitroLevel1:
+		max = 100
+	case discord.NitroLevel2:
+		max = 150
+	case discord.NitroLevel3:
+		max = 250
+	}
+
+	for _, feature := range g.Features {
+		if feature == moreEmoji && max < 200 {
+			max = 200
+		}
+	}
+
+	return max
+}
+
+// GuildSlots returns the emoji slot usage of the given guild. It follows the
+// cabinet, so it changes as the guild's boost level and emojis are updated.
+func (s *State) GuildSlots(guildID discord.GuildID) (GuildSlots, error) {
+	g, err := s.cab.Guild(guildID)
+	if err != nil {
+		return GuildSlots{}, errors.Wrap(err, "Failed to get guild")
+	}
+
+	emojis, err := s.cab.Emojis(guildID)
+	if err != nil {
+		return GuildSlots{}, errors.Wrap(err, "Failed to get emojis")
+	}
+
+	max := MaxEmojis(g)
+	slots := GuildSlots{
+		Static:   Slots{Max: max},
+		Animated: Slots{Max: max},
+	}
+
+	for _, e := range emojis {
+		if e.Animated {
+			slots.Animated.Used++
+		} else {
+			slots.Static.Used++
+		}
+	}
+
+	return slots, nil
+}
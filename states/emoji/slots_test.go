@@ -0,0 +1,42 @@
+package emoji
+
+import (
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/state/store/defaultstore"
+)
+
+func TestGuildSlots(t *testing.T) {
+	cab := defaultstore.New()
+	cab.GuildSet(&discord.Guild{ID: 10}, false)
+	cab.EmojiSet(10, []discord.Emoji{
+		{ID: 1}, {ID: 2}, {ID: 3, Animated: true},
+	}, false)
+
+	s := NewState(cab)
+
+	slots, err := s.GuildSlots(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := GuildSlots{Static: Slots{Used: 2, Max: 50}, Animated: Slots{Used: 1, Max: 50}}
+	if slots != want {
+		t.Fatalf("got slots %+v, want %+v", slots, want)
+	}
+
+	// Boosting the guild adds slots.
+	cab.GuildSet(&discord.Guild{ID: 10, NitroBoost: discord.NitroLevel2}, true)
+
+	slots, err = s.GuildSlots(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slots.Static.Max != 150 || slots.Static.Free() != 148 {
+		t.Fatalf("got slots %+v after boosting", slots)
+	}
+
+	if free := (Slots{Used: 60, Max: 50}).Free(); free != 0 {
+		t.Fatalf("got %d free slots over the limit", free)
+	}
+}
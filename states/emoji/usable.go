@@ -0,0 +1,131 @@
+package emoji
+
+import (
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// Usability describes whether the user can use an emoji and, if not, why.
+type Usability uint8
+
+const (
+	// Usable means that the emoji can be used.
+	Usable Usability = iota
+	// Unavailable means that the emoji's guild lost the Server Boosts needed
+	// for it.
+	Unavailable
+	// RoleLocked means that the emoji is restricted to roles that the user
+	// doesn't have.
+	RoleLocked
+	// NeedsNitro means that the emoji is from another guild, which requires
+	// Nitro.
+	NeedsNitro
+	// AnimatedNeedsNitro means that the emoji is animated, which requires
+	// Nitro.
+	AnimatedNeedsNitro
+	// ExternalDenied means that the channel doesn't allow emojis from other
+	// guilds.
+	ExternalDenied
+)
+
+// String returns a short explanation of the usability that can be shown in a
+// tooltip.
+func (u Usability) String() string {
+	switch u {
+	case Usable:
+		return "Usable"
+	case Unavailable:
+		return "This emoji is unavailable because the server lost its boosts"
+	case RoleLocked:
+		return "This emoji is restricted to roles you don't have"
+	case NeedsNitro:
+		return "Using emojis from other servers requires Nitro"
+	case AnimatedNeedsNitro:
+		return "Using animated emojis requires Nitro"
+	case ExternalDenied:
+		return "This channel doesn't allow emojis from other servers"
+	default:
+		return "Unknown"
+	}
+}
+
+// Usability returns whether the user can use the given custom emoji from the
+// given guild in the given channel. Checks that need data missing from the
+// state, such as the user's member, are skipped.
+func (s *State) Usability(e discord.Emoji, emojiGuildID discord.GuildID, chID discord.ChannelID) Usability {
+	if !e.IsCustom() {
+		return Usable
+	}
+
+	if !e.Available {
+		return Unavailable
+	}
+
+	me, err := s.cab.Me()
+	if err != nil {
+		return Usable
+	}
+
+	if len(e.RoleIDs) > 0 && !s.hasAnyRole(emojiGuildID, me.ID, e.RoleIDs) {
+		return RoleLocked
+	}
+
+	nitro := me.Nitro != discord.NoUserNitro
+
+	var chGuildID discord.GuildID
+	ch, err := s.cab.Channel(chID)
+	if err == nil {
+		chGuildID = ch.GuildID
+	}
+
+	if emojiGuildID != chGuildID {
+		if !nitro {
+			return NeedsNitro
+		}
+		if ch != nil && chGuildID.IsValid() && !s.canUseExternal(ch, me.ID) {
+			return ExternalDenied
+		}
+	}
+
+	if e.Animated && !nitro {
+		return AnimatedNeedsNitro
+	}
+
+	return Usable
+}
+
+func (s *State) hasAnyRole(guildID discord.GuildID, userID discord.UserID, roleIDs []discord.RoleID) bool {
+	m, err := s.cab.Member(guildID, userID)
+	if err != nil {
+		return true
+	}
+
+	for _, roleID := range roleIDs {
+		for _, myRoleID := range m.RoleIDs {
+			if roleID == myRoleID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (s *State) canUseExternal(ch *discord.Channel, userID discord.UserID) bool {
+	g, err := s.cab.Guild(ch.GuildID)
+	if err != nil {
+		return true
+	}
+
+	m, err := s.cab.Member(ch.GuildID, userID)
+	if err != nil {
+		return true
+	}
+
+	roles, err := s.cab.Roles(ch.GuildID)
+	if err != nil {
+		return true
+	}
+
+	perms := discord.CalcOverrides(*g, *ch, *m, roles)
+	return perms.Has(discord.PermissionUseExternalEmojis)
+}
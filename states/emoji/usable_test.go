@@ -0,0 +1,39 @@
+package emoji
+
+import (
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/state/store/defaultstore"
+)
+
+func TestUsability(t *testing.T) {
+	cab := defaultstore.New()
+	cab.MyselfSet(discord.User{ID: 1}, false)
+	cab.GuildSet(&discord.Guild{ID: 10}, false)
+	cab.ChannelSet(&discord.Channel{ID: 100, GuildID: 10}, false)
+	cab.MemberSet(10, &discord.Member{User: discord.User{ID: 1}, RoleIDs: []discord.RoleID{11}}, false)
+
+	s := NewState(cab)
+
+	tests := []struct {
+		name    string
+		emoji   discord.Emoji
+		guildID discord.GuildID
+		want    Usability
+	}{
+		{"same guild", discord.Emoji{ID: 1, Available: true}, 10, Usable},
+		{"unicode", discord.Emoji{Name: "🙂"}, 0, Usable},
+		{"unavailable", discord.Emoji{ID: 1}, 10, Unavailable},
+		{"role", discord.Emoji{ID: 1, Available: true, RoleIDs: []discord.RoleID{11}}, 10, Usable},
+		{"role locked", discord.Emoji{ID: 1, Available: true, RoleIDs: []discord.RoleID{12}}, 10, RoleLocked},
+		{"external", discord.Emoji{ID: 1, Available: true}, 20, NeedsNitro},
+		{"animated", discord.Emoji{ID: 1, Available: true, Animated: true}, 10, AnimatedNeedsNitro},
+	}
+
+	for _, test := range tests {
+		if got := s.Usability(test.emoji, test.guildID, 100); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package emoji
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/ningen/v3/readyextra"
+	"github.com/pkg/errors"
+)
+
+// UsageSaveDelay is the delay after RecordUsage before the usage is saved to
+// the file set using SetUsagePath, so that bursts of usage are saved once.
+var UsageSaveDelay = 2 * time.Second
+
+// Usage is how often and how recently an emoji was used.
+type Usage struct {
+	Emoji    discord.Emoji `json:"emoji"`
+	Count    int           `json:"count"`
+	LastUsed time.Time     `json:"last_used"`
+}
+
+type emojiUsage struct {
+	emoji    discord.Emoji
+	count    int
+	lastUsed time.Time
+}
+
+// emojiKey returns the key that identifies the emoji regardless of its other
+// fields: the ID for custom emojis, the name for Unicode emojis.
+func emojiKey(e discord.Emoji) string {
+	if e.IsCustom() {
+		return e.ID.String()
+	}
+	return e.Name
+}
+
+// SameEmoji returns true if both emojis refer to the same emoji.
+func SameEmoji(e1, e2 discord.Emoji) bool {
+	return emojiKey(e1) == emojiKey(e2)
+}
+
+// RecordUsage records that the current user has used the given emoji, e.g.
+// by reacting with it. The usage is used by FrequentlyUsed.
+func (s *State) RecordUsage(e discord.Emoji) {
+	s.usageMut.Lock()
+	defer s.usageMut.Unlock()
+
+	key := emojiKey(e)
+
+	usage, ok := s.usage[key]
+	if !ok {
+		usage = &emojiUsage{}
+		s.usage[key] = usage
+	}
+
+	usage.emoji = e
+	usage.count++
+	usage.lastUsed = time.Now()
+
+	s.scheduleSave()
+}
+
+// FrequentlyUsed returns up to limit emojis recorded by RecordUsage, most used
+// first. Ties are broken by the most recently used. A limit of 0 or less
+// returns all of them.
+func (s *State) FrequentlyUsed(limit int) []discord.Emoji {
+	s.usageMut.Lock()
+
+	usages := make([]*emojiUsage, 0, len(s.usage))
+	for _, usage := range s.usage {
+		usages = append(usages, usage)
+	}
+
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].count != usages[j].count {
+			return usages[i].count > usages[j].count
+		}
+		return usages[i].lastUsed.After(usages[j].lastUsed)
+	})
+
+	if limit > 0 && len(usages) > limit {
+		usages = usages[:limit]
+	}
+
+	emojis := make([]discord.Emoji, len(usages))
+	for i, usage := range usages {
+		emojis[i] = usage.emoji
+	}
+
+	s.usageMut.Unlock()
+
+	return emojis
+}
+
+// Usages returns the usage of every emoji recorded by RecordUsage or seeded
+// using SeedUsage, in no particular order.
+func (s *State) Usages() []Usage {
+	s.usageMut.Lock()
+	defer s.usageMut.Unlock()
+
+	usages := make([]Usage, 0, len(s.usage))
+	for _, usage := range s.usage {
+		usages = append(usages, Usage{
+			Emoji:    usage.emoji,
+			Count:    usage.count,
+			LastUsed: usage.lastUsed,
+		})
+	}
+
+	return usages
+}
+
+// SeedUsage merges the given usages into the recorded ones, such as the ones
+// decoded from the emoji usage of the user settings, which Discord keeps
+// across clients. For each emoji, the higher count and the later time are
+// kept, so seeding the same usages twice changes nothing.
+func (s *State) SeedUsage(usages []Usage) {
+	s.usageMut.Lock()
+	defer s.usageMut.Unlock()
+
+	s.seedUsage(usages)
+	s.scheduleSave()
+}
+
+// SeedSettingsUsage seeds the usage using SeedUsage from the emoji usage of
+// the user settings, such as the one in the Ready extras. The names of custom
+// emojis are looked up in the cabinet.
+func (s *State) SeedSettingsUsage(settings map[string]readyextra.EmojiUsage) {
+	if len(settings) == 0 {
+		return
+	}
+
+	usages := make([]Usage, 0, len(settings))
+	for key, u := range settings {
+		emoji := discord.Emoji{Name: key}
+		if id, err := discord.ParseSnowflake(key); err == nil {
+			emoji = s.customEmoji(discord.EmojiID(id))
+		}
+
+		usages = append(usages, Usage{
+			Emoji:    emoji,
+			Count:    u.TotalUses,
+			LastUsed: u.LastUsed(),
+		})
+	}
+
+	s.SeedUsage(usages)
+}
+
+// customEmoji returns the custom emoji with the given ID from any guild in the
+// cabinet, or an emoji with only the ID if it isn't found.
+func (s *State) customEmoji(id discord.EmojiID) discord.Emoji {
+	guilds, err := s.cab.Guilds()
+	if err != nil {
+		return discord.Emoji{ID: id}
+	}
+
+	for _, g := range guilds {
+		if e, err := s.cab.Emoji(g.ID, id); err == nil {
+			return *e
+		}
+	}
+
+	return discord.Emoji{ID: id}
+}
+
+// seedUsage is SeedUsage without saving. s.usageMut must be held.
+func (s *State) seedUsage(usages []Usage) {
+	for _, u := range usages {
+		key := emojiKey(u.Emoji)
+
+		usage, ok := s.usage[key]
+		if !ok {
+			usage = &emojiUsage{emoji: u.Emoji}
+			s.usage[key] = usage
+		}
+
+		if u.Count > usage.count {
+			usage.count = u.Count
+		}
+		if u.LastUsed.After(usage.lastUsed) {
+			usage.lastUsed = u.LastUsed
+		}
+	}
+}
+
+// SetUsagePath sets the file that the emoji usage is persisted to. The usage
+// in the file is loaded right away and merged with the recorded usage, and
+// the file is rewritten UsageSaveDelay after the usage changes. The file
+// should be per account, such as in a directory named after the user ID under
+// os.UserConfigDir. A file that doesn't exist yet isn't an error. An empty
+// path stops persisting the usage.
+func (s *State) SetUsagePath(path string) error {
+	var usages []Usage
+
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "failed to read emoji usage")
+		}
+		if len(b) > 0 {
+			if err := json.Unmarshal(b, &usages); err != nil {
+				return errors.Wrap(err, "failed to decode emoji usage")
+			}
+		}
+	}
+
+	s.usageMut.Lock()
+	defer s.usageMut.Unlock()
+
+	s.usagePath = path
+	s.seedUsage(usages)
+
+	return nil
+}
+
+// SaveUsage writes the emoji usage to the file set using SetUsagePath right
+// away, such as before the application exits. It does nothing if there is no
+// file.
+func (s *State) SaveUsage() error {
+	s.usageMut.Lock()
+	path := s.usagePath
+	if s.saveTimer != nil {
+		s.saveTimer.Stop()
+		s.saveTimer = nil
+	}
+	s.usageMut.Unlock()
+
+	if path == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(s.Usages())
+	if err != nil {
+		return errors.Wrap(err, "failed to encode emoji usage")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrap(err, "failed to create emoji usage directory")
+	}
+
+	// Write to a temporary file first, so that a crash doesn't leave a
+	// truncated file behind. The name is unique, so that a save in the
+	// background doesn't write over a save of SaveUsage.
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "failed to create emoji usage file")
+	}
+
+	_, err = f.Write(b)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return errors.Wrap(err, "failed to write emoji usage")
+	}
+
+	return nil
+}
+
+// scheduleSave saves the usage after UsageSaveDelay unless a save is already
+// scheduled. s.usageMut must be held.
+func (s *State) scheduleSave() {
+	if s.usagePath == "" || s.saveTimer != nil {
+		return
+	}
+
+	s.saveTimer = time.AfterFunc(UsageSaveDelay, func() {
+		if err := s.SaveUsage(); err != nil && s.OnError != nil {
+			s.OnError(err)
+		}
+	})
+}
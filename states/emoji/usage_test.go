@@ -0,0 +1,79 @@
+package emoji
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/state/store/defaultstore"
+	"github.com/diamondburned/ningen/v3/readyextra"
+)
+
+func TestUsagePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "1", "emoji_usage.json")
+
+	thumbs := discord.Emoji{Name: "👍"}
+	custom := discord.Emoji{ID: 20, Name: "custom"}
+	heart := discord.Emoji{Name: "❤️"}
+
+	s := NewState(defaultstore.New())
+	if err := s.SetUsagePath(path); err != nil {
+		t.Fatal("missing file:", err)
+	}
+
+	s.RecordUsage(thumbs)
+	s.RecordUsage(custom)
+	s.RecordUsage(custom)
+
+	// Seeded usage only raises the counts.
+	s.SeedUsage([]Usage{
+		{Emoji: thumbs, Count: 1, LastUsed: time.Unix(0, 0)},
+		{Emoji: heart, Count: 5, LastUsed: time.Now().Add(-time.Hour)},
+	})
+
+	if err := s.SaveUsage(); err != nil {
+		t.Fatal("save:", err)
+	}
+
+	loaded := NewState(defaultstore.New())
+	if err := loaded.SetUsagePath(path); err != nil {
+		t.Fatal("load:", err)
+	}
+
+	got := loaded.FrequentlyUsed(0)
+	want := []discord.Emoji{heart, custom, thumbs}
+	if len(got) != len(want) {
+		t.Fatalf("got %d emojis, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !SameEmoji(got[i], want[i]) {
+			t.Errorf("emoji %d is %q, want %q", i, got[i].Name, want[i].Name)
+		}
+	}
+}
+
+func TestSeedSettingsUsage(t *testing.T) {
+	cab := defaultstore.New()
+	cab.GuildSet(&discord.Guild{ID: 10}, false)
+	cab.EmojiSet(10, []discord.Emoji{{ID: 20, Name: "custom"}}, false)
+
+	s := NewState(cab)
+	s.RecordUsage(discord.Emoji{Name: "👍"})
+
+	s.SeedSettingsUsage(map[string]readyextra.EmojiUsage{
+		"20": {TotalUses: 4, RecentUses: []discord.UnixMsTimestamp{1000}},
+		"👍":  {TotalUses: 2},
+	})
+
+	got := s.FrequentlyUsed(0)
+	if len(got) != 2 {
+		t.Fatalf("got %d emojis, want 2", len(got))
+	}
+	if got[0].ID != 20 || got[0].Name != "custom" {
+		t.Errorf("first emoji is %+v, want the custom emoji", got[0])
+	}
+	if got[1].Name != "👍" {
+		t.Errorf("second emoji is %+v, want 👍", got[1])
+	}
+}
@@ -9,25 +9,34 @@ import (
 	"github.com/diamondburned/ningen/v3/handlerrepo"
 )
 
-// State contains additional guild states that are only available on join.
+// State contains additional guild states that are only available on join, as
+// well as the guild metadata for server headers.
 type State struct {
 	mutex sync.RWMutex
 	joins map[discord.GuildID]time.Time
+	infos map[discord.GuildID]Info
 }
 
 func NewState(h handlerrepo.AddHandler) *State {
-	s := &State{}
+	s := &State{
+		infos: map[discord.GuildID]Info{},
+	}
 
 	h.AddSyncHandler(func(r *gateway.ReadyEvent) {
 		s.mutex.Lock()
 		defer s.mutex.Unlock()
 
 		s.joins = make(map[discord.GuildID]time.Time, len(r.Guilds))
+		s.infos = make(map[discord.GuildID]Info, len(r.Guilds))
+
 		for _, guild := range r.Guilds {
 			s.joins[guild.ID] = guild.Joined.Time()
+			s.infos[guild.ID] = infoFromGuild(&guild.Guild)
 		}
 	})
 
+	s.addInfoHandlers(h)
+
 	return s
 }
 
@@ -0,0 +1,106 @@
+package guild
+
+import (
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/ningen/v3/handlerrepo"
+)
+
+// Info is the guild metadata shown in the server header of the official
+// client, such as the banner and the vanity invite.
+type Info struct {
+	// VanityURLCode is the code of the guild's vanity invite, or empty if the
+	// guild has none.
+	VanityURLCode string
+	Description   string
+
+	Banner          discord.Hash
+	Splash          discord.Hash
+	DiscoverySplash discord.Hash
+
+	// WidgetEnabled and WidgetChannelID are only known if Discord sends them,
+	// which it usually only does for users who can manage the guild.
+	WidgetEnabled   bool
+	WidgetChannelID discord.ChannelID
+
+	NitroBoost    discord.NitroBoost
+	NitroBoosters uint64
+	Features      []discord.GuildFeature
+}
+
+func infoFromGuild(g *discord.Guild) Info {
+	return Info{
+		VanityURLCode:   g.VanityURLCode,
+		Description:     g.Description,
+		Banner:          g.Banner,
+		Splash:          g.Splash,
+		DiscoverySplash: g.DiscoverySplash,
+		WidgetEnabled:   g.Widget,
+		WidgetChannelID: g.WidgetChannelID,
+		NitroBoost:      g.NitroBoost,
+		NitroBoosters:   g.NitroBoosters,
+		Features:        append([]discord.GuildFeature(nil), g.Features...),
+	}
+}
+
+// VanityURL returns the full vanity invite URL, or an empty string if the
+// guild has no vanity invite.
+func (i Info) VanityURL() string {
+	if i.VanityURLCode == "" {
+		return ""
+	}
+	return "https://discord.gg/" + i.VanityURLCode
+}
+
+// HasFeature returns true if the guild has the given feature.
+func (i Info) HasFeature(feature discord.GuildFeature) bool {
+	for _, f := range i.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// Discoverable returns true if the guild is listed in Server Discovery.
+func (i Info) Discoverable() bool {
+	return i.HasFeature(discord.Discoverable)
+}
+
+func (s *State) setInfo(g *discord.Guild) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.infos[g.ID] = infoFromGuild(g)
+}
+
+func (s *State) addInfoHandlers(h handlerrepo.AddHandler) {
+	h.AddSyncHandler(func(ev *gateway.GuildCreateEvent) {
+		s.setInfo(&ev.Guild)
+	})
+
+	h.AddSyncHandler(func(ev *gateway.GuildUpdateEvent) {
+		s.setInfo(&ev.Guild)
+	})
+
+	h.AddSyncHandler(func(ev *gateway.GuildDeleteEvent) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		delete(s.infos, ev.ID)
+	})
+}
+
+// Info returns the header metadata of the guild. It is kept up to date with
+// the guild's update events.
+func (s *State) Info(guildID discord.GuildID) (Info, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	info, ok := s.infos[guildID]
+	if ok {
+		info.Features = append([]discord.GuildFeature(nil), info.Features...)
+	}
+
+	return info, ok
+}
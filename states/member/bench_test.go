@@ -0,0 +1,97 @@
+package member
+
+import (
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/state"
+)
+
+func newBenchListUpdate(n int) *ListUpdateEvent {
+	items := make([]gateway.GuildMemberListOpItem, n)
+	for i := range items {
+		items[i].Member = &listMember{
+			Member: discord.Member{
+				User: discord.User{ID: discord.UserID(i + 1)},
+			},
+			Presence: discord.Presence{
+				User:   discord.User{ID: discord.UserID(i + 1)},
+				Status: discord.OnlineStatus,
+			},
+		}
+	}
+
+	return &ListUpdateEvent{GuildMemberListUpdate: gateway.GuildMemberListUpdate{
+		ID:          "everyone",
+		GuildID:     1,
+		MemberCount: uint64(n),
+		OnlineCount: uint64(n),
+		Ops: []gateway.GuildMemberListOp{
+			{Op: "SYNC", Range: [2]int{0, n - 1}, Items: items},
+		},
+	}}
+}
+
+func BenchmarkListUpdateSync(b *testing.B) {
+	s := NewState(state.New(""), noopHandler{})
+	ev := newBenchListUpdate(100)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		s.onListUpdate(ev)
+	}
+}
+
+func BenchmarkListUpdateInsertDelete(b *testing.B) {
+	s := NewState(state.New(""), noopHandler{})
+	s.onListUpdate(newBenchListUpdate(100))
+
+	item := gateway.GuildMemberListOpItem{
+		Member: &listMember{
+			Member: discord.Member{User: discord.User{ID: 1000}},
+		},
+	}
+
+	ev := &ListUpdateEvent{GuildMemberListUpdate: gateway.GuildMemberListUpdate{
+		ID:      "everyone",
+		GuildID: 1,
+		Ops: []gateway.GuildMemberListOp{
+			{Op: "INSERT", Index: 50, Item: item},
+			{Op: "DELETE", Index: 50},
+		},
+	}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		s.onListUpdate(ev)
+	}
+}
+
+func BenchmarkListUpdateState(b *testing.B) {
+	s := NewState(state.New(""), noopHandler{})
+	ev := newBenchListUpdate(100)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		s.onListUpdateState(ev)
+	}
+}
+
+// listMember is the anonymous type of gateway.GuildMemberListOpItem.Member.
+type listMember = struct {
+	discord.Member
+	HoistedRole string           `json:"hoisted_role"`
+	Presence    discord.Presence `json:"presence"`
+}
+
+type noopHandler struct{}
+
+func (noopHandler) AddHandler(interface{}) func()     { return func() {} }
+func (noopHandler) AddSyncHandler(interface{}) func() { return func() {} }
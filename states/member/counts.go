@@ -0,0 +1,114 @@
+package member
+
+import (
+	"context"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+	"github.com/diamondburned/ningen/v3/prefetch"
+	"github.com/pkg/errors"
+)
+
+// Counts contains the approximate member and online counts of a guild.
+type Counts struct {
+	// Members is the approximate number of members in the guild.
+	Members int
+	// Online is the approximate number of online members in the guild. It is
+	// 0 if it's not known yet.
+	Online int
+	// UpdatedAt is the time that the counts were last updated.
+	UpdatedAt time.Time
+}
+
+// CountsUpdateEvent is dispatched when the approximate counts of a guild are
+// changed. The events of a guild are dispatched in order.
+type CountsUpdateEvent struct {
+	Counts
+	GuildID discord.GuildID
+}
+
+var _ gateway.Event = (*CountsUpdateEvent)(nil)
+
+func (ev CountsUpdateEvent) Op() ws.OpCode           { return -1 }
+func (ev CountsUpdateEvent) EventType() ws.EventType { return "__member.CountsUpdateEvent" }
+
+// ApproximateCounts returns the approximate member and online counts of the
+// guild without needing to subscribe to a member list. The counts are sourced
+// from the Ready and Guild Create events, the "everyone" member list and
+// RefreshCounts. False is returned if no counts are known.
+func (m *State) ApproximateCounts(guildID discord.GuildID) (Counts, bool) {
+	guild := m.guildState(guildID, false)
+	if guild == nil {
+		return Counts{}, false
+	}
+
+	guild.mut.Lock()
+	defer guild.mut.Unlock()
+
+	return guild.counts, !guild.counts.UpdatedAt.IsZero()
+}
+
+// RefreshCounts asynchronously fetches the approximate counts of the guild
+// from the API. A CountsUpdateEvent is dispatched once the counts are fetched.
+// Callers can call this multiple times concurrently; only one request will be
+// made at a time.
+func (m *State) RefreshCounts(guildID discord.GuildID) {
+	guild := m.guildState(guildID, true)
+	guild.mut.Lock()
+	defer guild.mut.Unlock()
+
+	if guild.refreshingCounts {
+		return
+	}
+	guild.refreshingCounts = true
+
+	m.Scheduler.Go(context.Background(), prefetch.Background, func(ctx context.Context) {
+		defer func() {
+			guild.mut.Lock()
+			guild.refreshingCounts = false
+			guild.mut.Unlock()
+		}()
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		g, err := m.state.WithContext(ctx).GuildWithCount(guildID)
+		if err != nil {
+			m.OnError(errors.Wrap(err, "Failed to refresh guild counts"))
+			return
+		}
+
+		m.setCounts(guildID, int(g.ApproximateMembers), int(g.ApproximatePresences))
+	})
+}
+
+// setCounts updates the guild's counts. An online count of -1 keeps the old
+// online count.
+func (m *State) setCounts(guildID discord.GuildID, members, online int) {
+	guild := m.guildState(guildID, true)
+	guild.mut.Lock()
+
+	counts := guild.counts
+	counts.Members = members
+	if online > -1 {
+		counts.Online = online
+	}
+
+	changed := counts.Members != guild.counts.Members || counts.Online != guild.counts.Online
+	counts.UpdatedAt = time.Now()
+	guild.counts = counts
+
+	guild.mut.Unlock()
+
+	if changed {
+		m.ordered.Go(discord.Snowflake(guildID), func() {
+			m.state.Call(&CountsUpdateEvent{
+				Counts:  counts,
+				GuildID: guildID,
+			})
+		})
+	}
+}
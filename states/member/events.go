@@ -0,0 +1,88 @@
+package member
+
+import (
+	"context"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+)
+
+// ListSyncEvent is dispatched after a range of a member list is synced or
+// invalidated. For a SYNC op, Items contains the new items of Range. For an
+// INVALIDATE op, Items contains the items that were removed from Range.
+//
+// The list is already updated when the event is dispatched, so UIs can view it
+// using GetMemberListDirect with ListID.
+type ListSyncEvent struct {
+	gateway.GuildMemberListOp
+	GuildID discord.GuildID
+	ListID  string
+}
+
+var _ gateway.Event = (*ListSyncEvent)(nil)
+
+func (ev ListSyncEvent) Op() ws.OpCode           { return -1 }
+func (ev ListSyncEvent) EventType() ws.EventType { return "__member.ListSyncEvent" }
+
+// ListOpEvent is dispatched after an INSERT, UPDATE or DELETE op is applied to
+// a member list. Item is the inserted or updated item, or the deleted item for
+// DELETE ops. Like ListSyncEvent, the list is already updated.
+//
+// The op's name is in GuildMemberListOp.Op, since Op is the event's opcode.
+type ListOpEvent struct {
+	gateway.GuildMemberListOp
+	GuildID discord.GuildID
+	ListID  string
+}
+
+var _ gateway.Event = (*ListOpEvent)(nil)
+
+func (ev ListOpEvent) Op() ws.OpCode           { return -1 }
+func (ev ListOpEvent) EventType() ws.EventType { return "__member.ListOpEvent" }
+
+// dispatchListOps dispatches an event for each op of the list update that was
+// applied. The events are dispatched in the background, in order per guild. Only subscribed lists dispatch events, since passive updates don't
+// touch the items.
+func (m *State) dispatchListOps(ev *gateway.GuildMemberListUpdate, failed []int) {
+	for i, op := range ev.Ops {
+		if containsInt(failed, i) {
+			continue
+		}
+
+		var dispatch gateway.Event
+		switch op.Op {
+		case "SYNC", "INVALIDATE":
+			dispatch = &ListSyncEvent{
+				GuildMemberListOp: op,
+				GuildID:           ev.GuildID,
+				ListID:            ev.ID,
+			}
+		case "INSERT", "UPDATE", "DELETE":
+			dispatch = &ListOpEvent{
+				GuildMemberListOp: op,
+				GuildID:           ev.GuildID,
+				ListID:            ev.ID,
+			}
+		default:
+			continue
+		}
+
+		m.ordered.Go(discord.Snowflake(ev.GuildID), func() {
+			m.state.Handler.Call(dispatch)
+		})
+	}
+}
+
+func containsInt(ints []int, v int) bool {
+	for _, i := range ints {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Flush behaves like handlerrepo.Ordered.Flush for the state's events.
+func (m *State) Flush(ctx context.Context) error {
+	return m.ordered.Flush(ctx)
+}
@@ -39,6 +39,7 @@ type List struct {
 
 	memberCount int
 	onlineCount int
+	passive     bool
 
 	groups []gateway.GuildMemberListGroup
 	items  []gateway.GuildMemberListOpItem
@@ -95,6 +96,17 @@ func (l *List) TotalVisible() int {
 	return l.onlineCount
 }
 
+// Passive returns true if the list was last updated by an update that Discord
+// marked as passive, which it sends for guilds that the user isn't actively
+// viewing. Passive lists have up-to-date counts and groups, but their items are
+// not kept up-to-date.
+func (l *List) Passive() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.passive
+}
+
 // MemberCount returns the total number of members.
 func (l *List) MemberCount() int {
 	l.mu.Lock()
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -14,6 +15,8 @@ import (
 	"github.com/diamondburned/arikawa/v3/state"
 	"github.com/diamondburned/arikawa/v3/utils/json/option"
 	"github.com/diamondburned/ningen/v3/handlerrepo"
+	"github.com/diamondburned/ningen/v3/prefetch"
+	"github.com/diamondburned/ningen/v3/trace"
 	"github.com/pkg/errors"
 	"github.com/twmb/murmur3"
 )
@@ -21,6 +24,9 @@ import (
 var (
 	// ErrListNotFound is returned if GetMemberList can't find the list.
 	ErrListNotFound = errors.New("List not found.")
+	// ErrMemberNotFound is returned if RequestMemberWait is told by Discord
+	// that the member doesn't exist.
+	ErrMemberNotFound = errors.New("Member not found.")
 )
 
 // State handles members and the member list.
@@ -54,19 +60,47 @@ type State struct {
 	state   *state.State
 	guildMu sync.Mutex
 	guilds  map[discord.GuildID]*Guild // snowflake -> *Guild
+	noLazy  bool                       // guarded by guildMu
+	noBulk  bool                       // guarded by guildMu
+	// lost is the subscriptions of the previous session, which are replayed
+	// by Resubscribe. Guarded by guildMu.
+	lost map[discord.GuildID]GuildSubscription
+	// bulkSent is true if a GuildSubscriptionsBulkCommand was sent since the
+	// gateway last closed. Guarded by guildMu.
+	bulkSent bool
 
 	minFetchMu sync.Mutex
 	minFetched map[discord.ChannelID]int
 
+	threadMu sync.Mutex
+	threads  map[discord.ChannelID]*threadList
+
+	searchMu    sync.Mutex
+	searches    map[string]*pendingSearch // nonce -> search
+	searchNonce uint64
+
+	// ordered dispatches CountsUpdateEvents and the list events in order per
+	// guild.
+	ordered handlerrepo.Ordered
+
 	OnError func(error)
 
 	// RequestFrequency is the duration before the next SearchMember is allowed
 	// to do anything else. Default is 1s.
 	SearchFrequency time.Duration
 	SearchLimit     uint // 50
+	// SearchTimeout is the duration that SearchMemberAsync waits for all of
+	// the chunks to arrive. Default is 5s.
+	SearchTimeout time.Duration
 	// RequestPresences, when true, will make RequestMember ask for the
 	// presences as well.
 	RequestPresences bool // true
+	// Scheduler schedules member requests. If nil, each request spawns its
+	// own goroutine.
+	Scheduler *prefetch.Scheduler
+	// Tracer reports the gateway commands that the state sends. If nil,
+	// nothing is reported.
+	Tracer *trace.Tracer
 }
 
 func NewState(state *state.State, h handlerrepo.AddHandler) *State {
@@ -74,26 +108,47 @@ func NewState(state *state.State, h handlerrepo.AddHandler) *State {
 		state:      state,
 		guilds:     map[discord.GuildID]*Guild{},
 		minFetched: map[discord.ChannelID]int{},
+		threads:    map[discord.ChannelID]*threadList{},
+		searches:   map[string]*pendingSearch{},
 		OnError: func(err error) {
 			log.Println("ningen: members list error:", err)
 		},
 		SearchFrequency:  600 * time.Millisecond,
 		SearchLimit:      50,
+		SearchTimeout:    5 * time.Second,
 		RequestPresences: true,
 	}
 	h.AddSyncHandler(s.onListUpdateState)
 	h.AddSyncHandler(s.onListUpdate)
 	h.AddSyncHandler(s.onMembers)
-	h.AddSyncHandler(func(*gateway.ReadyEvent) {
+	h.AddSyncHandler(s.onPassiveUpdate)
+	h.AddSyncHandler(s.onClose)
+	s.addThreadHandlers(h)
+	h.AddSyncHandler(func(r *gateway.ReadyEvent) {
 		s.guildMu.Lock()
 		s.minFetchMu.Lock()
 
+		// Keep the subscriptions around for Resubscribe, since the new session
+		// doesn't have them.
+		s.keepLostSubscriptions()
+
 		// Invalidate everything.
 		s.guilds = map[discord.GuildID]*Guild{}
 		s.minFetched = map[discord.ChannelID]int{}
 
 		s.minFetchMu.Unlock()
 		s.guildMu.Unlock()
+
+		for _, guild := range r.Guilds {
+			if guild.MemberCount > 0 {
+				s.setCounts(guild.ID, int(guild.MemberCount), -1)
+			}
+		}
+	})
+	h.AddSyncHandler(func(g *gateway.GuildCreateEvent) {
+		if g.MemberCount > 0 {
+			s.setCounts(g.ID, int(g.MemberCount), -1)
+		}
 	})
 	return s
 }
@@ -106,13 +161,21 @@ type Guild struct {
 	// calls.
 	requested  map[discord.UserID]bool
 	requesting bool
+	// callers of RequestMemberWait waiting for the member. nil is sent if the
+	// member isn't found.
+	waiting map[discord.UserID][]chan *discord.Member
 
-	// last SearchMember call.
+	// last SearchMember call and its query.
 	lastSearch time.Time
+	lastQuery  string
 
 	// whether or not the guild is subscribed.
 	subscribed bool
 
+	// approximate counts of the guild.
+	counts           Counts
+	refreshingCounts bool
+
 	listMu sync.Mutex
 	lists  map[string]*List
 
@@ -160,43 +223,21 @@ func (m *State) guildState(guildID discord.GuildID, create bool) *Guild {
 //
 // The gateway command will be sent asynchronously.
 func (m *State) Subscribe(guildID discord.GuildID) {
-	gd := m.guildState(guildID, true)
-	gd.mut.Lock()
-	defer gd.mut.Unlock()
-
-	// Exit if already subscribed.
-	if gd.subscribed {
-		return
-	}
-
-	gd.subscribed = true
-
-	go func() {
-		// Subscribe.
-		err := m.state.Gateway().Send(context.Background(), &gateway.GuildSubscribeCommand{
-			GuildID:    guildID,
-			Typing:     true,
-			Threads:    true,
-			Activities: true,
-		})
-
-		if err != nil {
-			m.OnError(errors.Wrap(err, "Failed to subscribe guild"))
-
-			gd.mut.Lock()
-			gd.subscribed = false
-			gd.mut.Unlock()
-
-			return
-		}
-	}()
+	m.SubscribeGuilds(guildID)
 }
 
 // SearchMember queries Discord for a list of members with the given query
 // string.
 func (m *State) SearchMember(guildID discord.GuildID, query string) {
+	m.searchMember(guildID, query, "", nil)
+}
+
+// searchMember sends the search command with the given nonce unless another
+// search was done within SearchFrequency. It returns false if the command
+// isn't sent. onError, if not nil, is called after the command fails to send.
+func (m *State) searchMember(guildID discord.GuildID, query, nonce string, onError func()) bool {
 	if query == "" {
-		return
+		return false
 	}
 
 	gd := m.guildState(guildID, true)
@@ -204,10 +245,11 @@ func (m *State) SearchMember(guildID discord.GuildID, query string) {
 	defer gd.mut.Unlock()
 
 	if gd.lastSearch.Add(m.SearchFrequency).After(time.Now()) {
-		return
+		return false
 	}
 
 	gd.lastSearch = time.Now()
+	gd.lastQuery = query
 
 	go func() {
 		var queryVar option.String
@@ -220,14 +262,20 @@ func (m *State) SearchMember(guildID discord.GuildID, query string) {
 			Query:     queryVar,
 			Presences: m.RequestPresences,
 			Limit:     m.SearchLimit,
+			Nonce:     nonce,
 		}
 
-		err := m.state.Gateway().Send(context.Background(), search)
+		err := m.Tracer.Send(context.Background(), m.state.Gateway(), trace.MemberSearch, search)
 
 		if err != nil {
 			m.OnError(errors.Wrap(err, "Failed to search guild members"))
+			if onError != nil {
+				onError()
+			}
 		}
 	}()
+
+	return true
 }
 
 // RequestMember tries to ask the gateway for a member from the ID. This method
@@ -250,8 +298,9 @@ func (m *State) RequestMember(guildID discord.GuildID, memberID discord.UserID)
 	if guild.requested == nil {
 		guild.requested = make(map[discord.UserID]bool)
 	} else {
-		// Check if the member is already being requested.
-		if _, ok := guild.requested[memberID]; ok {
+		// Check if the member is already being requested. Members that were
+		// queued by a batch that got dropped are requested again.
+		if requested, ok := guild.requested[memberID]; ok && (requested || guild.requesting) {
 			return
 		}
 	}
@@ -263,59 +312,177 @@ func (m *State) RequestMember(guildID discord.GuildID, memberID discord.UserID)
 	}
 	guild.requesting = true
 
-	go func() {
-		// Wait for 500ms.
-		time.Sleep(500 * time.Millisecond)
+	// Wait for 500ms to batch requests. The batch is shared by every caller,
+	// so it isn't bound to any of their contexts.
+	time.AfterFunc(500*time.Millisecond, func() {
+		m.Scheduler.Go(context.Background(), prefetch.Visible, func(ctx context.Context) {
+			if ctx.Err() != nil {
+				// The batch was dropped, so the next RequestMember starts
+				// another one.
+				guild.mut.Lock()
+				guild.requesting = false
+				guild.mut.Unlock()
+				return
+			}
 
-		// Re-check the guild for the member list.
-		guild.mut.Lock()
+			m.requestMembers(ctx, guildID, guild)
+		})
+	})
+}
 
-		memberIDs := make([]discord.UserID, 0, 10)
-		for id, requested := range guild.requested {
-			if !requested {
-				memberIDs = append(memberIDs, id)
-				guild.requested[id] = true
-			}
+// RequestMemberWait is RequestMember, except it waits until the member
+// arrives or the context expires. Requests are batched the same way. If the
+// member is already in the state, it is returned immediately. If Discord says
+// that the member doesn't exist, ErrMemberNotFound is returned.
+func (m *State) RequestMemberWait(ctx context.Context, guildID discord.GuildID, memberID discord.UserID) (*discord.Member, error) {
+	if member, err := m.state.Cabinet.Member(guildID, memberID); err == nil {
+		return member, nil
+	}
+
+	ch := make(chan *discord.Member, 1)
+
+	guild := m.guildState(guildID, true)
+	guild.mut.Lock()
+	if guild.waiting == nil {
+		guild.waiting = make(map[discord.UserID][]chan *discord.Member)
+	}
+	guild.waiting[memberID] = append(guild.waiting[memberID], ch)
+	guild.mut.Unlock()
+
+	// The member may have arrived before the waiter was added, in which case
+	// RequestMember wouldn't request it.
+	if member, err := m.state.Cabinet.Member(guildID, memberID); err == nil {
+		guild.stopWaiting(memberID, ch)
+		return member, nil
+	}
+
+	m.RequestMember(guildID, memberID)
+
+	select {
+	case member := <-ch:
+		if member == nil {
+			return nil, ErrMemberNotFound
 		}
+		return member, nil
+	case <-ctx.Done():
+		guild.stopWaiting(memberID, ch)
+		return nil, ctx.Err()
+	}
+}
 
-		guild.requesting = false
-		guild.mut.Unlock()
+// stopWaiting removes the waiter of the member.
+func (g *Guild) stopWaiting(memberID discord.UserID, ch chan *discord.Member) {
+	g.mut.Lock()
+	defer g.mut.Unlock()
 
-		// Fetch everything that wasn't requested.
-		err := m.state.Gateway().Send(context.Background(), &gateway.RequestGuildMembersCommand{
-			GuildIDs:  []discord.GuildID{guildID},
-			UserIDs:   memberIDs,
-			Presences: m.RequestPresences,
-		})
+	waiting := g.waiting[memberID]
+	for i, w := range waiting {
+		if w == ch {
+			waiting = append(waiting[:i], waiting[i+1:]...)
+			break
+		}
+	}
 
-		log.Println("guild", guildID, "requested", len(memberIDs), "members")
+	if len(waiting) > 0 {
+		g.waiting[memberID] = waiting
+	} else {
+		delete(g.waiting, memberID)
+	}
+}
 
-		if err != nil {
-			guild.mut.Lock()
-			// Add back the member IDs that we failed to request.
-			for _, id := range memberIDs {
-				guild.requested[id] = false
-			}
-			guild.mut.Unlock()
+// wake sends the member to everyone waiting for it. g.mut must be held.
+func (g *Guild) wake(memberID discord.UserID, member *discord.Member) {
+	for _, ch := range g.waiting[memberID] {
+		ch <- member
+	}
+	delete(g.waiting, memberID)
+}
 
-			m.OnError(errors.Wrap(err, "Failed to request guild members"))
-			return
+// requestMembers requests all members of the guild that haven't been
+// requested yet.
+func (m *State) requestMembers(ctx context.Context, guildID discord.GuildID, guild *Guild) {
+	// Re-check the guild for the member list.
+	guild.mut.Lock()
+
+	memberIDs := make([]discord.UserID, 0, 10)
+	for id, requested := range guild.requested {
+		if !requested {
+			memberIDs = append(memberIDs, id)
+			guild.requested[id] = true
 		}
+	}
 
-		// Wait for Discord to deliver their events then delete them in the
-		// callback.
-	}()
+	guild.requesting = false
+	guild.mut.Unlock()
+
+	// Fetch everything that wasn't requested.
+	err := m.Tracer.Send(ctx, m.state.Gateway(), trace.Members, &gateway.RequestGuildMembersCommand{
+		GuildIDs:  []discord.GuildID{guildID},
+		UserIDs:   memberIDs,
+		Presences: m.RequestPresences,
+	})
+
+	log.Println("guild", guildID, "requested", len(memberIDs), "members")
+
+	if err != nil {
+		guild.mut.Lock()
+		// Add back the member IDs that we failed to request.
+		for _, id := range memberIDs {
+			guild.requested[id] = false
+		}
+		guild.mut.Unlock()
+
+		m.OnError(errors.Wrap(err, "Failed to request guild members"))
+		return
+	}
+
+	// Wait for Discord to deliver their events then delete them in the
+	// callback.
+}
+
+// PendingRequests returns the number of members that were asked for with
+// RequestMember but haven't arrived yet.
+func (m *State) PendingRequests() int {
+	m.guildMu.Lock()
+	guilds := make([]*Guild, 0, len(m.guilds))
+	for _, guild := range m.guilds {
+		guilds = append(guilds, guild)
+	}
+	m.guildMu.Unlock()
+
+	var n int
+	for _, guild := range guilds {
+		guild.mut.Lock()
+		n += len(guild.requested)
+		guild.mut.Unlock()
+	}
+
+	return n
 }
 
 // onMembers is called a bit after RequestGuildMembers if the UserIDs field is
 // filled.
 func (m *State) onMembers(c *gateway.GuildMembersChunkEvent) {
+	if c.Nonce != "" {
+		m.onSearchChunk(c)
+	}
+
 	guild := m.guildState(c.GuildID, true)
 	guild.mut.Lock()
 	defer guild.mut.Unlock()
 
-	for _, member := range c.Members {
+	for i, member := range c.Members {
 		delete(guild.requested, member.User.ID)
+		guild.wake(member.User.ID, &c.Members[i])
+	}
+
+	// Missing members are forgotten as well, so that they can be requested
+	// again, e.g. once they join the guild.
+	for _, id := range c.NotFound {
+		if sf, err := discord.ParseSnowflake(id); err == nil {
+			delete(guild.requested, discord.UserID(sf))
+			guild.wake(discord.UserID(sf), nil)
+		}
 	}
 }
 
@@ -380,114 +547,61 @@ func chunkEq(chk1, chk2 [][2]int) bool {
 // RequestMemberList tries to ask the gateway for a chunk (or many) of the
 // members list. Chunk is an integer (0, 1, ...), which indicates the maximum
 // number of chunks from 0 that the API should return. The function returns the
-// chunks to be fetched.
+// chunks to be fetched, or nil if they are already being fetched.
 //
 // Specifically, this method guarantees that the current chunk and the next
-// chunk will always be alive, as well as the first chunk.
+// chunk will always be alive, as well as the first chunk. Clients that know
+// which items are visible should use SetVisibleRange instead.
 //
 // If the given guild is not subscribed already, then it will subscribe
 // automatically.
 func (m *State) RequestMemberList(
 	guildID discord.GuildID, channelID discord.ChannelID, chunk int) [][2]int {
 
+	if !m.LazyGuilds() {
+		return nil
+	}
+
 	// Use the total to stop on max chunk.
 	var total = -1
 
 	// Get the list so we could calculate the total.
 	l, err := m.GetMemberList(guildID, channelID)
 	if err == nil {
-		total = l.TotalVisible()
-
-		// Round the total up with ceiling.
-		total = (total) / 100
+		total = l.TotalVisible() / MemberListChunkSize
 	}
 
-	// TODO: This won't be synchronized with the actual members list if we
-	// remove any of them from the list. Maybe remove the map state if possible.
 	m.minFetchMu.Lock()
-	defer m.minFetchMu.Unlock()
+	last, ok := m.minFetched[channelID]
+	m.minFetched[channelID] = chunk
+	m.minFetchMu.Unlock()
 
-	// Chunk to start.
-	start, ok := m.minFetched[channelID]
 	// Check if we've already had this chunk.
-	if ok && chunk == start {
-		// We should always keep the current chunk and next chunk alive. As
-		// such, we need an equal check.
+	if ok && chunk == last {
 		return nil
 	}
 
-	// Update the current chunks.
-	m.minFetched[channelID] = chunk
-
 	// Increment chunk by one, similar to how we add 1 into index for the
-	// length.
+	// length, then cap it if we have a total.
 	chunk++
-
-	// Cap chunk if we have a total.
 	if total > -1 && chunk > total {
 		chunk = total
 	}
 	// If we've reached the point where the chunks to be fetched go beyond the
 	// total, then we don't fetch anything.
-	if chunk < start {
+	if chunk < last {
 		return nil
 	}
 
-	// Derive the minimum chunk, if any. Skip the first chunk (0th), because
-	// we're adding that ourselves.
-	start = chunk - MaxMemberChunk
-	if start < 1 {
-		start = 1
-	}
-
-	// Always keep the first chunk alive.
-	chunks := make([][2]int, 1, chunk-start+1)
-	chunks[0] = [2]int{0, 99}
-
-	// Start from the last one fetched.
-	for i := start; i < chunk; i++ {
-		chunks = append(chunks, [2]int{
-			(i * 100),      // start: 100
-			(i * 100) + 99, // end:   199
-		})
+	// Keep the last MaxMemberChunk chunks up to the given one alive. The
+	// first chunk is added by setVisibleRange.
+	start := chunk - MaxMemberChunk
+	if start < 0 {
+		start = 0
 	}
 
-	go func() {
-		guild := m.guildState(guildID, true)
-		guild.subMutex.Lock()
-
-		// If we're already in the chunk and have fetched everything already,
-		// then we can exit.
-		if fetched, ok := guild.subChannels[channelID]; ok && chunkEq(fetched, chunks) {
-			guild.subMutex.Unlock()
-			return
-		}
-
-		for id := range guild.subChannels {
-			// Reset the chunks.
-			guild.subChannels[id] = firstChunk
-		}
-
-		// Set this channel's chunk to be different.
-		guild.subChannels[channelID] = chunks
-
-		guild.subscribed = true
-		guild.subMutex.Unlock() // Do not block IO.
-
-		// Subscribe.
-		err := m.state.Gateway().Send(context.Background(), &gateway.GuildSubscribeCommand{
-			GuildID:    guildID,
-			Channels:   guild.subChannels,
-			Typing:     true,
-			Activities: true,
-		})
-
-		if err != nil {
-			m.OnError(errors.Wrap(err, "Failed to subscribe to member list"))
-		}
-	}()
-
-	return chunks
+	return m.setVisibleRange(guildID, channelID,
+		start*MemberListChunkSize, chunk*MemberListChunkSize-1)
 }
 
 // GetMemberList looks up for the member list. It returns an error if no list
@@ -521,10 +635,41 @@ func (m *State) GetMemberListDirect(guildID discord.GuildID, id string) (*List,
 	return list, nil
 }
 
+// MemberLists returns the member lists of the guild that are kept, sorted by
+// their IDs.
+func (m *State) MemberLists(guildID discord.GuildID) []*List {
+	guild := m.guildState(guildID, false)
+	if guild == nil {
+		return nil
+	}
+
+	guild.listMu.Lock()
+	lists := make([]*List, 0, len(guild.lists))
+	for _, list := range guild.lists {
+		lists = append(lists, list)
+	}
+	guild.listMu.Unlock()
+
+	sort.Slice(lists, func(i, j int) bool { return lists[i].id < lists[j].id })
+	return lists
+}
+
 // onListUpdate is called a bit after RequestGuildMembers if the Channels field
 // is filled. It handles updating the local members list state.
-func (m *State) onListUpdate(ev *gateway.GuildMemberListUpdate) {
+//
+// If Discord marked the update as passive, then only the counts and groups are
+// updated, since the items were never requested.
+func (m *State) onListUpdate(ev *ListUpdateEvent) {
 	guild := m.guildState(ev.GuildID, true)
+	passive := ev.Passive
+
+	// Indices of the ops that couldn't be applied.
+	var failed []int
+
+	if !passive {
+		// Dispatch after the list is unlocked, so handlers can view it.
+		defer func() { m.dispatchListOps(&ev.GuildMemberListUpdate, failed) }()
+	}
 
 	ml := guild.list(ev.ID, true)
 	ml.mu.Lock()
@@ -533,6 +678,17 @@ func (m *State) onListUpdate(ev *gateway.GuildMemberListUpdate) {
 	ml.memberCount = int(ev.MemberCount)
 	ml.onlineCount = int(ev.OnlineCount)
 	ml.groups = ev.Groups
+	ml.passive = passive
+
+	// The everyone list contains everyone in the guild, so its counts are the
+	// guild's.
+	if ev.ID == "everyone" {
+		defer m.setCounts(ev.GuildID, ml.memberCount, ml.onlineCount)
+	}
+
+	if passive {
+		return
+	}
 
 	for i, op := range ev.Ops {
 		switch op.Op {
@@ -575,6 +731,7 @@ func (m *State) onListUpdate(ev *gateway.GuildMemberListUpdate) {
 				"Member %s: index out of range: len(ml.Items)=%d <= op.Index=%d\n",
 				op.Op, len(ml.items), oi,
 			))
+			failed = append(failed, i)
 			continue
 		}
 
@@ -590,7 +747,7 @@ func (m *State) onListUpdate(ev *gateway.GuildMemberListUpdate) {
 
 		case "DELETE":
 			// Copy the old item into the Items field for future uses.
-			op.Item = ml.items[i]
+			op.Item = ml.items[oi]
 			ev.Ops[i] = op
 			// Actually delete the item.
 			ml.items = append(ml.items[:oi], ml.items[oi+1:]...)
@@ -609,22 +766,28 @@ func (m *State) onListUpdate(ev *gateway.GuildMemberListUpdate) {
 
 // onListUpdateState is called when onListUpdate is called, but this one updates
 // the local member/presence state instead.
-func (m *State) onListUpdateState(ev *gateway.GuildMemberListUpdate) {
+func (m *State) onListUpdateState(ev *ListUpdateEvent) {
 	for _, op := range ev.Ops {
 		switch op.Op {
 		case "SYNC", "INSERT", "UPDATE":
-			items := append(op.Items, op.Item)
-			for i, item := range items {
-				if item.Member != nil {
-					update := op.Op == "UPDATE"
-					m.state.MemberSet(ev.GuildID, &items[i].Member.Member, update)
-					m.state.PresenceSet(ev.GuildID, &items[i].Member.Presence, update)
-				}
+			// Don't append Item to Items, since that may write into the
+			// event's backing array and costs an allocation for every op.
+			update := op.Op == "UPDATE"
+			for i := range op.Items {
+				m.setListItemState(ev.GuildID, &op.Items[i], update)
 			}
+			m.setListItemState(ev.GuildID, &op.Item, update)
 		}
 	}
 }
 
+func (m *State) setListItemState(guildID discord.GuildID, item *gateway.GuildMemberListOpItem, update bool) {
+	if item.Member != nil {
+		m.state.MemberSet(guildID, &item.Member.Member, update)
+		m.state.PresenceSet(guildID, &item.Member.Presence, update)
+	}
+}
+
 func growItems(items *[]gateway.GuildMemberListOpItem, maxLen int) {
 	cpy := *items
 	if len(cpy) >= maxLen {
@@ -1,14 +1,19 @@
 package member
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/diamondburned/arikawa/v3/discord"
 	"github.com/diamondburned/arikawa/v3/gateway"
 	"github.com/diamondburned/arikawa/v3/state"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+	"github.com/diamondburned/ningen/v3/prefetch"
 )
 
 type mockNingen struct {
@@ -26,10 +31,7 @@ const (
 )
 
 func ExampleState_RequestMemberList() {
-	s, err := state.New(os.Getenv("TOKEN"))
-	if err != nil {
-		log.Fatalln("Failed to create a state:", err)
-	}
+	s := state.New(os.Getenv("TOKEN"))
 
 	// Replace with the actual ningen.FromState function.
 	n, err := ningenFromState(s)
@@ -37,10 +39,10 @@ func ExampleState_RequestMemberList() {
 		log.Fatalln("Failed to create a ningen state:", err)
 	}
 
-	updates := make(chan *gateway.GuildMemberListUpdate, 1)
+	updates := make(chan *ListUpdateEvent, 1)
 	n.AddHandler(updates)
 
-	if err := n.Open(); err != nil {
+	if err := n.Open(context.Background()); err != nil {
 		panic(err)
 	}
 
@@ -112,3 +114,557 @@ func TestComputeListID(t *testing.T) {
 		t.Fatal("Unexpected ID:", id, "expected", "3720633681")
 	}
 }
+
+func TestListUpdateEventDecode(t *testing.T) {
+	ev := gateway.OpUnmarshalers.Lookup(0, "GUILD_MEMBER_LIST_UPDATE")()
+
+	payload := `{"id": "everyone", "guild_id": "1", "member_count": 10, "passive": true}`
+	if err := json.Unmarshal([]byte(payload), ev); err != nil {
+		t.Fatal("cannot decode GUILD_MEMBER_LIST_UPDATE:", err)
+	}
+
+	update, ok := ev.(*ListUpdateEvent)
+	if !ok {
+		t.Fatalf("GUILD_MEMBER_LIST_UPDATE is decoded as %T", ev)
+	}
+	if update.ID != "everyone" || update.MemberCount != 10 || !update.Passive {
+		t.Fatalf("got update %+v", update)
+	}
+}
+
+func TestListUpdatePassive(t *testing.T) {
+	s := NewState(state.New(""), noopHandler{})
+
+	ev := newBenchListUpdate(10)
+	ev.Passive = true
+	s.onListUpdate(ev)
+
+	l, err := s.GetMemberListDirect(1, "everyone")
+	if err != nil {
+		t.Fatal("list not created by passive update:", err)
+	}
+
+	if !l.Passive() {
+		t.Error("list is not passive")
+	}
+	if l.MemberCount() != 10 {
+		t.Errorf("member count = %d, want 10", l.MemberCount())
+	}
+
+	counts, ok := s.ApproximateCounts(1)
+	if !ok || counts.Members != 10 || counts.Online != 10 {
+		t.Errorf("counts = %+v (%v), want 10 members and 10 online", counts, ok)
+	}
+
+	var items int
+	l.ViewItems(func(it []gateway.GuildMemberListOpItem) { items = len(it) })
+	if items != 0 {
+		t.Errorf("passive list has %d items, want 0", items)
+	}
+
+	s.onListUpdate(newBenchListUpdate(10))
+
+	if l.Passive() {
+		t.Error("list is still passive after an active update")
+	}
+
+	l.ViewItems(func(it []gateway.GuildMemberListOpItem) { items = len(it) })
+	if items != 10 {
+		t.Errorf("list has %d items, want 10", items)
+	}
+}
+
+func TestThreadMembers(t *testing.T) {
+	s := NewState(state.New(""), noopHandler{})
+
+	var ev ThreadMemberListUpdateEvent
+	err := json.Unmarshal([]byte(`{
+		"guild_id": "1",
+		"thread_id": "2",
+		"members": [
+			{"user_id": "11", "join_timestamp": "2023-01-02T00:00:00+00:00", "flags": 0},
+			{"user_id": "10", "join_timestamp": "2023-01-01T00:00:00+00:00", "flags": 0,
+			 "member": {"user": {"id": "10", "username": "first"}, "roles": []}}
+		]
+	}`), &ev)
+	if err != nil {
+		t.Fatal("cannot unmarshal event:", err)
+	}
+
+	if _, err := s.GetThreadMembers(2); err != ErrListNotFound {
+		t.Fatalf("got error %v before the list update, want ErrListNotFound", err)
+	}
+
+	s.onThreadMemberList(&ev)
+
+	if m, err := s.state.Cabinet.Member(1, 10); err != nil || m.User.Username != "first" {
+		t.Errorf("member not stored in the cabinet: %v", err)
+	}
+
+	s.onThreadMembersUpdate(&gateway.ThreadMembersUpdateEvent{
+		ID:               2,
+		GuildID:          1,
+		AddedMembers:     []discord.ThreadMember{{UserID: 12, JoinTimestamp: discord.NowTimestamp()}},
+		RemovedMemberIDs: []discord.UserID{11},
+	})
+
+	members, err := s.GetThreadMembers(2)
+	if err != nil {
+		t.Fatal("cannot get thread members:", err)
+	}
+
+	var ids []discord.UserID
+	for _, member := range members {
+		ids = append(ids, member.UserID)
+	}
+
+	if len(ids) != 2 || ids[0] != 10 || ids[1] != 12 {
+		t.Errorf("got members %v, want [10 12]", ids)
+	}
+}
+
+func TestListEvents(t *testing.T) {
+	s := NewState(state.New(""), noopHandler{})
+
+	syncs := make(chan *ListSyncEvent, 10)
+	ops := make(chan *ListOpEvent, 10)
+	s.state.AddSyncHandler(func(ev *ListSyncEvent) { syncs <- ev })
+	s.state.AddSyncHandler(func(ev *ListOpEvent) { ops <- ev })
+
+	s.onListUpdate(newBenchListUpdate(10))
+
+	select {
+	case ev := <-syncs:
+		if ev.ListID != "everyone" || len(ev.Items) != 10 {
+			t.Fatalf("unexpected sync event %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no sync event dispatched")
+	}
+
+	s.onListUpdate(&ListUpdateEvent{GuildMemberListUpdate: gateway.GuildMemberListUpdate{
+		ID:      "everyone",
+		GuildID: 1,
+		Ops: []gateway.GuildMemberListOp{
+			{Op: "DELETE", Index: 3},
+			{Op: "DELETE", Index: 100},
+		},
+	}})
+
+	// The events of a guild are dispatched in order, so the events of the
+	// deletions have all arrived once the following sync's has.
+	s.onListUpdate(newBenchListUpdate(10))
+
+	var got []*ListOpEvent
+	for done := false; !done; {
+		select {
+		case ev := <-ops:
+			got = append(got, ev)
+		case <-syncs:
+			done = true
+		case <-time.After(time.Second):
+			t.Fatal("no sync event dispatched after the deletions")
+		}
+	}
+
+	// The op events are buffered before the sync event is sent.
+	for len(ops) > 0 {
+		got = append(got, <-ops)
+	}
+
+	if len(got) != 1 {
+		t.Fatalf("got %d op events, want 1", len(got))
+	}
+	if got[0].GuildMemberListOp.Op != "DELETE" || got[0].Item.Member == nil || got[0].Item.Member.User.ID != 4 {
+		t.Errorf("unexpected op event %+v", got[0])
+	}
+}
+
+func TestVisibleRanges(t *testing.T) {
+	s := NewState(state.New(""), noopHandler{})
+	guild := s.guildState(1, true)
+
+	type step struct {
+		name       string
+		start, end int
+		total      int
+		want       [][2]int
+		sent       bool
+	}
+
+	// A scroll down and back up again, where each step must keep every
+	// visible item subscribed.
+	steps := []step{
+		{"top", 0, 40, -1, [][2]int{{0, 99}}, true},
+		{"same chunk", 10, 60, -1, [][2]int{{0, 99}}, false},
+		{"across chunks", 80, 130, -1, [][2]int{{0, 99}, {100, 199}}, true},
+		{"down", 350, 420, -1, [][2]int{{0, 99}, {300, 399}, {400, 499}}, true},
+		{"past the end", 950, 990, 420, [][2]int{{0, 99}, {400, 499}}, true},
+		{"back up", 120, 180, 420, [][2]int{{0, 99}, {100, 199}}, true},
+		{"back to the top", 0, 40, 420, [][2]int{{0, 99}}, true},
+		{"too many", 100, 999, -1, [][2]int{{0, 99}, {100, 199}, {200, 299}}, true},
+	}
+
+	for _, step := range steps {
+		ranges := visibleRanges(step.start, step.end, step.total)
+		if !chunkEq(ranges, step.want) {
+			t.Errorf("%s: got ranges %v, want %v", step.name, ranges, step.want)
+			continue
+		}
+
+		changed := guild.setRanges(10, ranges)
+		if sent := changed != nil; sent != step.sent {
+			t.Errorf("%s: sent = %v, want %v", step.name, sent, step.sent)
+		}
+		if step.sent && !chunkEq(changed[10], step.want) {
+			t.Errorf("%s: sent ranges %v, want %v", step.name, changed[10], step.want)
+		}
+	}
+
+	// Scrolling another channel resets the first one, which is sent along.
+	guild.setRanges(10, visibleRanges(350, 420, -1))
+	changed := guild.setRanges(20, visibleRanges(150, 160, -1))
+	if len(changed) != 2 || !chunkEq(changed[10], firstChunk) || len(changed[20]) != 2 {
+		t.Errorf("got changed channels %v", changed)
+	}
+}
+
+func TestListSearch(t *testing.T) {
+	l := NewList("everyone", 1)
+
+	names := []struct{ username, nick string }{
+		{"bob", ""},
+		{"alice", "al"},
+		{"malice", ""},
+		{"carol", "Alpha Carol"},
+		{"a_l_ex", ""},
+	}
+
+	l.items = append(l.items, gateway.GuildMemberListOpItem{
+		Group: &gateway.GuildMemberListGroup{ID: "online"},
+	})
+	for i, name := range names {
+		l.items = append(l.items, gateway.GuildMemberListOpItem{
+			Member: &listMember{
+				Member: discord.Member{
+					User: discord.User{ID: discord.UserID(i + 1), Username: name.username},
+					Nick: name.nick,
+				},
+			},
+		})
+	}
+
+	results := l.Search("AL", 0)
+
+	// The exact nickname comes first, then prefixes, substrings and
+	// subsequences, each in the list's order.
+	want := []discord.UserID{2, 4, 3, 5}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for i, id := range want {
+		if results[i].Member.User.ID != id {
+			t.Errorf("result %d is %d, want %d", i, results[i].Member.User.ID, id)
+		}
+	}
+	if results[0].Index != 2 {
+		t.Errorf("got index %d for alice, want 2", results[0].Index)
+	}
+
+	if results := l.Search("al", 2); len(results) != 2 {
+		t.Errorf("got %d results with a limit of 2", len(results))
+	}
+	if results := l.Search("zzz", 0); len(results) != 0 {
+		t.Errorf("got results %+v for no match", results)
+	}
+}
+
+func TestSearchChunks(t *testing.T) {
+	s := NewState(state.New(""), noopHandler{})
+	s.SearchTimeout = 50 * time.Millisecond
+
+	nonce, search := s.addSearch()
+	other, _ := s.addSearch()
+
+	chunk := func(nonce string, index int, ids ...discord.UserID) *gateway.GuildMembersChunkEvent {
+		ev := &gateway.GuildMembersChunkEvent{
+			GuildID:    1,
+			ChunkIndex: index,
+			ChunkCount: 2,
+			Nonce:      nonce,
+		}
+		for _, id := range ids {
+			ev.Members = append(ev.Members, discord.Member{User: discord.User{ID: id}})
+		}
+		return ev
+	}
+
+	s.onMembers(chunk(nonce, 0, 1, 2))
+	s.onMembers(chunk(other, 0, 3))
+	s.onMembers(chunk("", 0, 4))
+
+	select {
+	case <-search.ch:
+		t.Fatal("search finished before all chunks arrived")
+	default:
+	}
+
+	s.onMembers(chunk(nonce, 1, 5))
+
+	members, ok := <-search.ch
+	if !ok || len(members) != 3 {
+		t.Fatalf("got members %+v, want 3", members)
+	}
+	if _, ok := <-search.ch; ok {
+		t.Error("channel isn't closed")
+	}
+
+	// The other search only gets its first chunk before the timeout.
+	s.searchMu.Lock()
+	otherSearch := s.searches[other]
+	s.searchMu.Unlock()
+
+	members, ok = <-otherSearch.ch
+	if !ok || len(members) != 1 || members[0].User.ID != 3 {
+		t.Fatalf("got members %+v after the timeout, want only 3", members)
+	}
+
+	if _, ok := <-s.SearchMemberAsync(1, ""); ok {
+		t.Error("empty query sent members")
+	}
+}
+
+func TestRequestMemberWait(t *testing.T) {
+	s := NewState(state.New(""), noopHandler{})
+
+	// Pretend that the members are already being requested, since there is no
+	// gateway to send the request over.
+	s.guildState(1, true).requested = map[discord.UserID]bool{2: true, 3: true, 4: true}
+
+	waitFor := func(id discord.UserID) <-chan error {
+		errCh := make(chan error, 1)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			member, err := s.RequestMemberWait(ctx, 1, id)
+			if err == nil && member.User.ID != id {
+				err = fmt.Errorf("got member %d, want %d", member.User.ID, id)
+			}
+			errCh <- err
+		}()
+
+		// Wait for the waiter to be added.
+		for {
+			guild := s.guildState(1, true)
+			guild.mut.Lock()
+			n := len(guild.waiting[id])
+			guild.mut.Unlock()
+			if n > 0 {
+				return errCh
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	found := waitFor(2)
+	missing := waitFor(3)
+
+	s.onMembers(&gateway.GuildMembersChunkEvent{
+		GuildID:    1,
+		Members:    []discord.Member{{User: discord.User{ID: 2}}},
+		NotFound:   []string{"3"},
+		ChunkCount: 1,
+	})
+
+	if err := <-found; err != nil {
+		t.Error("found member:", err)
+	}
+	if err := <-missing; err != ErrMemberNotFound {
+		t.Errorf("got error %v for the missing member, want ErrMemberNotFound", err)
+	}
+
+	// The missing member is requested again instead of waiting for a chunk
+	// that never comes. The batch is marked as pending so that nothing is sent.
+	guild := s.guildState(1, true)
+	guild.mut.Lock()
+	guild.requesting = true
+	guild.mut.Unlock()
+
+	missing = waitFor(3)
+
+	// The waiter is added before the member is requested.
+	for start := time.Now(); ; time.Sleep(time.Millisecond) {
+		guild.mut.Lock()
+		requested, ok := guild.requested[3]
+		guild.mut.Unlock()
+		if ok && !requested {
+			break
+		}
+		if time.Since(start) > time.Second {
+			t.Fatal("missing member is not queued to be requested again")
+		}
+	}
+
+	s.onMembers(&gateway.GuildMembersChunkEvent{
+		GuildID:    1,
+		NotFound:   []string{"3"},
+		ChunkCount: 1,
+	})
+
+	if err := <-missing; err != ErrMemberNotFound {
+		t.Errorf("got error %v for the missing member again, want ErrMemberNotFound", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := s.RequestMemberWait(ctx, 1, 4); err != context.Canceled {
+		t.Errorf("got error %v after the context expired, want context.Canceled", err)
+	}
+	if n := len(s.guildState(1, false).waiting); n != 0 {
+		t.Errorf("%d members are still waited for", n)
+	}
+}
+
+func TestRequestMemberDropped(t *testing.T) {
+	s := NewState(state.New(""), noopHandler{})
+	s.Scheduler = prefetch.NewScheduler(1)
+	s.Scheduler.Close()
+
+	guild := s.guildState(1, true)
+	requesting := func() bool {
+		guild.mut.Lock()
+		defer guild.mut.Unlock()
+		return guild.requesting
+	}
+
+	s.RequestMember(1, 2)
+
+	// The batch is dropped by the closed scheduler, which must not leave the
+	// guild thinking that it is still requesting.
+	for start := time.Now(); requesting(); time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 2*time.Second {
+			t.Fatal("guild is still requesting after the batch was dropped")
+		}
+	}
+
+	s.RequestMember(1, 2)
+	if !requesting() {
+		t.Error("member is not requested again after the batch was dropped")
+	}
+}
+
+func TestGuildSubscriptionsBulk(t *testing.T) {
+	cmd := &GuildSubscriptionsBulkCommand{
+		Subscriptions: map[discord.GuildID]GuildSubscription{
+			1: {Typing: true, Activities: true, MemberUpdates: true},
+			2: {Channels: map[discord.ChannelID][][2]int{3: {{0, 99}}}},
+		},
+	}
+
+	b, err := json.Marshal(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const want = `{"subscriptions":{"1":{"typing":true,"activities":true,"member_updates":true},` +
+		`"2":{"channels":{"3":[[0,99]]}}}}`
+	if string(b) != want {
+		t.Errorf("got %s, want %s", b, want)
+	}
+
+	legacy := legacySubscribeCommand(1, GuildSubscription{Typing: true, ThreadMemberLists: []discord.ChannelID{4}})
+	if cmd, ok := legacy.(*threadSubscribeCommand); !ok || cmd.GuildID != 1 || !cmd.Typing {
+		t.Errorf("got legacy command %#v for a thread member list", legacy)
+	}
+	if _, ok := legacySubscribeCommand(1, GuildSubscription{}).(*gateway.GuildSubscribeCommand); !ok {
+		t.Error("legacy command isn't a GuildSubscribeCommand")
+	}
+}
+
+func TestKeepLostSubscriptions(t *testing.T) {
+	s := NewState(state.New(""), noopHandler{})
+
+	s.guildState(1, true).subscribed = true
+	s.guildState(1, true).setRanges(2, [][2]int{{0, 99}, {100, 199}})
+	s.guildState(3, true)
+
+	s.guildMu.Lock()
+	s.keepLostSubscriptions()
+	s.guilds = map[discord.GuildID]*Guild{}
+	s.guildMu.Unlock()
+
+	if len(s.lost) != 1 {
+		t.Fatalf("got lost subscriptions %+v, want only guild 1", s.lost)
+	}
+	sub := s.lost[1]
+	if !sub.Typing || !sub.Activities || len(sub.Channels[2]) != 2 {
+		t.Errorf("got lost subscription %+v", sub)
+	}
+
+	// The guild isn't in the cabinet, so it's as if the user left it.
+	s.Resubscribe()
+
+	if s.lost != nil {
+		t.Error("lost subscriptions are kept after Resubscribe")
+	}
+	if s.IsSubscribed(1) {
+		t.Error("guild that the user left is subscribed")
+	}
+}
+
+func TestBulkSubscriptionsFallback(t *testing.T) {
+	s := NewState(state.New(""), noopHandler{})
+	s.guildState(1, true).subscribed = true
+
+	// Without a bulk command, the close wasn't caused by it.
+	s.onClose(&ws.CloseEvent{Code: CodeUnknownOpcode})
+	if !s.BulkSubscriptions() {
+		t.Fatal("bulk subscriptions are disabled without a bulk command")
+	}
+
+	s.bulkSent = true
+	s.onClose(&ws.CloseEvent{Code: 4000})
+	if !s.BulkSubscriptions() {
+		t.Fatal("bulk subscriptions are disabled after an unrelated close")
+	}
+
+	s.bulkSent = true
+	s.onClose(&ws.CloseEvent{Code: CodeUnknownOpcode})
+	if s.BulkSubscriptions() {
+		t.Fatal("bulk subscriptions are enabled after the gateway rejected them")
+	}
+	if _, ok := s.lost[1]; !ok {
+		t.Errorf("got lost subscriptions %+v, want guild 1 to be sent again", s.lost)
+	}
+}
+
+func TestRequestMemberList(t *testing.T) {
+	st := state.New("")
+	st.Cabinet.ChannelSet(&discord.Channel{ID: 10}, false)
+
+	s := NewState(st, noopHandler{})
+	s.OnError = func(error) {}
+
+	// A closed scheduler cancels the subscriptions instead of sending them.
+	s.Scheduler = prefetch.NewScheduler(1)
+	s.Scheduler.Close()
+
+	tests := []struct {
+		chunk int
+		want  [][2]int
+	}{
+		{0, [][2]int{{0, 99}}},
+		{0, nil},
+		{1, [][2]int{{0, 99}, {100, 199}}},
+		{5, [][2]int{{0, 99}, {400, 499}, {500, 599}}},
+	}
+
+	for _, test := range tests {
+		ranges := s.RequestMemberList(1, 10, test.chunk)
+		if !chunkEq(ranges, test.want) {
+			t.Errorf("chunk %d: got ranges %v, want %v", test.chunk, ranges, test.want)
+		}
+	}
+}
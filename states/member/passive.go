@@ -0,0 +1,121 @@
+package member
+
+import (
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+)
+
+func init() {
+	gateway.OpUnmarshalers.Add(
+		func() ws.Event { return new(PassiveUpdateEvent) },
+		func() ws.Event { return new(ListUpdateEvent) },
+	)
+}
+
+// ListUpdateEvent is a dispatch event for GUILD_MEMBER_LIST_UPDATE. It is
+// undocumented, and arikawa doesn't register an event for it:
+// gateway.GuildMemberListUpdate only describes its payload, so it is embedded
+// here along with whether the update is passive.
+type ListUpdateEvent struct {
+	gateway.GuildMemberListUpdate
+	// Passive is true if Discord sent the update for a guild that the user
+	// is not actively viewing. Passive updates keep the counts and groups
+	// fresh, but their ops aren't meant to be applied to the list.
+	Passive bool `json:"passive,omitempty"`
+}
+
+// Op implements ws.Event.
+func (*ListUpdateEvent) Op() ws.OpCode { return 0 }
+
+// EventType implements ws.Event.
+func (*ListUpdateEvent) EventType() ws.EventType { return "GUILD_MEMBER_LIST_UPDATE" }
+
+// PassiveUpdateEvent is a dispatch event for PASSIVE_UPDATE_V1. Discord sends
+// it for large guilds that the user is not actively viewing, which means that
+// the guild is not subscribed. It is undocumented.
+type PassiveUpdateEvent struct {
+	GuildID     discord.GuildID      `json:"guild_id"`
+	Members     []discord.Member     `json:"members,omitempty"`
+	VoiceStates []discord.VoiceState `json:"voice_states,omitempty"`
+	Channels    []struct {
+		ID               discord.ChannelID `json:"id"`
+		LastMessageID    discord.MessageID `json:"last_message_id"`
+		LastPinTimestamp discord.Timestamp `json:"last_pin_timestamp,omitempty"`
+	} `json:"channels,omitempty"`
+}
+
+// Op implements ws.Event.
+func (*PassiveUpdateEvent) Op() ws.OpCode { return 0 }
+
+// EventType implements ws.Event.
+func (*PassiveUpdateEvent) EventType() ws.EventType { return "PASSIVE_UPDATE_V1" }
+
+// onPassiveUpdate updates the local member, voice and channel states without
+// requiring the guild to be subscribed.
+func (m *State) onPassiveUpdate(ev *PassiveUpdateEvent) {
+	for i := range ev.Members {
+		m.state.MemberSet(ev.GuildID, &ev.Members[i], true)
+	}
+
+	for i := range ev.VoiceStates {
+		vs := &ev.VoiceStates[i]
+		vs.GuildID = ev.GuildID
+		m.state.VoiceStateSet(ev.GuildID, vs, true)
+	}
+
+	for _, update := range ev.Channels {
+		ch, err := m.state.Cabinet.Channel(update.ID)
+		if err != nil {
+			continue
+		}
+
+		if ch.LastMessageID < update.LastMessageID {
+			ch.LastMessageID = update.LastMessageID
+		}
+		if update.LastPinTimestamp.IsValid() {
+			ch.LastPinTime = update.LastPinTimestamp
+		}
+
+		m.state.ChannelSet(ch, true)
+	}
+}
+
+// IsSubscribed returns true if the guild has been subscribed using either
+// Subscribe or RequestMemberList. Guilds that aren't subscribed may still
+// receive passive updates; see List.Passive.
+func (m *State) IsSubscribed(guildID discord.GuildID) bool {
+	guild := m.guildState(guildID, false)
+	if guild == nil {
+		return false
+	}
+
+	return guild.isSubscribed()
+}
+
+func (g *Guild) isSubscribed() bool {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+
+	return g.subscribed
+}
+
+// SetLazyGuilds sets whether guild subscriptions are used, which is the case
+// by default. Bots can't subscribe to guilds, so if they are disabled,
+// Subscribe, RequestMemberList and RequestThreadMembers do nothing, and guilds
+// only receive passive updates. ningen disables them at Ready if the session
+// belongs to a bot.
+func (m *State) SetLazyGuilds(enabled bool) {
+	m.guildMu.Lock()
+	defer m.guildMu.Unlock()
+
+	m.noLazy = !enabled
+}
+
+// LazyGuilds returns true if guild subscriptions are used. See SetLazyGuilds.
+func (m *State) LazyGuilds() bool {
+	m.guildMu.Lock()
+	defer m.guildMu.Unlock()
+
+	return !m.noLazy
+}
@@ -0,0 +1,268 @@
+package member
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/ningen/v3/internal/fuzzy"
+)
+
+// ListSearchResult is a member found by List.Search.
+type ListSearchResult struct {
+	// Index is the index of the member's item in the list.
+	Index    int
+	Member   discord.Member
+	Presence discord.Presence
+}
+
+// Match is how well a query matches a name. Better matches are greater.
+type Match int
+
+const (
+	// MatchNone means that the name doesn't match.
+	MatchNone Match = iota
+	// MatchSubsequence means that the name contains the characters of the
+	// query in order.
+	MatchSubsequence
+	// MatchSubstring means that the name contains the query.
+	MatchSubstring
+	// MatchPrefix means that the name starts with the query.
+	MatchPrefix
+	// MatchExact means that the name is the query.
+	MatchExact
+)
+
+// MatchMember returns how well the query matches the best of the member's
+// nickname, display name and username, ignoring case.
+func MatchMember(query string, member *discord.Member) Match {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return MatchNone
+	}
+
+	return matchMember(query, member)
+}
+
+// matchMember is MatchMember for a query that is already lowercase.
+func matchMember(query string, member *discord.Member) Match {
+	match := MatchNone
+	for _, name := range [...]string{
+		member.Nick,
+		member.User.DisplayName,
+		member.User.Username,
+	} {
+		if m := matchName(query, name); m > match {
+			match = m
+		}
+	}
+	return match
+}
+
+// Search fuzzy-matches the query against the nicknames, display names and
+// usernames of the members in the list, ignoring case. Members whose names
+// start with the query come before those that only contain it, which come
+// before those that contain its characters in order. Members that match
+// equally well are in the list's order. At most limit results are returned,
+// or all of them if limit is 0 or less.
+//
+// Only the items that have been fetched are searched. See State.SearchList
+// for a search that asks Discord when there are too few results.
+func (l *List) Search(query string, limit int) []ListSearchResult {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return nil
+	}
+
+	type scored struct {
+		ListSearchResult
+		match Match
+	}
+
+	var results []scored
+
+	l.mu.Lock()
+	for i, item := range l.items {
+		if item.Member == nil {
+			continue
+		}
+
+		match := matchMember(query, &item.Member.Member)
+		if match == MatchNone {
+			continue
+		}
+
+		results = append(results, scored{
+			ListSearchResult: ListSearchResult{
+				Index:    i,
+				Member:   item.Member.Member,
+				Presence: item.Member.Presence,
+			},
+			match: match,
+		})
+	}
+	l.mu.Unlock()
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].match > results[j].match
+	})
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	found := make([]ListSearchResult, len(results))
+	for i, result := range results {
+		found[i] = result.ListSearchResult
+	}
+
+	return found
+}
+
+// matchName returns how well the lowercase query matches the name.
+func matchName(query, name string) Match {
+	switch fuzzy.MatchName(query, name, "") {
+	case fuzzy.Exact:
+		return MatchExact
+	case fuzzy.Prefix:
+		return MatchPrefix
+	case fuzzy.Substring:
+		return MatchSubstring
+	case fuzzy.Subsequence:
+		return MatchSubsequence
+	default:
+		return MatchNone
+	}
+}
+
+// SearchList searches the member list of the channel using List.Search. If it
+// finds fewer than limit members, or if the list hasn't been fetched, the
+// guild's members are also searched using SearchMember. The members that
+// Discord finds are put into the member store rather than the list, so
+// autocompleters should also look there once the GuildMembersChunkEvent
+// arrives, or use SearchMemberAsync to receive them directly.
+//
+// Autocompleters call SearchList on every keystroke, so the guild isn't
+// searched again for the query that it was last searched for, since those
+// members are already in the member store.
+func (m *State) SearchList(guildID discord.GuildID, chID discord.ChannelID, query string, limit int) []ListSearchResult {
+	var results []ListSearchResult
+
+	if list, err := m.GetMemberList(guildID, chID); err == nil {
+		results = list.Search(query, limit)
+	}
+
+	if limit <= 0 || len(results) < limit {
+		query = strings.ToLower(strings.TrimSpace(query))
+		if !m.searchedLast(guildID, query) {
+			m.SearchMember(guildID, query)
+		}
+	}
+
+	return results
+}
+
+// searchedLast returns true if the guild was last searched for the query.
+func (m *State) searchedLast(guildID discord.GuildID, query string) bool {
+	gd := m.guildState(guildID, false)
+	if gd == nil {
+		return false
+	}
+
+	gd.mut.Lock()
+	defer gd.mut.Unlock()
+
+	return gd.lastQuery == query
+}
+
+type pendingSearch struct {
+	ch      chan []discord.Member
+	members []discord.Member
+	chunks  int
+	timer   *time.Timer
+}
+
+// SearchMemberAsync is SearchMember, except the members that Discord finds are
+// sent to the returned channel once all of their chunks have arrived, after
+// which the channel is closed. The chunks are told apart from those of other
+// searches by their nonce.
+//
+// If the chunks don't arrive within SearchTimeout, the members that have
+// arrived so far are sent instead. The channel is closed without anything
+// being sent if the query is empty, if the search is throttled by
+// SearchFrequency, or if the command fails to send.
+func (m *State) SearchMemberAsync(guildID discord.GuildID, query string) <-chan []discord.Member {
+	nonce, search := m.addSearch()
+
+	if !m.searchMember(guildID, query, nonce, func() { m.cancelSearch(nonce, search) }) {
+		m.cancelSearch(nonce, search)
+	}
+
+	return search.ch
+}
+
+// addSearch adds a pending search with a new nonce.
+func (m *State) addSearch() (string, *pendingSearch) {
+	m.searchMu.Lock()
+	defer m.searchMu.Unlock()
+
+	m.searchNonce++
+	nonce := "ningen-search-" + strconv.FormatUint(m.searchNonce, 10)
+
+	search := &pendingSearch{ch: make(chan []discord.Member, 1)}
+	search.timer = time.AfterFunc(m.SearchTimeout, func() { m.finishSearch(nonce, search) })
+	m.searches[nonce] = search
+
+	return nonce, search
+}
+
+// onSearchChunk adds the members in the chunk to the search with the chunk's
+// nonce, if any, and finishes it once all chunks have arrived.
+func (m *State) onSearchChunk(c *gateway.GuildMembersChunkEvent) {
+	m.searchMu.Lock()
+	search, ok := m.searches[c.Nonce]
+	if !ok {
+		m.searchMu.Unlock()
+		return
+	}
+
+	search.members = append(search.members, c.Members...)
+	search.chunks++
+	done := search.chunks >= c.ChunkCount
+	m.searchMu.Unlock()
+
+	if done {
+		m.finishSearch(c.Nonce, search)
+	}
+}
+
+// finishSearch sends the members found so far and closes the channel.
+func (m *State) finishSearch(nonce string, search *pendingSearch) {
+	m.endSearch(nonce, search, true)
+}
+
+// cancelSearch closes the channel without sending anything.
+func (m *State) cancelSearch(nonce string, search *pendingSearch) {
+	m.endSearch(nonce, search, false)
+}
+
+func (m *State) endSearch(nonce string, search *pendingSearch, send bool) {
+	m.searchMu.Lock()
+	// The search may have already ended, such as by a timeout.
+	if current, ok := m.searches[nonce]; !ok || current != search {
+		m.searchMu.Unlock()
+		return
+	}
+	delete(m.searches, nonce)
+	search.timer.Stop()
+	members := search.members
+	m.searchMu.Unlock()
+
+	if send {
+		search.ch <- members
+	}
+	close(search.ch)
+}
@@ -0,0 +1,279 @@
+package member
+
+import (
+	"context"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+	"github.com/diamondburned/ningen/v3/trace"
+	"github.com/pkg/errors"
+)
+
+// GuildSubscription is what a guild is subscribed to in a
+// GuildSubscriptionsBulkCommand. It is undocumented.
+type GuildSubscription struct {
+	Typing     bool `json:"typing,omitempty"`
+	Threads    bool `json:"threads,omitempty"`
+	Activities bool `json:"activities,omitempty"`
+	// MemberUpdates subscribes to the member updates of the guild. It is
+	// ignored by GuildSubscribeCommand.
+	MemberUpdates bool `json:"member_updates,omitempty"`
+	// Channels contains the ranges of the member lists to subscribe to.
+	Channels map[discord.ChannelID][][2]int `json:"channels,omitempty"`
+	// ThreadMemberLists contains the threads whose member lists to request.
+	ThreadMemberLists []discord.ChannelID `json:"thread_member_lists,omitempty"`
+}
+
+// GuildSubscriptionsBulkCommand is a command for Op 37, which replaces
+// GuildSubscribeCommand by subscribing to several guilds at once. It is
+// undocumented.
+type GuildSubscriptionsBulkCommand struct {
+	Subscriptions map[discord.GuildID]GuildSubscription `json:"subscriptions"`
+}
+
+// Op implements ws.Event.
+func (*GuildSubscriptionsBulkCommand) Op() ws.OpCode { return 37 }
+
+// EventType implements ws.Event.
+func (*GuildSubscriptionsBulkCommand) EventType() ws.EventType { return "" }
+
+// CodeUnknownOpcode is the close code that the gateway closes the connection
+// with when it receives a command with an unknown op code.
+const CodeUnknownOpcode = 4001
+
+// SetBulkSubscriptions sets whether guild subscriptions are sent using
+// GuildSubscriptionsBulkCommand, which is the case by default. If they are
+// disabled, a GuildSubscribeCommand is sent for each guild instead, for
+// gateways that don't support the bulk command.
+//
+// Bulk subscriptions are disabled automatically if the gateway closes the
+// connection with CodeUnknownOpcode after a GuildSubscriptionsBulkCommand was
+// sent. The subscriptions are then sent again using GuildSubscribeCommand once
+// the gateway reconnects.
+func (m *State) SetBulkSubscriptions(enabled bool) {
+	m.guildMu.Lock()
+	defer m.guildMu.Unlock()
+
+	m.noBulk = !enabled
+}
+
+// BulkSubscriptions returns true if guild subscriptions are sent in bulk. See
+// SetBulkSubscriptions.
+func (m *State) BulkSubscriptions() bool {
+	m.guildMu.Lock()
+	defer m.guildMu.Unlock()
+
+	return !m.noBulk
+}
+
+// SendSubscriptions subscribes to the given guilds. The subscriptions are sent
+// in one GuildSubscriptionsBulkCommand, or in a GuildSubscribeCommand for each
+// guild if bulk subscriptions are disabled. Unlike Subscribe, the state
+// doesn't keep track of what is sent.
+func (m *State) SendSubscriptions(ctx context.Context, subs map[discord.GuildID]GuildSubscription) error {
+	if len(subs) == 0 {
+		return nil
+	}
+
+	m.guildMu.Lock()
+	bulk := !m.noBulk
+	m.bulkSent = m.bulkSent || bulk
+	m.guildMu.Unlock()
+
+	if bulk {
+		return m.Tracer.Send(ctx, m.state.Gateway(), trace.Subscriptions, &GuildSubscriptionsBulkCommand{
+			Subscriptions: subs,
+		})
+	}
+
+	for guildID, sub := range subs {
+		cmd := legacySubscribeCommand(guildID, sub)
+		if err := m.Tracer.Send(ctx, m.state.Gateway(), trace.Subscriptions, cmd); err != nil {
+			return errors.Wrapf(err, "failed to subscribe guild %d", guildID)
+		}
+	}
+
+	return nil
+}
+
+// onClose falls back to GuildSubscribeCommand if the gateway closed the
+// connection because it doesn't know GuildSubscriptionsBulkCommand. The
+// subscriptions that it rejected are replayed by Resubscribe once the gateway
+// reconnects, whether the session is resumed or not.
+func (m *State) onClose(ev *ws.CloseEvent) {
+	m.guildMu.Lock()
+	defer m.guildMu.Unlock()
+
+	bulkSent := m.bulkSent
+	m.bulkSent = false
+
+	if ev.Code != CodeUnknownOpcode || !bulkSent || m.noBulk {
+		return
+	}
+
+	m.noBulk = true
+	m.keepLostSubscriptions()
+}
+
+// legacySubscribeCommand returns the GuildSubscribeCommand for the guild's
+// subscription.
+func legacySubscribeCommand(guildID discord.GuildID, sub GuildSubscription) ws.Event {
+	cmd := gateway.GuildSubscribeCommand{
+		GuildID:    guildID,
+		Typing:     sub.Typing,
+		Threads:    sub.Threads,
+		Activities: sub.Activities,
+		Channels:   sub.Channels,
+	}
+
+	if len(sub.ThreadMemberLists) > 0 {
+		return &threadSubscribeCommand{
+			GuildSubscribeCommand: cmd,
+			ThreadMemberLists:     sub.ThreadMemberLists,
+		}
+	}
+
+	return &cmd
+}
+
+// SubscribeGuilds is Subscribe for several guilds at once. The guilds that
+// aren't subscribed yet are subscribed to in one command if bulk subscriptions
+// are enabled.
+//
+// The gateway command will be sent asynchronously.
+func (m *State) SubscribeGuilds(guildIDs ...discord.GuildID) {
+	if !m.LazyGuilds() {
+		return
+	}
+
+	subs := make(map[discord.GuildID]GuildSubscription, len(guildIDs))
+	guilds := make([]*Guild, 0, len(guildIDs))
+
+	for _, guildID := range guildIDs {
+		gd := m.guildState(guildID, true)
+		gd.mut.Lock()
+		// Skip if already subscribed.
+		if !gd.subscribed {
+			gd.subscribed = true
+			subs[guildID] = GuildSubscription{
+				Typing:     true,
+				Threads:    true,
+				Activities: true,
+			}
+			guilds = append(guilds, gd)
+		}
+		gd.mut.Unlock()
+	}
+
+	if len(subs) == 0 {
+		return
+	}
+
+	go func() {
+		if err := m.SendSubscriptions(context.Background(), subs); err != nil {
+			m.OnError(errors.Wrap(err, "Failed to subscribe guild"))
+
+			for _, gd := range guilds {
+				gd.mut.Lock()
+				gd.subscribed = false
+				gd.mut.Unlock()
+			}
+		}
+	}()
+}
+
+// Resubscribe sends the subscriptions that were lost when the gateway started
+// a new session, which are those of the guilds subscribed to with Subscribe
+// and of the member list ranges from SetVisibleRange. ningen calls it before
+// dispatching its ConnectedEvent. Resumed sessions keep their subscriptions,
+// so nothing is sent after a Resumed event.
+//
+// The gateway command will be sent asynchronously.
+func (m *State) Resubscribe() {
+	m.guildMu.Lock()
+	lost := m.lost
+	m.lost = nil
+	m.guildMu.Unlock()
+
+	if len(lost) == 0 || !m.LazyGuilds() {
+		return
+	}
+
+	subs := make(map[discord.GuildID]GuildSubscription, len(lost))
+	guilds := make([]*Guild, 0, len(lost))
+
+	for guildID, sub := range lost {
+		// The user may have left the guild in the meantime.
+		if _, err := m.state.Cabinet.Guild(guildID); err != nil {
+			continue
+		}
+
+		gd := m.guildState(guildID, true)
+
+		gd.mut.Lock()
+		gd.subscribed = true
+		gd.mut.Unlock()
+
+		if len(sub.Channels) > 0 {
+			gd.subMutex.Lock()
+			for chID, ranges := range sub.Channels {
+				gd.subChannels[chID] = ranges
+			}
+			gd.subMutex.Unlock()
+		}
+
+		subs[guildID] = sub
+		guilds = append(guilds, gd)
+	}
+
+	if len(subs) == 0 {
+		return
+	}
+
+	go func() {
+		if err := m.SendSubscriptions(context.Background(), subs); err != nil {
+			m.OnError(errors.Wrap(err, "Failed to resubscribe guilds"))
+
+			for _, gd := range guilds {
+				gd.mut.Lock()
+				gd.subscribed = false
+				gd.mut.Unlock()
+			}
+		}
+	}()
+}
+
+// keepLostSubscriptions adds the subscriptions of the current guilds to the
+// ones that Resubscribe replays. m.guildMu must be held.
+func (m *State) keepLostSubscriptions() {
+	for guildID, gd := range m.guilds {
+		gd.mut.Lock()
+		subscribed := gd.subscribed
+		gd.mut.Unlock()
+
+		if !subscribed {
+			continue
+		}
+
+		sub := GuildSubscription{
+			Typing:     true,
+			Threads:    true,
+			Activities: true,
+		}
+
+		gd.subMutex.Lock()
+		if len(gd.subChannels) > 0 {
+			sub.Channels = make(map[discord.ChannelID][][2]int, len(gd.subChannels))
+			for chID, ranges := range gd.subChannels {
+				sub.Channels[chID] = ranges
+			}
+		}
+		gd.subMutex.Unlock()
+
+		if m.lost == nil {
+			m.lost = make(map[discord.GuildID]GuildSubscription)
+		}
+		m.lost[guildID] = sub
+	}
+}
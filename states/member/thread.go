@@ -0,0 +1,209 @@
+package member
+
+import (
+	"context"
+	"sort"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+	"github.com/diamondburned/ningen/v3/handlerrepo"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	gateway.OpUnmarshalers.Add(
+		func() ws.Event { return new(ThreadMemberListUpdateEvent) },
+	)
+}
+
+// ThreadMemberListUpdateEvent is a dispatch event for
+// THREAD_MEMBER_LIST_UPDATE. Discord sends it with the full member list of a
+// thread after the thread's member list is requested using
+// RequestThreadMembers. It is undocumented.
+type ThreadMemberListUpdateEvent struct {
+	GuildID  discord.GuildID        `json:"guild_id"`
+	ThreadID discord.ChannelID      `json:"thread_id"`
+	Members  []discord.ThreadMember `json:"members"`
+}
+
+// Op implements ws.Event.
+func (*ThreadMemberListUpdateEvent) Op() ws.OpCode { return 0 }
+
+// EventType implements ws.Event.
+func (*ThreadMemberListUpdateEvent) EventType() ws.EventType {
+	return "THREAD_MEMBER_LIST_UPDATE"
+}
+
+// threadSubscribeCommand is GuildSubscribeCommand with the undocumented
+// thread_member_lists field, which arikawa doesn't have.
+type threadSubscribeCommand struct {
+	gateway.GuildSubscribeCommand
+	ThreadMemberLists []discord.ChannelID `json:"thread_member_lists"`
+}
+
+func (*threadSubscribeCommand) Op() ws.OpCode           { return 14 }
+func (*threadSubscribeCommand) EventType() ws.EventType { return "" }
+
+type threadList struct {
+	guildID discord.GuildID
+	members []discord.ThreadMember
+}
+
+func (m *State) addThreadHandlers(h handlerrepo.AddHandler) {
+	h.AddSyncHandler(func(*gateway.ReadyEvent) {
+		m.threadMu.Lock()
+		defer m.threadMu.Unlock()
+
+		m.threads = map[discord.ChannelID]*threadList{}
+	})
+
+	h.AddSyncHandler(m.onThreadMemberList)
+	h.AddSyncHandler(m.onThreadMembersUpdate)
+
+	h.AddSyncHandler(func(ev *gateway.ThreadDeleteEvent) {
+		m.threadMu.Lock()
+		defer m.threadMu.Unlock()
+
+		delete(m.threads, ev.ID)
+	})
+
+	h.AddSyncHandler(func(ev *gateway.GuildDeleteEvent) {
+		m.threadMu.Lock()
+		defer m.threadMu.Unlock()
+
+		for id, list := range m.threads {
+			if list.guildID == ev.ID {
+				delete(m.threads, id)
+			}
+		}
+	})
+}
+
+func (m *State) onThreadMemberList(ev *ThreadMemberListUpdateEvent) {
+	members := make([]discord.ThreadMember, len(ev.Members))
+
+	for i := range ev.Members {
+		m.setThreadMemberState(ev.GuildID, &ev.Members[i])
+
+		members[i] = ev.Members[i]
+		members[i].ID = ev.ThreadID
+		// The members and presences live in the cabinet.
+		members[i].Member = nil
+		members[i].Presence = nil
+	}
+
+	sortThreadMembers(members)
+
+	m.threadMu.Lock()
+	defer m.threadMu.Unlock()
+
+	m.threads[ev.ThreadID] = &threadList{
+		guildID: ev.GuildID,
+		members: members,
+	}
+}
+
+func (m *State) onThreadMembersUpdate(ev *gateway.ThreadMembersUpdateEvent) {
+	for i := range ev.AddedMembers {
+		m.setThreadMemberState(ev.GuildID, &ev.AddedMembers[i])
+	}
+
+	m.threadMu.Lock()
+	defer m.threadMu.Unlock()
+
+	// Only lists that were requested are kept, since the event doesn't
+	// carry the full list.
+	list, ok := m.threads[ev.ID]
+	if !ok {
+		return
+	}
+
+	for _, userID := range ev.RemovedMemberIDs {
+		if i := findThreadMember(list.members, userID); i > -1 {
+			list.members = append(list.members[:i], list.members[i+1:]...)
+		}
+	}
+
+	for _, member := range ev.AddedMembers {
+		member.ID = ev.ID
+		member.Member = nil
+		member.Presence = nil
+
+		if i := findThreadMember(list.members, member.UserID); i > -1 {
+			list.members[i] = member
+		} else {
+			list.members = append(list.members, member)
+		}
+	}
+
+	sortThreadMembers(list.members)
+}
+
+func (m *State) setThreadMemberState(guildID discord.GuildID, member *discord.ThreadMember) {
+	if member.Member != nil {
+		m.state.MemberSet(guildID, member.Member, false)
+	}
+	if member.Presence != nil {
+		m.state.PresenceSet(guildID, member.Presence, true)
+	}
+}
+
+func findThreadMember(members []discord.ThreadMember, userID discord.UserID) int {
+	for i, member := range members {
+		if member.UserID == userID {
+			return i
+		}
+	}
+	return -1
+}
+
+// sortThreadMembers sorts the members by when they joined, like the official
+// client.
+func sortThreadMembers(members []discord.ThreadMember) {
+	sort.SliceStable(members, func(i, j int) bool {
+		return members[i].JoinTimestamp.Time().Before(members[j].JoinTimestamp.Time())
+	})
+}
+
+// RequestThreadMembers asks Discord for the member list of the given thread.
+// The list is sent in a ThreadMemberListUpdateEvent, after which it can be
+// read using GetThreadMembers. It is kept up to date with the thread's member
+// updates afterwards.
+//
+// The gateway command will be sent asynchronously.
+func (m *State) RequestThreadMembers(guildID discord.GuildID, threadID discord.ChannelID) {
+	if !m.LazyGuilds() {
+		return
+	}
+
+	go func() {
+		err := m.SendSubscriptions(context.Background(), map[discord.GuildID]GuildSubscription{
+			guildID: {
+				Typing:            true,
+				Threads:           true,
+				Activities:        true,
+				ThreadMemberLists: []discord.ChannelID{threadID},
+			},
+		})
+		if err != nil {
+			m.OnError(errors.Wrap(err, "Failed to request thread members"))
+		}
+	}()
+}
+
+// GetThreadMembers returns the members of the given thread sorted by when they
+// joined. The members' guild member and presence are in the cabinet. It
+// returns ErrListNotFound if the list hasn't been received; see
+// RequestThreadMembers.
+func (m *State) GetThreadMembers(threadID discord.ChannelID) ([]discord.ThreadMember, error) {
+	m.threadMu.Lock()
+	defer m.threadMu.Unlock()
+
+	list, ok := m.threads[threadID]
+	if !ok {
+		return nil, ErrListNotFound
+	}
+
+	return append([]discord.ThreadMember(nil), list.members...), nil
+}
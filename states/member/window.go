@@ -0,0 +1,176 @@
+package member
+
+import (
+	"context"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/ningen/v3/prefetch"
+	"github.com/pkg/errors"
+)
+
+// MemberListChunkSize is the number of items in each range of a member list
+// subscription.
+const MemberListChunkSize = 100
+
+// SetVisibleRange declares that the items from start to end, inclusive, of
+// the channel's member list are visible, such as when the member list is
+// scrolled. The ranges that cover them are subscribed to, along with the first
+// range, which is always kept alive. Only MaxMemberChunk ranges besides the
+// first are subscribed to at once, starting from the one containing start.
+//
+// Only one channel of a guild has more than the first range subscribed to, so
+// the ranges of the other channels are reset. The subscribe command only
+// contains the channels whose ranges have changed, and nothing is sent if none
+// have. The ranges of the channel are returned.
+func (m *State) SetVisibleRange(chID discord.ChannelID, start, end int) [][2]int {
+	if !m.LazyGuilds() {
+		return nil
+	}
+
+	ch, err := m.state.Cabinet.Channel(chID)
+	if err != nil {
+		m.OnError(errors.Wrap(err, "Failed to get member list channel"))
+		return nil
+	}
+
+	m.minFetchMu.Lock()
+	m.minFetched[chID] = start / MemberListChunkSize
+	m.minFetchMu.Unlock()
+
+	return m.setVisibleRange(ch.GuildID, chID, start, end)
+}
+
+func (m *State) setVisibleRange(guildID discord.GuildID, chID discord.ChannelID, start, end int) [][2]int {
+	total := -1
+	if list, err := m.GetMemberList(guildID, chID); err == nil {
+		// Each group has a header item.
+		total = list.TotalVisible()
+		list.ViewGroups(func(groups []gateway.GuildMemberListGroup) {
+			total += len(groups)
+		})
+	}
+
+	ranges := visibleRanges(start, end, total)
+
+	guild := m.guildState(guildID, true)
+	changed := guild.setRanges(chID, ranges)
+	if changed == nil {
+		return ranges
+	}
+
+	guild.mut.Lock()
+	guild.subscribed = true
+	guild.mut.Unlock()
+
+	m.Scheduler.Go(context.Background(), prefetch.Visible, func(ctx context.Context) {
+		if ctx.Err() != nil {
+			// The ranges were never sent, so they are sent again the next
+			// time that they are set.
+			guild.forgetRanges(changed)
+			return
+		}
+
+		err := m.SendSubscriptions(ctx, map[discord.GuildID]GuildSubscription{
+			guildID: {
+				Typing:     true,
+				Activities: true,
+				Channels:   changed,
+			},
+		})
+
+		if err != nil {
+			m.OnError(errors.Wrap(err, "Failed to subscribe to member list"))
+		}
+	})
+
+	return ranges
+}
+
+// visibleRanges returns the ranges that cover the visible items from start to
+// end. The first range is always included, followed by at most MaxMemberChunk
+// ranges starting from the one containing start. Total is the number of items
+// in the list, or -1 if it isn't known, in which case the ranges aren't capped.
+func visibleRanges(start, end, total int) [][2]int {
+	if start < 0 {
+		start = 0
+	}
+	if end < start {
+		end = start
+	}
+
+	first := start / MemberListChunkSize
+	last := end / MemberListChunkSize
+
+	if total >= 0 {
+		lastChunk := 0
+		if total > 0 {
+			lastChunk = (total - 1) / MemberListChunkSize
+		}
+		if last > lastChunk {
+			last = lastChunk
+		}
+		if first > lastChunk {
+			first = lastChunk
+		}
+	}
+
+	// The first range is added regardless.
+	if first < 1 {
+		first = 1
+	}
+	if last-first+1 > MaxMemberChunk {
+		last = first + MaxMemberChunk - 1
+	}
+
+	ranges := make([][2]int, 1, 1+MaxMemberChunk)
+	ranges[0] = firstChunk[0]
+
+	for i := first; i <= last; i++ {
+		ranges = append(ranges, [2]int{
+			(i * MemberListChunkSize),
+			(i * MemberListChunkSize) + MemberListChunkSize - 1,
+		})
+	}
+
+	return ranges
+}
+
+// setRanges sets the ranges of the channel and resets the ranges of the other
+// channels to the first chunk. It returns the channels whose ranges have
+// changed, or nil if none have.
+func (g *Guild) setRanges(chID discord.ChannelID, ranges [][2]int) map[discord.ChannelID][][2]int {
+	g.subMutex.Lock()
+	defer g.subMutex.Unlock()
+
+	changed := map[discord.ChannelID][][2]int{}
+
+	for id, old := range g.subChannels {
+		if id != chID && !chunkEq(old, firstChunk) {
+			g.subChannels[id] = firstChunk
+			changed[id] = firstChunk
+		}
+	}
+
+	if old, ok := g.subChannels[chID]; !ok || !chunkEq(old, ranges) {
+		g.subChannels[chID] = ranges
+		changed[chID] = ranges
+	}
+
+	if len(changed) == 0 {
+		return nil
+	}
+
+	return changed
+}
+
+// forgetRanges forgets the ranges of the channels, so that setRanges treats
+// them as changed again.
+func (g *Guild) forgetRanges(ranges map[discord.ChannelID][][2]int) {
+	g.subMutex.Lock()
+	defer g.subMutex.Unlock()
+
+	for chID := range ranges {
+		delete(g.subChannels, chID)
+	}
+}
@@ -0,0 +1,343 @@
+// Package messages loads the message history of channels on demand, such as
+// when the user scrolls up in a channel.
+package messages
+
+import (
+	"context"
+	"sync"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/state"
+	"github.com/diamondburned/arikawa/v3/utils/httputil"
+	"github.com/diamondburned/ningen/v3/discordmd"
+	"github.com/diamondburned/ningen/v3/handlerrepo"
+	"github.com/diamondburned/ningen/v3/prefetch"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultLoadLimit is the number of messages that LoadMore loads if the
+	// limit is 0.
+	DefaultLoadLimit = 50
+	// MaxLoadLimit is the maximum number of messages that LoadMore loads at
+	// once, which is the most that Discord returns per request.
+	MaxLoadLimit = 100
+)
+
+type loadKey struct {
+	channelID discord.ChannelID
+	before    discord.MessageID
+}
+
+type loadCall struct {
+	done     chan struct{}
+	limit    uint
+	callers  int
+	messages []discord.Message
+	err      error
+}
+
+// State loads older messages of channels and keeps track of which channels
+// have been loaded to the top.
+type State struct {
+	// Scheduler schedules the fetches started by Prefetch and
+	// PrefetchAttachments. If nil, each fetch spawns its own goroutine.
+	Scheduler *prefetch.Scheduler
+
+	mutex sync.Mutex
+	state *state.State
+	top   map[discord.ChannelID]struct{}
+	// oldest is the oldest message loaded in each channel, which may no
+	// longer fit in the cabinet. It is kept even if the message is deleted,
+	// since it still marks where the loaded history ends.
+	oldest  map[discord.ChannelID]discord.MessageID
+	loading map[loadKey]*loadCall
+	// flags are the flags of the attachments of the loaded messages that
+	// have any, since discord.Attachment drops them.
+	flags map[discord.AttachmentID]attachmentFlags
+}
+
+// attachmentFlags are the flags of an attachment along with the message that
+// it belongs to, so that they can be dropped once the message is deleted.
+type attachmentFlags struct {
+	messageID discord.MessageID
+	flags     discordmd.AttachmentFlags
+}
+
+func NewState(state *state.State, r handlerrepo.AddHandler) *State {
+	messageState := &State{
+		state:   state,
+		top:     map[discord.ChannelID]struct{}{},
+		oldest:  map[discord.ChannelID]discord.MessageID{},
+		loading: map[loadKey]*loadCall{},
+		flags:   map[discord.AttachmentID]attachmentFlags{},
+	}
+
+	r.AddSyncHandler(func(*gateway.ReadyEvent) {
+		messageState.mutex.Lock()
+		defer messageState.mutex.Unlock()
+
+		messageState.top = map[discord.ChannelID]struct{}{}
+		messageState.oldest = map[discord.ChannelID]discord.MessageID{}
+		messageState.flags = map[discord.AttachmentID]attachmentFlags{}
+	})
+
+	r.AddSyncHandler(func(ev *gateway.ChannelDeleteEvent) {
+		messageState.mutex.Lock()
+		defer messageState.mutex.Unlock()
+
+		delete(messageState.top, ev.ID)
+		delete(messageState.oldest, ev.ID)
+	})
+
+	r.AddSyncHandler(func(ev *gateway.MessageDeleteEvent) {
+		messageState.forget([]discord.MessageID{ev.ID})
+	})
+
+	r.AddSyncHandler(func(ev *gateway.MessageDeleteBulkEvent) {
+		messageState.forget(ev.IDs)
+	})
+
+	return messageState
+}
+
+// LoadMore loads up to limit messages that were sent in the channel before the
+// given message, newest first. If before is null, the messages before the
+// oldest message loaded so far or in the cabinet are loaded, or the latest
+// messages if there are none.
+//
+// The loaded messages are added to the cabinet after the messages that it
+// already has, as long as it has room for them; newer messages are never
+// evicted for them. Concurrent calls for the same channel and message share
+// the same request.
+//
+// If fewer messages than requested are returned, the top of the channel has
+// been reached; see ReachedTop.
+func (s *State) LoadMore(chID discord.ChannelID, before discord.MessageID, limit uint) ([]discord.Message, error) {
+	if limit == 0 {
+		limit = DefaultLoadLimit
+	}
+	if limit > MaxLoadLimit {
+		limit = MaxLoadLimit
+	}
+
+	s.mutex.Lock()
+
+	if !before.IsValid() {
+		before = s.oldest[chID]
+
+		msgs, _ := s.state.Cabinet.Messages(chID)
+		if len(msgs) > 0 && (!before.IsValid() || msgs[len(msgs)-1].ID < before) {
+			before = msgs[len(msgs)-1].ID
+		}
+	}
+
+	key := loadKey{chID, before}
+
+	if call, ok := s.loading[key]; ok && call.limit >= limit {
+		call.callers++
+		s.mutex.Unlock()
+		<-call.done
+		return trim(call.messages, limit), call.err
+	}
+
+	call := &loadCall{
+		done:    make(chan struct{}),
+		limit:   limit,
+		callers: 1,
+	}
+	s.loading[key] = call
+
+	s.mutex.Unlock()
+
+	call.messages, call.err = s.load(chID, before, limit)
+	if call.err != nil {
+		call.err = errors.Wrap(call.err, "cannot load messages")
+	}
+
+	s.mutex.Lock()
+	if s.loading[key] == call {
+		delete(s.loading, key)
+	}
+	if call.err == nil {
+		if len(call.messages) > 0 {
+			oldest := call.messages[len(call.messages)-1].ID
+			if old, ok := s.oldest[chID]; !ok || oldest < old {
+				s.oldest[chID] = oldest
+			}
+		}
+		if uint(len(call.messages)) < limit {
+			s.top[chID] = struct{}{}
+		}
+	}
+	s.mutex.Unlock()
+
+	close(call.done)
+
+	return call.messages, call.err
+}
+
+func (s *State) load(chID discord.ChannelID, before discord.MessageID, limit uint) ([]discord.Message, error) {
+	var param struct {
+		Before discord.MessageID `schema:"before,omitempty"`
+		Limit  uint              `schema:"limit"`
+	}
+	param.Before = before
+	param.Limit = limit
+
+	// The messages are decoded along with the flags of their attachments.
+	var page []struct {
+		discord.Message
+		Attachments []discordmd.Attachment `json:"attachments"`
+	}
+
+	err := s.state.RequestJSON(
+		&page, "GET",
+		api.EndpointChannels+chID.String()+"/messages",
+		httputil.WithSchema(s.state.Client, param),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs := make([]discord.Message, len(page))
+
+	s.mutex.Lock()
+	for i, msg := range page {
+		msgs[i] = msg.Message
+		if len(msg.Attachments) == 0 {
+			continue
+		}
+
+		msgs[i].Attachments = make([]discord.Attachment, len(msg.Attachments))
+		for j, a := range msg.Attachments {
+			msgs[i].Attachments[j] = a.Attachment
+			if a.Flags != 0 {
+				s.flags[a.ID] = attachmentFlags{msg.ID, a.Flags}
+			}
+		}
+	}
+	s.mutex.Unlock()
+
+	var guildID discord.GuildID
+	if ch, err := s.state.Cabinet.Channel(chID); err == nil {
+		guildID = ch.GuildID
+	}
+
+	// The messages are newest first, which is the order that the cabinet
+	// appends them in.
+	for i := range msgs {
+		if !msgs[i].GuildID.IsValid() {
+			msgs[i].GuildID = guildID
+		}
+
+		s.state.Cabinet.MessageSet(&msgs[i], false)
+	}
+
+	return msgs, nil
+}
+
+func trim(msgs []discord.Message, limit uint) []discord.Message {
+	if uint(len(msgs)) > limit {
+		msgs = msgs[:limit]
+	}
+	return append([]discord.Message(nil), msgs...)
+}
+
+// Pending returns the number of LoadMore calls that are waiting for messages
+// to load, including the calls that share the load of another call.
+func (s *State) Pending() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var n int
+	for _, call := range s.loading {
+		n += call.callers
+	}
+	return n
+}
+
+// ReachedTop returns true if LoadMore has loaded the first message of the
+// channel.
+func (s *State) ReachedTop(chID discord.ChannelID) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, ok := s.top[chID]
+	return ok
+}
+
+// Prefetch loads the next page of the channel's history in the background
+// with the given priority, so that it is in the cabinet before the user
+// scrolls up, e.g. for the channels next to the visible one. Nothing is
+// loaded if the top of the channel has been reached or if ctx is canceled
+// before the fetch starts. Errors are ignored, since the messages are loaded
+// again by LoadMore once they are needed.
+func (s *State) Prefetch(ctx context.Context, chID discord.ChannelID, p prefetch.Priority) {
+	if s.ReachedTop(chID) {
+		return
+	}
+
+	s.Scheduler.Go(ctx, p, func(ctx context.Context) {
+		if ctx.Err() != nil {
+			return
+		}
+		s.LoadMore(chID, 0, 0)
+	})
+}
+
+// PrefetchAttachments schedules fetch to be called for each attachment of the
+// messages with the given priority, e.g. to download the images of the
+// messages that are about to scroll into view. ningen doesn't store files, so
+// fetch is what downloads and caches them. fetch isn't called for the
+// attachments whose fetches are dropped or canceled using ctx before they
+// start.
+func (s *State) PrefetchAttachments(
+	ctx context.Context, msgs []discord.Message, p prefetch.Priority,
+	fetch func(context.Context, discord.Attachment)) {
+
+	for _, msg := range msgs {
+		for _, a := range msg.Attachments {
+			a := a
+			s.Scheduler.Go(ctx, p, func(ctx context.Context) {
+				if ctx.Err() != nil {
+					return
+				}
+				fetch(ctx, a)
+			})
+		}
+	}
+}
+
+// AttachmentFlags returns the flags of the attachment of a message loaded by
+// LoadMore. The flags of the attachments of messages from the gateway aren't
+// known, since arikawa drops them, so they are 0.
+func (s *State) AttachmentFlags(id discord.AttachmentID) discordmd.AttachmentFlags {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.flags[id].flags
+}
+
+// forget drops the flags of the attachments of the deleted messages.
+func (s *State) forget(ids []discord.MessageID) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.flags) == 0 {
+		return
+	}
+
+	deleted := make(map[discord.MessageID]struct{}, len(ids))
+	for _, id := range ids {
+		deleted[id] = struct{}{}
+	}
+
+	for id, f := range s.flags {
+		if _, ok := deleted[f.messageID]; ok {
+			delete(s.flags, id)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package mute
+
+import (
+	"sort"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// LocalMutes are mutes that only exist in this client and are never synced to
+// Discord. They can be marshaled to persist them.
+type LocalMutes struct {
+	Guilds   []discord.GuildID   `json:"guilds,omitempty"`
+	Channels []discord.ChannelID `json:"channels,omitempty"`
+}
+
+// SetUseLocal sets whether local mutes are used. If they are, locally muted
+// guilds and channels are reported as muted by Guild, Channel, GuildSettings
+// and ChannelOverrides as if they were muted in the account settings, which
+// also affects unread indicators and notifications. Local mutes are kept
+// either way.
+func (m *State) SetUseLocal(useLocal bool) {
+	m.mutex.Lock()
+	m.useLocal = useLocal
+	m.mutex.Unlock()
+}
+
+// UsesLocal returns true if local mutes are used. See SetUseLocal.
+func (m *State) UsesLocal() bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.useLocal
+}
+
+// SetLocalGuild mutes or unmutes the guild locally.
+func (m *State) SetLocalGuild(guildID discord.GuildID, muted bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if muted {
+		m.localGuilds[guildID] = struct{}{}
+	} else {
+		delete(m.localGuilds, guildID)
+	}
+}
+
+// SetLocalChannel mutes or unmutes the channel locally. Like muted categories
+// in the account settings, a locally muted category mutes its channels.
+func (m *State) SetLocalChannel(channelID discord.ChannelID, muted bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if muted {
+		m.localChannels[channelID] = struct{}{}
+	} else {
+		delete(m.localChannels, channelID)
+	}
+}
+
+// LocalGuild returns true if the guild is muted locally, regardless of whether
+// local mutes are used.
+func (m *State) LocalGuild(guildID discord.GuildID) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	_, ok := m.localGuilds[guildID]
+	return ok
+}
+
+// LocalChannel returns true if the channel is muted locally, regardless of
+// whether local mutes are used.
+func (m *State) LocalChannel(channelID discord.ChannelID) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	_, ok := m.localChannels[channelID]
+	return ok
+}
+
+// LocalMutes returns all local mutes sorted by ID. They can be restored later
+// using LoadLocalMutes.
+func (m *State) LocalMutes() LocalMutes {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var mutes LocalMutes
+
+	if len(m.localGuilds) > 0 {
+		mutes.Guilds = make([]discord.GuildID, 0, len(m.localGuilds))
+		for id := range m.localGuilds {
+			mutes.Guilds = append(mutes.Guilds, id)
+		}
+		sort.Slice(mutes.Guilds, func(i, j int) bool { return mutes.Guilds[i] < mutes.Guilds[j] })
+	}
+
+	if len(m.localChannels) > 0 {
+		mutes.Channels = make([]discord.ChannelID, 0, len(m.localChannels))
+		for id := range m.localChannels {
+			mutes.Channels = append(mutes.Channels, id)
+		}
+		sort.Slice(mutes.Channels, func(i, j int) bool { return mutes.Channels[i] < mutes.Channels[j] })
+	}
+
+	return mutes
+}
+
+// LoadLocalMutes replaces all local mutes with the given ones, usually ones
+// that were persisted from LocalMutes.
+func (m *State) LoadLocalMutes(mutes LocalMutes) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.localGuilds = make(map[discord.GuildID]struct{}, len(mutes.Guilds))
+	for _, id := range mutes.Guilds {
+		m.localGuilds[id] = struct{}{}
+	}
+
+	m.localChannels = make(map[discord.ChannelID]struct{}, len(mutes.Channels))
+	for _, id := range mutes.Channels {
+		m.localChannels[id] = struct{}{}
+	}
+}
+
+// localGuild returns true if local mutes are used and the guild is muted
+// locally. m.mutex must be held.
+func (m *State) localGuild(guildID discord.GuildID) bool {
+	if !m.useLocal {
+		return false
+	}
+	_, ok := m.localGuilds[guildID]
+	return ok
+}
+
+// localChannel is localGuild for channels. m.mutex must be held.
+func (m *State) localChannel(channelID discord.ChannelID) bool {
+	if !m.useLocal {
+		return false
+	}
+	_, ok := m.localChannels[channelID]
+	return ok
+}
@@ -1,5 +1,6 @@
 // Package mute implements a channel/guild muted state. It automatically
-// updates.
+// updates. Guilds and channels can also be muted locally without changing the
+// account settings; see SetUseLocal.
 package mute
 
 import (
@@ -19,10 +20,18 @@ type State struct {
 	mutex    sync.RWMutex
 	guilds   map[discord.GuildID]gateway.UserGuildSetting
 	channels map[discord.ChannelID]gateway.UserChannelOverride
+
+	useLocal      bool
+	localGuilds   map[discord.GuildID]struct{}
+	localChannels map[discord.ChannelID]struct{}
 }
 
 func NewState(cab *store.Cabinet, r handlerrepo.AddHandler) *State {
-	mute := &State{cab: cab}
+	mute := &State{
+		cab:           cab,
+		localGuilds:   map[discord.GuildID]struct{}{},
+		localChannels: map[discord.ChannelID]struct{}{},
+	}
 
 	r.AddSyncHandler(func(r *gateway.ReadyEvent) {
 		mute.mutex.Lock()
@@ -68,8 +77,12 @@ func (m *State) Category(channelID discord.ChannelID) bool {
 func (m *State) Channel(channelID discord.ChannelID) bool {
 	m.mutex.RLock()
 	mute, ok := m.channels[channelID]
+	local := m.localChannel(channelID)
 	m.mutex.RUnlock()
 
+	if local {
+		return true
+	}
 	if !ok || muteConfigInvalid(mute.MuteConfig) {
 		return false
 	}
@@ -79,9 +92,14 @@ func (m *State) Channel(channelID discord.ChannelID) bool {
 func (m *State) ChannelOverrides(channelID discord.ChannelID) gateway.UserChannelOverride {
 	m.mutex.RLock()
 	override, ok := m.channels[channelID]
+	local := m.localChannel(channelID)
 	m.mutex.RUnlock()
 
 	if ok {
+		if local {
+			override.Muted = true
+			override.MuteConfig = nil
+		}
 		return override
 	}
 
@@ -92,6 +110,7 @@ func (m *State) ChannelOverrides(channelID discord.ChannelID) gateway.UserChanne
 	}
 
 	return gateway.UserChannelOverride{
+		Muted:         local,
 		Notifications: noti,
 		ChannelID:     channelID,
 	}
@@ -102,8 +121,12 @@ func (m *State) ChannelOverrides(channelID discord.ChannelID) gateway.UserChanne
 func (m *State) Guild(guildID discord.GuildID, everyone bool) bool {
 	m.mutex.RLock()
 	mute, ok := m.guilds[guildID]
+	local := m.localGuild(guildID)
 	m.mutex.RUnlock()
 
+	if local && !everyone {
+		return true
+	}
 	if !ok || muteConfigInvalid(mute.MuteConfig) {
 		return false
 	}
@@ -113,9 +136,14 @@ func (m *State) Guild(guildID discord.GuildID, everyone bool) bool {
 func (m *State) GuildSettings(guildID discord.GuildID) gateway.UserGuildSetting {
 	m.mutex.RLock()
 	setting, ok := m.guilds[guildID]
+	local := m.localGuild(guildID)
 	m.mutex.RUnlock()
 
 	if ok {
+		if local {
+			setting.Muted = true
+			setting.MuteConfig = nil
+		}
 		return setting
 	}
 
@@ -132,6 +160,7 @@ func (m *State) GuildSettings(guildID discord.GuildID) gateway.UserGuildSetting
 
 	return gateway.UserGuildSetting{
 		GuildID:       guildID,
+		Muted:         local,
 		Notifications: noti,
 	}
 }
@@ -1,19 +1,49 @@
 package note
 
 import (
+	"context"
+	"fmt"
 	"sync"
+	"unicode/utf8"
 
 	"github.com/diamondburned/arikawa/v3/discord"
 	"github.com/diamondburned/arikawa/v3/gateway"
 	"github.com/diamondburned/arikawa/v3/state"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
 	"github.com/diamondburned/ningen/v3/handlerrepo"
+	"github.com/diamondburned/ningen/v3/prefetch"
+	"github.com/diamondburned/ningen/v3/readyextra"
+	"github.com/pkg/errors"
 )
 
+// UpdateEvent is dispatched when the known note of a user changes, including
+// when SetNote optimistically changes it and when it is reverted because
+// Discord rejected it.
+type UpdateEvent struct {
+	UserID discord.UserID
+	Note   string
+}
+
+var _ gateway.Event = (*UpdateEvent)(nil)
+
+func (ev UpdateEvent) Op() ws.OpCode           { return -1 }
+func (ev UpdateEvent) EventType() ws.EventType { return "__note.UpdateEvent" }
+
 type State struct {
+	// Scheduler schedules note fetches. If nil, each fetch spawns its own
+	// goroutine.
+	Scheduler *prefetch.Scheduler
+	// ReadyExtras shares the decoded extras of the Ready event. If nil, the
+	// notes decode them on their own.
+	ReadyExtras *readyextra.Cache
+
 	mutex    sync.Mutex
 	state    *state.State
 	notes    map[discord.UserID]string
 	fetching map[discord.UserID]struct{}
+
+	// ordered dispatches UpdateEvents in order per user.
+	ordered handlerrepo.Ordered
 }
 
 func NewState(state *state.State, r handlerrepo.AddHandler) *State {
@@ -23,18 +53,39 @@ func NewState(state *state.State, r handlerrepo.AddHandler) *State {
 		fetching: map[discord.UserID]struct{}{},
 	}
 
-	r.AddSyncHandler(func(u *gateway.UserNoteUpdateEvent) {
+	r.AddSyncHandler(func(r *gateway.ReadyEvent) {
+		// Depending on the capabilities, the notes may not be in the Ready
+		// event, in which case they are fetched as needed.
+		notes := noteState.ReadyExtras.Of(r).Notes
+		if notes == nil {
+			return
+		}
+
 		noteState.mutex.Lock()
 		defer noteState.mutex.Unlock()
 
-		noteState.notes[u.ID] = u.Note
+		noteState.notes = make(map[discord.UserID]string, len(notes))
+		for userID, note := range notes {
+			noteState.notes[userID] = note
+		}
+	})
+
+	r.AddSyncHandler(func(u *gateway.UserNoteUpdateEvent) {
+		noteState.set(u.ID, u.Note)
 	})
 
 	return noteState
 }
 
-// Note returns the note for the given user, or an empty string if none.
+// Note returns the note for the given user, or an empty string if none. If the
+// note isn't known yet, it is fetched in the background.
 func (s *State) Note(userID discord.UserID) string {
+	return s.NoteContext(context.Background(), userID)
+}
+
+// NoteContext is Note, except the fetch is skipped if ctx is canceled before it
+// starts, e.g. because the view that shows the note was closed.
+func (s *State) NoteContext(ctx context.Context, userID discord.UserID) string {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
@@ -49,15 +100,118 @@ func (s *State) Note(userID discord.UserID) string {
 
 	s.fetching[userID] = struct{}{}
 
-	go func() {
-		note, _ := s.state.Note(userID)
+	s.Scheduler.Go(ctx, prefetch.Visible, func(ctx context.Context) {
+		defer func() {
+			s.mutex.Lock()
+			delete(s.fetching, userID)
+			s.mutex.Unlock()
+		}()
 
-		s.mutex.Lock()
-		defer s.mutex.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
 
-		s.notes[userID] = note
-		delete(s.fetching, userID)
-	}()
+		note, _ := s.state.WithContext(ctx).Note(userID)
+		s.set(userID, note)
+	})
 
 	return ""
 }
+
+// NoteMaxLength is the maximum number of characters that Discord allows in a
+// user note.
+const NoteMaxLength = 256
+
+// NoteTooLongError is returned by SetNote and ValidateNote if the note is
+// longer than NoteMaxLength.
+type NoteTooLongError struct {
+	Length int
+}
+
+// Error implements error.
+func (err *NoteTooLongError) Error() string {
+	return fmt.Sprintf("note is too long (%d/%d characters)", err.Length, NoteMaxLength)
+}
+
+// ValidateNote checks the note before it is sent to Discord. A
+// *NoteTooLongError is returned if the note is too long.
+func ValidateNote(note string) error {
+	if n := utf8.RuneCountInString(note); n > NoteMaxLength {
+		return &NoteTooLongError{Length: n}
+	}
+	return nil
+}
+
+// TruncateNote truncates the note to at most NoteMaxLength characters. The
+// note is returned as-is if it is already short enough.
+func TruncateNote(note string) string {
+	var n int
+	for i := range note {
+		if n == NoteMaxLength {
+			return note[:i]
+		}
+		n++
+	}
+	return note
+}
+
+// set sets the note and dispatches an UpdateEvent if it changed.
+func (s *State) set(userID discord.UserID, note string) {
+	s.mutex.Lock()
+	old, ok := s.notes[userID]
+	s.notes[userID] = note
+	s.mutex.Unlock()
+
+	if !ok || old != note {
+		s.dispatch(&UpdateEvent{UserID: userID, Note: note})
+	}
+}
+
+// dispatch dispatches ev in the background; see handlerrepo.Ordered.
+func (s *State) dispatch(ev *UpdateEvent) {
+	s.ordered.Go(discord.Snowflake(ev.UserID), func() {
+		s.state.Handler.Call(ev)
+	})
+}
+
+// SetNote validates and sets the note for the given user. The local state is
+// updated optimistically before the note is sent. If Discord rejects the note,
+// the previous note is restored, unless the note has changed again since. The
+// UserNoteUpdateEvent that Discord sends back has the final say.
+func (s *State) SetNote(userID discord.UserID, note string) error {
+	if err := ValidateNote(note); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	previous, known := s.notes[userID]
+	s.mutex.Unlock()
+
+	s.set(userID, note)
+
+	if err := s.state.SetNote(userID, note); err != nil {
+		s.mutex.Lock()
+		reverted := s.notes[userID] == note
+		if reverted {
+			if known {
+				s.notes[userID] = previous
+			} else {
+				delete(s.notes, userID)
+			}
+		}
+		s.mutex.Unlock()
+
+		if reverted {
+			s.dispatch(&UpdateEvent{UserID: userID, Note: previous})
+		}
+
+		return errors.Wrap(err, "cannot set note")
+	}
+
+	return nil
+}
+
+// Flush behaves like handlerrepo.Ordered.Flush for the state's events.
+func (s *State) Flush(ctx context.Context) error {
+	return s.ordered.Flush(ctx)
+}
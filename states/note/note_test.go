@@ -0,0 +1,45 @@
+package note
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateNote(t *testing.T) {
+	if err := ValidateNote(strings.Repeat("a", NoteMaxLength)); err != nil {
+		t.Fatal("unexpected error for max length note:", err)
+	}
+
+	// Multi-byte characters count as one character each.
+	if err := ValidateNote(strings.Repeat("é", NoteMaxLength)); err != nil {
+		t.Fatal("unexpected error for max length multi-byte note:", err)
+	}
+
+	err := ValidateNote(strings.Repeat("a", NoteMaxLength+1))
+
+	var tooLong *NoteTooLongError
+	if !errors.As(err, &tooLong) {
+		t.Fatalf("expected *NoteTooLongError, got %v", err)
+	}
+	if tooLong.Length != NoteMaxLength+1 {
+		t.Fatalf("expected length %d, got %d", NoteMaxLength+1, tooLong.Length)
+	}
+}
+
+func TestTruncateNote(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"hello", "hello"},
+		{strings.Repeat("a", NoteMaxLength+10), strings.Repeat("a", NoteMaxLength)},
+		{strings.Repeat("é", NoteMaxLength+1), strings.Repeat("é", NoteMaxLength)},
+	}
+
+	for _, test := range tests {
+		if got := TruncateNote(test.in); got != test.want {
+			t.Errorf("TruncateNote(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
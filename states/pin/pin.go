@@ -0,0 +1,272 @@
+// Package pin provides a cache of pinned messages per channel.
+package pin
+
+import (
+	"context"
+	"sync"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/state"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+	"github.com/diamondburned/ningen/v3/handlerrepo"
+	"github.com/pkg/errors"
+)
+
+// UpdateEvent is dispatched when the cached pinned messages of a channel
+// change.
+type UpdateEvent struct {
+	ChannelID discord.ChannelID
+	// Pins are the pinned messages of the channel, newest pin first.
+	Pins []discord.Message
+}
+
+var _ gateway.Event = (*UpdateEvent)(nil)
+
+func (ev UpdateEvent) Op() ws.OpCode           { return -1 }
+func (ev UpdateEvent) EventType() ws.EventType { return "__pin.UpdateEvent" }
+
+type channelPins struct {
+	messages []discord.Message
+	// expected is the number of ChannelPinsUpdateEvents caused by our own
+	// changes that have not arrived yet. Those events don't invalidate the
+	// cache, since it has already been updated.
+	expected int
+}
+
+// State caches the pinned messages of channels.
+type State struct {
+	mutex sync.Mutex
+	state *state.State
+	pins  map[discord.ChannelID]*channelPins
+
+	// ordered dispatches UpdateEvents in order per channel.
+	ordered handlerrepo.Ordered
+}
+
+func NewState(state *state.State, r handlerrepo.AddHandler) *State {
+	pinState := &State{
+		state: state,
+		pins:  map[discord.ChannelID]*channelPins{},
+	}
+
+	r.AddSyncHandler(func(*gateway.ReadyEvent) {
+		pinState.mutex.Lock()
+		defer pinState.mutex.Unlock()
+
+		pinState.pins = map[discord.ChannelID]*channelPins{}
+	})
+
+	r.AddSyncHandler(func(ev *gateway.ChannelPinsUpdateEvent) {
+		pinState.mutex.Lock()
+		defer pinState.mutex.Unlock()
+
+		pins, ok := pinState.pins[ev.ChannelID]
+		if !ok {
+			return
+		}
+
+		if pins.expected > 0 {
+			pins.expected--
+			return
+		}
+
+		// Someone else changed the pins. Refetch on the next Pins call.
+		delete(pinState.pins, ev.ChannelID)
+	})
+
+	r.AddSyncHandler(func(ev *gateway.MessageUpdateEvent) {
+		pinState.mutex.Lock()
+		defer pinState.mutex.Unlock()
+
+		pins, ok := pinState.pins[ev.ChannelID]
+		if !ok {
+			return
+		}
+
+		for i := range pins.messages {
+			if pins.messages[i].ID == ev.ID {
+				pins.messages[i] = ev.Message
+				return
+			}
+		}
+	})
+
+	r.AddSyncHandler(func(ev *gateway.MessageDeleteEvent) {
+		pinState.remove(ev.ChannelID, ev.ID)
+	})
+
+	return pinState
+}
+
+// Pins returns the pinned messages of the given channel, newest pin first.
+// The pins are fetched if they're not cached.
+func (s *State) Pins(chID discord.ChannelID) ([]discord.Message, error) {
+	if pins, ok := s.Cached(chID); ok {
+		return pins, nil
+	}
+
+	msgs, err := s.state.PinnedMessages(chID)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot fetch pinned messages")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.pins[chID] = &channelPins{messages: msgs}
+	return append([]discord.Message(nil), msgs...), nil
+}
+
+// Cached returns the cached pinned messages of the given channel without
+// fetching them.
+func (s *State) Cached(chID discord.ChannelID) ([]discord.Message, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	pins, ok := s.pins[chID]
+	if !ok {
+		return nil, false
+	}
+
+	return append([]discord.Message(nil), pins.messages...), true
+}
+
+// Pin pins the given message. The cache is updated before the API call and
+// reverted if it fails.
+func (s *State) Pin(chID discord.ChannelID, msgID discord.MessageID, reason api.AuditLogReason) error {
+	msg, err := s.state.Cabinet.Message(chID, msgID)
+	if err != nil {
+		msg = &discord.Message{ID: msgID, ChannelID: chID}
+	}
+
+	pinned := *msg
+	pinned.Pinned = true
+
+	var old []discord.Message
+	var cached bool
+
+	s.update(chID, func(pins *channelPins) {
+		old, cached = pins.messages, true
+		pins.messages = append([]discord.Message{pinned}, removeMessage(pins.messages, msgID)...)
+		pins.expected++
+	})
+
+	if err := s.state.PinMessage(chID, msgID, reason); err != nil {
+		if cached {
+			s.revert(chID, old)
+		}
+		return errors.Wrap(err, "cannot pin message")
+	}
+
+	return nil
+}
+
+// Unpin unpins the given message. The cache is updated before the API call
+// and reverted if it fails.
+func (s *State) Unpin(chID discord.ChannelID, msgID discord.MessageID, reason api.AuditLogReason) error {
+	var old []discord.Message
+	var cached bool
+
+	s.update(chID, func(pins *channelPins) {
+		old, cached = pins.messages, true
+		pins.messages = removeMessage(pins.messages, msgID)
+		pins.expected++
+	})
+
+	if err := s.state.UnpinMessage(chID, msgID, reason); err != nil {
+		if cached {
+			s.revert(chID, old)
+		}
+		return errors.Wrap(err, "cannot unpin message")
+	}
+
+	return nil
+}
+
+// revert restores the pins from before a failed Pin or Unpin.
+func (s *State) revert(chID discord.ChannelID, old []discord.Message) {
+	s.update(chID, func(pins *channelPins) {
+		pins.messages = old
+		pins.expected--
+	})
+}
+
+// update changes the cached pins using fn and dispatches an UpdateEvent. It
+// does nothing if the channel's pins aren't cached, since they'll be fetched
+// fresh anyway.
+func (s *State) update(chID discord.ChannelID, fn func(*channelPins)) {
+	s.mutex.Lock()
+
+	pins, ok := s.pins[chID]
+	if !ok {
+		s.mutex.Unlock()
+		return
+	}
+
+	fn(pins)
+
+	ev := &UpdateEvent{
+		ChannelID: chID,
+		Pins:      append([]discord.Message(nil), pins.messages...),
+	}
+
+	s.mutex.Unlock()
+
+	s.dispatch(ev)
+}
+
+// dispatch dispatches ev in the background; see handlerrepo.Ordered.
+func (s *State) dispatch(ev *UpdateEvent) {
+	s.ordered.Go(discord.Snowflake(ev.ChannelID), func() {
+		s.state.Handler.Call(ev)
+	})
+}
+
+func (s *State) remove(chID discord.ChannelID, msgID discord.MessageID) {
+	s.mutex.Lock()
+
+	pins, ok := s.pins[chID]
+	if !ok || !containsMessage(pins.messages, msgID) {
+		s.mutex.Unlock()
+		return
+	}
+
+	pins.messages = removeMessage(pins.messages, msgID)
+
+	ev := &UpdateEvent{
+		ChannelID: chID,
+		Pins:      append([]discord.Message(nil), pins.messages...),
+	}
+
+	s.mutex.Unlock()
+
+	s.dispatch(ev)
+}
+
+func containsMessage(msgs []discord.Message, id discord.MessageID) bool {
+	for _, msg := range msgs {
+		if msg.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// removeMessage returns msgs without the message with the given ID. msgs is
+// not modified.
+func removeMessage(msgs []discord.Message, id discord.MessageID) []discord.Message {
+	filtered := make([]discord.Message, 0, len(msgs))
+	for _, msg := range msgs {
+		if msg.ID != id {
+			filtered = append(filtered, msg)
+		}
+	}
+	return filtered
+}
+
+// Flush behaves like handlerrepo.Ordered.Flush for the state's events.
+func (s *State) Flush(ctx context.Context) error {
+	return s.ordered.Flush(ctx)
+}
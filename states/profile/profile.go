@@ -0,0 +1,308 @@
+// Package profile fetches and caches user profiles, which have what profile
+// popovers show that the user object doesn't, such as the bio and the
+// connected accounts.
+package profile
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/state"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+	"github.com/diamondburned/ningen/v3/handlerrepo"
+	"github.com/diamondburned/ningen/v3/prefetch"
+	"github.com/pkg/errors"
+)
+
+// DefaultTTL is the duration that profiles are cached for if the State's TTL
+// is 0.
+const DefaultTTL = 10 * time.Minute
+
+// DefaultErrorTTL is the duration that fetch errors are cached for if the
+// State's ErrorTTL is 0. It is short, since most errors are transient.
+const DefaultErrorTTL = 10 * time.Second
+
+// Badge is a badge shown on a profile.
+type Badge struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+	// Icon is the hash of the badge's icon.
+	Icon string `json:"icon"`
+	// Link is where clicking the badge leads to, if anywhere.
+	Link string `json:"link,omitempty"`
+}
+
+// IconURL returns the URL of the badge's icon.
+func (b Badge) IconURL() string {
+	return "https://cdn.discordapp.com/badge-icons/" + b.Icon + ".png"
+}
+
+// MutualGuild is a guild that the current user shares with the profile's
+// user.
+type MutualGuild struct {
+	ID discord.GuildID `json:"id"`
+	// Nick is the user's nickname in the guild, if they have one.
+	Nick string `json:"nick"`
+}
+
+// Profile is a user's profile.
+type Profile struct {
+	User     discord.User
+	Bio      string
+	Pronouns string
+	// ConnectedAccounts are the accounts that the user shows on their
+	// profile.
+	ConnectedAccounts []discord.Connection
+	// PremiumSince is when the user subscribed to Nitro. It is zero if they
+	// aren't subscribed.
+	PremiumSince discord.Timestamp
+	// PremiumGuildSince is when the user started boosting a guild. It is zero
+	// if they aren't boosting any.
+	PremiumGuildSince discord.Timestamp
+	Badges            []Badge
+	// GuildBadges are the badges of the user in the guild that the profile
+	// was fetched for, which is never the case for profiles fetched by State.
+	GuildBadges   []Badge
+	MutualGuilds  []MutualGuild
+	MutualFriends []discord.User
+	// FetchedAt is when the profile was fetched.
+	FetchedAt time.Time
+}
+
+// profileResponse is the response of the user profile endpoint.
+type profileResponse struct {
+	User        discord.User `json:"user"`
+	UserProfile struct {
+		Bio      string `json:"bio"`
+		Pronouns string `json:"pronouns"`
+	} `json:"user_profile"`
+	ConnectedAccounts []discord.Connection `json:"connected_accounts"`
+	PremiumSince      discord.Timestamp    `json:"premium_since"`
+	PremiumGuildSince discord.Timestamp    `json:"premium_guild_since"`
+	Badges            []Badge              `json:"badges"`
+	GuildBadges       []Badge              `json:"guild_badges"`
+	MutualGuilds      []MutualGuild        `json:"mutual_guilds"`
+	MutualFriends     []discord.User       `json:"mutual_friends"`
+}
+
+// UpdateEvent is dispatched when a profile is fetched.
+type UpdateEvent struct {
+	Profile *Profile
+}
+
+var _ gateway.Event = (*UpdateEvent)(nil)
+
+func (ev UpdateEvent) Op() ws.OpCode           { return -1 }
+func (ev UpdateEvent) EventType() ws.EventType { return "__profile.UpdateEvent" }
+
+// entry is a cached profile, or the error of fetching it.
+type entry struct {
+	profile *Profile
+	err     error
+	fetched time.Time
+}
+
+// call is an in-flight profile fetch.
+type call struct {
+	done    chan struct{}
+	profile *Profile
+	err     error
+}
+
+// State fetches and caches user profiles. Profiles are treated as read-only,
+// since they are shared between callers.
+type State struct {
+	// Scheduler schedules the fetches started by Profile. If nil, each fetch
+	// spawns its own goroutine.
+	Scheduler *prefetch.Scheduler
+	// TTL is the duration that profiles are cached for. If it is 0,
+	// DefaultTTL is used.
+	TTL time.Duration
+	// ErrorTTL is the duration that fetch errors are cached for, during which
+	// the profile isn't fetched again. If it is 0, DefaultErrorTTL is used.
+	ErrorTTL time.Duration
+
+	mutex    sync.Mutex
+	state    *state.State
+	profiles map[discord.UserID]entry
+	calls    map[discord.UserID]*call
+	// queued are the users whose profiles Profile has scheduled a fetch for.
+	queued map[discord.UserID]struct{}
+}
+
+func NewState(state *state.State, r handlerrepo.AddHandler) *State {
+	profileState := &State{
+		state:    state,
+		profiles: map[discord.UserID]entry{},
+		calls:    map[discord.UserID]*call{},
+		queued:   map[discord.UserID]struct{}{},
+	}
+
+	// The mutual guilds and friends of every profile change when the current
+	// user's guilds or friends do.
+	reset := func() {
+		profileState.mutex.Lock()
+		profileState.profiles = map[discord.UserID]entry{}
+		profileState.mutex.Unlock()
+	}
+
+	r.AddSyncHandler(func(*gateway.ReadyEvent) { reset() })
+	r.AddSyncHandler(func(*gateway.GuildCreateEvent) { reset() })
+	r.AddSyncHandler(func(*gateway.GuildDeleteEvent) { reset() })
+	r.AddSyncHandler(func(*gateway.RelationshipAddEvent) { reset() })
+	r.AddSyncHandler(func(*gateway.RelationshipRemoveEvent) { reset() })
+
+	r.AddSyncHandler(func(ev *gateway.GuildMemberAddEvent) {
+		profileState.Invalidate(ev.User.ID)
+	})
+	r.AddSyncHandler(func(ev *gateway.GuildMemberRemoveEvent) {
+		profileState.Invalidate(ev.User.ID)
+	})
+	r.AddSyncHandler(func(ev *gateway.UserUpdateEvent) {
+		profileState.Invalidate(ev.ID)
+	})
+
+	return profileState
+}
+
+// fresh returns true if the cached entry hasn't expired yet.
+func (s *State) fresh(e entry) bool {
+	ttl := s.TTL
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+
+	if e.err != nil {
+		ttl = s.ErrorTTL
+		if ttl == 0 {
+			ttl = DefaultErrorTTL
+		}
+	}
+
+	return time.Since(e.fetched) < ttl
+}
+
+// Profile returns the cached profile of the user, or nil if it isn't cached.
+// If the profile isn't cached or has expired, it is fetched in the
+// background, and an UpdateEvent is dispatched once it is. Expired profiles
+// are still returned until then. The fetch is skipped if ctx is canceled
+// before it starts, e.g. because the popover that shows the profile was
+// closed.
+func (s *State) Profile(ctx context.Context, userID discord.UserID) *Profile {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e, ok := s.profiles[userID]
+	if ok && s.fresh(e) {
+		return e.profile
+	}
+
+	if _, ok := s.calls[userID]; ok {
+		return e.profile
+	}
+	if _, ok := s.queued[userID]; ok {
+		return e.profile
+	}
+
+	s.queued[userID] = struct{}{}
+
+	s.Scheduler.Go(ctx, prefetch.Visible, func(ctx context.Context) {
+		defer func() {
+			s.mutex.Lock()
+			delete(s.queued, userID)
+			s.mutex.Unlock()
+		}()
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		s.Fetch(ctx, userID)
+	})
+
+	return e.profile
+}
+
+// Fetch returns the profile of the user, fetching it if it isn't cached or has
+// expired. Concurrent fetches of the same profile share a single request. The
+// error of a failed fetch is cached for ErrorTTL, so that a failing profile
+// isn't requested over and over.
+func (s *State) Fetch(ctx context.Context, userID discord.UserID) (*Profile, error) {
+	s.mutex.Lock()
+
+	if e, ok := s.profiles[userID]; ok && s.fresh(e) {
+		s.mutex.Unlock()
+		return e.profile, e.err
+	}
+
+	c, ok := s.calls[userID]
+	if !ok {
+		c = &call{done: make(chan struct{})}
+		s.calls[userID] = c
+		go s.fetch(userID, c)
+	}
+
+	s.mutex.Unlock()
+
+	select {
+	case <-c.done:
+		return c.profile, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// fetch fetches the profile for the call. It isn't bound to the context of
+// any caller, since the result is shared.
+func (s *State) fetch(userID discord.UserID, c *call) {
+	var resp profileResponse
+
+	err := s.state.RequestJSON(
+		&resp, "GET",
+		api.EndpointUsers+userID.String()+"/profile?with_mutual_guilds=true&with_mutual_friends=true",
+	)
+	if err != nil {
+		c.err = errors.Wrap(err, "cannot fetch user profile")
+	} else {
+		c.profile = &Profile{
+			User:              resp.User,
+			Bio:               resp.UserProfile.Bio,
+			Pronouns:          resp.UserProfile.Pronouns,
+			ConnectedAccounts: resp.ConnectedAccounts,
+			PremiumSince:      resp.PremiumSince,
+			PremiumGuildSince: resp.PremiumGuildSince,
+			Badges:            resp.Badges,
+			GuildBadges:       resp.GuildBadges,
+			MutualGuilds:      resp.MutualGuilds,
+			MutualFriends:     resp.MutualFriends,
+			FetchedAt:         time.Now(),
+		}
+	}
+
+	s.mutex.Lock()
+	delete(s.calls, userID)
+	s.profiles[userID] = entry{
+		profile: c.profile,
+		err:     c.err,
+		fetched: time.Now(),
+	}
+	s.mutex.Unlock()
+
+	close(c.done)
+
+	if c.profile != nil {
+		s.state.Handler.Call(&UpdateEvent{Profile: c.profile})
+	}
+}
+
+// Invalidate removes the cached profile of the user, so that it is fetched
+// again the next time it is needed.
+func (s *State) Invalidate(userID discord.UserID) {
+	s.mutex.Lock()
+	delete(s.profiles, userID)
+	s.mutex.Unlock()
+}
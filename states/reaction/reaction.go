@@ -0,0 +1,217 @@
+// Package reaction keeps track of message reactions independently of the
+// message store, so that reaction counts survive messages being evicted.
+package reaction
+
+import (
+	"context"
+	"sync"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/state"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+	"github.com/diamondburned/ningen/v3/handlerrepo"
+	"github.com/diamondburned/ningen/v3/states/emoji"
+)
+
+// UpdateEvent is dispatched when the reactions of a message change.
+type UpdateEvent struct {
+	ChannelID discord.ChannelID
+	MessageID discord.MessageID
+}
+
+var _ gateway.Event = (*UpdateEvent)(nil)
+
+func (ev UpdateEvent) Op() ws.OpCode           { return -1 }
+func (ev UpdateEvent) EventType() ws.EventType { return "__reaction.UpdateEvent" }
+
+// State keeps track of the reactions of messages.
+type State struct {
+	mutex    sync.Mutex
+	state    *state.State
+	channels map[discord.ChannelID]map[discord.MessageID][]discord.Reaction
+
+	// ordered dispatches UpdateEvents in order per channel.
+	ordered handlerrepo.Ordered
+}
+
+func NewState(state *state.State, r handlerrepo.AddHandler) *State {
+	reactionState := &State{
+		state:    state,
+		channels: map[discord.ChannelID]map[discord.MessageID][]discord.Reaction{},
+	}
+
+	r.AddSyncHandler(func(*gateway.ReadyEvent) {
+		reactionState.mutex.Lock()
+		defer reactionState.mutex.Unlock()
+
+		reactionState.channels = map[discord.ChannelID]map[discord.MessageID][]discord.Reaction{}
+	})
+
+	r.AddSyncHandler(func(ev *gateway.MessageReactionAddEvent) {
+		reactionState.edit(ev.ChannelID, ev.MessageID, func(reactions []discord.Reaction, counted bool) []discord.Reaction {
+			me := reactionState.isMe(ev.UserID)
+
+			if i := find(reactions, ev.Emoji); i > -1 {
+				if !counted {
+					reactions[i].Count++
+				}
+				// The message store doesn't set Me for existing reactions.
+				reactions[i].Me = reactions[i].Me || me
+				return reactions
+			}
+
+			return append(reactions, discord.Reaction{
+				Count: 1,
+				Me:    me,
+				Emoji: ev.Emoji,
+			})
+		})
+	})
+
+	r.AddSyncHandler(func(ev *gateway.MessageReactionRemoveEvent) {
+		reactionState.edit(ev.ChannelID, ev.MessageID, func(reactions []discord.Reaction, counted bool) []discord.Reaction {
+			i := find(reactions, ev.Emoji)
+			if i == -1 {
+				return reactions
+			}
+
+			if !counted {
+				reactions[i].Count--
+			}
+			if reactionState.isMe(ev.UserID) {
+				reactions[i].Me = false
+			}
+
+			if reactions[i].Count < 1 {
+				reactions = append(reactions[:i], reactions[i+1:]...)
+			}
+
+			return reactions
+		})
+	})
+
+	r.AddSyncHandler(func(ev *gateway.MessageReactionRemoveAllEvent) {
+		reactionState.edit(ev.ChannelID, ev.MessageID, func([]discord.Reaction, bool) []discord.Reaction {
+			return nil
+		})
+	})
+
+	r.AddSyncHandler(func(ev *gateway.MessageReactionRemoveEmojiEvent) {
+		reactionState.edit(ev.ChannelID, ev.MessageID, func(reactions []discord.Reaction, counted bool) []discord.Reaction {
+			if i := find(reactions, ev.Emoji); i > -1 {
+				reactions = append(reactions[:i], reactions[i+1:]...)
+			}
+			return reactions
+		})
+	})
+
+	r.AddSyncHandler(func(ev *gateway.MessageDeleteEvent) {
+		reactionState.mutex.Lock()
+		defer reactionState.mutex.Unlock()
+
+		delete(reactionState.channels[ev.ChannelID], ev.ID)
+	})
+
+	r.AddSyncHandler(func(ev *gateway.MessageDeleteBulkEvent) {
+		reactionState.mutex.Lock()
+		defer reactionState.mutex.Unlock()
+
+		for _, id := range ev.IDs {
+			delete(reactionState.channels[ev.ChannelID], id)
+		}
+	})
+
+	r.AddSyncHandler(func(ev *gateway.ChannelDeleteEvent) {
+		reactionState.mutex.Lock()
+		defer reactionState.mutex.Unlock()
+
+		delete(reactionState.channels, ev.ID)
+	})
+
+	return reactionState
+}
+
+func (s *State) isMe(userID discord.UserID) bool {
+	me, err := s.state.Cabinet.Me()
+	return err == nil && me.ID == userID
+}
+
+func find(reactions []discord.Reaction, e discord.Emoji) int {
+	for i, r := range reactions {
+		if emoji.SameEmoji(r.Emoji, e) {
+			return i
+		}
+	}
+	return -1
+}
+
+// edit applies fn onto a copy of the message's reactions and dispatches an
+// UpdateEvent. If the message's reactions aren't known yet, they start from
+// the message store, in which case counted is true, since the store has
+// already counted the event; if the message isn't in the store either, they
+// start empty.
+func (s *State) edit(
+	chID discord.ChannelID, msgID discord.MessageID,
+	fn func(reactions []discord.Reaction, counted bool) []discord.Reaction) {
+
+	s.mutex.Lock()
+
+	messages, ok := s.channels[chID]
+	if !ok {
+		messages = map[discord.MessageID][]discord.Reaction{}
+		s.channels[chID] = messages
+	}
+
+	reactions, ok := messages[msgID]
+	if ok {
+		reactions = fn(append([]discord.Reaction(nil), reactions...), false)
+	} else if m, err := s.state.Cabinet.Message(chID, msgID); err == nil {
+		reactions = fn(append([]discord.Reaction(nil), m.Reactions...), true)
+	} else {
+		reactions = fn(nil, false)
+	}
+
+	messages[msgID] = reactions
+	s.mutex.Unlock()
+
+	// The event is dispatched in the background, since edit is called from
+	// the handlers of the reaction events.
+	s.ordered.Go(discord.Snowflake(chID), func() {
+		s.state.Handler.Call(&UpdateEvent{ChannelID: chID, MessageID: msgID})
+	})
+}
+
+// Reactions returns the reactions of the given message. If the state hasn't
+// seen any reaction event for the message, the reactions are taken from the
+// message store. Reactions of messages that are in neither only count the
+// events received since the message was first seen.
+func (s *State) Reactions(chID discord.ChannelID, msgID discord.MessageID) []discord.Reaction {
+	s.mutex.Lock()
+	reactions, ok := s.channels[chID][msgID]
+	s.mutex.Unlock()
+
+	if ok {
+		return append([]discord.Reaction(nil), reactions...)
+	}
+
+	m, err := s.state.Cabinet.Message(chID, msgID)
+	if err != nil {
+		return nil
+	}
+
+	return append([]discord.Reaction(nil), m.Reactions...)
+}
+
+// Reacted returns true if the current user reacted to the given message with
+// the given emoji.
+func (s *State) Reacted(chID discord.ChannelID, msgID discord.MessageID, e discord.Emoji) bool {
+	reactions := s.Reactions(chID, msgID)
+	i := find(reactions, e)
+	return i > -1 && reactions[i].Me
+}
+
+// Flush behaves like handlerrepo.Ordered.Flush for the state's events.
+func (s *State) Flush(ctx context.Context) error {
+	return s.ordered.Flush(ctx)
+}
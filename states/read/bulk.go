@@ -0,0 +1,105 @@
+package read
+
+import (
+	"log"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/httputil"
+)
+
+// BulkAckLimit is the maximum number of channels acked in a single bulk ack
+// request.
+const BulkAckLimit = 100
+
+type bulkAckEntry struct {
+	ChannelID discord.ChannelID `json:"channel_id"`
+	MessageID discord.MessageID `json:"message_id"`
+}
+
+// MarkGuildRead marks all channels of the guild as read. See MarkChannelsRead.
+func (r *State) MarkGuildRead(guildID discord.GuildID) {
+	chs, err := r.state.Cabinet.Channels(guildID)
+	if err != nil {
+		return
+	}
+
+	chIDs := make([]discord.ChannelID, len(chs))
+	for i, ch := range chs {
+		chIDs[i] = ch.ID
+	}
+
+	r.MarkChannelsRead(chIDs...)
+}
+
+// MarkChannelsRead marks the given channels as read up to their last message.
+// The read states are updated before it returns, and one UpdateEvent is
+// dispatched per channel that changed. The acks are sent in the background
+// using Discord's bulk ack endpoint. It does nothing in passive mode.
+func (r *State) MarkChannelsRead(chIDs ...discord.ChannelID) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.passive {
+		return
+	}
+
+	var entries []bulkAckEntry
+
+	for _, chID := range chIDs {
+		ch, _ := r.state.Cabinet.Channel(chID)
+		if ch == nil || !ch.LastMessageID.IsValid() {
+			continue
+		}
+
+		rs, ok := r.states[chID]
+		if !ok {
+			rs = &gateway.ReadState{ChannelID: chID}
+			r.states[chID] = rs
+		}
+
+		if rs.LastMessageID >= ch.LastMessageID && rs.MentionCount == 0 {
+			continue
+		}
+
+		rs.LastMessageID = ch.LastMessageID
+		rs.MentionCount = 0
+		delete(r.mentions, chID)
+
+		r.versions.send(chID, ch.LastMessageID)
+		entries = append(entries, bulkAckEntry{chID, ch.LastMessageID})
+
+		r.announce(rs, 0, false)
+	}
+
+	for len(entries) > 0 {
+		n := len(entries)
+		if n > BulkAckLimit {
+			n = BulkAckLimit
+		}
+
+		batch := entries[:n]
+		entries = entries[n:]
+
+		r.pending.goTrack(func() { r.bulkAck(batch) })
+	}
+}
+
+func (r *State) bulkAck(entries []bulkAckEntry) {
+	body := struct {
+		ReadStates []bulkAckEntry `json:"read_states"`
+	}{entries}
+
+	err := r.state.FastRequest(
+		"POST", api.Endpoint+"read-states/ack-bulk",
+		httputil.WithJSONBody(body),
+	)
+	if err != nil {
+		log.Println("Discord: bulk message ack failed:", err)
+
+		for _, entry := range entries {
+			r.revert(entry.ChannelID, entry.MessageID)
+		}
+	}
+}
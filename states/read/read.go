@@ -2,7 +2,7 @@
 package read
 
 import (
-	"encoding/json"
+	"context"
 	"log"
 	"sync"
 
@@ -12,8 +12,13 @@ import (
 	"github.com/diamondburned/arikawa/v3/state"
 	"github.com/diamondburned/arikawa/v3/utils/ws"
 	"github.com/diamondburned/ningen/v3/handlerrepo"
+	"github.com/diamondburned/ningen/v3/readyextra"
 )
 
+// UpdateEvent is dispatched when a read state changes. The UpdateEvents and
+// CorrectionEvents of a channel are dispatched in the order of the changes
+// that caused them. Only synchronous handlers are guaranteed to see them in
+// that order, since asynchronous handlers each run in their own goroutine.
 type UpdateEvent struct {
 	gateway.ReadState
 	GuildID discord.GuildID
@@ -26,46 +31,147 @@ func (ev UpdateEvent) Op() ws.OpCode           { return -1 }
 func (ev UpdateEvent) EventType() ws.EventType { return "__read.UpdateEvent" }
 
 type State struct {
+	// ReadyExtras shares the decoded extras of the Ready event. If nil, the
+	// read states decode them on their own.
+	ReadyExtras *readyextra.Cache
+
 	mutex  sync.Mutex
 	state  *state.State
 	states map[discord.ChannelID]*gateway.ReadState
 
 	selfID discord.UserID
+
+	// deleted keeps track of the last deleted message of each channel whose
+	// last message got deleted, so that ChannelUpdate events carrying the
+	// stale last message ID can be corrected.
+	deleted map[discord.ChannelID]discord.MessageID
+
+	// mentions keeps track of the unread messages that mentioned the user in
+	// each channel, along with how many times, so that the mention count can
+	// be lowered when they're deleted.
+	mentions map[discord.ChannelID]map[discord.MessageID]int
+
+	// versions keeps track of the read state version of each channel; see
+	// Version.
+	versions versions
+
+	passive bool
+
+	pending pending
+}
+
+// pending tracks in-flight acks and update events. It is used over a
+// sync.WaitGroup because work may be added while Flush is waiting.
+type pending struct {
+	mutex sync.Mutex
+	count int
+	done  chan struct{}
+
+	ordered handlerrepo.Ordered
+}
+
+var closedCh = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// goTrack runs fn in a goroutine and tracks it until it returns.
+func (p *pending) goTrack(fn func()) {
+	p.add()
+
+	go func() {
+		defer p.finish()
+		fn()
+	}()
+}
+
+// goOrdered is like goTrack, except functions of the same channel run one
+// after another in the order that goOrdered was called. It is used for
+// dispatching events, so that a channel's events arrive in the same order as
+// the read state changes that caused them.
+func (p *pending) goOrdered(chID discord.ChannelID, fn func()) {
+	p.add()
+
+	p.ordered.Go(discord.Snowflake(chID), func() {
+		defer p.finish()
+		fn()
+	})
+}
+
+func (p *pending) add() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.count == 0 {
+		p.done = make(chan struct{})
+	}
+	p.count++
+}
+
+func (p *pending) finish() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.count--
+	if p.count == 0 {
+		close(p.done)
+	}
+}
+
+func (p *pending) len() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.count
+}
+
+func (p *pending) wait() <-chan struct{} {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.count == 0 {
+		return closedCh
+	}
+	return p.done
 }
 
 func NewState(state *state.State, r handlerrepo.AddHandler) *State {
 	readstate := &State{
-		state:  state,
-		states: make(map[discord.ChannelID]*gateway.ReadState),
+		state:    state,
+		states:   make(map[discord.ChannelID]*gateway.ReadState),
+		deleted:  make(map[discord.ChannelID]discord.MessageID),
+		mentions: make(map[discord.ChannelID]map[discord.MessageID]int),
 	}
+	readstate.versions.reset()
 
 	r.AddSyncHandler(func(r *gateway.ReadyEvent) {
-		// Discord sucks massive fucking balls.
-		// They sometimes do this. Probably because of the .capabilities field.
-		// Not sure why.
-		var undocumentedWeirdness struct {
-			ReadStates struct {
-				Entries []gateway.ReadState `json:"entries"`
-			} `json:"read_state"`
-		}
-		json.Unmarshal(r.RawEventBody, &undocumentedWeirdness)
+		// With the versioned read states capability, the read states are in
+		// an object that arikawa doesn't decode.
+		extras := readstate.ReadyExtras.Of(r)
 
 		readstate.mutex.Lock()
 		defer readstate.mutex.Unlock()
 
 		readstate.selfID = r.User.ID
+		readstate.deleted = make(map[discord.ChannelID]discord.MessageID)
+		readstate.mentions = make(map[discord.ChannelID]map[discord.MessageID]int)
+		readstate.versions.reset()
 
 		for i, rs := range r.ReadStates {
 			readstate.states[rs.ChannelID] = &r.ReadStates[i]
 		}
-		for i, rs := range undocumentedWeirdness.ReadStates.Entries {
-			readstate.states[rs.ChannelID] = &undocumentedWeirdness.ReadStates.Entries[i]
+		if extras.ReadStates.Versioned {
+			for _, rs := range extras.ReadStates.Entries {
+				// The extras are shared, so they must not be modified.
+				rs := rs
+				readstate.states[rs.ChannelID] = &rs
+			}
 		}
 	})
 
 	r.AddSyncHandler(func(a *gateway.MessageAckEvent) {
-		// do not send a duplicate ack
-		readstate.markRead(a.ChannelID, a.MessageID, false)
+		readstate.serverAck(a.ChannelID, a.MessageID, true)
 	})
 
 	r.AddSyncHandler(func(c *gateway.MessageCreateEvent) {
@@ -78,7 +184,8 @@ func NewState(state *state.State, r handlerrepo.AddHandler) *State {
 
 		selfID := readstate.SelfID()
 		if c.Author.ID == selfID {
-			readstate.markRead(c.ChannelID, c.ID, false)
+			// Discord marks our own messages as read.
+			readstate.serverAck(c.ChannelID, c.ID, false)
 			return
 		}
 
@@ -92,9 +199,125 @@ func NewState(state *state.State, r handlerrepo.AddHandler) *State {
 		readstate.MarkUnread(c.ChannelID, c.ID, mentions)
 	})
 
+	r.AddSyncHandler(func(d *gateway.MessageDeleteEvent) {
+		readstate.reconcile(d.ChannelID, []discord.MessageID{d.ID})
+	})
+
+	r.AddSyncHandler(func(d *gateway.MessageDeleteBulkEvent) {
+		readstate.reconcile(d.ChannelID, d.IDs)
+	})
+
+	r.AddSyncHandler(func(c *gateway.ChannelUpdateEvent) {
+		readstate.reconcile(c.ID, nil)
+	})
+
 	return readstate
 }
 
+// reconcile recomputes the effective last message of the channel after the
+// given messages are deleted, or after the channel is updated if deletedIDs is
+// nil, and announces the corrected read indication. Without this, a channel
+// whose last unread message is deleted would stay unread forever. The deleted
+// messages that mentioned the user are also taken off the mention count.
+func (r *State) reconcile(chID discord.ChannelID, deletedIDs []discord.MessageID) {
+	ch, _ := r.state.Cabinet.Channel(chID)
+	if ch == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	mentionsChanged := r.forgetMentions(chID, deletedIDs)
+	lastChanged := r.correctLast(ch, deletedIDs)
+	if !mentionsChanged && !lastChanged {
+		return
+	}
+
+	rs, ok := r.states[chID]
+	if !ok {
+		return
+	}
+
+	unread := channelIsUnread(ch, rs.LastMessageID)
+	rscp := *rs
+
+	r.pending.goOrdered(chID, func() {
+		r.state.Call(&UpdateEvent{
+			ReadState: rscp,
+			GuildID:   ch.GuildID,
+			Unread:    unread,
+		})
+	})
+}
+
+// forgetMentions lowers the mention count of the channel by the mentions of
+// the deleted messages that are still unread. It returns true if the count
+// changed. r.mutex must be held.
+func (r *State) forgetMentions(chID discord.ChannelID, deletedIDs []discord.MessageID) bool {
+	mentions := r.mentions[chID]
+	rs, ok := r.states[chID]
+	if len(mentions) == 0 || !ok {
+		return false
+	}
+
+	var forgotten int
+	for _, id := range deletedIDs {
+		if n, ok := mentions[id]; ok {
+			delete(mentions, id)
+			if id > rs.LastMessageID {
+				forgotten += n
+			}
+		}
+	}
+
+	if len(mentions) == 0 {
+		delete(r.mentions, chID)
+	}
+
+	if forgotten == 0 || rs.MentionCount == 0 {
+		return false
+	}
+
+	rs.MentionCount -= forgotten
+	if rs.MentionCount < 0 {
+		rs.MentionCount = 0
+	}
+	return true
+}
+
+// correctLast sets the channel's last message to the latest message in the
+// cabinet if its last message was deleted. It returns true if it did so.
+// r.mutex must be held.
+func (r *State) correctLast(ch *discord.Channel, deletedIDs []discord.MessageID) bool {
+	if deletedIDs != nil {
+		if !containsMessageID(deletedIDs, ch.LastMessageID) {
+			return false
+		}
+		r.deleted[ch.ID] = ch.LastMessageID
+	} else {
+		// The channel may have been updated with the deleted message as its
+		// last message.
+		if last, ok := r.deleted[ch.ID]; !ok || ch.LastMessageID != last {
+			return false
+		}
+	}
+
+	// The cabinet has already removed the deleted message, so the latest
+	// cached message is the effective last message. If there are none, then
+	// the effective last message is unknown: there may be newer messages
+	// that were never loaded, so the channel is left as it is.
+	msgs, _ := r.state.Cabinet.Messages(ch.ID)
+	if len(msgs) == 0 {
+		return false
+	}
+
+	ch.LastMessageID = msgs[0].ID
+	r.state.ChannelSet(ch, true)
+
+	return true
+}
+
 func (r *State) SelfID() discord.UserID {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
@@ -102,15 +325,24 @@ func (r *State) SelfID() discord.UserID {
 	return r.selfID
 }
 
-// ReadState gets the read state for a channel.
+// ReadState gets a copy of the read state for a channel.
 func (r *State) ReadState(channelID discord.ChannelID) *gateway.ReadState {
+	if s, ok := r.Entry(channelID); ok {
+		return &s
+	}
+	return nil
+}
+
+// Entry is like ReadState, except the read state is returned by value. It is
+// meant for callers that check many channels at once.
+func (r *State) Entry(channelID discord.ChannelID) (gateway.ReadState, bool) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
 	if s, ok := r.states[channelID]; ok && s.LastMessageID.IsValid() {
-		return s
+		return *s, true
 	}
-	return nil
+	return gateway.ReadState{}, false
 }
 
 func (r *State) MarkUnread(chID discord.ChannelID, msgID discord.MessageID, mentions int) {
@@ -126,6 +358,15 @@ func (r *State) MarkUnread(chID discord.ChannelID, msgID discord.MessageID, ment
 	}
 
 	rs.MentionCount += mentions
+	if mentions > 0 {
+		if r.mentions[chID] == nil {
+			r.mentions[chID] = make(map[discord.MessageID]int)
+		}
+		r.mentions[chID][msgID] += mentions
+	}
+
+	// A new message supersedes any deleted last message.
+	delete(r.deleted, chID)
 
 	ch, _ := r.state.Cabinet.Channel(chID)
 	if ch == nil {
@@ -144,6 +385,7 @@ func (r *State) MarkUnread(chID discord.ChannelID, msgID discord.MessageID, ment
 			rs.LastMessageID = msgID
 			// Reset the mentions as well.
 			rs.MentionCount = 0
+			delete(r.mentions, chID)
 		}
 	}
 
@@ -151,7 +393,7 @@ func (r *State) MarkUnread(chID discord.ChannelID, msgID discord.MessageID, ment
 	// latest message's ID. We don't check for inequality since the latest
 	// message may have been deleted, leading to us trying to mark a deleted
 	// message.
-	unread := rs.LastMessageID < msgID
+	unread := channelIsUnread(ch, rs.LastMessageID)
 	rscp := *rs
 
 	// Force callbacks to run in a goroutine. This is because MarkRead and
@@ -159,25 +401,86 @@ func (r *State) MarkUnread(chID discord.ChannelID, msgID discord.MessageID, ment
 	// these callbacks may occupy the main loop. It may also run in any other
 	// goroutine, making it impossible to properly synchronize these callbacks.
 	// Doing this helps making a consistent synchronizing behavior.
-	go func() {
+	r.pending.goOrdered(chID, func() {
 		// Announce that there is a change.
 		r.state.Call(&UpdateEvent{
 			ReadState: rscp,
 			GuildID:   ch.GuildID,
 			Unread:    unread,
 		})
-	}()
+	})
 }
 
+// MarkRead marks the channel as read up to the given message and sends an ack
+// in the background. It does nothing in passive mode.
+//
+// The read state of a forum is the aggregate of the read states of its posts,
+// so marking a forum as read marks the posts that the user follows as read,
+// along with the forum itself, in one bulk ack; see MarkChannelsRead. Posts
+// without a read state never make the forum unread, so they aren't acked.
 func (r *State) MarkRead(chID discord.ChannelID, msgID discord.MessageID) {
+	if ch, _ := r.state.Cabinet.Channel(chID); ch != nil && ch.Type == discord.GuildForum {
+		r.MarkChannelsRead(r.forumChannels(ch)...)
+		return
+	}
+
 	// send ack
 	r.markRead(chID, msgID, true)
 }
 
+// forumChannels returns the IDs of the forum and its posts in the cabinet
+// that have a read state.
+func (r *State) forumChannels(forum *discord.Channel) []discord.ChannelID {
+	chIDs := []discord.ChannelID{forum.ID}
+
+	chs, _ := r.state.Cabinet.Channels(forum.GuildID)
+	for _, ch := range chs {
+		if ch.ParentID != forum.ID {
+			continue
+		}
+		if _, ok := r.Entry(ch.ID); ok {
+			chIDs = append(chIDs, ch.ID)
+		}
+	}
+
+	return chIDs
+}
+
+// channelIsUnread returns true if the channel has messages after the given
+// one. Forums are never unread by themselves, since their last message is
+// really their last post.
+func channelIsUnread(ch *discord.Channel, lastReadID discord.MessageID) bool {
+	return ch.Type != discord.GuildForum && lastReadID < ch.LastMessageID
+}
+
+// SetPassive sets whether the state is in passive mode. In passive mode, the
+// state never acks and MarkRead does nothing; the read states only mirror the
+// acks made by the user's other devices, which arrive as soon as they're made.
+// It is meant for notification daemons and bridges that observe the read
+// states without affecting them.
+func (r *State) SetPassive(passive bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.passive = passive
+}
+
+// IsPassive returns true if the state is in passive mode. See SetPassive.
+func (r *State) IsPassive() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.passive
+}
+
 func (r *State) markRead(chID discord.ChannelID, msgID discord.MessageID, sendack bool) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
+	if sendack && r.passive {
+		return
+	}
+
 	rs, ok := r.states[chID]
 	if !ok {
 		rs = &gateway.ReadState{
@@ -192,10 +495,17 @@ func (r *State) markRead(chID discord.ChannelID, msgID discord.MessageID, sendac
 		return
 	}
 
+	// Never move the read state backwards locally, since the newer read
+	// state may have come from another device.
+	if sendack && msgID < rs.LastMessageID {
+		return
+	}
+
 	// Update.
 	// prevMessageID := rs.LastMessageID
 	rs.LastMessageID = msgID
 	rs.MentionCount = 0
+	delete(r.mentions, chID)
 
 	// Send out Ack in the background, but only if we explicitly want to, that
 	// is, if MarkRead is called and sendAck is true. In the event that the
@@ -211,14 +521,15 @@ func (r *State) markRead(chID discord.ChannelID, msgID discord.MessageID, sendac
 		// ours, then ack.
 		if m.Author.ID != r.selfID {
 			// log.Println("ningen: actually acking", chID, "for message", msgID, "was", prevMessageID)
-			go r.ack(chID, msgID)
+			r.versions.send(chID, msgID)
+			r.pending.goTrack(func() { r.ack(chID, msgID) })
 		}
 	}
 
 	// copy
 	rscp := *rs
 
-	go func() {
+	r.pending.goOrdered(chID, func() {
 		ch, _ := r.state.Cabinet.Channel(chID)
 		if ch == nil {
 			return
@@ -230,12 +541,49 @@ func (r *State) markRead(chID discord.ChannelID, msgID discord.MessageID, sendac
 			GuildID:   ch.GuildID,
 			Unread:    false,
 		})
-	}()
+	})
+}
+
+func containsMessageID(ids []discord.MessageID, id discord.MessageID) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Flush blocks until all acks sent by MarkRead and all pending UpdateEvents
+// are done, or until ctx is done, in which case ctx's error is returned. It
+// should be called before exiting, so that the server-side read state matches
+// what the user has seen.
+func (r *State) Flush(ctx context.Context) error {
+	select {
+	case <-r.pending.wait():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pending returns the number of acks and read state updates that are still in
+// flight.
+func (r *State) Pending() int {
+	return r.pending.len()
+}
+
+// Len returns the number of read states known.
+func (r *State) Len() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return len(r.states)
 }
 
 func (r *State) ack(chID discord.ChannelID, msgID discord.MessageID) {
 	if err := r.state.Ack(chID, msgID, &api.Ack{}); err != nil {
 		log.Println("Discord: message ack failed:", err)
+		r.revert(chID, msgID)
 	}
 }
 
@@ -251,3 +599,18 @@ func (r *State) TotalMentionCount() int {
 	}
 	return total
 }
+
+// Mentioned returns the read states of the channels that mention the current
+// user.
+func (r *State) Mentioned() []gateway.ReadState {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var states []gateway.ReadState
+	for _, rs := range r.states {
+		if rs.MentionCount > 0 {
+			states = append(states, *rs)
+		}
+	}
+	return states
+}
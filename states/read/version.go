@@ -0,0 +1,151 @@
+package read
+
+import (
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+)
+
+// CorrectionEvent is dispatched after an UpdateEvent when the read state that
+// was optimistically set by MarkRead turns out to be wrong, either because
+// another device moved the read state back or because the ack failed.
+type CorrectionEvent struct {
+	UpdateEvent
+	// Previous is the last read message ID before the correction.
+	Previous discord.MessageID
+}
+
+var _ gateway.Event = (*CorrectionEvent)(nil)
+
+func (ev CorrectionEvent) Op() ws.OpCode           { return -1 }
+func (ev CorrectionEvent) EventType() ws.EventType { return "__read.CorrectionEvent" }
+
+// versions keeps track of what the server has acknowledged for each channel.
+// It is guarded by State's mutex.
+type versions struct {
+	// version is the number of acks that the server has sent.
+	version map[discord.ChannelID]uint64
+	// acked is the last message ID acknowledged by the server.
+	acked map[discord.ChannelID]discord.MessageID
+	// sending is the message ID of our ack that is still in flight.
+	sending map[discord.ChannelID]discord.MessageID
+}
+
+func (v *versions) reset() {
+	v.version = map[discord.ChannelID]uint64{}
+	v.acked = map[discord.ChannelID]discord.MessageID{}
+	v.sending = map[discord.ChannelID]discord.MessageID{}
+}
+
+func (v *versions) send(chID discord.ChannelID, msgID discord.MessageID) {
+	v.sending[chID] = msgID
+}
+
+// Version returns the number of acks that the server has sent for the channel
+// since Ready, including the acks made by other devices. arikawa's
+// gateway.MessageAckEvent doesn't decode the version of the read state, so it
+// is counted instead; the gateway delivers the acks in the order that the
+// server made them, so a read state with a higher version is still newer.
+func (r *State) Version(chID discord.ChannelID) uint64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.versions.version[chID]
+}
+
+// serverAck applies an ack that the server has made, which may have come from
+// another device. The server is preferred over the local state, unless our own
+// newer ack is still in flight. Acks arrive in the order that the server made
+// them, so the last one is always the newest. counted is true for the acks
+// sent as MESSAGE_ACK, as opposed to our own messages that Discord marks as
+// read.
+func (r *State) serverAck(chID discord.ChannelID, msgID discord.MessageID, counted bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if counted {
+		r.versions.version[chID]++
+	}
+
+	rs, ok := r.states[chID]
+	if !ok {
+		rs = &gateway.ReadState{ChannelID: chID}
+		r.states[chID] = rs
+	}
+
+	r.versions.acked[chID] = msgID
+
+	sending, isSending := r.versions.sending[chID]
+	if isSending && sending == msgID {
+		delete(r.versions.sending, chID)
+	}
+
+	// Nothing changed, e.g. our own ack coming back.
+	if rs.LastMessageID == msgID && rs.MentionCount == 0 {
+		return
+	}
+
+	// Our ack is newer and will be acknowledged later.
+	if isSending && sending != msgID && msgID < rs.LastMessageID {
+		return
+	}
+
+	previous := rs.LastMessageID
+	rs.LastMessageID = msgID
+	rs.MentionCount = 0
+	delete(r.mentions, chID)
+
+	r.announce(rs, previous, msgID < previous)
+}
+
+// revert reverts the optimistic read state set for the ack that failed.
+func (r *State) revert(chID discord.ChannelID, msgID discord.MessageID) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.versions.sending[chID] != msgID {
+		return
+	}
+	delete(r.versions.sending, chID)
+
+	rs, ok := r.states[chID]
+	if !ok || rs.LastMessageID != msgID {
+		return
+	}
+
+	acked, ok := r.versions.acked[chID]
+	if !ok {
+		return
+	}
+
+	rs.LastMessageID = acked
+	r.announce(rs, msgID, true)
+}
+
+// announce dispatches an UpdateEvent for the read state, followed by a
+// CorrectionEvent if corrected is true. r.mutex must be held.
+func (r *State) announce(rs *gateway.ReadState, previous discord.MessageID, corrected bool) {
+	rscp := *rs
+
+	r.pending.goOrdered(rscp.ChannelID, func() {
+		ch, _ := r.state.Cabinet.Channel(rscp.ChannelID)
+		if ch == nil {
+			return
+		}
+
+		update := UpdateEvent{
+			ReadState: rscp,
+			GuildID:   ch.GuildID,
+			Unread:    channelIsUnread(ch, rscp.LastMessageID),
+		}
+
+		r.state.Call(&update)
+
+		if corrected {
+			r.state.Call(&CorrectionEvent{
+				UpdateEvent: update,
+				Previous:    previous,
+			})
+		}
+	})
+}
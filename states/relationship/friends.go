@@ -0,0 +1,112 @@
+package relationship
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+	"github.com/diamondburned/ningen/v3/handlerrepo"
+)
+
+// Friend is a friend along with their global presence.
+type Friend struct {
+	discord.User
+	// Presence is the friend's presence, or nil if it isn't known, in which
+	// case they should be shown as offline.
+	Presence *discord.Presence
+}
+
+// Status returns the friend's status, which is OfflineStatus if their
+// presence isn't known.
+func (f Friend) Status() discord.Status {
+	if f.Presence == nil || f.Presence.Status == discord.UnknownStatus {
+		return discord.OfflineStatus
+	}
+	return f.Presence.Status
+}
+
+// FriendPresenceUpdateEvent is dispatched when the global presence of a friend
+// changes.
+type FriendPresenceUpdateEvent struct {
+	Friend
+}
+
+var _ gateway.Event = (*FriendPresenceUpdateEvent)(nil)
+
+func (ev FriendPresenceUpdateEvent) Op() ws.OpCode { return -1 }
+func (ev FriendPresenceUpdateEvent) EventType() ws.EventType {
+	return "__relationship.FriendPresenceUpdateEvent"
+}
+
+func (r *State) addFriendHandlers(h handlerrepo.AddHandler) {
+	h.AddSyncHandler(func(ev *gateway.PresenceUpdateEvent) {
+		// Friends' global presences don't belong to any guild.
+		if ev.GuildID.IsValid() || r.Relationship(ev.User.ID) != discord.FriendRelationship {
+			return
+		}
+
+		r.dispatch(&FriendPresenceUpdateEvent{r.friend(ev.User.ID)})
+	})
+}
+
+// Friends returns the user's friends with their global presences, online
+// friends first, then idle, do not disturb and offline ones. Friends with the
+// same status are sorted by name.
+func (r *State) Friends() []Friend {
+	var friends []Friend
+
+	r.Each(func(userID discord.UserID, t discord.RelationshipType) bool {
+		if t == discord.FriendRelationship {
+			friends = append(friends, Friend{User: discord.User{ID: userID}})
+		}
+		return false
+	})
+
+	for i := range friends {
+		friends[i] = r.friend(friends[i].ID)
+	}
+
+	sort.SliceStable(friends, func(i, j int) bool {
+		ri, rj := statusRank(friends[i].Status()), statusRank(friends[j].Status())
+		if ri != rj {
+			return ri < rj
+		}
+
+		ni, nj := strings.ToLower(friends[i].DisplayOrUsername()), strings.ToLower(friends[j].DisplayOrUsername())
+		if ni != nj {
+			return ni < nj
+		}
+
+		return friends[i].ID < friends[j].ID
+	})
+
+	return friends
+}
+
+func (r *State) friend(userID discord.UserID) Friend {
+	friend := Friend{User: discord.User{ID: userID}}
+
+	if p, err := r.state.Cabinet.Presence(0, userID); err == nil {
+		friend.Presence = p
+		if p.User.Username != "" {
+			friend.User = p.User
+		}
+	}
+
+	return friend
+}
+
+func statusRank(status discord.Status) int {
+	switch status {
+	case discord.OnlineStatus:
+		return 0
+	case discord.IdleStatus:
+		return 1
+	case discord.DoNotDisturbStatus:
+		return 2
+	default:
+		return 3
+	}
+}
@@ -1,22 +1,48 @@
 package relationship
 
 import (
+	"context"
 	"sort"
+	"strings"
 	"sync"
 
+	"github.com/diamondburned/arikawa/v3/api"
 	"github.com/diamondburned/arikawa/v3/discord"
 	"github.com/diamondburned/arikawa/v3/gateway"
-	"github.com/diamondburned/arikawa/v3/state/store"
+	"github.com/diamondburned/arikawa/v3/state"
+	"github.com/diamondburned/arikawa/v3/utils/httputil"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
 	"github.com/diamondburned/ningen/v3/handlerrepo"
+	"github.com/pkg/errors"
 )
 
+// UpdateEvent is dispatched when the relationship with a user changes,
+// including when it is changed optimistically and when that is reverted
+// because Discord rejected the change. Type is 0 if the relationship was
+// removed.
+type UpdateEvent struct {
+	UserID discord.UserID
+	Type   discord.RelationshipType
+}
+
+var _ gateway.Event = (*UpdateEvent)(nil)
+
+func (ev UpdateEvent) Op() ws.OpCode           { return -1 }
+func (ev UpdateEvent) EventType() ws.EventType { return "__relationship.UpdateEvent" }
+
 type State struct {
 	mutex         sync.RWMutex
+	state         *state.State
 	relationships map[discord.UserID]discord.RelationshipType
+
+	// ordered dispatches the events in order. Relationships change rarely, so
+	// a single queue is used for all users.
+	ordered handlerrepo.Ordered
 }
 
-func NewState(store store.PresenceStore, r handlerrepo.AddHandler) *State {
+func NewState(state *state.State, r handlerrepo.AddHandler) *State {
 	rela := &State{
+		state:         state,
 		relationships: map[discord.UserID]discord.RelationshipType{},
 	}
 
@@ -31,34 +57,142 @@ func NewState(store store.PresenceStore, r handlerrepo.AddHandler) *State {
 
 			if rl.User.ID == rl.UserID {
 				// Update our local presence state.
-				presence, _ := store.Presence(0, rl.UserID)
+				presence, _ := state.Cabinet.Presence(0, rl.UserID)
 				if presence != nil {
 					presence.User = rl.User
 				} else {
 					presence = &discord.Presence{User: rl.User}
 				}
-				store.PresenceSet(0, presence, true)
+				state.PresenceSet(0, presence, true)
 			}
 		}
 	})
 
 	r.AddSyncHandler(func(add *gateway.RelationshipAddEvent) {
-		rela.mutex.Lock()
-		defer rela.mutex.Unlock()
-
-		rela.relationships[add.UserID] = add.Type
+		rela.set(add.UserID, add.Type)
 	})
 
 	r.AddSyncHandler(func(rem *gateway.RelationshipRemoveEvent) {
-		rela.mutex.Lock()
-		defer rela.mutex.Unlock()
-
-		delete(rela.relationships, rem.UserID)
+		rela.set(rem.UserID, 0)
 	})
 
+	rela.addFriendHandlers(r)
+
 	return rela
 }
 
+// set sets the relationship, removing it if t is 0, and dispatches an
+// UpdateEvent if it changed.
+func (r *State) set(userID discord.UserID, t discord.RelationshipType) {
+	r.mutex.Lock()
+	old := r.relationships[userID]
+	if t == 0 {
+		delete(r.relationships, userID)
+	} else {
+		r.relationships[userID] = t
+	}
+	r.mutex.Unlock()
+
+	if old != t {
+		r.dispatch(&UpdateEvent{UserID: userID, Type: t})
+	}
+}
+
+// dispatch dispatches ev in the background; see handlerrepo.Ordered.
+func (r *State) dispatch(ev gateway.Event) {
+	r.ordered.Go(0, func() {
+		r.state.Handler.Call(ev)
+	})
+}
+
+// change optimistically sets the relationship and calls fn. If fn fails, the
+// previous relationship is restored, unless it has changed again since.
+func (r *State) change(userID discord.UserID, t discord.RelationshipType, fn func() error) error {
+	previous := r.Relationship(userID)
+	r.set(userID, t)
+
+	if err := fn(); err != nil {
+		r.mutex.Lock()
+		unchanged := r.relationships[userID] == t
+		r.mutex.Unlock()
+
+		if unchanged {
+			r.set(userID, previous)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// SendFriendRequest sends a friend request to the user with the given
+// username, which may have a legacy "#1234" discriminator. The user's ID isn't
+// known until Discord sends the outgoing request back as a
+// RelationshipAddEvent, so the local state is only updated then.
+func (r *State) SendFriendRequest(username string) error {
+	body := struct {
+		Username      string  `json:"username"`
+		Discriminator *string `json:"discriminator"`
+	}{
+		Username: username,
+	}
+
+	if i := strings.LastIndexByte(username, '#'); i != -1 && len(username)-i == 5 {
+		discriminator := username[i+1:]
+		body.Username = username[:i]
+		body.Discriminator = &discriminator
+	}
+
+	err := r.state.FastRequest(
+		"POST", api.EndpointMe+"/relationships",
+		httputil.WithJSONBody(body),
+	)
+	if err != nil {
+		return errors.Wrap(err, "cannot send friend request")
+	}
+
+	return nil
+}
+
+// RemoveFriend removes the user from the friends list. It also cancels or
+// ignores a pending friend request with the user.
+func (r *State) RemoveFriend(userID discord.UserID) error {
+	err := r.change(userID, 0, func() error {
+		return r.state.DeleteRelationship(userID)
+	})
+	if err != nil {
+		return errors.Wrap(err, "cannot remove friend")
+	}
+	return nil
+}
+
+// Block blocks the user, which also removes them as a friend.
+func (r *State) Block(userID discord.UserID) error {
+	err := r.change(userID, discord.BlockedRelationship, func() error {
+		return r.state.SetRelationship(userID, discord.BlockedRelationship)
+	})
+	if err != nil {
+		return errors.Wrap(err, "cannot block user")
+	}
+	return nil
+}
+
+// Unblock unblocks the user. It does nothing if the user isn't blocked.
+func (r *State) Unblock(userID discord.UserID) error {
+	if !r.IsBlocked(userID) {
+		return nil
+	}
+
+	err := r.change(userID, 0, func() error {
+		return r.state.DeleteRelationship(userID)
+	})
+	if err != nil {
+		return errors.Wrap(err, "cannot unblock user")
+	}
+	return nil
+}
+
 func (r *State) Each(fn func(discord.UserID, discord.RelationshipType) (stop bool)) {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
@@ -103,3 +237,8 @@ func (r *State) BlockedUserIDs() []discord.UserID {
 
 	return userIDs
 }
+
+// Flush behaves like handlerrepo.Ordered.Flush for the state's events.
+func (r *State) Flush(ctx context.Context) error {
+	return r.ordered.Flush(ctx)
+}
@@ -0,0 +1,325 @@
+// Package send queues outgoing messages so that they can be shown before
+// Discord accepts them and retried after the connection drops.
+package send
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/state"
+	"github.com/diamondburned/arikawa/v3/utils/httputil"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+	"github.com/diamondburned/ningen/v3/handlerrepo"
+)
+
+// ErrFlagged is the error of the FailedEvent of a queued message that Filter
+// flagged. Such messages are never sent.
+var ErrFlagged = errors.New("message content is flagged by a content filter")
+
+// MaxAttempts is the number of times a queued message is sent before it is
+// given up on.
+const MaxAttempts = 5
+
+// SucceededEvent is dispatched when a queued message is sent. Message is the
+// message that Discord created; its Nonce is the nonce of the pending message.
+type SucceededEvent struct {
+	Message discord.Message
+}
+
+// FailedEvent is dispatched when sending a queued message fails. If Retrying
+// is true, the message stays queued and is sent again once the gateway
+// reconnects; otherwise, it is dropped.
+type FailedEvent struct {
+	ChannelID discord.ChannelID
+	Nonce     string
+	Err       error
+	Retrying  bool
+}
+
+var (
+	_ gateway.Event = (*SucceededEvent)(nil)
+	_ gateway.Event = (*FailedEvent)(nil)
+)
+
+func (ev SucceededEvent) Op() ws.OpCode           { return -1 }
+func (ev SucceededEvent) EventType() ws.EventType { return "__send.SucceededEvent" }
+
+func (ev FailedEvent) Op() ws.OpCode           { return -1 }
+func (ev FailedEvent) EventType() ws.EventType { return "__send.FailedEvent" }
+
+type pending struct {
+	message  discord.Message
+	data     api.SendMessageData
+	attempts int
+	sending  bool
+}
+
+// State queues messages and keeps track of the ones that haven't been sent
+// yet.
+type State struct {
+	// Filter, if set, filters the content of queued messages before they are
+	// sent. It returns the filtered content and whether the message is
+	// flagged, in which case it fails with ErrFlagged instead of being sent.
+	Filter func(content string) (filtered string, flagged bool)
+
+	mutex   sync.Mutex
+	state   *state.State
+	pending map[string]*pending
+	// lastNonce is the last nonce given to a queued message.
+	lastNonce discord.Snowflake
+
+	// ordered dispatches the events in order per channel.
+	ordered handlerrepo.Ordered
+}
+
+func NewState(state *state.State, r handlerrepo.AddHandler) *State {
+	sendState := &State{
+		state:   state,
+		pending: map[string]*pending{},
+	}
+
+	r.AddSyncHandler(func(*gateway.ReadyEvent) { sendState.retry() })
+	r.AddSyncHandler(func(*gateway.ResumedEvent) { sendState.retry() })
+
+	r.AddSyncHandler(func(ev *gateway.MessageCreateEvent) {
+		if ev.Nonce == "" {
+			return
+		}
+
+		// Discord echoes the nonce back in the message, which may arrive
+		// before the API call returns.
+		if me, _ := state.Me(); me == nil || me.ID != ev.Author.ID {
+			return
+		}
+
+		sendState.succeed(ev.Nonce, ev.Message)
+	})
+
+	return sendState
+}
+
+// newNonce returns a snowflake of the current time for the nonce of a queued
+// message. Snowflakes only have a millisecond resolution, so the nonce is
+// bumped past the last one if needed to keep the nonces of messages queued in
+// the same millisecond apart.
+func (s *State) newNonce() discord.Snowflake {
+	nonce := discord.NewSnowflake(time.Now())
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if nonce <= s.lastNonce {
+		nonce = s.lastNonce + 1
+	}
+	s.lastNonce = nonce
+
+	return nonce
+}
+
+// QueueMessage queues the message to be sent to the channel and returns the
+// local pending message immediately. The pending message's Nonce identifies
+// it in the SucceededEvent or FailedEvent; its ID is the nonce as a
+// snowflake, so it sorts after the messages sent before it.
+//
+// The message is sent in the background. If the connection fails, the
+// message is sent again when the gateway reconnects, up to MaxAttempts times.
+// Messages with files are only retried if all of the files' readers are
+// io.Seekers.
+func (s *State) QueueMessage(chID discord.ChannelID, data api.SendMessageData) discord.Message {
+	nonceID := s.newNonce()
+	nonce := strconv.FormatUint(uint64(nonceID), 10)
+
+	data.Nonce = nonce
+
+	var flagged bool
+	if s.Filter != nil {
+		data.Content, flagged = s.Filter(data.Content)
+	}
+
+	msg := discord.Message{
+		ID:        discord.MessageID(nonceID),
+		ChannelID: chID,
+		Type:      discord.DefaultMessage,
+		Content:   data.Content,
+		Embeds:    data.Embeds,
+		Timestamp: discord.NewTimestamp(time.Now()),
+		TTS:       data.TTS,
+		Reference: data.Reference,
+		Nonce:     nonce,
+	}
+
+	if ch, err := s.state.Cabinet.Channel(chID); err == nil {
+		msg.GuildID = ch.GuildID
+	}
+	if me, err := s.state.Cabinet.Me(); err == nil {
+		msg.Author = *me
+	}
+
+	if flagged {
+		// Fail in the background like any other failed message, so that the
+		// pending message can be shown first.
+		s.dispatch(chID, &FailedEvent{
+			ChannelID: chID,
+			Nonce:     nonce,
+			Err:       ErrFlagged,
+		})
+		return msg
+	}
+
+	p := &pending{
+		message: msg,
+		data:    data,
+		sending: true,
+	}
+
+	s.mutex.Lock()
+	s.pending[nonce] = p
+	s.mutex.Unlock()
+
+	go s.send(p)
+
+	return msg
+}
+
+// PendingMessages returns the local messages in the channel that haven't been
+// sent yet, oldest first.
+func (s *State) PendingMessages(chID discord.ChannelID) []discord.Message {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var msgs []discord.Message
+	for _, p := range s.pending {
+		if p.message.ChannelID == chID {
+			msgs = append(msgs, p.message)
+		}
+	}
+
+	sort.Slice(msgs, func(i, j int) bool {
+		return msgs[i].ID < msgs[j].ID
+	})
+
+	return msgs
+}
+
+// Cancel removes the pending message with the given nonce from the queue. A
+// message that is being sent can't be cancelled; false is returned if the
+// message isn't queued or is being sent.
+func (s *State) Cancel(nonce string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	p, ok := s.pending[nonce]
+	if !ok || p.sending {
+		return false
+	}
+
+	delete(s.pending, nonce)
+	return true
+}
+
+func (s *State) send(p *pending) {
+	msg, err := s.state.SendMessageComplex(p.message.ChannelID, p.data)
+	if err == nil {
+		s.succeed(p.message.Nonce, *msg)
+		return
+	}
+
+	s.mutex.Lock()
+
+	if _, ok := s.pending[p.message.Nonce]; !ok {
+		// The message's echo arrived first, so it was sent after all.
+		s.mutex.Unlock()
+		return
+	}
+
+	p.attempts++
+	p.sending = false
+
+	retrying := p.attempts < MaxAttempts && canRetry(err, p.data)
+	if !retrying {
+		delete(s.pending, p.message.Nonce)
+	}
+
+	s.mutex.Unlock()
+
+	s.dispatch(p.message.ChannelID, &FailedEvent{
+		ChannelID: p.message.ChannelID,
+		Nonce:     p.message.Nonce,
+		Err:       err,
+		Retrying:  retrying,
+	})
+}
+
+func (s *State) succeed(nonce string, msg discord.Message) {
+	s.mutex.Lock()
+	_, ok := s.pending[nonce]
+	delete(s.pending, nonce)
+	s.mutex.Unlock()
+
+	if ok {
+		s.dispatch(msg.ChannelID, &SucceededEvent{Message: msg})
+	}
+}
+
+// dispatch dispatches the event in the background, since succeed is also
+// called from the MessageCreateEvent handler.
+func (s *State) dispatch(chID discord.ChannelID, ev gateway.Event) {
+	s.ordered.Go(discord.Snowflake(chID), func() {
+		s.state.Handler.Call(ev)
+	})
+}
+
+// retry sends the messages that failed to send again.
+func (s *State) retry() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, p := range s.pending {
+		if p.sending {
+			continue
+		}
+
+		p.sending = true
+		go s.send(p)
+	}
+}
+
+// canRetry returns true if the message can be sent again after failing with
+// the given error. Only connection errors and server errors are retried.
+func canRetry(err error, data api.SendMessageData) bool {
+	var reqErr httputil.RequestError
+	var httpErr *httputil.HTTPError
+
+	switch {
+	case errors.As(err, &reqErr):
+	case errors.As(err, &httpErr) && httpErr.Status >= 500:
+	default:
+		return false
+	}
+
+	// Files have to be read again from the start.
+	for _, file := range data.Files {
+		seeker, ok := file.Reader.(io.Seeker)
+		if !ok {
+			return false
+		}
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Flush behaves like handlerrepo.Ordered.Flush for the state's events.
+func (s *State) Flush(ctx context.Context) error {
+	return s.ordered.Flush(ctx)
+}
@@ -0,0 +1,49 @@
+package sticker
+
+import (
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/ningen/v3/states/emoji"
+	"github.com/pkg/errors"
+)
+
+// moreStickers is the feature of guilds that have extra sticker slots
+// regardless of their boost level.
+const moreStickers discord.GuildFeature = "MORE_STICKERS"
+
+// MaxStickers returns the number of stickers that the guild can have.
+func MaxStickers(g *discord.Guild) int {
+	max := 5
+	switch g.NitroBoost {
+	case discord.NitroLevel1:
+		max = 15
+	case discord.NitroLevel2:
+		max = 30
+	case discord.NitroLevel3:
+		max = 60
+	}
+
+	for _, feature := range g.Features {
+		if feature == moreStickers {
+			max = 60
+		}
+	}
+
+	return max
+}
+
+// GuildSlots returns the sticker slot usage of the given guild. Unavailable
+// stickers still take up slots. The usage changes as the guild's boost level
+// and stickers are updated.
+func (s *State) GuildSlots(guildID discord.GuildID) (emoji.Slots, error) {
+	g, err := s.state.Cabinet.Guild(guildID)
+	if err != nil {
+		return emoji.Slots{}, errors.Wrap(err, "cannot get guild")
+	}
+
+	stickers, err := s.GuildStickers(guildID)
+	if err != nil {
+		return emoji.Slots{}, err
+	}
+
+	return emoji.Slots{Used: len(stickers), Max: MaxStickers(g)}, nil
+}
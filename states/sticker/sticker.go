@@ -0,0 +1,228 @@
+// Package sticker keeps track of the stickers that the user can send: the
+// stickers of their guilds and Discord's sticker packs.
+package sticker
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/state"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+	"github.com/diamondburned/ningen/v3/handlerrepo"
+	"github.com/diamondburned/ningen/v3/readyextra"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	gateway.OpUnmarshalers.Add(
+		func() ws.Event { return new(GuildStickersUpdateEvent) },
+	)
+}
+
+// GuildStickersUpdateEvent is a dispatch event for GUILD_STICKERS_UPDATE. It
+// contains all stickers of the guild.
+type GuildStickersUpdateEvent struct {
+	GuildID  discord.GuildID   `json:"guild_id"`
+	Stickers []discord.Sticker `json:"stickers"`
+}
+
+// Op implements ws.Event.
+func (*GuildStickersUpdateEvent) Op() ws.OpCode { return 0 }
+
+// EventType implements ws.Event.
+func (*GuildStickersUpdateEvent) EventType() ws.EventType { return "GUILD_STICKERS_UPDATE" }
+
+// Pack is a pack of standard stickers made by Discord.
+type Pack struct {
+	ID             discord.StickerPackID `json:"id"`
+	Name           string                `json:"name"`
+	Description    string                `json:"description"`
+	Stickers       []discord.Sticker     `json:"stickers"`
+	CoverStickerID discord.StickerID     `json:"cover_sticker_id,omitempty"`
+	BannerAssetID  discord.Snowflake     `json:"banner_asset_id,omitempty"`
+}
+
+// Guild is a guild along with its stickers.
+type Guild struct {
+	discord.Guild
+	Stickers []discord.Sticker
+}
+
+// State keeps track of guild stickers and sticker packs.
+type State struct {
+	// ReadyExtras shares the decoded extras of the Ready event. If nil, the
+	// stickers decode them on their own.
+	ReadyExtras *readyextra.Cache
+
+	mutex  sync.Mutex
+	state  *state.State
+	guilds map[discord.GuildID][]discord.Sticker
+	packs  []Pack
+}
+
+func NewState(state *state.State, r handlerrepo.AddHandler) *State {
+	stickerState := &State{
+		state:  state,
+		guilds: map[discord.GuildID][]discord.Sticker{},
+	}
+
+	r.AddSyncHandler(func(r *gateway.ReadyEvent) {
+		// arikawa doesn't decode guild stickers.
+		guilds := stickerState.ReadyExtras.Of(r).Guilds
+
+		stickerState.mutex.Lock()
+		defer stickerState.mutex.Unlock()
+
+		stickerState.guilds = make(map[discord.GuildID][]discord.Sticker, len(guilds))
+		for _, g := range guilds {
+			if g.Stickers != nil {
+				stickerState.guilds[g.ID] = g.Stickers
+			}
+		}
+	})
+
+	r.AddSyncHandler(func(ev *GuildStickersUpdateEvent) {
+		stickerState.mutex.Lock()
+		defer stickerState.mutex.Unlock()
+
+		stickerState.guilds[ev.GuildID] = ev.Stickers
+	})
+
+	r.AddSyncHandler(func(ev *gateway.GuildDeleteEvent) {
+		stickerState.mutex.Lock()
+		defer stickerState.mutex.Unlock()
+
+		delete(stickerState.guilds, ev.ID)
+	})
+
+	return stickerState
+}
+
+// HasNitro returns true if the current user has Nitro.
+func (s *State) HasNitro() bool {
+	u, err := s.state.Cabinet.Me()
+	return err == nil && u.Nitro != discord.NoUserNitro
+}
+
+// GuildStickers returns the stickers of the given guild. The stickers are
+// fetched from the API if they aren't known yet.
+func (s *State) GuildStickers(guildID discord.GuildID) ([]discord.Sticker, error) {
+	s.mutex.Lock()
+	stickers, ok := s.guilds[guildID]
+	s.mutex.Unlock()
+
+	if ok {
+		return stickers, nil
+	}
+
+	err := s.state.RequestJSON(
+		&stickers, "GET",
+		api.EndpointGuilds+guildID.String()+"/stickers",
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot fetch guild stickers")
+	}
+
+	s.mutex.Lock()
+	s.guilds[guildID] = stickers
+	s.mutex.Unlock()
+
+	return stickers, nil
+}
+
+// Packs returns Discord's sticker packs. The packs are fetched from the API
+// once and cached.
+func (s *State) Packs() ([]Pack, error) {
+	s.mutex.Lock()
+	packs := s.packs
+	s.mutex.Unlock()
+
+	if packs != nil {
+		return packs, nil
+	}
+
+	var body struct {
+		StickerPacks []Pack `json:"sticker_packs"`
+	}
+
+	err := s.state.RequestJSON(&body, "GET", api.Endpoint+"sticker-packs")
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot fetch sticker packs")
+	}
+
+	if body.StickerPacks == nil {
+		body.StickerPacks = []Pack{}
+	}
+
+	s.mutex.Lock()
+	s.packs = body.StickerPacks
+	s.mutex.Unlock()
+
+	return body.StickerPacks, nil
+}
+
+// ForGuild returns the guild stickers that can be sent in the given guild. If
+// the user has Nitro, the stickers of all guilds are returned with the given
+// guild first; otherwise, only the given guild's stickers are returned.
+// Stickers that are unavailable, such as after losing Server Boosts, are
+// omitted.
+func (s *State) ForGuild(guildID discord.GuildID) ([]Guild, error) {
+	if !s.HasNitro() {
+		if !guildID.IsValid() {
+			return nil, nil
+		}
+
+		g, err := s.state.Cabinet.Guild(guildID)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get guild")
+		}
+
+		stickers, err := s.GuildStickers(guildID)
+		if err != nil {
+			return nil, err
+		}
+
+		stickers = available(stickers)
+		if len(stickers) == 0 {
+			return nil, nil
+		}
+
+		return []Guild{{Guild: *g, Stickers: stickers}}, nil
+	}
+
+	guilds, err := s.state.Cabinet.Guilds()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get guilds")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stickers := make([]Guild, 0, len(guilds))
+
+	for _, g := range guilds {
+		if st := available(s.guilds[g.ID]); len(st) > 0 {
+			stickers = append(stickers, Guild{Guild: g, Stickers: st})
+		}
+	}
+
+	sort.SliceStable(stickers, func(i, j int) bool {
+		return stickers[i].ID == guildID
+	})
+
+	return stickers, nil
+}
+
+// available returns the stickers that are available in a new slice.
+func available(stickers []discord.Sticker) []discord.Sticker {
+	filtered := make([]discord.Sticker, 0, len(stickers))
+	for _, sticker := range stickers {
+		if sticker.Available {
+			filtered = append(filtered, sticker)
+		}
+	}
+	return filtered
+}
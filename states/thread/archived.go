@@ -0,0 +1,198 @@
+package thread
+
+import (
+	"sort"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/ningen/v3/handlerrepo"
+	"github.com/pkg/errors"
+)
+
+// ArchivedForumPostsPageSize is the number of archived forum posts that
+// LoadArchivedForumPosts loads at once.
+const ArchivedForumPostsPageSize = 25
+
+// archivedKey identifies the archived threads of a channel. Discord paginates
+// the public and private archived threads separately.
+type archivedKey struct {
+	parentID discord.ChannelID
+	private  bool
+}
+
+func archivedKeyOf(thread *discord.Channel) archivedKey {
+	return archivedKey{thread.ParentID, thread.Type == discord.GuildPrivateThread}
+}
+
+// archivedThreads are the archived threads of a channel loaded so far, most
+// recently archived first. They are kept up to date with the thread events,
+// so loading the next page continues where the last one ended.
+type archivedThreads struct {
+	threads []discord.Channel
+	hasMore bool
+}
+
+func (s *State) addArchivedHandlers(h handlerrepo.AddHandler) {
+	h.AddSyncHandler(func(*gateway.ReadyEvent) {
+		s.archivedMu.Lock()
+		defer s.archivedMu.Unlock()
+
+		s.archived = make(map[archivedKey]*archivedThreads)
+	})
+
+	h.AddSyncHandler(func(ev *gateway.ThreadUpdateEvent) {
+		s.archivedMu.Lock()
+		defer s.archivedMu.Unlock()
+
+		archived, ok := s.archived[archivedKeyOf(&ev.Channel)]
+		if !ok {
+			return
+		}
+
+		i := findThread(archived.threads, ev.ID)
+		if i != -1 {
+			archived.threads = append(archived.threads[:i], archived.threads[i+1:]...)
+		}
+
+		// Threads that are active again are in the cabinet instead, and
+		// threads that were just archived go before the ones archived earlier.
+		if ev.ThreadMetadata != nil && ev.ThreadMetadata.Archived {
+			archived.insert(ev.Channel)
+		}
+	})
+
+	h.AddSyncHandler(func(ev *gateway.ThreadDeleteEvent) {
+		s.archivedMu.Lock()
+		defer s.archivedMu.Unlock()
+
+		for _, private := range []bool{false, true} {
+			archived, ok := s.archived[archivedKey{ev.ParentID, private}]
+			if !ok {
+				continue
+			}
+
+			if i := findThread(archived.threads, ev.ID); i != -1 {
+				archived.threads = append(archived.threads[:i], archived.threads[i+1:]...)
+			}
+		}
+	})
+
+	h.AddSyncHandler(func(ev *gateway.ChannelDeleteEvent) {
+		s.archivedMu.Lock()
+		defer s.archivedMu.Unlock()
+
+		delete(s.archived, archivedKey{ev.ID, false})
+		delete(s.archived, archivedKey{ev.ID, true})
+	})
+}
+
+// insert inserts the thread in the order of its archive time. Threads that are
+// older than all loaded threads are left to be loaded with their page.
+func (a *archivedThreads) insert(thread discord.Channel) {
+	i := sort.Search(len(a.threads), func(i int) bool {
+		return archiveTime(a.threads[i]) < archiveTime(thread)
+	})
+	if i == len(a.threads) && a.hasMore {
+		return
+	}
+
+	a.threads = append(a.threads, discord.Channel{})
+	copy(a.threads[i+1:], a.threads[i:])
+	a.threads[i] = thread
+}
+
+// loadArchived loads the next page of up to limit archived threads of the
+// channel. It returns false once all archived threads have been loaded.
+func (s *State) loadArchived(key archivedKey, limit uint) (hasMore bool, err error) {
+	var before discord.Timestamp
+
+	s.archivedMu.Lock()
+	if archived, ok := s.archived[key]; ok {
+		if !archived.hasMore {
+			s.archivedMu.Unlock()
+			return false, nil
+		}
+		if n := len(archived.threads); n > 0 && archived.threads[n-1].ThreadMetadata != nil {
+			before = archived.threads[n-1].ThreadMetadata.ArchiveTimestamp
+		}
+	}
+	s.archivedMu.Unlock()
+
+	var page *api.ArchivedThreads
+	if key.private {
+		page, err = s.state.PrivateArchivedThreads(key.parentID, before, limit)
+	} else {
+		page, err = s.state.PublicArchivedThreads(key.parentID, before, limit)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	s.archivedMu.Lock()
+	defer s.archivedMu.Unlock()
+
+	archived, ok := s.archived[key]
+	if !ok {
+		archived = &archivedThreads{}
+		s.archived[key] = archived
+	}
+
+	for _, thread := range page.Threads {
+		if findThread(archived.threads, thread.ID) == -1 {
+			archived.threads = append(archived.threads, thread)
+		}
+	}
+	// An empty page would otherwise be requested again forever.
+	archived.hasMore = page.More && len(page.Threads) > 0
+
+	return archived.hasMore, nil
+}
+
+// loadedArchived returns a copy of the archived threads loaded for the
+// channel. loaded is false if no page has been loaded yet.
+func (s *State) loadedArchived(key archivedKey) (threads []discord.Channel, hasMore, loaded bool) {
+	s.archivedMu.Lock()
+	defer s.archivedMu.Unlock()
+
+	archived, ok := s.archived[key]
+	if !ok {
+		return nil, true, false
+	}
+
+	return append([]discord.Channel(nil), archived.threads...), archived.hasMore, true
+}
+
+// LoadArchivedForumPosts loads the next page of archived posts of the given
+// forum channel, which ForumPosts then includes. It returns false once all
+// archived posts have been loaded.
+func (s *State) LoadArchivedForumPosts(chID discord.ChannelID) (hasMore bool, err error) {
+	hasMore, err = s.loadArchived(archivedKey{parentID: chID}, ArchivedForumPostsPageSize)
+	if err != nil {
+		return false, errors.Wrap(err, "cannot load archived posts")
+	}
+	return hasMore, nil
+}
+
+// ArchivedForumPostsLoaded returns true if all archived posts of the forum
+// have been loaded using LoadArchivedForumPosts.
+func (s *State) ArchivedForumPostsLoaded(chID discord.ChannelID) bool {
+	_, hasMore, loaded := s.loadedArchived(archivedKey{parentID: chID})
+	return loaded && !hasMore
+}
+
+func findThread(threads []discord.Channel, id discord.ChannelID) int {
+	for i, thread := range threads {
+		if thread.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func archiveTime(ch discord.Channel) int64 {
+	if ch.ThreadMetadata == nil {
+		return 0
+	}
+	return ch.ThreadMetadata.ArchiveTimestamp.Time().UnixNano()
+}
@@ -0,0 +1,97 @@
+package thread
+
+import (
+	"sort"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/pkg/errors"
+)
+
+// DefaultArchivedThreadsLimit is the number of archived threads that
+// ArchivedThreads returns if the limit is 0.
+const DefaultArchivedThreadsLimit = 50
+
+// ArchivedThreads returns up to limit archived threads of the given channel
+// that were archived before the given time, most recently archived first. If
+// before is zero, the most recently archived threads are returned. To get the
+// next page, pass the ArchiveTimestamp of the last returned thread. The
+// returned boolean is true if there are more archived threads.
+//
+// Private threads are only included if the user can manage threads in the
+// channel, since Discord lists the other private threads that they have
+// joined separately. The threads are loaded into the same cache as the
+// archived forum posts, which is kept up to date with the thread events, so
+// only the pages that weren't loaded yet are fetched.
+func (s *State) ArchivedThreads(
+	parentID discord.ChannelID, before discord.Timestamp, limit uint) ([]discord.Channel, bool, error) {
+
+	if limit == 0 {
+		limit = DefaultArchivedThreadsLimit
+	}
+
+	threads, more, err := s.archivedBefore(archivedKey{parentID, false}, before, limit)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "cannot get public archived threads")
+	}
+
+	if s.canManageThreads(parentID) {
+		private, privateMore, err := s.archivedBefore(archivedKey{parentID, true}, before, limit)
+		if err != nil {
+			return nil, false, errors.Wrap(err, "cannot get private archived threads")
+		}
+
+		threads = append(threads, private...)
+		more = more || privateMore
+	}
+
+	sort.SliceStable(threads, func(i, j int) bool {
+		return archiveTime(threads[i]) > archiveTime(threads[j])
+	})
+
+	// The rest of the threads are returned again in the next page, since it
+	// starts at the last thread returned here.
+	if uint(len(threads)) > limit {
+		threads = threads[:limit]
+		more = true
+	}
+
+	return threads, more, nil
+}
+
+// archivedBefore returns up to limit archived threads of the key that were
+// archived before the given time, loading more pages until there are enough.
+func (s *State) archivedBefore(
+	key archivedKey, before discord.Timestamp, limit uint) ([]discord.Channel, bool, error) {
+
+	for {
+		loaded, hasMore, ok := s.loadedArchived(key)
+
+		threads := loaded[:0]
+		for _, thread := range loaded {
+			if !before.IsValid() || archiveTime(thread) < before.Time().UnixNano() {
+				threads = append(threads, thread)
+			}
+		}
+
+		if ok && (uint(len(threads)) >= limit || !hasMore) {
+			if uint(len(threads)) > limit {
+				return threads[:limit], true, nil
+			}
+			return threads, hasMore, nil
+		}
+
+		if _, err := s.loadArchived(key, limit); err != nil {
+			return nil, false, err
+		}
+	}
+}
+
+func (s *State) canManageThreads(chID discord.ChannelID) bool {
+	me, err := s.cabinet.Me()
+	if err != nil {
+		return false
+	}
+
+	perms, err := s.state.Permissions(chID, me.ID)
+	return err == nil && perms.Has(discord.PermissionManageThreads)
+}
@@ -0,0 +1,234 @@
+package thread
+
+import (
+	"sort"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+)
+
+// ForumView is the tag filter and sort order that the user has chosen for a
+// forum channel.
+type ForumView struct {
+	// Tags are the tags to filter posts by. If empty, posts are not filtered.
+	Tags []discord.TagID `json:"tags,omitempty"`
+	// MatchAll makes posts only match if they have all of Tags applied instead
+	// of any of them.
+	MatchAll bool `json:"match_all,omitempty"`
+	// SortOrder is the order that posts are sorted in.
+	SortOrder discord.SortOrderType `json:"sort_order"`
+}
+
+// matches returns true if the post matches the tag filter.
+func (v *ForumView) matches(post *discord.Channel) bool {
+	if len(v.Tags) == 0 {
+		return true
+	}
+
+	var matched int
+	for _, tag := range v.Tags {
+		for _, applied := range post.AppliedTags {
+			if tag == applied {
+				matched++
+				break
+			}
+		}
+	}
+
+	if v.MatchAll {
+		return matched == len(v.Tags)
+	}
+	return matched > 0
+}
+
+// ForumViewUpdateEvent is dispatched when the ForumView of a forum is changed
+// using SetForumView.
+type ForumViewUpdateEvent struct {
+	ChannelID discord.ChannelID
+	View      ForumView
+}
+
+var _ gateway.Event = (*ForumViewUpdateEvent)(nil)
+
+func (ev ForumViewUpdateEvent) Op() ws.OpCode           { return -1 }
+func (ev ForumViewUpdateEvent) EventType() ws.EventType { return "__thread.ForumViewUpdateEvent" }
+
+// ForumView returns the view that the user has chosen for the given forum. If
+// the user has not chosen one, the view with the forum's default sort order is
+// returned.
+func (s *State) ForumView(chID discord.ChannelID) ForumView {
+	s.viewsMu.RLock()
+	view, ok := s.views[chID]
+	s.viewsMu.RUnlock()
+
+	if ok {
+		return view
+	}
+
+	ch, _ := s.cabinet.Channel(chID)
+	if ch != nil && ch.DefaultSoftOrder != nil {
+		view.SortOrder = *ch.DefaultSoftOrder
+	}
+
+	return view
+}
+
+// SetForumView sets the view of the given forum and dispatches a
+// ForumViewUpdateEvent.
+func (s *State) SetForumView(chID discord.ChannelID, view ForumView) {
+	view.Tags = append([]discord.TagID(nil), view.Tags...)
+
+	s.viewsMu.Lock()
+	s.views[chID] = view
+	s.viewsMu.Unlock()
+
+	s.state.Handler.Call(&ForumViewUpdateEvent{
+		ChannelID: chID,
+		View:      view,
+	})
+}
+
+// ForumViews returns a copy of all forum views chosen by the user. The
+// returned map can be marshaled to persist the views and restored later using
+// LoadForumViews.
+func (s *State) ForumViews() map[discord.ChannelID]ForumView {
+	s.viewsMu.RLock()
+	defer s.viewsMu.RUnlock()
+
+	views := make(map[discord.ChannelID]ForumView, len(s.views))
+	for id, view := range s.views {
+		views[id] = view
+	}
+
+	return views
+}
+
+// LoadForumViews replaces all forum views with the given ones, usually ones
+// that were persisted from ForumViews.
+func (s *State) LoadForumViews(views map[discord.ChannelID]ForumView) {
+	s.viewsMu.Lock()
+	defer s.viewsMu.Unlock()
+
+	s.views = make(map[discord.ChannelID]ForumView, len(views))
+	for id, view := range views {
+		s.views[id] = view
+	}
+}
+
+// ForumPosts returns the cached posts of the given forum channel filtered and
+// sorted by the given view. The active posts are combined with the archived
+// posts loaded using LoadArchivedForumPosts. If view is nil, the view returned by
+// ForumView is used. Pinned posts are always put first, as in the official
+// client.
+func (s *State) ForumPosts(chID discord.ChannelID, view *ForumView) ([]discord.Channel, error) {
+	if view == nil {
+		v := s.ForumView(chID)
+		view = &v
+	}
+
+	forum, err := s.cabinet.Channel(chID)
+	if err != nil {
+		return nil, err
+	}
+
+	channels, err := s.cabinet.Channels(forum.GuildID)
+	if err != nil {
+		return nil, err
+	}
+
+	posts := make([]discord.Channel, 0, 16)
+	for i := range channels {
+		post := &channels[i]
+		if post.ParentID != chID || !isThread(post.Type) || !view.matches(post) {
+			continue
+		}
+		posts = append(posts, *post)
+	}
+
+	archived, _, _ := s.loadedArchived(archivedKey{parentID: chID})
+	for _, post := range archived {
+		// Posts that are active again are already in the cabinet.
+		if findThread(posts, post.ID) == -1 && view.matches(&post) {
+			posts = append(posts, post)
+		}
+	}
+
+	sort.SliceStable(posts, func(i, j int) bool {
+		pinnedI := posts[i].Flags&discord.PinnedThread != 0
+		pinnedJ := posts[j].Flags&discord.PinnedThread != 0
+		if pinnedI != pinnedJ {
+			return pinnedI
+		}
+
+		if view.SortOrder == discord.SortOrderTypeLatestActivity {
+			return postActivity(&posts[i]) > postActivity(&posts[j])
+		}
+		return posts[i].ID > posts[j].ID
+	})
+
+	return posts, nil
+}
+
+// ForumTags returns the tags that can be applied to posts in the given forum
+// channel.
+func (s *State) ForumTags(chID discord.ChannelID) []discord.Tag {
+	forum, err := s.cabinet.Channel(chID)
+	if err != nil {
+		return nil
+	}
+	return append([]discord.Tag(nil), forum.AvailableTags...)
+}
+
+// ForumTag returns the tag with the given ID of the given forum channel.
+func (s *State) ForumTag(chID discord.ChannelID, tagID discord.TagID) (discord.Tag, bool) {
+	forum, err := s.cabinet.Channel(chID)
+	if err != nil {
+		return discord.Tag{}, false
+	}
+
+	for _, tag := range forum.AvailableTags {
+		if tag.ID == tagID {
+			return tag, true
+		}
+	}
+
+	return discord.Tag{}, false
+}
+
+// ForumPostTags returns the tags applied to the given forum post, in the order
+// that the forum lists them. Tags that were removed from the forum are skipped.
+func (s *State) ForumPostTags(post *discord.Channel) []discord.Tag {
+	if len(post.AppliedTags) == 0 {
+		return nil
+	}
+
+	var tags []discord.Tag
+	for _, tag := range s.ForumTags(post.ParentID) {
+		for _, applied := range post.AppliedTags {
+			if tag.ID == applied {
+				tags = append(tags, tag)
+				break
+			}
+		}
+	}
+
+	return tags
+}
+
+// postActivity returns the snowflake of the latest activity in the post.
+func postActivity(post *discord.Channel) discord.Snowflake {
+	if post.LastMessageID.IsValid() {
+		return discord.Snowflake(post.LastMessageID)
+	}
+	return discord.Snowflake(post.ID)
+}
+
+func isThread(t discord.ChannelType) bool {
+	switch t {
+	case discord.GuildAnnouncementThread, discord.GuildPublicThread, discord.GuildPrivateThread:
+		return true
+	default:
+		return false
+	}
+}
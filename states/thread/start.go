@@ -0,0 +1,172 @@
+package thread
+
+import (
+	"context"
+	"encoding/json"
+	"mime/multipart"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/sendpart"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+	"github.com/pkg/errors"
+)
+
+// StartedEvent is dispatched after StartThread has created and joined a
+// thread and seeded the local caches with it. UIs can use it to open the new
+// thread.
+type StartedEvent struct {
+	Thread discord.Channel
+	// Message is the first message of the thread. It is nil for threads
+	// started without a message.
+	Message *discord.Message
+}
+
+var _ gateway.Event = (*StartedEvent)(nil)
+
+func (ev StartedEvent) Op() ws.OpCode           { return -1 }
+func (ev StartedEvent) EventType() ws.EventType { return "__thread.StartedEvent" }
+
+// StartThreadOpts contains the options for StartThread.
+type StartThreadOpts struct {
+	// AutoArchiveDuration is the duration after which the thread is
+	// automatically archived. The server default is used if it is 0.
+	AutoArchiveDuration discord.ArchiveDuration
+	// Type is the type of the thread to create. It is ignored when starting a
+	// thread from a message or a forum post.
+	Type discord.ChannelType
+	// Invitable specifies whether non-moderators can add other non-moderators
+	// to a private thread.
+	Invitable bool
+	// AppliedTags are the forum tags to apply to a forum post.
+	AppliedTags []discord.TagID
+	// Message is the first message of the thread. It is required for forum
+	// posts. For other threads without a starting message, it is sent right
+	// after the thread is created.
+	Message *api.SendMessageData
+}
+
+type forumThreadData struct {
+	Name                string                  `json:"name"`
+	AutoArchiveDuration discord.ArchiveDuration `json:"auto_archive_duration,omitempty"`
+	AppliedTags         []discord.TagID         `json:"applied_tags,omitempty"`
+	Message             api.SendMessageData     `json:"message"`
+}
+
+func (data forumThreadData) NeedsMultipart() bool {
+	return data.Message.NeedsMultipart()
+}
+
+func (data forumThreadData) WriteMultipart(body *multipart.Writer) error {
+	return sendpart.Write(body, data, data.Message.Files)
+}
+
+// StartThread creates a thread named name in the given channel, joins it and
+// seeds the local caches with it, then dispatches a StartedEvent.
+//
+// If messageID is valid, the thread is started from that message. If the
+// channel is a forum, a forum post is created, which requires opts.Message.
+// Otherwise, a thread without a starting message is created.
+func (s *State) StartThread(
+	ctx context.Context,
+	chID discord.ChannelID, messageID discord.MessageID,
+	name string, opts StartThreadOpts) (*discord.Channel, error) {
+
+	client := s.state.WithContext(ctx)
+
+	var thread *discord.Channel
+	var message *discord.Message
+	var err error
+
+	parent, _ := s.cabinet.Channel(chID)
+
+	switch {
+	case messageID.IsValid():
+		thread, err = client.StartThreadWithMessage(chID, messageID, api.StartThreadData{
+			Name:                name,
+			AutoArchiveDuration: opts.AutoArchiveDuration,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot start thread from message")
+		}
+
+	case parent != nil && parent.Type == discord.GuildForum:
+		if opts.Message == nil {
+			return nil, errors.New("forum posts require a first message")
+		}
+
+		var raw json.RawMessage
+
+		err = sendpart.POST(client.Client.Client, forumThreadData{
+			Name:                name,
+			AutoArchiveDuration: opts.AutoArchiveDuration,
+			AppliedTags:         opts.AppliedTags,
+			Message:             *opts.Message,
+		}, &raw, api.EndpointChannels+chID.String()+"/threads")
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot create forum post")
+		}
+
+		// discord.Channel has its own UnmarshalJSON, so the message has to be
+		// decoded separately.
+		var post struct {
+			Message *discord.Message `json:"message"`
+		}
+
+		if err := json.Unmarshal(raw, &thread); err != nil {
+			return nil, errors.Wrap(err, "cannot decode forum post")
+		}
+		if err := json.Unmarshal(raw, &post); err != nil {
+			return nil, errors.Wrap(err, "cannot decode forum post message")
+		}
+
+		message = post.Message
+
+	default:
+		thread, err = client.StartThreadWithoutMessage(chID, api.StartThreadData{
+			Name:                name,
+			AutoArchiveDuration: opts.AutoArchiveDuration,
+			Type:                opts.Type,
+			Invitable:           opts.Invitable,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot start thread")
+		}
+
+		if opts.Message != nil {
+			message, err = client.SendMessageComplex(thread.ID, *opts.Message)
+			if err != nil {
+				return thread, errors.Wrap(err, "cannot send first message")
+			}
+		}
+	}
+
+	if err := client.JoinThread(thread.ID); err != nil {
+		return thread, errors.Wrap(err, "cannot join thread")
+	}
+
+	s.joinedMu.Lock()
+	s.joined[thread.ID] = struct{}{}
+	s.joinedMu.Unlock()
+
+	if thread.GuildID == 0 && parent != nil {
+		thread.GuildID = parent.GuildID
+	}
+
+	s.cabinet.ChannelSet(thread, false)
+
+	if message != nil {
+		if message.GuildID == 0 {
+			message.GuildID = thread.GuildID
+		}
+		s.cabinet.MessageSet(message, false)
+	}
+
+	s.state.Handler.Call(&StartedEvent{
+		Thread:  *thread,
+		Message: message,
+	})
+
+	return thread, nil
+}
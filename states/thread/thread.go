@@ -18,6 +18,12 @@ type State struct {
 
 	joinedMu sync.RWMutex
 	joined   map[discord.ChannelID]struct{}
+
+	viewsMu sync.RWMutex
+	views   map[discord.ChannelID]ForumView
+
+	archivedMu sync.Mutex
+	archived   map[archivedKey]*archivedThreads
 }
 
 func NewState(state *state.State, h handlerrepo.AddHandler) *State {
@@ -25,8 +31,13 @@ func NewState(state *state.State, h handlerrepo.AddHandler) *State {
 		state:   state,
 		cabinet: state.Cabinet,
 		joined:  make(map[discord.ChannelID]struct{}),
+		views:   make(map[discord.ChannelID]ForumView),
+
+		archived: make(map[archivedKey]*archivedThreads),
 	}
 
+	s.addArchivedHandlers(h)
+
 	var userID discord.UserID
 
 	h.AddSyncHandler(func(ev *gateway.ReadyEvent) {
@@ -83,6 +94,12 @@ func NewState(state *state.State, h handlerrepo.AddHandler) *State {
 		s.joinedMu.Unlock()
 	})
 
+	h.AddSyncHandler(func(ev *gateway.ThreadDeleteEvent) {
+		s.joinedMu.Lock()
+		delete(s.joined, ev.ID)
+		s.joinedMu.Unlock()
+	})
+
 	return s
 }
 
@@ -95,3 +112,24 @@ func (s *State) ThreadIsJoined(id discord.ChannelID) bool {
 	_, ok := s.joined[id]
 	return ok
 }
+
+// JoinedThreads returns the IDs of the active threads in the given parent
+// channel that the current user is joined to. Archived threads are excluded.
+func (s *State) JoinedThreads(parentID discord.ChannelID) []discord.ChannelID {
+	s.joinedMu.RLock()
+	defer s.joinedMu.RUnlock()
+
+	var ids []discord.ChannelID
+	for id := range s.joined {
+		ch, err := s.cabinet.Channel(id)
+		if err != nil || ch.ParentID != parentID {
+			continue
+		}
+		if ch.ThreadMetadata != nil && ch.ThreadMetadata.Archived {
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	return ids
+}
@@ -0,0 +1,92 @@
+package voice
+
+import (
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/ningen/v3/states/member"
+)
+
+// Activity is what a user is doing in voice, for the icons next to them in
+// member lists.
+type Activity struct {
+	// ChannelID is the voice channel that the user is in. It is null if the
+	// user isn't in voice.
+	ChannelID discord.ChannelID
+	// Muted is true if the user is muted by themselves or by the server.
+	Muted bool
+	// Deafened is true if the user is deafened by themselves or by the
+	// server.
+	Deafened bool
+	// Streaming is true if the user is sharing their screen.
+	Streaming bool
+	// Video is true if the user's camera is on.
+	Video bool
+}
+
+// InVoice returns true if the user is in a voice channel.
+func (a Activity) InVoice() bool {
+	return a.ChannelID.IsValid()
+}
+
+func activityOf(vs *discord.VoiceState) Activity {
+	return Activity{
+		ChannelID: vs.ChannelID,
+		Muted:     vs.Mute || vs.SelfMute,
+		Deafened:  vs.Deaf || vs.SelfDeaf,
+		Streaming: vs.SelfStream,
+		Video:     vs.SelfVideo,
+	}
+}
+
+// UserActivity returns the voice activity of the user in the given guild.
+func (s *State) UserActivity(guildID discord.GuildID, userID discord.UserID) Activity {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	g, ok := s.guilds[guildID]
+	if !ok {
+		return Activity{}
+	}
+
+	vs, ok := g.users[userID]
+	if !ok {
+		return Activity{}
+	}
+
+	return activityOf(&vs)
+}
+
+// ListItem is an item of a member list along with the voice activity of its
+// member. The activity is zero for groups and for members that aren't in
+// voice.
+type ListItem struct {
+	gateway.GuildMemberListOpItem
+	Voice Activity
+}
+
+// ViewListItems is member.List.ViewItems, except each item comes with the
+// voice activity of its member, so that member lists can show voice icons
+// without looking up every row. The same rules as ViewItems apply to fn.
+func (s *State) ViewListItems(l *member.List, fn func(items []ListItem)) {
+	s.mutex.Lock()
+	var activities map[discord.UserID]Activity
+	if g, ok := s.guilds[l.GuildID()]; ok {
+		activities = make(map[discord.UserID]Activity, len(g.users))
+		for userID, vs := range g.users {
+			activities[userID] = activityOf(&vs)
+		}
+	}
+	s.mutex.Unlock()
+
+	l.ViewItems(func(items []gateway.GuildMemberListOpItem) {
+		listItems := make([]ListItem, len(items))
+		for i, item := range items {
+			listItems[i].GuildMemberListOpItem = item
+			if item.Member != nil {
+				listItems[i].Voice = activities[item.Member.User.ID]
+			}
+		}
+
+		fn(listItems)
+	})
+}
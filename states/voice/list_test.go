@@ -0,0 +1,43 @@
+package voice
+
+import (
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+func TestUserActivity(t *testing.T) {
+	s := &State{
+		guilds:        map[discord.GuildID]*guildVoice{},
+		channelGuilds: map[discord.ChannelID]discord.GuildID{},
+	}
+
+	s.setGuild(1, []discord.VoiceState{
+		{UserID: 10, ChannelID: 100, SelfMute: true, SelfStream: true},
+		{UserID: 11, ChannelID: 100, Deaf: true, SelfVideo: true},
+	})
+
+	tests := []struct {
+		userID discord.UserID
+		want   Activity
+	}{
+		{10, Activity{ChannelID: 100, Muted: true, Streaming: true}},
+		{11, Activity{ChannelID: 100, Deafened: true, Video: true}},
+		{12, Activity{}},
+	}
+
+	for _, test := range tests {
+		got := s.UserActivity(1, test.userID)
+		if got != test.want {
+			t.Errorf("user %d: got %+v, want %+v", test.userID, got, test.want)
+		}
+		if got.InVoice() != test.want.ChannelID.IsValid() {
+			t.Errorf("user %d: unexpected InVoice %v", test.userID, got.InVoice())
+		}
+	}
+
+	s.set(discord.VoiceState{GuildID: 1, UserID: 10})
+	if a := s.UserActivity(1, 10); a.InVoice() {
+		t.Errorf("user 10 still in voice after leaving: %+v", a)
+	}
+}
@@ -0,0 +1,202 @@
+package voice
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/utils/json"
+	"github.com/pkg/errors"
+)
+
+// LatencyEndpoint lists the addresses of the voice servers of each region.
+// The official client pings them to pick the closest region.
+const LatencyEndpoint = "https://latency.discord.media/rtc"
+
+const (
+	// PingTimeout is the timeout of a single ping.
+	PingTimeout = 2 * time.Second
+	// MaxPingsPerRegion is the number of voice servers pinged per region. The
+	// lowest latency is used.
+	MaxPingsPerRegion = 3
+)
+
+// RegionCacheDuration is how long Regions caches the regions and their
+// latencies for.
+var RegionCacheDuration = 5 * time.Minute
+
+// Region is a voice region along with its latency as measured by the client.
+type Region struct {
+	discord.VoiceRegion
+	// Latency is the round trip time to the region's closest voice server.
+	// It is 0 if the latency couldn't be measured.
+	Latency time.Duration
+}
+
+// Pinger measures the round trip time to the given voice server address.
+type Pinger func(ctx context.Context, addr string) (time.Duration, error)
+
+// PingTCP measures the time that a TCP handshake with port 443 of the address
+// takes. Voice itself is UDP, but the handshake's round trip is close enough
+// to compare regions.
+func PingTCP(ctx context.Context, addr string) (time.Duration, error) {
+	var dialer net.Dialer
+
+	start := time.Now()
+
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(addr, "443"))
+	if err != nil {
+		return 0, err
+	}
+
+	rtt := time.Since(start)
+	conn.Close()
+
+	return rtt, nil
+}
+
+type cachedRegions struct {
+	regions []Region
+	time    time.Time
+}
+
+type latencyHosts struct {
+	Region string   `json:"region"`
+	IPs    []string `json:"ips"`
+}
+
+// Regions returns the voice regions that can be picked for voice channels in
+// the given guild, or for calls if the guild ID is invalid. The regions are
+// sorted by their latency, with the regions that couldn't be measured last.
+// They're cached for RegionCacheDuration.
+func (s *State) Regions(ctx context.Context, guildID discord.GuildID) ([]Region, error) {
+	s.regionMu.Lock()
+	cached, ok := s.regions[guildID]
+	s.regionMu.Unlock()
+
+	if ok && time.Since(cached.time) < RegionCacheDuration {
+		return append([]Region(nil), cached.regions...), nil
+	}
+
+	endpoint := api.Endpoint + "voice/regions"
+	if guildID.IsValid() {
+		endpoint = api.EndpointGuilds + guildID.String() + "/regions"
+	}
+
+	var voiceRegions []discord.VoiceRegion
+	if err := s.state.Client.WithContext(ctx).RequestJSON(&voiceRegions, "GET", endpoint); err != nil {
+		return nil, errors.Wrap(err, "cannot fetch voice regions")
+	}
+
+	// The latencies are best effort; regions are still returned without them.
+	hosts, _ := fetchLatencyHosts(ctx)
+	regions := sortRegions(voiceRegions, measureLatencies(ctx, s.Pinger, hosts))
+
+	s.regionMu.Lock()
+	s.regions[guildID] = cachedRegions{regions, time.Now()}
+	s.regionMu.Unlock()
+
+	return append([]Region(nil), regions...), nil
+}
+
+func fetchLatencyHosts(ctx context.Context) ([]latencyHosts, error) {
+	// This isn't Discord's API, so the token mustn't be sent.
+	req, err := http.NewRequestWithContext(ctx, "GET", LatencyEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot fetch latency hosts")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status %q fetching latency hosts", resp.Status)
+	}
+
+	var hosts []latencyHosts
+	if err := json.DecodeStream(resp.Body, &hosts); err != nil {
+		return nil, errors.Wrap(err, "cannot decode latency hosts")
+	}
+
+	return hosts, nil
+}
+
+// measureLatencies pings the hosts of all regions concurrently and returns the
+// lowest latency of each region that could be pinged.
+func measureLatencies(ctx context.Context, ping Pinger, hosts []latencyHosts) map[string]time.Duration {
+	latencies := make(map[string]time.Duration, len(hosts))
+	if ping == nil {
+		return latencies
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, host := range hosts {
+		ips := host.IPs
+		if len(ips) > MaxPingsPerRegion {
+			ips = ips[:MaxPingsPerRegion]
+		}
+
+		wg.Add(1)
+		go func(region string, ips []string) {
+			defer wg.Done()
+
+			var best time.Duration
+			for _, ip := range ips {
+				ctx, cancel := context.WithTimeout(ctx, PingTimeout)
+				rtt, err := ping(ctx, ip)
+				cancel()
+
+				if err == nil && rtt > 0 && (best == 0 || rtt < best) {
+					best = rtt
+				}
+			}
+
+			if best > 0 {
+				mutex.Lock()
+				latencies[region] = best
+				mutex.Unlock()
+			}
+		}(host.Region, ips)
+	}
+
+	wg.Wait()
+	return latencies
+}
+
+// sortRegions pairs the regions with their latencies and sorts them by
+// latency. Regions without a latency are sorted by name after the others.
+// Deprecated regions are left out.
+func sortRegions(voiceRegions []discord.VoiceRegion, latencies map[string]time.Duration) []Region {
+	regions := make([]Region, 0, len(voiceRegions))
+	for _, vr := range voiceRegions {
+		if !vr.Deprecated {
+			regions = append(regions, Region{vr, latencies[vr.ID]})
+		}
+	}
+
+	sort.SliceStable(regions, func(i, j int) bool {
+		li, lj := regions[i].Latency, regions[j].Latency
+		switch {
+		case li == lj:
+			return regions[i].Name < regions[j].Name
+		case li == 0:
+			return false
+		case lj == 0:
+			return true
+		default:
+			return li < lj
+		}
+	})
+
+	return regions
+}
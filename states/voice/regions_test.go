@@ -0,0 +1,56 @@
+package voice
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+func TestRegionLatencies(t *testing.T) {
+	rtts := map[string]time.Duration{
+		"1.0.0.1": 80 * time.Millisecond,
+		"1.0.0.2": 40 * time.Millisecond,
+		"2.0.0.1": 20 * time.Millisecond,
+	}
+
+	ping := func(ctx context.Context, addr string) (time.Duration, error) {
+		if rtt, ok := rtts[addr]; ok {
+			return rtt, nil
+		}
+		return 0, errors.New("unreachable")
+	}
+
+	latencies := measureLatencies(context.Background(), ping, []latencyHosts{
+		{Region: "us-east", IPs: []string{"1.0.0.1", "1.0.0.2"}},
+		{Region: "japan", IPs: []string{"2.0.0.1"}},
+		{Region: "brazil", IPs: []string{"3.0.0.1"}},
+	})
+
+	regions := sortRegions([]discord.VoiceRegion{
+		{ID: "brazil", Name: "Brazil"},
+		{ID: "us-east", Name: "US East"},
+		{ID: "europe", Name: "Europe"},
+		{ID: "japan", Name: "Japan"},
+		{ID: "us-south", Name: "US South", Deprecated: true},
+	}, latencies)
+
+	want := []Region{
+		{discord.VoiceRegion{ID: "japan", Name: "Japan"}, 20 * time.Millisecond},
+		{discord.VoiceRegion{ID: "us-east", Name: "US East"}, 40 * time.Millisecond},
+		{discord.VoiceRegion{ID: "brazil", Name: "Brazil"}, 0},
+		{discord.VoiceRegion{ID: "europe", Name: "Europe"}, 0},
+	}
+
+	if len(regions) != len(want) {
+		t.Fatalf("got regions %+v, want %+v", regions, want)
+	}
+
+	for i := range want {
+		if regions[i] != want[i] {
+			t.Errorf("region %d: got %+v, want %+v", i, regions[i], want[i])
+		}
+	}
+}
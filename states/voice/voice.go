@@ -0,0 +1,280 @@
+// Package voice keeps track of who is in which voice channel.
+package voice
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/state"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+	"github.com/diamondburned/ningen/v3/handlerrepo"
+	"github.com/diamondburned/ningen/v3/states/member"
+)
+
+// UpdateEvent is dispatched when the users in a voice channel change. It is
+// dispatched once for each affected channel, so moving between channels
+// dispatches two events.
+type UpdateEvent struct {
+	GuildID   discord.GuildID
+	ChannelID discord.ChannelID
+}
+
+var _ gateway.Event = (*UpdateEvent)(nil)
+
+func (ev UpdateEvent) Op() ws.OpCode           { return -1 }
+func (ev UpdateEvent) EventType() ws.EventType { return "__voice.UpdateEvent" }
+
+type guildVoice struct {
+	// users maps each user to their voice state.
+	users map[discord.UserID]discord.VoiceState
+	// channels maps each channel to the users in it.
+	channels map[discord.ChannelID]map[discord.UserID]struct{}
+}
+
+func newGuildVoice() *guildVoice {
+	return &guildVoice{
+		users:    map[discord.UserID]discord.VoiceState{},
+		channels: map[discord.ChannelID]map[discord.UserID]struct{}{},
+	}
+}
+
+// set sets the voice state of the user and returns the channel that the user
+// was in before. A voice state without a channel removes the user.
+func (g *guildVoice) set(vs discord.VoiceState) (old discord.ChannelID) {
+	if prev, ok := g.users[vs.UserID]; ok {
+		old = prev.ChannelID
+		if users := g.channels[old]; users != nil {
+			delete(users, vs.UserID)
+			if len(users) == 0 {
+				delete(g.channels, old)
+			}
+		}
+	}
+
+	if !vs.ChannelID.IsValid() {
+		delete(g.users, vs.UserID)
+		return old
+	}
+
+	g.users[vs.UserID] = vs
+
+	users, ok := g.channels[vs.ChannelID]
+	if !ok {
+		users = map[discord.UserID]struct{}{}
+		g.channels[vs.ChannelID] = users
+	}
+	users[vs.UserID] = struct{}{}
+
+	return old
+}
+
+// State keeps track of voice states. Voice states of calls in private channels
+// are kept under the null guild ID.
+type State struct {
+	// Pinger measures the latency to voice servers for Regions. It defaults
+	// to PingTCP.
+	Pinger Pinger
+
+	mutex  sync.Mutex
+	guilds map[discord.GuildID]*guildVoice
+	// channelGuilds maps each channel with users in it to its guild.
+	channelGuilds map[discord.ChannelID]discord.GuildID
+
+	// ordered dispatches UpdateEvents in order per guild.
+	ordered handlerrepo.Ordered
+
+	state    *state.State
+	regionMu sync.Mutex
+	regions  map[discord.GuildID]cachedRegions
+}
+
+func NewState(state *state.State, r handlerrepo.AddHandler) *State {
+	voiceState := &State{
+		Pinger:        PingTCP,
+		guilds:        map[discord.GuildID]*guildVoice{},
+		channelGuilds: map[discord.ChannelID]discord.GuildID{},
+		state:         state,
+		regions:       map[discord.GuildID]cachedRegions{},
+	}
+
+	r.AddSyncHandler(func(r *gateway.ReadyEvent) {
+		voiceState.mutex.Lock()
+		defer voiceState.mutex.Unlock()
+
+		voiceState.guilds = map[discord.GuildID]*guildVoice{}
+		voiceState.channelGuilds = map[discord.ChannelID]discord.GuildID{}
+
+		for _, guild := range r.Guilds {
+			voiceState.setGuild(guild.ID, guild.VoiceStates)
+		}
+	})
+
+	r.AddSyncHandler(func(ev *gateway.GuildCreateEvent) {
+		voiceState.mutex.Lock()
+		defer voiceState.mutex.Unlock()
+
+		voiceState.setGuild(ev.ID, ev.VoiceStates)
+	})
+
+	r.AddSyncHandler(func(ev *gateway.GuildDeleteEvent) {
+		voiceState.mutex.Lock()
+		defer voiceState.mutex.Unlock()
+
+		voiceState.setGuild(ev.ID, nil)
+	})
+
+	r.AddSyncHandler(func(ev *member.PassiveUpdateEvent) {
+		if ev.VoiceStates == nil {
+			return
+		}
+
+		voiceState.mutex.Lock()
+		before := voiceState.guildChannels(ev.GuildID)
+		voiceState.setGuild(ev.GuildID, ev.VoiceStates)
+		after := voiceState.guildChannels(ev.GuildID)
+		voiceState.mutex.Unlock()
+
+		for chID := range before {
+			after[chID] = struct{}{}
+		}
+		for chID := range after {
+			voiceState.dispatch(&UpdateEvent{GuildID: ev.GuildID, ChannelID: chID})
+		}
+	})
+
+	r.AddSyncHandler(func(ev *gateway.VoiceStateUpdateEvent) {
+		voiceState.mutex.Lock()
+		old := voiceState.set(ev.VoiceState)
+		voiceState.mutex.Unlock()
+
+		if old.IsValid() && old != ev.ChannelID {
+			voiceState.dispatch(&UpdateEvent{GuildID: ev.GuildID, ChannelID: old})
+		}
+		if ev.ChannelID.IsValid() {
+			voiceState.dispatch(&UpdateEvent{GuildID: ev.GuildID, ChannelID: ev.ChannelID})
+		}
+	})
+
+	return voiceState
+}
+
+// dispatch dispatches ev in the background; see handlerrepo.Ordered.
+func (s *State) dispatch(ev *UpdateEvent) {
+	s.ordered.Go(discord.Snowflake(ev.GuildID), func() {
+		s.state.Handler.Call(ev)
+	})
+}
+
+// setGuild replaces the voice states of the guild. s.mutex must be held.
+func (s *State) setGuild(guildID discord.GuildID, voiceStates []discord.VoiceState) {
+	if g, ok := s.guilds[guildID]; ok {
+		for chID := range g.channels {
+			delete(s.channelGuilds, chID)
+		}
+		delete(s.guilds, guildID)
+	}
+
+	for _, vs := range voiceStates {
+		vs.GuildID = guildID
+		s.set(vs)
+	}
+}
+
+// set sets a single voice state. s.mutex must be held.
+func (s *State) set(vs discord.VoiceState) (old discord.ChannelID) {
+	g, ok := s.guilds[vs.GuildID]
+	if !ok {
+		if !vs.ChannelID.IsValid() {
+			return 0
+		}
+		g = newGuildVoice()
+		s.guilds[vs.GuildID] = g
+	}
+
+	old = g.set(vs)
+
+	if old.IsValid() {
+		if _, ok := g.channels[old]; !ok {
+			delete(s.channelGuilds, old)
+		}
+	}
+	if vs.ChannelID.IsValid() {
+		s.channelGuilds[vs.ChannelID] = vs.GuildID
+	}
+
+	return old
+}
+
+// guildChannels returns the channels of the guild that have users in them.
+// s.mutex must be held.
+func (s *State) guildChannels(guildID discord.GuildID) map[discord.ChannelID]struct{} {
+	channels := map[discord.ChannelID]struct{}{}
+	if g, ok := s.guilds[guildID]; ok {
+		for chID := range g.channels {
+			channels[chID] = struct{}{}
+		}
+	}
+	return channels
+}
+
+// ChannelVoiceStates returns the voice states of the users in the given voice
+// channel, sorted by user ID.
+func (s *State) ChannelVoiceStates(chID discord.ChannelID) []discord.VoiceState {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	guildID, ok := s.channelGuilds[chID]
+	if !ok {
+		return nil
+	}
+
+	g := s.guilds[guildID]
+	users := g.channels[chID]
+
+	voiceStates := make([]discord.VoiceState, 0, len(users))
+	for userID := range users {
+		voiceStates = append(voiceStates, g.users[userID])
+	}
+
+	sort.Slice(voiceStates, func(i, j int) bool {
+		return voiceStates[i].UserID < voiceStates[j].UserID
+	})
+
+	return voiceStates
+}
+
+// ChannelUserCount returns the number of users in the given voice channel.
+func (s *State) ChannelUserCount(chID discord.ChannelID) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	guildID, ok := s.channelGuilds[chID]
+	if !ok {
+		return 0
+	}
+
+	return len(s.guilds[guildID].channels[chID])
+}
+
+// UserVoiceChannel returns the voice channel that the user is in within the
+// given guild. False is returned if the user isn't in a voice channel.
+func (s *State) UserVoiceChannel(guildID discord.GuildID, userID discord.UserID) (discord.ChannelID, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	g, ok := s.guilds[guildID]
+	if !ok {
+		return 0, false
+	}
+
+	vs, ok := g.users[userID]
+	return vs.ChannelID, ok
+}
+
+// Flush behaves like handlerrepo.Ordered.Flush for the state's events.
+func (s *State) Flush(ctx context.Context) error {
+	return s.ordered.Flush(ctx)
+}
@@ -0,0 +1,230 @@
+package ningen
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/httputil/httpdriver"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+	"github.com/pkg/errors"
+)
+
+// SuperProperties describes the client that ningen presents itself as. The
+// official client calls these super properties.
+//
+// arikawa's identify payload has no fields for SystemLocale, ReleaseChannel
+// and ClientBuildNumber, so only the other fields are sent when identifying.
+// If ClientBuildNumber is set, all of them are also sent as the
+// X-Super-Properties header of API requests like the official client does;
+// NoTelemetry lets that header through since ningen builds it itself.
+// SystemLocale is also sent as the X-Discord-Locale header, which Discord uses
+// to localize e.g. error messages.
+type SuperProperties struct {
+	OS                string `json:"os"`
+	Browser           string `json:"browser"`
+	Device            string `json:"device"`
+	SystemLocale      string `json:"system_locale"`
+	BrowserUserAgent  string `json:"browser_user_agent"`
+	BrowserVersion    string `json:"browser_version"`
+	OSVersion         string `json:"os_version"`
+	ReleaseChannel    string `json:"release_channel"`
+	ClientBuildNumber int    `json:"client_build_number"`
+}
+
+// DefaultSuperProperties is used by New. It mimics the official web client in
+// Firefox on the current OS.
+var DefaultSuperProperties = SuperProperties{
+	OS:                superPropertiesOS(),
+	Browser:           "Firefox",
+	SystemLocale:      "en-US",
+	BrowserUserAgent:  superPropertiesUserAgent(),
+	BrowserVersion:    "121.0",
+	ReleaseChannel:    "stable",
+	ClientBuildNumber: 256231,
+}
+
+func superPropertiesOS() string {
+	switch runtime.GOOS {
+	case "windows":
+		return "Windows"
+	case "darwin":
+		return "Mac OS X"
+	default:
+		return "Linux"
+	}
+}
+
+func superPropertiesUserAgent() string {
+	const firefox = "Gecko/20100101 Firefox/121.0"
+
+	switch runtime.GOOS {
+	case "windows":
+		return "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:121.0) " + firefox
+	case "darwin":
+		return "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:121.0) " + firefox
+	default:
+		return "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) " + firefox
+	}
+}
+
+// IdentifyProperties returns the identify properties for the super
+// properties.
+func (p SuperProperties) IdentifyProperties() gateway.IdentifyProperties {
+	return gateway.IdentifyProperties{
+		OS:               p.OS,
+		Browser:          p.Browser,
+		Device:           p.Device,
+		BrowserUserAgent: p.BrowserUserAgent,
+		BrowserVersion:   p.BrowserVersion,
+		OSVersion:        p.OSVersion,
+	}
+}
+
+// localeHeader returns the request option that sends the system locale.
+func (p SuperProperties) localeHeader() func(httpdriver.Request) error {
+	header := http.Header{"X-Discord-Locale": {p.SystemLocale}}
+	return func(r httpdriver.Request) error {
+		r.AddHeader(header)
+		return nil
+	}
+}
+
+// header returns the X-Super-Properties header for the super properties.
+func (p SuperProperties) header() string {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+type superPropertiesState struct {
+	mutex sync.RWMutex
+	props SuperProperties
+}
+
+func (s *superPropertiesState) get() SuperProperties {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.props
+}
+
+func (s *superPropertiesState) set(props SuperProperties) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.props = props
+}
+
+// header returns the X-Super-Properties header, or an empty string if the
+// client build number isn't known.
+func (s *superPropertiesState) header() string {
+	props := s.get()
+	if props.ClientBuildNumber == 0 {
+		return ""
+	}
+	return props.header()
+}
+
+// SuperProperties returns the super properties that the State was created
+// with, including the latest build number found by UpdateBuildNumber.
+func (s *State) SuperProperties() SuperProperties {
+	return s.superProps.get()
+}
+
+// FetchBuildNumber fetches the build number of the official web client. It
+// can be replaced to use a different source.
+var FetchBuildNumber = fetchBuildNumber
+
+var (
+	assetRegex       = regexp.MustCompile(`/assets/([a-z0-9.]+\.js)`)
+	buildNumberRegex = regexp.MustCompile(`buildNumber\D+(\d+)`)
+)
+
+func fetchBuildNumber(ctx context.Context) (int, error) {
+	app, err := httpGet(ctx, "https://discord.com/app")
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot fetch app page")
+	}
+
+	assets := assetRegex.FindAllSubmatch(app, -1)
+
+	// The build number is usually in one of the last scripts.
+	for i := len(assets) - 1; i >= 0; i-- {
+		script, err := httpGet(ctx, "https://discord.com/assets/"+string(assets[i][1]))
+		if err != nil {
+			return 0, errors.Wrap(err, "cannot fetch asset")
+		}
+
+		if match := buildNumberRegex.FindSubmatch(script); match != nil {
+			return strconv.Atoi(string(match[1]))
+		}
+	}
+
+	return 0, errors.New("build number not found")
+}
+
+func httpGet(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// UpdateBuildNumber fetches the latest build number using FetchBuildNumber
+// and stores it in the State's super properties, which are sent with the
+// following API requests.
+func (s *State) UpdateBuildNumber(ctx context.Context) error {
+	build, err := FetchBuildNumber(ctx)
+	if err != nil {
+		return errors.Wrap(err, "cannot update build number")
+	}
+
+	s.superProps.mutex.Lock()
+	s.superProps.props.ClientBuildNumber = build
+	s.superProps.mutex.Unlock()
+
+	return nil
+}
+
+// WatchBuildNumber calls UpdateBuildNumber every interval until ctx is done.
+// Errors are dispatched as BackgroundErrorEvents, and the last known build
+// number is kept.
+func (s *State) WatchBuildNumber(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.UpdateBuildNumber(ctx); err != nil && ctx.Err() == nil {
+			s.dispatch(&ws.BackgroundErrorEvent{Err: err})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package ningen_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/utils/httputil"
+	"github.com/diamondburned/arikawa/v3/utils/httputil/httpdriver"
+	"github.com/diamondburned/ningen/v3"
+)
+
+func TestSuperProperties(t *testing.T) {
+	props := ningen.DefaultSuperProperties
+	props.Browser = "Chrome"
+
+	n := ningen.NewWithSuperProperties("token", props)
+
+	if got := n.SuperProperties(); got != props {
+		t.Errorf("got super properties %+v, want %+v", got, props)
+	}
+	if n.Client.UserAgent != props.BrowserUserAgent {
+		t.Errorf("got user agent %q, want %q", n.Client.UserAgent, props.BrowserUserAgent)
+	}
+
+	var locale string
+	n.Client.Client.Retries = 1
+	n.Client.Client.Client = httpdriver.WrapClient(http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			locale = r.Header.Get("X-Discord-Locale")
+			return &http.Response{
+				StatusCode: 200,
+				Header:     http.Header{"Content-Type": {"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(`{}`)),
+			}, nil
+		}),
+	})
+
+	if _, err := n.Client.Me(); err != nil {
+		t.Fatal("cannot get user:", err)
+	}
+	if locale != props.SystemLocale {
+		t.Errorf("got locale header %q, want %q", locale, props.SystemLocale)
+	}
+}
+
+func TestSuperPropertiesHeader(t *testing.T) {
+	var mu sync.Mutex
+	var headers []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers = append(headers, r.Header.Get("X-Super-Properties"))
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	n := ningen.NewWithSuperProperties("token", ningen.DefaultSuperProperties)
+
+	request := func() ningen.SuperProperties {
+		t.Helper()
+
+		// Analytics headers added by the caller are replaced by ningen's.
+		var v struct{}
+		err := n.Client.Client.RequestJSON(&v, "GET", server.URL+"/api/v9/users/@me",
+			httputil.WithHeaders(http.Header{"X-Super-Properties": {"eyJvcyI6IkxpbnV4In0="}}))
+		if err != nil {
+			t.Fatal("cannot request:", err)
+		}
+
+		mu.Lock()
+		header := headers[len(headers)-1]
+		mu.Unlock()
+
+		b, err := base64.StdEncoding.DecodeString(header)
+		if err != nil {
+			t.Fatalf("cannot decode header %q: %v", header, err)
+		}
+
+		var props ningen.SuperProperties
+		if err := json.Unmarshal(b, &props); err != nil {
+			t.Fatalf("cannot decode header %q: %v", b, err)
+		}
+		return props
+	}
+
+	if props := request(); props != ningen.DefaultSuperProperties {
+		t.Errorf("got super properties %+v, want %+v", props, ningen.DefaultSuperProperties)
+	}
+
+	old := ningen.FetchBuildNumber
+	ningen.FetchBuildNumber = func(context.Context) (int, error) { return 300000, nil }
+	t.Cleanup(func() { ningen.FetchBuildNumber = old })
+
+	if err := n.UpdateBuildNumber(context.Background()); err != nil {
+		t.Fatal("cannot update build number:", err)
+	}
+	if build := n.SuperProperties().ClientBuildNumber; build != 300000 {
+		t.Errorf("got build number %d after updating, want 300000", build)
+	}
+	if props := request(); props.ClientBuildNumber != 300000 {
+		t.Errorf("sent build number %d after updating, want 300000", props.ClientBuildNumber)
+	}
+}
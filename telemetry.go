@@ -0,0 +1,111 @@
+package ningen
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/diamondburned/arikawa/v3/utils/httputil"
+	"github.com/diamondburned/arikawa/v3/utils/httputil/httpdriver"
+	"github.com/pkg/errors"
+)
+
+// ErrTelemetryBlocked is returned for API requests to Discord's telemetry
+// endpoints, which ningen never lets through.
+var ErrTelemetryBlocked = errors.New("request to telemetry endpoint blocked")
+
+// telemetryEndpoints are the last path segments of Discord's analytics
+// endpoints.
+var telemetryEndpoints = map[string]struct{}{
+	"science": {},
+	"track":   {},
+	"metrics": {},
+}
+
+// analyticsHeaders are the request headers that carry analytics data. They are
+// stripped from every request.
+var analyticsHeaders = []string{
+	"X-Super-Properties",
+	"X-Context-Properties",
+	"X-Fingerprint",
+	"X-Track",
+}
+
+// IsTelemetryPath returns true if the given URL path is one of Discord's
+// telemetry endpoints.
+func IsTelemetryPath(p string) bool {
+	_, ok := telemetryEndpoints[path.Base(p)]
+	return ok
+}
+
+// NoTelemetry puts the given HTTP client into no-telemetry mode: requests to
+// telemetry endpoints fail with ErrTelemetryBlocked without being sent, and
+// analytics headers are stripped from all other requests, regardless of where
+// they are added. FromState always does this to the State's API client, which
+// then only sends the X-Super-Properties header that ningen builds from the
+// State's SuperProperties.
+func NoTelemetry(c *httputil.Client) {
+	noTelemetry(c, nil)
+}
+
+// noTelemetry is NoTelemetry, except the X-Super-Properties header of props is
+// sent if props isn't nil.
+func noTelemetry(c *httputil.Client, props *superPropertiesState) {
+	if client, ok := c.Client.(noTelemetryClient); ok {
+		if props != nil {
+			client.superProps = props
+			c.Client = client
+		}
+		return
+	}
+	c.Client = noTelemetryClient{c.Client, props}
+}
+
+// HasNoTelemetry returns true if NoTelemetry was applied to the given client.
+func HasNoTelemetry(c *httputil.Client) bool {
+	_, ok := c.Client.(noTelemetryClient)
+	return ok
+}
+
+type noTelemetryClient struct {
+	httpdriver.Client
+	superProps *superPropertiesState
+}
+
+func (c noTelemetryClient) NewRequest(ctx context.Context, method, u string) (httpdriver.Request, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	if IsTelemetryPath(parsed.Path) {
+		return nil, ErrTelemetryBlocked
+	}
+	return c.Client.NewRequest(ctx, method, u)
+}
+
+func (c noTelemetryClient) Do(req httpdriver.Request) (httpdriver.Response, error) {
+	if IsTelemetryPath(req.GetPath()) {
+		return nil, ErrTelemetryBlocked
+	}
+
+	var header http.Header
+	switch req := req.(type) {
+	case *httpdriver.DefaultRequest:
+		header = req.Header
+	case *httpdriver.MockRequest:
+		header = req.Header
+	}
+
+	for _, name := range analyticsHeaders {
+		header.Del(name)
+	}
+
+	if c.superProps != nil && header != nil {
+		if props := c.superProps.header(); props != "" {
+			header.Set("X-Super-Properties", props)
+		}
+	}
+
+	return c.Client.Do(req)
+}
@@ -0,0 +1,61 @@
+package ningen_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/utils/httputil"
+	"github.com/diamondburned/ningen/v3"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestNoTelemetry(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	var superProps []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		superProps = append(superProps, r.Header.Get("X-Super-Properties"))
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	client := n.Client.Client
+	if !ningen.HasNoTelemetry(client) {
+		t.Fatal("state client is not in no-telemetry mode")
+	}
+
+	for _, endpoint := range []string{"/api/v9/science", "/api/v9/track", "/api/v9/metrics"} {
+		err := client.RequestJSON(nil, "POST", server.URL+endpoint)
+		if !errors.Is(err, ningen.ErrTelemetryBlocked) {
+			t.Errorf("%s: got error %v, want ErrTelemetryBlocked", endpoint, err)
+		}
+	}
+
+	var v struct{}
+	err := client.RequestJSON(&v, "GET", server.URL+"/api/v9/users/@me",
+		httputil.WithHeaders(http.Header{"X-Super-Properties": {"eyJvcyI6IkxpbnV4In0="}}))
+	if err != nil {
+		t.Fatal("cannot request non-telemetry endpoint:", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(paths) != 1 || paths[0] != "/api/v9/users/@me" {
+		t.Fatalf("server received %v, want only /api/v9/users/@me", paths)
+	}
+	if superProps[0] != "" {
+		t.Errorf("X-Super-Properties was sent: %q", superProps[0])
+	}
+}
@@ -0,0 +1,100 @@
+// Package trace reports the gateway commands that ningen sends, such as guild
+// subscriptions, member requests and presence updates. It is meant for
+// debugging rate limit disconnects and excessive traffic on accounts with many
+// guilds.
+package trace
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+)
+
+// Subsystem is the part of ningen that sent a command.
+type Subsystem string
+
+const (
+	// Presence is for the presence updates of SetStatus and SetAFK.
+	Presence Subsystem = "presence"
+	// Idle is for the presence updates of the idle detection.
+	Idle Subsystem = "idle"
+	// CustomStatus is for clearing expired custom statuses.
+	CustomStatus Subsystem = "custom status"
+	// DMPresences is for requesting the presences of DM recipients.
+	DMPresences Subsystem = "dm presences"
+	// Members is for requesting members, such as the authors of messages.
+	Members Subsystem = "members"
+	// MemberSearch is for searching members, such as for mention
+	// autocompletion.
+	MemberSearch Subsystem = "member search"
+	// Subscriptions is for guild subscriptions, including member list ranges
+	// and thread member lists.
+	Subscriptions Subsystem = "subscriptions"
+)
+
+// Command is a gateway command that was sent.
+type Command struct {
+	// Time is when the command was sent.
+	Time time.Time
+	// Subsystem is what sent the command.
+	Subsystem Subsystem
+	// Command is the command itself.
+	Command ws.Event
+	// Err is the error from sending the command, if any.
+	Err error
+}
+
+// Tracer reports every gateway command sent through it to a hook. Nothing is
+// reported until a hook is set.
+//
+// A nil *Tracer is valid: it sends commands without reporting them.
+type Tracer struct {
+	mutex sync.RWMutex
+	hook  func(Command)
+}
+
+// NewTracer creates a new Tracer without a hook.
+func NewTracer() *Tracer {
+	return &Tracer{}
+}
+
+// SetHook sets the function that is called after each command is sent. It is
+// called from the goroutine that sent the command, so it must not block. A nil
+// hook stops the reporting.
+func (t *Tracer) SetHook(hook func(Command)) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.hook = hook
+}
+
+// Send sends the command through the gateway and reports it as sent by the
+// given subsystem.
+func (t *Tracer) Send(ctx context.Context, gw *gateway.Gateway, from Subsystem, cmd ws.Event) error {
+	if t == nil {
+		return gw.Send(ctx, cmd)
+	}
+
+	t.mutex.RLock()
+	hook := t.hook
+	t.mutex.RUnlock()
+
+	if hook == nil {
+		return gw.Send(ctx, cmd)
+	}
+
+	sent := time.Now()
+	err := gw.Send(ctx, cmd)
+
+	hook(Command{
+		Time:      sent,
+		Subsystem: from,
+		Command:   cmd,
+		Err:       err,
+	})
+
+	return err
+}
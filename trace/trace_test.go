@@ -0,0 +1,46 @@
+package trace
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+func TestTracer(t *testing.T) {
+	// The gateway is never opened, so sending fails without touching the
+	// network.
+	gw := gateway.NewCustomWithIdentifier("wss://gateway.invalid", gateway.DefaultIdentifier("ningentest"), nil)
+	cmd := &gateway.RequestGuildMembersCommand{}
+
+	var tracer *Tracer
+	if err := tracer.Send(context.Background(), gw, Members, cmd); err == nil {
+		t.Error("sending through a closed gateway succeeded")
+	}
+
+	tracer = NewTracer()
+	tracer.Send(context.Background(), gw, Members, cmd)
+
+	var commands []Command
+	tracer.SetHook(func(c Command) { commands = append(commands, c) })
+
+	before := time.Now()
+	err := tracer.Send(context.Background(), gw, Members, cmd)
+
+	if len(commands) != 1 {
+		t.Fatalf("got %d commands, want 1", len(commands))
+	}
+
+	c := commands[0]
+	if c.Subsystem != Members || c.Command != cmd || c.Err != err || c.Time.Before(before) {
+		t.Errorf("got command %+v", c)
+	}
+
+	tracer.SetHook(nil)
+	tracer.Send(context.Background(), gw, Members, cmd)
+
+	if len(commands) != 1 {
+		t.Error("command reported after the hook was removed")
+	}
+}
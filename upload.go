@@ -0,0 +1,128 @@
+package ningen
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/utils/sendpart"
+	"github.com/pkg/errors"
+)
+
+// UploadProgressFunc is called as the files of a message are uploaded. sent
+// is the number of bytes of all files read so far, and total is their total
+// size, or -1 if the size of any of the files isn't known.
+type UploadProgressFunc func(sent, total int64)
+
+// SendMessageWithProgress sends the message like SendMessageComplex and calls
+// onProgress as its files are uploaded. onProgress is called from the
+// goroutine that uploads the files, once for every chunk read from them.
+//
+// The content is filtered by the outgoing content filters first, and
+// ErrContentFlagged is returned if they flag it. The upload is cancelled once
+// the State's context is done, so use
+// WithContext to make an upload cancellable. The size of files is only known
+// if their readers are io.Seekers, such as *os.File and *bytes.Reader.
+func (s *State) SendMessageWithProgress(
+	chID discord.ChannelID, data api.SendMessageData, onProgress UploadProgressFunc) (*discord.Message, error) {
+
+	var flagged bool
+	if data.Content, flagged = s.FilterContent(FilterOutgoing, data.Content); flagged {
+		return nil, ErrContentFlagged
+	}
+
+	if len(data.Files) > 0 && onProgress != nil {
+		progress := &uploadProgress{
+			ctx:   s.Context(),
+			total: filesSize(data.Files),
+			fn:    onProgress,
+		}
+
+		files := make([]sendpart.File, len(data.Files))
+		for i, file := range data.Files {
+			files[i] = sendpart.File{
+				Name:   file.Name,
+				Reader: &progressReader{file.Reader, progress},
+			}
+		}
+
+		data.Files = files
+	}
+
+	msg, err := s.SendMessageComplex(chID, data)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot send message")
+	}
+
+	return msg, nil
+}
+
+// filesSize returns the total size of the files that are left to be read, or
+// -1 if it isn't known.
+func filesSize(files []sendpart.File) int64 {
+	var total int64
+
+	for _, file := range files {
+		seeker, ok := file.Reader.(io.Seeker)
+		if !ok {
+			return -1
+		}
+
+		pos, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+
+		end, err := seeker.Seek(0, io.SeekEnd)
+		if err != nil {
+			return -1
+		}
+
+		if _, err := seeker.Seek(pos, io.SeekStart); err != nil {
+			return -1
+		}
+
+		total += end - pos
+	}
+
+	return total
+}
+
+type uploadProgress struct {
+	ctx   context.Context
+	total int64
+	fn    UploadProgressFunc
+
+	mutex sync.Mutex
+	sent  int64
+}
+
+func (p *uploadProgress) add(n int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.sent += int64(n)
+	p.fn(p.sent, p.total)
+}
+
+type progressReader struct {
+	r io.Reader
+	p *uploadProgress
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	// Stop reading as soon as the upload is cancelled, instead of only once
+	// the request notices.
+	if err := r.p.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := r.r.Read(b)
+	if n > 0 {
+		r.p.add(n)
+	}
+
+	return n, err
+}
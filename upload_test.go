@@ -0,0 +1,63 @@
+package ningen_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/utils/httputil/httpdriver"
+	"github.com/diamondburned/arikawa/v3/utils/sendpart"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestSendMessageWithProgress(t *testing.T) {
+	const chID = 300000000000000002
+
+	n := ningentest.NewState(t, ningentest.Guilds)
+	n.Client.Client.Retries = 1
+	n.Client.Client.Client = httpdriver.WrapClient(http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			if _, err := io.Copy(io.Discard, r.Body); err != nil {
+				return nil, err
+			}
+
+			body := `{"id":"900000000000000100","channel_id":"300000000000000002"}`
+			return &http.Response{
+				StatusCode: 200,
+				Header:     http.Header{"Content-Type": {"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(body)),
+			}, nil
+		}),
+	})
+
+	file := bytes.Repeat([]byte("a"), 100000)
+
+	var sent, total int64
+	msg, err := n.SendMessageWithProgress(chID, api.SendMessageData{
+		Files: []sendpart.File{{Name: "a.txt", Reader: bytes.NewReader(file)}},
+	}, func(s, t int64) { sent, total = s, t })
+	if err != nil {
+		t.Fatal("cannot send message:", err)
+	}
+
+	if msg.ID != 900000000000000100 {
+		t.Errorf("got message ID %d", msg.ID)
+	}
+	if sent != int64(len(file)) || total != int64(len(file)) {
+		t.Errorf("got progress %d/%d, want %d/%d", sent, total, len(file), len(file))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = n.WithContext(ctx).SendMessageWithProgress(chID, api.SendMessageData{
+		Files: []sendpart.File{{Name: "a.txt", Reader: bytes.NewReader(file)}},
+	}, func(s, t int64) {})
+	if err == nil {
+		t.Error("cancelled upload succeeded")
+	}
+}
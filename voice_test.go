@@ -0,0 +1,49 @@
+package ningen_test
+
+import (
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/ningen/v3/ningentest"
+)
+
+func TestVoiceChannelState(t *testing.T) {
+	n := ningentest.NewState(t, ningentest.Guilds)
+
+	const guildID = 200000000000000001
+	const ch1, ch2 = 300000000000000010, 300000000000000011
+
+	join := func(userID discord.UserID, chID discord.ChannelID) {
+		ningentest.Dispatch(n, &gateway.VoiceStateUpdateEvent{
+			VoiceState: discord.VoiceState{GuildID: guildID, ChannelID: chID, UserID: userID},
+		})
+	}
+
+	join(100000000000000002, ch1)
+	join(100000000000000003, ch1)
+
+	if count := n.VoiceChannelState.ChannelUserCount(ch1); count != 2 {
+		t.Fatalf("got %d users in voice, want 2", count)
+	}
+
+	join(100000000000000002, ch2)
+
+	vs := n.VoiceChannelState.ChannelVoiceStates(ch1)
+	if len(vs) != 1 || vs[0].UserID != 100000000000000003 {
+		t.Fatalf("got %+v in the first channel after moving", vs)
+	}
+
+	if chID, ok := n.VoiceChannelState.UserVoiceChannel(guildID, 100000000000000002); !ok || chID != ch2 {
+		t.Fatalf("user is in %v (%v), want %v", chID, ok, discord.ChannelID(ch2))
+	}
+
+	join(100000000000000003, 0)
+
+	if count := n.VoiceChannelState.ChannelUserCount(ch1); count != 0 {
+		t.Fatalf("got %d users in voice after leaving, want 0", count)
+	}
+	if _, ok := n.VoiceChannelState.UserVoiceChannel(guildID, 100000000000000003); ok {
+		t.Fatal("user is still in voice after leaving")
+	}
+}